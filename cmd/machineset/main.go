@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -29,6 +30,7 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/controller/machineset"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
 	mapiwebhooks "github.com/openshift/machine-api-operator/pkg/webhooks"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -92,11 +94,29 @@ func main() {
 		fmt.Sprintf("The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership of a led but unrenewed leader slot. This is effectively the maximum duration that a leader can be stopped before it is replaced by another candidate. This is only applicable if leader election is enabled. Default: (%s)", defaultLeaderElectionValues.LeaseDuration.Duration),
 	)
 
+	tracingEndpoint := flag.String("tracing-endpoint", "",
+		"Host and port of the OTLP/HTTP collector the traces of the controller are exported to. If unspecified, tracing is disabled.")
+
+	tracingInsecure := flag.Bool("tracing-insecure", false,
+		"Export the traces to the collector set by --tracing-endpoint without TLS.")
+
+	tracingSamplingRatio := flag.Float64("tracing-sampling-ratio", 1,
+		"Ratio of the MachineSet reconciles which are traced, between 0 and 1.")
+
 	flag.Parse()
 	if *watchNamespace != "" {
 		log.Printf("Watching cluster-api objects only in namespace %q for reconciliation.", *watchNamespace)
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "machine-api-machineset", tracing.Options{
+		Endpoint:      *tracingEndpoint,
+		Insecure:      *tracingInsecure,
+		SamplingRatio: *tracingSamplingRatio,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Printf("Registering Components.")
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
@@ -182,5 +202,14 @@ func main() {
 	log.Printf("Starting the Cmd.")
 
 	// Start the Cmd
-	log.Fatal(mgr.Start(signals.SetupSignalHandler()))
+	err = mgr.Start(signals.SetupSignalHandler())
+
+	// Flush the pending spans before exiting.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
+	log.Fatal(err)
 }
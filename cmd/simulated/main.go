@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/library-go/pkg/config/leaderelection"
+	capimachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/controller/simulated"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// The simulated machine controller reconciles machines with instances simulated in memory,
+// for local development and scale testing without a cloud.
+func main() {
+	var printVersion bool
+	flag.BoolVar(&printVersion, "version", false, "print version and exit")
+
+	// Used to get the default values for leader election from library-go
+	defaultLeaderElectionValues := leaderelection.LeaderElectionDefaulting(
+		configv1.LeaderElection{},
+		"", "",
+	)
+
+	klog.InitFlags(nil)
+	watchNamespace := flag.String(
+		"namespace",
+		"",
+		"Namespace that the controller watches to reconcile machine-api objects. If unspecified, the controller watches for machine-api objects across all namespaces.",
+	)
+
+	leaderElectResourceNamespace := flag.String(
+		"leader-elect-resource-namespace",
+		"",
+		"The namespace of resource object that is used for locking during leader election. If unspecified and running in cluster, defaults to the service account namespace for the controller. Required for leader-election outside of a cluster.",
+	)
+
+	leaderElect := flag.Bool(
+		"leader-elect",
+		false,
+		"Start a leader election client and gain leadership before executing the main loop. Enable this when running replicated components for high availability.",
+	)
+
+	// Default values are printed for the user to see, but zero is set as the default to distinguish user intent from default value for topology aware leader election
+	leaderElectLeaseDuration := flag.Duration(
+		"leader-elect-lease-duration",
+		0,
+		fmt.Sprintf("The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership of a led but unrenewed leader slot. This is effectively the maximum duration that a leader can be stopped before it is replaced by another candidate. This is only applicable if leader election is enabled. Default: (%s)", defaultLeaderElectionValues.LeaseDuration.Duration),
+	)
+
+	metricsAddress := flag.String(
+		"metrics-bind-address",
+		metrics.DefaultMachineMetricsAddress,
+		"Address for hosting metrics",
+	)
+
+	provisioningLatency := flag.Duration(
+		"provisioning-latency",
+		30*time.Second,
+		"Time it takes for a simulated instance to be provisioned and for its Node to register.",
+	)
+
+	deletionLatency := flag.Duration(
+		"deletion-latency",
+		10*time.Second,
+		"Time it takes for a deleted simulated instance to be gone.",
+	)
+
+	createFailureRate := flag.Float64(
+		"create-failure-rate",
+		0,
+		"Probability, between 0 and 1, that the creation of a simulated instance fails with a transient error.",
+	)
+
+	actuatorQPS := flag.Float64(
+		"actuator-qps",
+		0,
+		"Average number of calls per second the machine controller makes to its actuator, across all machines. If zero, the calls are not rate limited.",
+	)
+
+	actuatorBurst := flag.Int(
+		"actuator-burst",
+		1,
+		"Number of calls the machine controller can make to its actuator above the rate set by --actuator-qps.",
+	)
+
+	actuatorMaxInFlight := flag.Int(
+		"actuator-max-in-flight",
+		0,
+		"Maximum number of concurrent calls the machine controller makes to its actuator. If zero, the concurrent calls are not limited.",
+	)
+
+	provisioningTimeout := flag.Duration(
+		"provisioning-timeout",
+		0,
+		"Time allowed for the instance of a machine to be provisioned after its creation was first attempted, before the machine is failed. If zero, the provisioning does not time out.",
+	)
+
+	nodeRegistrationTimeout := flag.Duration(
+		"node-registration-timeout",
+		0,
+		"Time allowed for the node of a machine to register after its instance was provisioned, before the machine is failed. If zero, the node registration does not time out.",
+	)
+
+	flag.Set("logtostderr", "true")
+	healthAddr := flag.String(
+		"health-addr",
+		":9440",
+		"The address for health checking.",
+	)
+	flag.Parse()
+
+	if printVersion {
+		fmt.Println(version.String)
+		os.Exit(0)
+	}
+
+	if *createFailureRate < 0 || *createFailureRate > 1 {
+		klog.Fatalf("Invalid --create-failure-rate %v: it must be between 0 and 1", *createFailureRate)
+	}
+
+	cfg := config.GetConfigOrDie()
+	syncPeriod := 10 * time.Minute
+
+	le := util.GetLeaderElectionConfig(cfg, configv1.LeaderElection{
+		Disable:       !*leaderElect,
+		LeaseDuration: metav1.Duration{Duration: *leaderElectLeaseDuration},
+	})
+
+	opts := manager.Options{
+		MetricsBindAddress:      *metricsAddress,
+		HealthProbeBindAddress:  *healthAddr,
+		SyncPeriod:              &syncPeriod,
+		LeaderElection:          *leaderElect,
+		LeaderElectionNamespace: *leaderElectResourceNamespace,
+		LeaderElectionID:        "cluster-api-provider-simulated-leader",
+		LeaseDuration:           &le.LeaseDuration.Duration,
+		RetryPeriod:             &le.RetryPeriod.Duration,
+		RenewDeadline:           &le.RenewDeadline.Duration,
+	}
+
+	if *watchNamespace != "" {
+		opts.Namespace = *watchNamespace
+		klog.Infof("Watching machine-api objects only in namespace %q for reconciliation.", opts.Namespace)
+	}
+
+	// Setup a Manager
+	mgr, err := manager.New(cfg, opts)
+	if err != nil {
+		klog.Fatalf("Failed to set up overall controller manager: %v", err)
+	}
+
+	if err := machinev1.AddToScheme(mgr.GetScheme()); err != nil {
+		klog.Fatal(err)
+	}
+
+	// Initialize machine actuator.
+	machineActuator := simulated.NewActuator(simulated.ActuatorParams{
+		Client:              mgr.GetClient(),
+		EventRecorder:       mgr.GetEventRecorderFor("simulatedcontroller"),
+		ProvisioningLatency: *provisioningLatency,
+		DeletionLatency:     *deletionLatency,
+		CreateFailureRate:   *createFailureRate,
+	})
+
+	if err := capimachine.AddWithOptions(mgr, machineActuator, capimachine.Options{
+		ActuatorLimits: capimachine.ActuatorLimits{
+			QPS:         *actuatorQPS,
+			Burst:       *actuatorBurst,
+			MaxInFlight: *actuatorMaxInFlight,
+		},
+		ProvisioningTimeouts: capimachine.ProvisioningTimeouts{
+			Provisioning:     *provisioningTimeout,
+			NodeRegistration: *nodeRegistrationTimeout,
+		},
+	}); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err = mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		klog.Fatalf("Failed to run manager: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/controller/machine/remote"
+	machine "github.com/openshift/machine-api-operator/pkg/controller/vsphere"
+	"github.com/openshift/machine-api-operator/pkg/version"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// The vsphere-actuator serves the vSphere actuator to machine controllers started with the --actuator-address flag.
+// It is the reference server of the out-of-process actuator protocol.
+func main() {
+	var printVersion bool
+	flag.BoolVar(&printVersion, "version", false, "print version and exit")
+
+	klog.InitFlags(nil)
+	watchNamespace := flag.String(
+		"namespace",
+		"",
+		"Namespace of the machine-api objects served by the actuator. If unspecified, the actuator serves machine-api objects across all namespaces.",
+	)
+
+	listenAddress := flag.String(
+		"listen-address",
+		"unix:///var/run/machine-api/actuator.sock",
+		"Address the actuator is served on, either unix:///path/to/socket or tcp://host:port with a loopback host.",
+	)
+
+	flag.Set("logtostderr", "true")
+	healthAddr := flag.String(
+		"health-addr",
+		":9443",
+		"The address for health checking.",
+	)
+	flag.Parse()
+
+	if printVersion {
+		fmt.Println(version.String)
+		os.Exit(0)
+	}
+
+	opts := manager.Options{
+		// The actuator only needs the client and the caches of the manager, which runs no controller.
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: *healthAddr,
+	}
+	if *watchNamespace != "" {
+		opts.Namespace = *watchNamespace
+		klog.Infof("Serving machine-api objects only in namespace %q.", opts.Namespace)
+	}
+
+	mgr, err := manager.New(config.GetConfigOrDie(), opts)
+	if err != nil {
+		klog.Fatalf("Failed to set up overall controller manager: %v", err)
+	}
+
+	if err := configv1.AddToScheme(mgr.GetScheme()); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := machinev1.AddToScheme(mgr.GetScheme()); err != nil {
+		klog.Fatal(err)
+	}
+
+	server, err := remote.NewServer(machine.NewActuator(machine.ActuatorParams{
+		Client:        mgr.GetClient(),
+		APIReader:     mgr.GetAPIReader(),
+		EventRecorder: mgr.GetEventRecorderFor("vspherecontroller"),
+		TaskIDCache:   make(map[string]string),
+	}))
+	if err != nil {
+		klog.Fatalf("Failed to set up actuator server: %v", err)
+	}
+
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		klog.Infof("Serving the vSphere actuator on %q.", *listenAddress)
+		if err := server.ListenAndServe(*listenAddress); !errors.Is(err, remote.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatal(err)
+	}
+
+	if err = mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		klog.Fatalf("Failed to run manager: %v", err)
+	}
+}
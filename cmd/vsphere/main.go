@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -10,10 +11,12 @@ import (
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/library-go/pkg/config/leaderelection"
 	capimachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/controller/machine/remote"
 	machine "github.com/openshift/machine-api-operator/pkg/controller/vsphere"
 	machinesetcontroller "github.com/openshift/machine-api-operator/pkg/controller/vsphere/machineset"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
 	"github.com/openshift/machine-api-operator/pkg/version"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
@@ -67,6 +70,60 @@ func main() {
 		"Address for hosting metrics",
 	)
 
+	actuatorAddress := flag.String(
+		"actuator-address",
+		"",
+		"Address of an out-of-process actuator server, either unix:///path/to/socket or tcp://host:port with a loopback host. If set, machines are reconciled with this actuator instead of the built-in vSphere actuator.",
+	)
+
+	actuatorQPS := flag.Float64(
+		"actuator-qps",
+		0,
+		"Average number of calls per second the machine controller makes to its actuator, across all machines. If zero, the calls are not rate limited.",
+	)
+
+	actuatorBurst := flag.Int(
+		"actuator-burst",
+		1,
+		"Number of calls the machine controller can make to its actuator above the rate set by --actuator-qps.",
+	)
+
+	actuatorMaxInFlight := flag.Int(
+		"actuator-max-in-flight",
+		0,
+		"Maximum number of concurrent calls the machine controller makes to its actuator. If zero, the concurrent calls are not limited.",
+	)
+
+	provisioningTimeout := flag.Duration(
+		"provisioning-timeout",
+		0,
+		"Time allowed for the instance of a machine to be provisioned after its creation was first attempted, before the machine is failed. If zero, the provisioning does not time out.",
+	)
+
+	nodeRegistrationTimeout := flag.Duration(
+		"node-registration-timeout",
+		0,
+		"Time allowed for the node of a machine to register after its instance was provisioned, before the machine is failed. If zero, the node registration does not time out.",
+	)
+
+	tracingEndpoint := flag.String(
+		"tracing-endpoint",
+		"",
+		"Host and port of the OTLP/HTTP collector the traces of the controllers are exported to. If unspecified, tracing is disabled.",
+	)
+
+	tracingInsecure := flag.Bool(
+		"tracing-insecure",
+		false,
+		"Export the traces to the collector set by --tracing-endpoint without TLS.",
+	)
+
+	tracingSamplingRatio := flag.Float64(
+		"tracing-sampling-ratio",
+		1,
+		"Ratio of the Machines whose reconciles are traced, between 0 and 1.",
+	)
+
 	flag.Set("logtostderr", "true")
 	healthAddr := flag.String(
 		"health-addr",
@@ -80,6 +137,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "machine-api-vsphere", tracing.Options{
+		Endpoint:      *tracingEndpoint,
+		Insecure:      *tracingInsecure,
+		SamplingRatio: *tracingSamplingRatio,
+	})
+	if err != nil {
+		klog.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	cfg := config.GetConfigOrDie()
 	syncPeriod := 10 * time.Minute
 
@@ -116,12 +182,19 @@ func main() {
 	taskIDCache := make(map[string]string)
 
 	// Initialize machine actuator.
-	machineActuator := machine.NewActuator(machine.ActuatorParams{
+	var machineActuator capimachine.Actuator = machine.NewActuator(machine.ActuatorParams{
 		Client:        mgr.GetClient(),
 		APIReader:     mgr.GetAPIReader(),
 		EventRecorder: mgr.GetEventRecorderFor("vspherecontroller"),
 		TaskIDCache:   taskIDCache,
 	})
+	if *actuatorAddress != "" {
+		machineActuator, err = remote.NewActuator(*actuatorAddress)
+		if err != nil {
+			klog.Fatalf("Failed to set up remote actuator: %v", err)
+		}
+		klog.Infof("Reconciling machines with the actuator at %q.", *actuatorAddress)
+	}
 
 	if err := configv1.AddToScheme(mgr.GetScheme()); err != nil {
 		klog.Fatal(err)
@@ -135,7 +208,17 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	capimachine.AddWithActuator(mgr, machineActuator)
+	capimachine.AddWithOptions(mgr, machineActuator, capimachine.Options{
+		ActuatorLimits: capimachine.ActuatorLimits{
+			QPS:         *actuatorQPS,
+			Burst:       *actuatorBurst,
+			MaxInFlight: *actuatorMaxInFlight,
+		},
+		ProvisioningTimeouts: capimachine.ProvisioningTimeouts{
+			Provisioning:     *provisioningTimeout,
+			NodeRegistration: *nodeRegistrationTimeout,
+		},
+	})
 
 	ctrl.SetLogger(klogr.New())
 	setupLog := ctrl.Log.WithName("setup")
@@ -155,7 +238,16 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	if err = mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+
+	// Flush the pending spans before exiting.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		klog.Errorf("Failed to flush traces: %v", err)
+	}
+
+	if err != nil {
 		klog.Fatalf("Failed to run manager: %v", err)
 	}
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Actuator controls machines on a specific infrastructure. All
@@ -34,3 +35,14 @@ type Actuator interface {
 	// Checks if the machine currently exists.
 	Exists(context.Context, *machinev1.Machine) (bool, error)
 }
+
+// InstanceLister is an optional interface of Actuators which can list all the instances of the cluster in a single call.
+// When an Actuator implements it, Exists is served from a short-lived snapshot of the instances shared by all Machines,
+// and the Actuator is only called for the Machines whose instance is not in the snapshot.
+type InstanceLister interface {
+	// ListInstances returns the IDs of all the existing instances of the cluster.
+	ListInstances(context.Context) (sets.String, error)
+	// InstanceID returns the ID of the instance of the machine, as returned by ListInstances.
+	// An empty ID means the instance must be looked up with Exists, for example when it has no provider ID yet.
+	InstanceID(context.Context, *machinev1.Machine) string
+}
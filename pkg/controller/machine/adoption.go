@@ -0,0 +1,39 @@
+package machine
+
+import (
+	"context"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+// reconcileMissingAdoptedInstance fails a Machine created to adopt an existing instance when the instance can not be found.
+// Unlike other Machines, an adopted Machine is never created by the machine controller, so the provider ID must be fixed
+// by recreating the Machine.
+func (r *ReconcileMachine) reconcileMissingAdoptedInstance(ctx context.Context, m *machinev1.Machine, originalConditions machinev1.Conditions) (reconcile.Result, error) {
+	providerID := pointer.StringDeref(m.Spec.ProviderID, "")
+	klog.Warningf("%v: instance %q to adopt was not found on provider", m.GetName(), providerID)
+	r.eventRecorder.Eventf(m, corev1.EventTypeWarning, "AdoptionFailed", "Instance %q to adopt was not found on provider", providerID)
+
+	conditions.Set(m, conditions.FalseCondition(
+		machinev1.InstanceExistsCondition,
+		machinev1.InstanceMissingReason,
+		machinev1.ConditionSeverityWarning,
+		"Instance %q to adopt was not found on provider", providerID,
+	))
+
+	err := InvalidMachineConfiguration("instance %q to adopt was not found on provider", providerID)
+	return reconcile.Result{}, r.updateStatus(ctx, m, phaseFailed, err, originalConditions)
+}
+
+// machineHasBeenAdopted returns true once the instance of a Machine created to adopt it has been found,
+// and the Machine has moved past the Provisioning phase.
+func machineHasBeenAdopted(m *machinev1.Machine) bool {
+	phase := stringPointerDeref(m.Status.Phase)
+	return phase != "" && phase != phaseProvisioning
+}
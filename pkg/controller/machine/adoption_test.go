@@ -0,0 +1,73 @@
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+)
+
+func TestReconcileAdoptingMachine(t *testing.T) {
+	testCases := []struct {
+		name                string
+		instanceExists      bool
+		expectedPhase       string
+		expectedErrorReason *machinev1.MachineStatusError
+		expectedEvent       string
+	}{
+		{
+			name:           "when the instance to adopt exists",
+			instanceExists: true,
+			expectedPhase:  phaseProvisioned,
+			expectedEvent:  "Adopting existing instance \"vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d\"",
+		},
+		{
+			name:                "when the instance to adopt does not exist",
+			expectedPhase:       phaseFailed,
+			expectedErrorReason: machineStatusErrorPtr(machinev1.InvalidConfigurationMachineError),
+			expectedEvent:       "Instance \"vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d\" to adopt was not found on provider",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := getMachine("adopting", "")
+			m.Status.Phase = nil
+			m.Status.NodeRef = nil
+			m.Spec.ProviderID = pointer.String("vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d")
+			m.Annotations[machines.AdoptInstanceAnnotation] = ""
+
+			act := newTestActuator()
+			act.ExistsValue = tc.instanceExists
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileMachine{
+				Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+				scheme:        scheme.Scheme,
+				eventRecorder: recorder,
+				actuator:      act,
+			}
+
+			key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+			_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(act.CreateCallCount).To(BeZero(), "the instance to adopt should never be created")
+
+			updated := &machinev1.Machine{}
+			g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+			g.Expect(updated.Status.Phase).To(Equal(pointer.String(tc.expectedPhase)))
+			g.Expect(updated.Status.ErrorReason).To(Equal(tc.expectedErrorReason))
+			g.Expect(recorder.Events).To(Receive(ContainSubstring(tc.expectedEvent)))
+		})
+	}
+}
@@ -27,6 +27,10 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,6 +45,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -52,6 +57,9 @@ const (
 	// ExcludeNodeDrainingAnnotation annotation explicitly skips node draining if set
 	ExcludeNodeDrainingAnnotation = "machine.openshift.io/exclude-node-draining"
 
+	// ExcludeWaitForVolumeDetachAnnotation annotation explicitly skips waiting for the volumes to detach from the node if set
+	ExcludeWaitForVolumeDetachAnnotation = "machine.openshift.io/exclude-wait-for-volume-detach"
+
 	// MachineRegionLabelName as annotation name for a machine region
 	MachineRegionLabelName = "machine.openshift.io/region"
 
@@ -100,26 +108,46 @@ const (
 var DefaultActuator Actuator
 
 func AddWithActuator(mgr manager.Manager, actuator Actuator) error {
-	if err := add(mgr, newReconciler(mgr, actuator), "machine-controller"); err != nil {
+	return AddWithOptions(mgr, actuator, Options{})
+}
+
+// Options configures the machine controller.
+type Options struct {
+	// ActuatorLimits limits the calls of the machine controller to the actuator.
+	ActuatorLimits ActuatorLimits
+
+	// ProvisioningTimeouts fail the Machines whose instance is not provisioned, or whose Node does not register, in time.
+	ProvisioningTimeouts ProvisioningTimeouts
+}
+
+// AddWithOptions is AddWithActuator, with the machine controller configured by the given options.
+func AddWithOptions(mgr manager.Manager, actuator Actuator, opts Options) error {
+	if err := add(mgr, newReconciler(mgr, actuator, opts), "machine-controller"); err != nil {
 		return err
 	}
 	if err := addWithOpts(mgr, controller.Options{
 		Reconciler:  newDrainController(mgr),
 		RateLimiter: newDrainRateLimiter(),
-	}, "machine-drain-controller"); err != nil {
+	}, "machine-drain-controller", ignoreDrainProgressUpdates()); err != nil {
 		return err
 	}
 	return nil
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager, actuator Actuator) reconcile.Reconciler {
+func newReconciler(mgr manager.Manager, actuator Actuator, opts Options) reconcile.Reconciler {
 	r := &ReconcileMachine{
-		Client:        mgr.GetClient(),
-		eventRecorder: mgr.GetEventRecorderFor("machine-controller"),
-		config:        mgr.GetConfig(),
-		scheme:        mgr.GetScheme(),
-		actuator:      actuator,
+		Client:               mgr.GetClient(),
+		apiReader:            mgr.GetAPIReader(),
+		eventRecorder:        mgr.GetEventRecorderFor("machine-controller"),
+		config:               mgr.GetConfig(),
+		scheme:               mgr.GetScheme(),
+		actuator:             newLimitedActuator(newTracedActuator(actuator), opts.ActuatorLimits),
+		provisioningTimeouts: opts.ProvisioningTimeouts,
+	}
+	// The instances are listed within the same limits as the other actuator calls.
+	if lister, ok := actuator.(InstanceLister); ok {
+		r.instanceSnapshot = newInstanceSnapshot(newLimitedInstanceLister(newTracedInstanceLister(lister), r.actuator))
 	}
 	return r
 }
@@ -137,7 +165,7 @@ func add(mgr manager.Manager, r reconcile.Reconciler, controllerName string) err
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func addWithOpts(mgr manager.Manager, opts controller.Options, controllerName string) error {
+func addWithOpts(mgr manager.Manager, opts controller.Options, controllerName string, predicates ...predicate.Predicate) error {
 	// Create a new controller
 	c, err := controller.New(controllerName, mgr, opts)
 	if err != nil {
@@ -145,10 +173,16 @@ func addWithOpts(mgr manager.Manager, opts controller.Options, controllerName st
 	}
 
 	// Watch for changes to Machine
-	return c.Watch(
+	if err := c.Watch(
 		&source.Kind{Type: &machinev1.Machine{}},
 		&handler.EnqueueRequestForObject{},
-	)
+		predicates...,
+	); err != nil {
+		return err
+	}
+
+	// Watch for MachineSets being paused or resumed, which pauses or resumes their Machines
+	return watchMachineSetPause(c, mgr.GetClient())
 }
 
 // ReconcileMachine reconciles a Machine object
@@ -157,10 +191,19 @@ type ReconcileMachine struct {
 	config *rest.Config
 	scheme *runtime.Scheme
 
+	// apiReader reads straight from the API, bypassing the cache, when checking the volumes attached to Nodes.
+	apiReader client.Reader
+
 	eventRecorder record.EventRecorder
 
 	actuator Actuator
 
+	// instanceSnapshot serves Exists for actuators which can list all the instances of the cluster, it is nil otherwise.
+	instanceSnapshot *instanceSnapshot
+
+	// provisioningTimeouts fail the Machines which are not provisioned, or whose Node does not register, in time.
+	provisioningTimeouts ProvisioningTimeouts
+
 	// nowFunc is used to mock time in testing. It should be nil in production.
 	nowFunc func() time.Time
 }
@@ -182,6 +225,16 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, err
 	}
 
+	ctx, span := tracing.Start(ctx, "ReconcileMachine.Reconcile", m, tracing.MachineAttributes(m)...)
+	defer span.End()
+
+	result, err := r.reconcileMachine(ctx, m)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// reconcileMachine reconciles the Machine towards its desired state.
+func (r *ReconcileMachine) reconcileMachine(ctx context.Context, m *machinev1.Machine) (reconcile.Result, error) {
 	// Implement controller logic here
 	machineName := m.GetName()
 	klog.Infof("%v: reconciling Machine", machineName)
@@ -197,6 +250,21 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, err
 	}
 
+	// Paused machines are neither created, updated nor deleted, only their status is reported
+	pausedBy, err := machinePausedBy(ctx, r.Client, m)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	setPausedCondition(m, pausedBy)
+	if pausedBy != "" {
+		klog.Infof("%v: reconciliation is paused by %s", machineName, pausedBy)
+		var cause error
+		if machineIsFailed(m) {
+			cause = failureCause(m)
+		}
+		return reconcile.Result{}, r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), cause, originalConditions)
+	}
+
 	// If object hasn't been deleted and doesn't have a finalizer, add one
 	// Add a finalizer to newly created objects.
 	if m.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -206,7 +274,11 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			m.Finalizers = append(m.ObjectMeta.Finalizers, machinev1.MachineFinalizer)
 		}
 
-		if len(m.Finalizers) > finalizerCount {
+		// The trace context is stored along with the finalizer, or on its own for Machines which were created
+		// before tracing was enabled.
+		traceContextAdded := tracing.Inject(ctx, m)
+
+		if len(m.Finalizers) > finalizerCount || traceContextAdded {
 			if err := r.Client.Update(ctx, m); err != nil {
 				klog.Infof("%v: failed to add finalizers to machine: %v", machineName, err)
 				return reconcile.Result{}, err
@@ -228,10 +300,15 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			return reconcile.Result{}, nil
 		}
 
+		// The orphan deletion mode removes the machine only, the node is not drained
+		// and the instance and the node are left running.
+		if deletionmode.IsOrphan(m.GetAnnotations()) {
+			return reconcile.Result{}, r.orphanMachine(ctx, m)
+		}
+
 		klog.Infof("%v: reconciling machine triggers delete", machineName)
-		// check if machine was already drained
-		drainedCondition := conditions.Get(m, machinev1.MachineDrained)
-		if drainedCondition == nil || drainedCondition.Status != corev1.ConditionTrue {
+		// check if machine was already drained, or the drain was abandoned after exceeding its timeout
+		if !isDrainFinished(m) {
 			klog.Infof("%s: waiting for node to be drained before deleting instance", machineName)
 			// this will requeue and proceed when drain controller will set the condition
 			return reconcile.Result{}, nil
@@ -239,12 +316,39 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 
 		// pre-term.delete lifecycle hook
 		// Return early without error, will requeue if/when the hook owner removes the annotation.
+		// Requeue when a hook has a timeout, so that the hook can be expired.
 		if len(m.Spec.LifecycleHooks.PreTerminate) > 0 {
-			klog.Infof("%v: not deleting machine: lifecycle blocked by pre-terminate hook", machineName)
-			return reconcile.Result{}, nil
+			hookTimeouts := &lifecycleHookTimeouts{client: r.Client, eventRecorder: r.eventRecorder, now: r.now()}
+			held, requeueAfter, err := hookTimeouts.reconcile(ctx, m, lifecyclehooks.PreTerminate)
+			if err != nil {
+				klog.Errorf("%v: failed to check pre-terminate hook timeouts: %v", machineName, err)
+				return reconcile.Result{}, err
+			}
+			if held {
+				klog.Infof("%v: not deleting machine: lifecycle blocked by pre-terminate hook", machineName)
+				return reconcile.Result{RequeueAfter: requeueAfter}, nil
+			}
+		}
+
+		// check if the volumes were detached from the node, the wait was skipped, or it exceeded its timeout
+		if !isVolumeDetachFinished(m) {
+			if err := r.reconcileVolumeDetach(ctx, m); err != nil {
+				klog.Errorf("%v: failed to check if volumes are detached from node: %v", machineName, err)
+				return reconcile.Result{}, err
+			}
+			if err := r.updateStatus(ctx, m, phaseDeleting, nil, originalConditions); err != nil {
+				return reconcile.Result{}, err
+			}
+			if !isVolumeDetachFinished(m) {
+				klog.Infof("%v: waiting for volumes to be detached from node before deleting instance", machineName)
+				return reconcile.Result{RequeueAfter: requeueAfter}, nil
+			}
 		}
 
 		if err := r.actuator.Delete(ctx, m); err != nil {
+			if throttled := asThrottledError(err); throttled != nil {
+				return r.requeueThrottled(ctx, m, throttled, originalConditions)
+			}
 			// isInvalidMachineConfiguration will take care of the case where the
 			// configuration is invalid from the beginning. len(m.Status.Addresses) > 0
 			// will handle the case when a machine configuration was invalidated
@@ -257,8 +361,22 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			}
 		}
 
+		// The deletion of the instance is timed from the first request to the actuator which did not fail.
+		deletionStarted := timelineStepTime(m, TimelineInstanceDeletionStarted)
+		if deletionStarted == nil {
+			now := metav1.NewTime(r.now())
+			deletionStarted = &now
+			if err := patchTimelineStep(ctx, r.Client, m, TimelineInstanceDeletionStarted, now.Time); err != nil {
+				klog.Errorf("%v: failed to record the start of the instance deletion: %v", machineName, err)
+				return reconcile.Result{}, err
+			}
+		}
+
 		instanceExists, err := r.actuator.Exists(ctx, m)
 		if err != nil {
+			if throttled := asThrottledError(err); throttled != nil {
+				return r.requeueThrottled(ctx, m, throttled, originalConditions)
+			}
 			klog.Errorf("%v: failed to check if machine exists: %v", machineName, err)
 			return reconcile.Result{}, err
 		}
@@ -268,12 +386,25 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			return reconcile.Result{RequeueAfter: requeueAfter}, nil
 		}
 
+		// The last steps are recorded along with the removal of the finalizer.
+		instanceDeleted := r.now()
+		if err := recordTimelineStep(m, TimelineInstanceDeleted, instanceDeleted); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		var nodeDeleteDuration time.Duration
 		if m.Status.NodeRef != nil {
 			klog.Infof("%v: deleting node %q for machine", machineName, m.Status.NodeRef.Name)
+			nodeDeletionStarted := r.now()
 			if err := r.deleteNode(ctx, m.Status.NodeRef.Name); err != nil {
 				klog.Errorf("%v: error deleting node for machine: %v", machineName, err)
 				return reconcile.Result{}, err
 			}
+			nodeDeleted := r.now()
+			if err := recordTimelineStep(m, TimelineNodeDeleted, nodeDeleted); err != nil {
+				return reconcile.Result{}, err
+			}
+			nodeDeleteDuration = nodeDeleted.Sub(nodeDeletionStarted)
 		}
 
 		// Remove finalizer on successful deletion.
@@ -284,16 +415,24 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		}
 
 		klog.Infof("%v: machine deletion successful", machineName)
+
+		// Update the metrics once the deletion has succeeded, so that each deletion is only counted once.
+		metrics.MachineInstanceDeleteDurationSeconds.Observe(instanceDeleted.Sub(deletionStarted.Time).Seconds())
+		if m.Status.NodeRef != nil {
+			metrics.MachineNodeDeleteDurationSeconds.Observe(nodeDeleteDuration.Seconds())
+		}
 		return reconcile.Result{}, nil
 	}
 
 	if machineIsFailed(m) {
-		klog.Warningf("%v: machine has gone %q phase. It won't reconcile", machineName, phaseFailed)
-		return reconcile.Result{}, nil
+		return r.reconcileFailedMachine(ctx, m, originalConditions)
 	}
 
-	instanceExists, err := r.actuator.Exists(ctx, m)
+	instanceExists, err := r.instanceExists(ctx, m)
 	if err != nil {
+		if throttled := asThrottledError(err); throttled != nil {
+			return r.requeueThrottled(ctx, m, throttled, originalConditions)
+		}
 		klog.Errorf("%v: failed to check if machine exists: %v", machineName, err)
 
 		conditions.Set(m, conditions.UnknownCondition(
@@ -310,8 +449,17 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 	}
 
 	if instanceExists {
+		// Adopted instances are brought under management by the update, which fills in the status of the machine
+		if machines.IsAdoptingInstance(m) && !machineHasBeenAdopted(m) {
+			klog.Infof("%v: adopting existing instance %q", machineName, pointer.StringDeref(m.Spec.ProviderID, ""))
+			r.eventRecorder.Eventf(m, corev1.EventTypeNormal, "Adopting", "Adopting existing instance %q", pointer.StringDeref(m.Spec.ProviderID, ""))
+		}
+
 		klog.Infof("%v: reconciling machine triggers idempotent update", machineName)
 		if err := r.actuator.Update(ctx, m); err != nil {
+			if throttled := asThrottledError(err); throttled != nil {
+				return r.requeueThrottled(ctx, m, throttled, originalConditions)
+			}
 			klog.Errorf("%v: error updating machine: %v, retrying in %v seconds", machineName, err, requeueAfter)
 
 			if patchErr := r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), nil, originalConditions); patchErr != nil {
@@ -326,6 +474,9 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 
 		if !machineIsProvisioned(m) {
 			klog.Errorf("%v: instance exists but providerID or addresses has not been given to the machine yet, requeuing", machineName)
+			if timedOut := r.provisioningTimedOut(m, MachineWaitingForInstance); timedOut != nil {
+				return r.failProvisioningTimeout(ctx, m, timedOut, originalConditions)
+			}
 			if patchErr := r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), nil, originalConditions); patchErr != nil {
 				klog.Errorf("%v: error patching status: %v", machineName, patchErr)
 			}
@@ -334,6 +485,10 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		}
 
 		if !machineHasNode(m) {
+			if timedOut := r.provisioningTimedOut(m, MachineWaitingForNodeRegistration); timedOut != nil {
+				return r.failProvisioningTimeout(ctx, m, timedOut, originalConditions)
+			}
+
 			// Requeue until we reach running phase
 			if err := r.updateStatus(ctx, m, phaseProvisioned, nil, originalConditions); err != nil {
 				return reconcile.Result{}, err
@@ -342,9 +497,24 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			return reconcile.Result{RequeueAfter: requeueAfter}, nil
 		}
 
+		setNodeRegistered(m)
+
+		// post-provision lifecycle hook
+		// Return early without error, will requeue if/when the hook owner removes the annotation.
+		// Machines which are already running are not taken out of the Running phase.
+		if stringPointerDeref(m.Status.Phase) != phaseRunning && len(lifecyclehooks.Hooks(m, lifecyclehooks.PostProvision)) > 0 {
+			klog.Infof("%v: not marking machine as running: lifecycle blocked by post-provision hook", machineName)
+			return reconcile.Result{}, r.updateStatus(ctx, m, phaseProvisioned, nil, originalConditions)
+		}
+
 		return reconcile.Result{}, r.updateStatus(ctx, m, phaseRunning, nil, originalConditions)
 	}
 
+	// The instance to adopt does not exist, it must never be created in its place.
+	if machines.IsAdoptingInstance(m) && !machineHasBeenAdopted(m) {
+		return r.reconcileMissingAdoptedInstance(ctx, m, originalConditions)
+	}
+
 	// Instance does not exist but the machine has been given a providerID/address.
 	// This can only be reached if an instance was deleted outside the machine API
 	if machineIsProvisioned(m) {
@@ -377,8 +547,27 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, nil
 	}
 
+	// pre-create lifecycle hook
+	// Return early without error, will requeue if/when the hook owner removes the annotation.
+	if len(lifecyclehooks.Hooks(m, lifecyclehooks.PreCreate)) > 0 {
+		klog.Infof("%v: not creating instance: lifecycle blocked by pre-create hook", machineName)
+		return reconcile.Result{}, r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), nil, originalConditions)
+	}
+
+	if timedOut := r.provisioningTimedOut(m, MachineWaitingForInstance); timedOut != nil {
+		return r.failProvisioningTimeout(ctx, m, timedOut, originalConditions)
+	}
+	if provisioningWaitStarted(m, originalConditions) {
+		if err := r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), nil, originalConditions); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
 	klog.Infof("%v: reconciling machine triggers idempotent create", machineName)
 	if err := r.actuator.Create(ctx, m); err != nil {
+		if throttled := asThrottledError(err); throttled != nil {
+			return r.requeueThrottled(ctx, m, throttled, originalConditions)
+		}
 		klog.Warningf("%v: failed to create machine: %v", machineName, err)
 		if isInvalidMachineConfigurationError(err) {
 			if err := r.updateStatus(ctx, m, phaseFailed, err, originalConditions); err != nil {
@@ -447,8 +636,8 @@ func (r *ReconcileMachine) updateStatus(ctx context.Context, machine *machinev1.
 	// A call to Patch will mutate our local copy of the machine to match what is stored in the API.
 	// Before we make any changes to the status subresource on our local copy, we need to patch the object first,
 	// otherwise our local changes to the status subresource will be lost.
-	if phase == phaseFailed {
-		err := r.patchFailedMachineInstanceAnnotation(ctx, machine)
+	if phaseChanged || phase == phaseFailed {
+		err := r.patchPhaseAnnotations(ctx, machine, phase, phaseChanged)
 		if err != nil {
 			klog.Errorf("Failed to update machine %q: %v", machine.GetName(), err)
 			return err
@@ -511,12 +700,22 @@ func (r *ReconcileMachine) updateStatus(ctx context.Context, machine *machinev1.
 	return nil
 }
 
-func (r *ReconcileMachine) patchFailedMachineInstanceAnnotation(ctx context.Context, machine *machinev1.Machine) error {
+// patchPhaseAnnotations records the phase the Machine enters in its phase timeline,
+// and marks the state of the instance of a Failed Machine as unknown.
+func (r *ReconcileMachine) patchPhaseAnnotations(ctx context.Context, machine *machinev1.Machine, phase string, phaseChanged bool) error {
 	baseToPatch := client.MergeFrom(machine.DeepCopy())
-	if machine.Annotations == nil {
-		machine.Annotations = map[string]string{}
+	// The Deleting phase may already have been recorded by the drain controller, ahead of the status.
+	if phaseChanged && timelinePhase(machine) != phase {
+		if err := addTimelineEvent(machine, TimelineEvent{Phase: phase, Time: metav1.NewTime(r.now())}); err != nil {
+			return err
+		}
+	}
+	if phase == phaseFailed {
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[MachineInstanceStateAnnotationName] = unknownInstanceState
 	}
-	machine.Annotations[MachineInstanceStateAnnotationName] = unknownInstanceState
 	if err := r.Client.Patch(ctx, machine, baseToPatch); err != nil {
 		return err
 	}
@@ -601,6 +800,30 @@ func setLifecycleHookConditions(m *machinev1.Machine) {
 	} else {
 		conditions.MarkTrue(m, machinev1.MachineTerminable)
 	}
+
+	// The creation hook conditions are only reported once hooks have been set,
+	// so that Machines which never used them are left untouched.
+	if preCreate := lifecyclehooks.Hooks(m, lifecyclehooks.PreCreate); len(preCreate) > 0 {
+		conditions.Set(m, conditions.FalseCondition(
+			MachinePreCreateHookSucceeded,
+			machinev1.MachineHookPresent,
+			machinev1.ConditionSeverityWarning,
+			"Instance creation currently blocked by: %+v", preCreate,
+		))
+	} else if conditions.Get(m, MachinePreCreateHookSucceeded) != nil {
+		conditions.MarkTrue(m, MachinePreCreateHookSucceeded)
+	}
+
+	if postProvision := lifecyclehooks.Hooks(m, lifecyclehooks.PostProvision); len(postProvision) > 0 && stringPointerDeref(m.Status.Phase) != phaseRunning {
+		conditions.Set(m, conditions.FalseCondition(
+			MachinePostProvisionHookSucceeded,
+			machinev1.MachineHookPresent,
+			machinev1.ConditionSeverityWarning,
+			"Running phase currently blocked by: %+v", postProvision,
+		))
+	} else if conditions.Get(m, MachinePostProvisionHookSucceeded) != nil {
+		conditions.MarkTrue(m, MachinePostProvisionHookSucceeded)
+	}
 }
 
 // now is used to get the current time. If the reconciler nowFunc is no nil this will be used instead of time.Now().
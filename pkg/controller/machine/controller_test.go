@@ -27,11 +27,14 @@ import (
 	. "github.com/onsi/gomega"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -43,6 +46,8 @@ var (
 )
 
 func TestReconcileRequest(t *testing.T) {
+	volumeDetachStarted := metav1.NewTime(time.Now().Add(-time.Hour))
+
 	machineNoPhase := machinev1.Machine{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "Machine",
@@ -114,6 +119,67 @@ func TestReconcileRequest(t *testing.T) {
 			},
 		},
 	}
+	machineProvisioningPreCreateHook := machinev1.Machine{
+		TypeMeta: metav1.TypeMeta{
+			Kind: "Machine",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "create-precreate",
+			Namespace:  "default",
+			Finalizers: []string{machinev1.MachineFinalizer, metav1.FinalizerDeleteDependents},
+			Labels: map[string]string{
+				machinev1.MachineClusterIDLabel: "testcluster",
+			},
+			Annotations: map[string]string{
+				lifecyclehooks.PreCreateHookAnnotationPrefix + "/ipam-reservation": "machine-api-tests",
+			},
+		},
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{
+				Value: &runtime.RawExtension{
+					Raw: []byte("{}"),
+				},
+			},
+		},
+		Status: machinev1.MachineStatus{
+			Phase: pointer.StringPtr(phaseProvisioning),
+		},
+	}
+	machineProvisionedPostProvisionHook := machinev1.Machine{
+		TypeMeta: metav1.TypeMeta{
+			Kind: "Machine",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "update-postprovision",
+			Namespace:  "default",
+			Finalizers: []string{machinev1.MachineFinalizer, metav1.FinalizerDeleteDependents},
+			Labels: map[string]string{
+				machinev1.MachineClusterIDLabel: "testcluster",
+			},
+			Annotations: map[string]string{
+				lifecyclehooks.PostProvisionHookAnnotationPrefix + "/node-hardening": "machine-api-tests",
+			},
+		},
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{
+				Value: &runtime.RawExtension{
+					Raw: []byte("{}"),
+				},
+			},
+		},
+		Status: machinev1.MachineStatus{
+			Phase: pointer.StringPtr(phaseProvisioned),
+			Addresses: []corev1.NodeAddress{
+				{
+					Type:    corev1.NodeInternalIP,
+					Address: "0.0.0.0",
+				},
+			},
+			NodeRef: &corev1.ObjectReference{
+				Name: "a node",
+			},
+		},
+	}
 	time := metav1.Now()
 	machineDeleting := machinev1.Machine{
 		TypeMeta: metav1.TypeMeta{
@@ -321,6 +387,96 @@ func TestReconcileRequest(t *testing.T) {
 			Conditions: machinev1.Conditions{*conditions.TrueCondition(machinev1.MachineDrained)},
 		},
 	}
+	machineDeletingDrainTimeoutExceeded := machinev1.Machine{
+		TypeMeta: metav1.TypeMeta{
+			Kind: "Machine",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "delete-drain-timeout-exceeded",
+			Namespace:         "default",
+			Finalizers:        []string{machinev1.MachineFinalizer, metav1.FinalizerDeleteDependents},
+			DeletionTimestamp: &time,
+			Labels: map[string]string{
+				machinev1.MachineClusterIDLabel: "testcluster",
+			},
+		},
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{
+				Value: &runtime.RawExtension{
+					Raw: []byte("{}"),
+				},
+			},
+		},
+		Status: machinev1.MachineStatus{
+			Conditions: machinev1.Conditions{
+				*conditions.FalseCondition(machinev1.MachineDrained, MachineDrainTimeoutExceeded, machinev1.ConditionSeverityWarning, "Node drain did not complete within 10m0s"),
+			},
+		},
+	}
+
+	nodeWithVolumesAttached := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-with-volumes-attached",
+		},
+		Status: corev1.NodeStatus{
+			VolumesAttached: []corev1.AttachedVolume{
+				{
+					Name:       "kubernetes.io/csi/volume",
+					DevicePath: "/dev/sdb",
+				},
+			},
+		},
+	}
+	nodeWithVolumesDetached := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-with-volumes-detached",
+		},
+	}
+	newMachineDeletingWithNode := func(name, nodeName string) machinev1.Machine {
+		return machinev1.Machine{
+			TypeMeta: metav1.TypeMeta{
+				Kind: "Machine",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Finalizers:        []string{machinev1.MachineFinalizer, metav1.FinalizerDeleteDependents},
+				DeletionTimestamp: &time,
+				Annotations:       map[string]string{},
+				Labels: map[string]string{
+					machinev1.MachineClusterIDLabel: "testcluster",
+				},
+			},
+			Spec: machinev1.MachineSpec{
+				ProviderSpec: machinev1.ProviderSpec{
+					Value: &runtime.RawExtension{
+						Raw: []byte("{}"),
+					},
+				},
+			},
+			Status: machinev1.MachineStatus{
+				NodeRef: &corev1.ObjectReference{
+					Name: nodeName,
+				},
+				Conditions: machinev1.Conditions{*conditions.TrueCondition(machinev1.MachineDrained)},
+			},
+		}
+	}
+	machineDeletingVolumesAttached := newMachineDeletingWithNode("delete-volumes-attached", nodeWithVolumesAttached.Name)
+	machineDeletingVolumesDetached := newMachineDeletingWithNode("delete-volumes-detached", nodeWithVolumesDetached.Name)
+	machineDeletingExcludeWaitForVolumeDetach := newMachineDeletingWithNode("delete-exclude-wait-for-volume-detach", nodeWithVolumesAttached.Name)
+	machineDeletingExcludeWaitForVolumeDetach.Annotations[ExcludeWaitForVolumeDetachAnnotation] = ""
+	machineDeletingInvalidDrainPolicy := newMachineDeletingWithNode("delete-invalid-drain-policy", nodeWithVolumesDetached.Name)
+	machineDeletingInvalidDrainPolicy.Annotations[drainpolicy.VolumeDetachTimeoutAnnotation] = "forever"
+	machineDeletingVolumeDetachTimeoutExceeded := newMachineDeletingWithNode("delete-volume-detach-timeout-exceeded", nodeWithVolumesAttached.Name)
+	machineDeletingVolumeDetachTimeoutExceeded.Annotations[drainpolicy.VolumeDetachTimeoutAnnotation] = "10m"
+	machineDeletingVolumeDetachTimeoutExceeded.Status.Conditions = append(machineDeletingVolumeDetachTimeoutExceeded.Status.Conditions, machinev1.Condition{
+		Type:               MachineVolumesDetached,
+		Status:             corev1.ConditionFalse,
+		Reason:             MachineWaitingForVolumeDetach,
+		Severity:           machinev1.ConditionSeverityInfo,
+		LastTransitionTime: volumeDetachStarted,
+	})
 
 	type expected struct {
 		createCallCount int64
@@ -375,6 +531,32 @@ func TestReconcileRequest(t *testing.T) {
 				phase:           phaseProvisioned,
 			},
 		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineProvisioningPreCreateHook.Name, Namespace: machineProvisioningPreCreateHook.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 0,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseProvisioning,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineProvisionedPostProvisionHook.Name, Namespace: machineProvisionedPostProvisionHook.Namespace}},
+			existsValue: true,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 1,
+				deleteCallCount: 0,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseProvisioned,
+			},
+		},
 		{
 			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeleting.Name, Namespace: machineDeleting.Namespace}},
 			existsValue: false,
@@ -466,6 +648,84 @@ func TestReconcileRequest(t *testing.T) {
 				phase:           phaseDeleting,
 			},
 		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingDrainTimeoutExceeded.Name, Namespace: machineDeletingDrainTimeoutExceeded.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 1,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingVolumesAttached.Name, Namespace: machineDeletingVolumesAttached.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  0,
+				updateCallCount: 0,
+				deleteCallCount: 0,
+				result:          reconcile.Result{RequeueAfter: requeueAfter},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingVolumesDetached.Name, Namespace: machineDeletingVolumesDetached.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 1,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingInvalidDrainPolicy.Name, Namespace: machineDeletingInvalidDrainPolicy.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 1,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingExcludeWaitForVolumeDetach.Name, Namespace: machineDeletingExcludeWaitForVolumeDetach.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 1,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
+		{
+			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineDeletingVolumeDetachTimeoutExceeded.Name, Namespace: machineDeletingVolumeDetachTimeoutExceeded.Namespace}},
+			existsValue: false,
+			expected: expected{
+				createCallCount: 0,
+				existCallCount:  1,
+				updateCallCount: 0,
+				deleteCallCount: 1,
+				result:          reconcile.Result{},
+				error:           false,
+				phase:           phaseDeleting,
+			},
+		},
 		{
 			request:     reconcile.Request{NamespacedName: types.NamespacedName{Name: machineFailed.Name, Namespace: machineFailed.Namespace}},
 			existsValue: false,
@@ -499,21 +759,34 @@ func TestReconcileRequest(t *testing.T) {
 			act := newTestActuator()
 			act.ExistsValue = tc.existsValue
 			machinev1.AddToScheme(scheme.Scheme)
+			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme,
+				&machineNoPhase,
+				&machineProvisioning,
+				&machineProvisioned,
+				&machineProvisioningPreCreateHook,
+				&machineProvisionedPostProvisionHook,
+				&machineDeleting,
+				&machineDeletingPreDrainHook,
+				&machineDeletingPreDrainHookWithoutNode,
+				&machineDeletingPreTerminateHook,
+				&machineFailed,
+				&machineRunning,
+				&machineDeletingAlreadyDrained,
+				&machineDeletingDrainTimeoutExceeded,
+				&machineDeletingVolumesAttached,
+				&machineDeletingVolumesDetached,
+				&machineDeletingInvalidDrainPolicy,
+				&machineDeletingExcludeWaitForVolumeDetach,
+				&machineDeletingVolumeDetachTimeoutExceeded,
+				&nodeWithVolumesAttached,
+				&nodeWithVolumesDetached,
+			)
 			r := &ReconcileMachine{
-				Client: fake.NewFakeClientWithScheme(scheme.Scheme,
-					&machineNoPhase,
-					&machineProvisioning,
-					&machineProvisioned,
-					&machineDeleting,
-					&machineDeletingPreDrainHook,
-					&machineDeletingPreDrainHookWithoutNode,
-					&machineDeletingPreTerminateHook,
-					&machineFailed,
-					&machineRunning,
-					&machineDeletingAlreadyDrained,
-				),
-				scheme:   scheme.Scheme,
-				actuator: act,
+				Client:        fakeClient,
+				apiReader:     fakeClient,
+				scheme:        scheme.Scheme,
+				eventRecorder: record.NewFakeRecorder(10),
+				actuator:      act,
 			}
 
 			result, err := r.Reconcile(ctx, tc.request)
@@ -773,8 +1046,9 @@ func TestUpdateStatus(t *testing.T) {
 			g.Expect(got.Status.Conditions).To(conditions.MatchConditions(tc.conditions))
 			g.Expect(machine.Status.Conditions).To(conditions.MatchConditions(tc.conditions))
 
-			g.Expect(got.GetAnnotations()).To(Equal(tc.annotations))
-			g.Expect(machine.GetAnnotations()).To(Equal(tc.annotations))
+			// The phase timeline is covered by the timeline tests.
+			g.Expect(withoutPhaseTimeline(got.GetAnnotations())).To(Equal(tc.annotations))
+			g.Expect(withoutPhaseTimeline(machine.GetAnnotations())).To(Equal(tc.annotations))
 
 			if tc.existingProviderStatus != "" {
 				g.Expect(got.Status.ProviderStatus).ToNot(BeNil())
@@ -784,6 +1058,20 @@ func TestUpdateStatus(t *testing.T) {
 	}
 }
 
+// withoutPhaseTimeline returns the annotations without the phase timeline, or nil if no other annotation is set.
+func withoutPhaseTimeline(annotations map[string]string) map[string]string {
+	filtered := map[string]string{}
+	for k, v := range annotations {
+		if k != PhaseTimelineAnnotation {
+			filtered[k] = v
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
 func TestMachineIsProvisioned(t *testing.T) {
 	name := "test"
 	namespace := "test"
@@ -1096,10 +1384,20 @@ func TestSetLifecycleHookConditions(t *testing.T) {
 	}
 	terminableFalse := conditions.FalseCondition(machinev1.MachineTerminable, machinev1.MachineHookPresent, machinev1.ConditionSeverityWarning, "Terminate operation currently blocked by: [{Name:pre-terminate Owner:pre-terminate-owner}]")
 
+	preCreateHookAnnotations := map[string]string{lifecyclehooks.PreCreateHookAnnotationPrefix + "/pre-create": "pre-create-owner"}
+	preCreateTrue := conditions.TrueCondition(MachinePreCreateHookSucceeded)
+	preCreateFalse := conditions.FalseCondition(MachinePreCreateHookSucceeded, machinev1.MachineHookPresent, machinev1.ConditionSeverityWarning, "Instance creation currently blocked by: [{Name:pre-create Owner:pre-create-owner}]")
+
+	postProvisionHookAnnotations := map[string]string{lifecyclehooks.PostProvisionHookAnnotationPrefix + "/post-provision": "post-provision-owner"}
+	postProvisionTrue := conditions.TrueCondition(MachinePostProvisionHookSucceeded)
+	postProvisionFalse := conditions.FalseCondition(MachinePostProvisionHookSucceeded, machinev1.MachineHookPresent, machinev1.ConditionSeverityWarning, "Running phase currently blocked by: [{Name:post-provision Owner:post-provision-owner}]")
+
 	testCases := []struct {
 		name               string
 		existingConditions machinev1.Conditions
 		lifecycleHooks     machinev1.LifecycleHooks
+		annotations        map[string]string
+		phase              string
 		expectedConditions machinev1.Conditions
 	}{
 		{
@@ -1177,6 +1475,57 @@ func TestSetLifecycleHookConditions(t *testing.T) {
 				*terminableTrue,
 			},
 		},
+		{
+			name:        "with a pre-create hook",
+			annotations: preCreateHookAnnotations,
+			expectedConditions: machinev1.Conditions{
+				*drainableTrue,
+				*terminableTrue,
+				*preCreateFalse,
+			},
+		},
+		{
+			name: "with a pre-create hook removed",
+			existingConditions: machinev1.Conditions{
+				*preCreateFalse,
+			},
+			expectedConditions: machinev1.Conditions{
+				*drainableTrue,
+				*terminableTrue,
+				*preCreateTrue,
+			},
+		},
+		{
+			name:        "with a post-provision hook",
+			annotations: postProvisionHookAnnotations,
+			phase:       phaseProvisioned,
+			expectedConditions: machinev1.Conditions{
+				*drainableTrue,
+				*terminableTrue,
+				*postProvisionFalse,
+			},
+		},
+		{
+			name:        "with a post-provision hook on a running machine",
+			annotations: postProvisionHookAnnotations,
+			phase:       phaseRunning,
+			expectedConditions: machinev1.Conditions{
+				*drainableTrue,
+				*terminableTrue,
+			},
+		},
+		{
+			name: "with a post-provision hook removed",
+			existingConditions: machinev1.Conditions{
+				*postProvisionFalse,
+			},
+			phase: phaseProvisioned,
+			expectedConditions: machinev1.Conditions{
+				*drainableTrue,
+				*terminableTrue,
+				*postProvisionTrue,
+			},
+		},
 		{
 			name: "with hooks are removed",
 			existingConditions: machinev1.Conditions{
@@ -1195,10 +1544,14 @@ func TestSetLifecycleHookConditions(t *testing.T) {
 			g := NewWithT(t)
 
 			machine := &machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tc.annotations,
+				},
 				Spec: machinev1.MachineSpec{
 					LifecycleHooks: tc.lifecycleHooks,
 				},
 				Status: machinev1.MachineStatus{
+					Phase:      pointer.StringPtr(tc.phase),
 					Conditions: tc.existingConditions,
 				},
 			}
@@ -0,0 +1,191 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+// MachineDrainBudgetExceeded is the reason set on the MachineDrained condition, or on the Maintenance condition, while the
+// drain is held back because a drain budget covering the Machine has no room for another drain.
+const MachineDrainBudgetExceeded = "DrainBudgetExceeded"
+
+// drainBudget limits how many Machines within its scope may drain their Nodes at the same time.
+type drainBudget struct {
+	// name identifies the budget in conditions and events.
+	name string
+
+	// maxConcurrent is the maximum number of Machines within the scope of the budget that may drain at the same time.
+	maxConcurrent int
+
+	// inScope returns true when the Machine counts against the budget.
+	inScope func(ctx context.Context, m *machinev1.Machine) (bool, error)
+
+	// isDraining returns true when the Machine is draining its Node. When nil, isDrainInProgress is used.
+	isDraining func(ctx context.Context, m *machinev1.Machine) (bool, error)
+}
+
+// drainBudgetsFor returns the drain budgets which cover the Machine.
+// Control plane Machines are always covered by a budget which allows a single control plane drain at a time.
+// Other budgets are configured through the drain policy of the Machine.
+func (d *machineDrainController) drainBudgetsFor(ctx context.Context, m *machinev1.Machine, policy *drainpolicy.Policy) ([]drainBudget, error) {
+	budgets := []drainBudget{}
+
+	controlPlane, err := d.isControlPlaneMachine(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if controlPlane {
+		budgets = append(budgets, drainBudget{
+			name:          "control plane",
+			maxConcurrent: 1,
+			inScope:       d.isControlPlaneMachine,
+			isDraining:    d.isControlPlaneDrainInProgress,
+		})
+	}
+
+	if policy.MaxConcurrentDrains == 0 {
+		return budgets, nil
+	}
+
+	if policy.DrainBudgetSelector != nil {
+		selector := policy.DrainBudgetSelector
+		budgets = append(budgets, drainBudget{
+			name:          fmt.Sprintf("selector %q", selector.String()),
+			maxConcurrent: policy.MaxConcurrentDrains,
+			inScope: func(_ context.Context, other *machinev1.Machine) (bool, error) {
+				return selector.Matches(labels.Set(other.Labels)), nil
+			},
+		})
+		return budgets, nil
+	}
+
+	owner := metav1.GetControllerOf(m)
+	if owner == nil || owner.Kind != "MachineSet" {
+		// Without a MachineSet, the budget would only ever cover this Machine.
+		return budgets, nil
+	}
+	budgets = append(budgets, drainBudget{
+		name:          fmt.Sprintf("MachineSet %q", owner.Name),
+		maxConcurrent: policy.MaxConcurrentDrains,
+		inScope: func(_ context.Context, other *machinev1.Machine) (bool, error) {
+			otherOwner := metav1.GetControllerOf(other)
+			return otherOwner != nil && otherOwner.UID == owner.UID, nil
+		},
+	})
+
+	return budgets, nil
+}
+
+// blockingDrainBudget returns the first of the budgets which has no room for the Machine to start draining,
+// along with the names of the Machines currently draining within its scope.
+// Drains are tracked through the DrainStarted condition, which is only set once a drain has been let through,
+// unless the budget decides for itself which Machines are draining.
+// The Machines are read straight from the API so that a drain let through by the previous reconcile is always seen.
+func (d *machineDrainController) blockingDrainBudget(ctx context.Context, m *machinev1.Machine, budgets []drainBudget) (*drainBudget, []string, error) {
+	if len(budgets) == 0 {
+		return nil, nil, nil
+	}
+
+	machines := &machinev1.MachineList{}
+	if err := d.apiReader.List(ctx, machines, client.InNamespace(m.Namespace)); err != nil {
+		return nil, nil, fmt.Errorf("could not list machines: %w", err)
+	}
+
+	for i := range budgets {
+		budget := &budgets[i]
+		draining := []string{}
+
+		for j := range machines.Items {
+			other := &machines.Items[j]
+			if other.Name == m.Name {
+				continue
+			}
+
+			isDraining := isDrainInProgress(other)
+			if !isDraining && budget.isDraining != nil {
+				var err error
+				if isDraining, err = budget.isDraining(ctx, other); err != nil {
+					return nil, nil, err
+				}
+			}
+			if !isDraining {
+				continue
+			}
+
+			inScope, err := budget.inScope(ctx, other)
+			if err != nil {
+				return nil, nil, err
+			}
+			if inScope {
+				draining = append(draining, other.Name)
+			}
+		}
+
+		if len(draining) >= budget.maxConcurrent {
+			return budget, draining, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// isControlPlaneMachine checks whether the Node of the Machine is a control plane node.
+func (d *machineDrainController) isControlPlaneMachine(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	if m.Status.NodeRef == nil {
+		return false, nil
+	}
+
+	node := &corev1.Node{}
+	if err := d.Client.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get node %q: %w", m.Status.NodeRef.Name, err)
+	}
+
+	return isControlPlaneNode(*node), nil
+}
+
+// isControlPlaneDrainInProgress returns true when the Machine is draining its Node, including drains which were started
+// before drains were tracked through the DrainStarted condition. The Node of a deleting Machine which has not finished
+// draining being cordoned is then taken as its drain being in progress, so that a second control plane drain is not
+// started alongside one which was already running when the drain controller was upgraded.
+func (d *machineDrainController) isControlPlaneDrainInProgress(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	if isDrainInProgress(m) {
+		return true, nil
+	}
+	if m.DeletionTimestamp.IsZero() || conditions.Get(m, MachineDrainStarted) != nil || isDrainFinished(m) || m.Status.NodeRef == nil {
+		return false, nil
+	}
+
+	node := &corev1.Node{}
+	if err := d.Client.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get node %q: %w", m.Status.NodeRef.Name, err)
+	}
+
+	return node.Spec.Unschedulable, nil
+}
+
+// isDrainInProgress returns true when the drain controller has started draining the Node of the Machine and has not finished yet.
+// The Nodes of Machines in maintenance count as draining from the start of their drain until the maintenance ends,
+// as they stay out of service throughout.
+func isDrainInProgress(m *machinev1.Machine) bool {
+	if maintenance := conditions.Get(m, MachineMaintenance); maintenance != nil &&
+		(maintenance.Reason == MachineMaintenanceDraining || maintenance.Reason == MachineMaintenanceNodeDrained) {
+		return true
+	}
+	return !m.DeletionTimestamp.IsZero() && conditions.Get(m, MachineDrainStarted) != nil && !isDrainFinished(m)
+}
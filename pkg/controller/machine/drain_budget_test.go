@@ -0,0 +1,264 @@
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+func TestBlockingDrainBudget(t *testing.T) {
+	workerNode := newNode("worker")
+	otherWorkerNode := newNode("other-worker")
+	controlPlaneNode := newNode("controlplane", controlPlaneLabel)
+	masterNode := newNode("master", masterLabel)
+	masterNodeCordoned := newNode("master-cordoned", masterLabel, cordoned)
+
+	machine := func(name, nodeName string, transforms ...func(m *machinev1.Machine)) *machinev1.Machine {
+		m := getMachine(name, phaseDeleting)
+		m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		for _, transform := range transforms {
+			transform(m)
+		}
+		return m
+	}
+	draining := func(m *machinev1.Machine) {
+		conditions.MarkTrue(m, MachineDrainStarted)
+	}
+	drained := func(m *machinev1.Machine) {
+		conditions.MarkTrue(m, MachineDrainStarted)
+		conditions.MarkTrue(m, machinev1.MachineDrained)
+	}
+	notDeleting := func(m *machinev1.Machine) {
+		m.DeletionTimestamp = nil
+	}
+	inMaintenance := func(reason string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.DeletionTimestamp = nil
+			conditions.MarkFalse(m, MachineMaintenance, reason, machinev1.ConditionSeverityInfo, "")
+		}
+	}
+	ownedBy := func(machineSet string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: machinev1.GroupVersion.String(),
+				Kind:       "MachineSet",
+				Name:       machineSet,
+				UID:        types.UID(machineSet),
+				Controller: pointer.Bool(true),
+			}}
+		}
+	}
+	annotated := func(key, value string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.Annotations[key] = value
+		}
+	}
+	labelled := func(key, value string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.Labels[key] = value
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		machine          *machinev1.Machine
+		objects          []runtime.Object
+		expectedBudget   string
+		expectedDraining []string
+	}{
+		{
+			name:    "With a worker machine and no drain budget",
+			machine: machine("worker", workerNode.Name),
+			objects: []runtime.Object{
+				machine("other-worker", otherWorkerNode.Name, draining),
+			},
+		},
+		{
+			name:    "With a control plane machine",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name),
+				machine("worker", workerNode.Name, draining),
+			},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine draining",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name, draining),
+			},
+			expectedBudget:   "control plane",
+			expectedDraining: []string{"master"},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine drained",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name, drained),
+			},
+		},
+		{
+			name:    "With a control plane machine and another control plane node cordoned outside of a drain",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master-cordoned", masterNodeCordoned.Name, notDeleting),
+			},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine drained for maintenance",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master-cordoned", masterNodeCordoned.Name, inMaintenance(MachineMaintenanceNodeDrained)),
+			},
+			expectedBudget:   "control plane",
+			expectedDraining: []string{"master-cordoned"},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine draining for maintenance",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name, inMaintenance(MachineMaintenanceDraining)),
+			},
+			expectedBudget:   "control plane",
+			expectedDraining: []string{"master"},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine waiting to drain for maintenance",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name, inMaintenance(MachineDrainBudgetExceeded)),
+			},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine whose maintenance has ended",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master", masterNode.Name, inMaintenance(MachineMaintenanceEnded)),
+			},
+		},
+		{
+			name:    "With a control plane machine and another control plane machine draining since before drains were tracked",
+			machine: machine("controlplane", controlPlaneNode.Name),
+			objects: []runtime.Object{
+				machine("master-cordoned", masterNodeCordoned.Name),
+			},
+			expectedBudget:   "control plane",
+			expectedDraining: []string{"master-cordoned"},
+		},
+		{
+			name:    "With a worker machine and a control plane machine draining since before drains were tracked",
+			machine: machine("worker", workerNode.Name, ownedBy("storage"), annotated(drainpolicy.DrainBudgetAnnotation, "1")),
+			objects: []runtime.Object{
+				machine("master-cordoned", masterNodeCordoned.Name, ownedBy("storage")),
+			},
+		},
+		{
+			name:    "With a MachineSet drain budget not yet reached",
+			machine: machine("worker", workerNode.Name, ownedBy("storage"), annotated(drainpolicy.DrainBudgetAnnotation, "2")),
+			objects: []runtime.Object{
+				machine("storage-0", otherWorkerNode.Name, ownedBy("storage"), draining),
+				machine("storage-1", otherWorkerNode.Name, ownedBy("storage"), drained),
+				machine("compute-0", otherWorkerNode.Name, ownedBy("compute"), draining),
+			},
+		},
+		{
+			name:    "With a MachineSet drain budget reached",
+			machine: machine("worker", workerNode.Name, ownedBy("storage"), annotated(drainpolicy.DrainBudgetAnnotation, "2")),
+			objects: []runtime.Object{
+				machine("storage-0", otherWorkerNode.Name, ownedBy("storage"), draining),
+				machine("storage-1", otherWorkerNode.Name, ownedBy("storage"), draining),
+			},
+			expectedBudget:   `MachineSet "storage"`,
+			expectedDraining: []string{"storage-0", "storage-1"},
+		},
+		{
+			name: "With a selector drain budget reached",
+			machine: machine("worker", workerNode.Name, ownedBy("storage-a"), labelled("pool", "storage"),
+				annotated(drainpolicy.DrainBudgetAnnotation, "1"), annotated(drainpolicy.DrainBudgetSelectorAnnotation, "pool=storage")),
+			objects: []runtime.Object{
+				machine("storage-b-0", otherWorkerNode.Name, ownedBy("storage-b"), labelled("pool", "storage"), draining),
+				machine("compute-0", otherWorkerNode.Name, ownedBy("storage-a"), draining),
+			},
+			expectedBudget:   `selector "pool=storage"`,
+			expectedDraining: []string{"storage-b-0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objects := append([]runtime.Object{tc.machine, workerNode, otherWorkerNode, controlPlaneNode, masterNode, masterNodeCordoned}, tc.objects...)
+			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+
+			d := &machineDrainController{
+				Client:    fakeClient,
+				apiReader: fakeClient,
+			}
+
+			policy, errs := drainpolicy.Parse(tc.machine.Annotations, field.NewPath("metadata", "annotations"))
+			g.Expect(errs).To(BeEmpty())
+
+			budgets, err := d.drainBudgetsFor(ctx, tc.machine, policy)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			budget, draining, err := d.blockingDrainBudget(ctx, tc.machine, budgets)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.expectedBudget == "" {
+				g.Expect(budget).To(BeNil())
+				return
+			}
+			g.Expect(budget).ToNot(BeNil())
+			g.Expect(budget.name).To(Equal(tc.expectedBudget))
+			g.Expect(draining).To(ConsistOf(tc.expectedDraining))
+		})
+	}
+}
+
+func TestDrainControllerHoldsMachineOverDrainBudget(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("controlplane", phaseDeleting)
+	m.Status.NodeRef = &corev1.ObjectReference{Name: "controlplane"}
+	other := getMachine("master", phaseDeleting)
+	other.Status.NodeRef = &corev1.ObjectReference{Name: "master"}
+	conditions.MarkTrue(other, MachineDrainStarted)
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, m, other, newNode("controlplane", controlPlaneLabel), newNode("master", masterLabel))
+	recorder := record.NewFakeRecorder(10)
+	d := &machineDrainController{
+		Client:        fakeClient,
+		apiReader:     fakeClient,
+		scheme:        scheme.Scheme,
+		eventRecorder: recorder,
+	}
+
+	result, err := d.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: m.Namespace, Name: m.Name}})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).ToNot(BeZero())
+	g.Expect(recorder.Events).To(Receive(ContainSubstring("DrainBudgetExceeded")))
+
+	updated := &machinev1.Machine{}
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: m.Name}, updated)).To(Succeed())
+	g.Expect(conditions.Get(updated, MachineDrainStarted)).To(BeNil())
+
+	drained := conditions.Get(updated, machinev1.MachineDrained)
+	g.Expect(drained).ToNot(BeNil())
+	g.Expect(drained.Reason).To(Equal(MachineDrainBudgetExceeded))
+	g.Expect(drained.Message).To(Equal("Drain held by the control plane drain budget, which allows 1 concurrent drains: already draining master"))
+}
@@ -3,13 +3,16 @@ package machine
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
@@ -22,12 +25,25 @@ import (
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 
+	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
 )
 
 const (
 	nodeControlPlaneLabel = "node-role.kubernetes.io/control-plane"
 	nodeMasterLabel       = "node-role.kubernetes.io/master"
+
+	// MachineDrainStarted is set on the Machine when the drain controller first proceeds with draining its Node.
+	// Its LastTransitionTime marks the start of the drain and is used to enforce the drain timeout.
+	MachineDrainStarted machinev1.ConditionType = "DrainStarted"
+
+	// MachineDrainTimeoutExceeded is the reason set on the MachineDrained condition when the drain
+	// was abandoned because it did not complete within the drain timeout.
+	MachineDrainTimeoutExceeded = drainpolicy.DrainTimeoutExceededReason
 )
 
 // DrainController performs pods eviction for deleting node
@@ -36,13 +52,20 @@ type machineDrainController struct {
 	config *rest.Config
 	scheme *runtime.Scheme
 
+	// apiReader reads straight from the API, bypassing the cache, when checking the drain budgets.
+	apiReader client.Reader
+
 	eventRecorder record.EventRecorder
+
+	// nowFunc is used to mock time in testing. It should be nil in production.
+	nowFunc func() time.Time
 }
 
 // newDrainController returns a new reconcile.Reconciler for machine-drain-controller
 func newDrainController(mgr manager.Manager) reconcile.Reconciler {
 	d := &machineDrainController{
 		Client:        mgr.GetClient(),
+		apiReader:     mgr.GetAPIReader(),
 		eventRecorder: mgr.GetEventRecorderFor("machine-drain-controller"),
 		config:        mgr.GetConfig(),
 		scheme:        mgr.GetScheme(),
@@ -75,34 +98,147 @@ func (d *machineDrainController) Reconcile(ctx context.Context, request reconcil
 		return reconcile.Result{}, err
 	}
 
-	existingDrainedCondition := conditions.Get(m, machinev1.MachineDrained)
-	alreadyDrained := existingDrainedCondition != nil && existingDrainedCondition.Status == corev1.ConditionTrue
+	// The Paused condition is reported by the machine controller
+	pausedBy, err := machinePausedBy(ctx, d.Client, m)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if pausedBy != "" {
+		klog.V(3).Infof("%v: not draining machine: reconciliation is paused by %s", m.Name, pausedBy)
+		return reconcile.Result{}, nil
+	}
+
+	// Machines which are not being deleted are only drained for maintenance
+	if m.ObjectMeta.DeletionTimestamp.IsZero() {
+		return d.reconcileMaintenance(ctx, m)
+	}
 
-	if !m.ObjectMeta.DeletionTimestamp.IsZero() && stringPointerDeref(m.Status.Phase) == phaseDeleting && !alreadyDrained {
+	// Orphaned machines are deleted without draining their node, the machine controller removes them straight away
+	if deletionmode.IsOrphan(m.GetAnnotations()) {
+		klog.V(3).Infof("%v: not draining machine: the node is orphaned along with the instance", m.Name)
+		return reconcile.Result{}, nil
+	}
+
+	if stringPointerDeref(m.Status.Phase) == phaseDeleting && !isDrainFinished(m) {
 		drainFinishedCondition := conditions.TrueCondition(machinev1.MachineDrained)
+		// drainResult is the timeline step recording the end of the drain, it is empty when the drain is skipped.
+		var drainResult string
 
 		if _, exists := m.ObjectMeta.Annotations[ExcludeNodeDrainingAnnotation]; !exists && m.Status.NodeRef != nil {
 			// pre-drain.delete lifecycle hook
 			// Return early without error, will requeue if/when the hook owner removes the annotation.
+			// Requeue when a hook has a timeout, so that the hook can be expired.
 			if len(m.Spec.LifecycleHooks.PreDrain) > 0 {
-				klog.Infof("%v: not draining machine: lifecycle blocked by pre-drain hook", m.Name)
-				d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainBlocked", "Drain blocked by pre-drain hook")
-				return reconcile.Result{}, nil
+				hookTimeouts := &lifecycleHookTimeouts{client: d.Client, eventRecorder: d.eventRecorder, now: d.now()}
+				held, requeueAfter, err := hookTimeouts.reconcile(ctx, m, lifecyclehooks.PreDrain)
+				if err != nil {
+					klog.Errorf("%v: failed to check pre-drain hook timeouts: %v", m.Name, err)
+					return reconcile.Result{}, err
+				}
+				if held {
+					klog.Infof("%v: not draining machine: lifecycle blocked by pre-drain hook", m.Name)
+					d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainBlocked", "Drain blocked by pre-drain hook")
+					return reconcile.Result{RequeueAfter: requeueAfter}, nil
+				}
+			}
+
+			policy := drainPolicy(m, d.eventRecorder)
+
+			if conditions.Get(m, MachineDrainStarted) == nil {
+				budgets, err := d.drainBudgetsFor(ctx, m, policy)
+				if err != nil {
+					return reconcile.Result{}, fmt.Errorf("could not determine drain budgets: %w", err)
+				}
+				budget, draining, err := d.blockingDrainBudget(ctx, m, budgets)
+				if err != nil {
+					return reconcile.Result{}, fmt.Errorf("could not check drain budgets: %w", err)
+				}
+				if budget != nil {
+					message := fmt.Sprintf("Drain held by the %s drain budget, which allows %d concurrent drains: already draining %s",
+						budget.name, budget.maxConcurrent, strings.Join(draining, ", "))
+					klog.Infof("%v: not draining machine: %s", m.Name, message)
+					d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainBudgetExceeded", "%s", message)
+					conditions.Set(m, conditions.FalseCondition(
+						machinev1.MachineDrained,
+						MachineDrainBudgetExceeded,
+						machinev1.ConditionSeverityInfo,
+						"%s", message,
+					))
+					if err := d.Client.Status().Update(ctx, m); err != nil {
+						return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
+					}
+					return reconcile.Result{RequeueAfter: 20 * time.Second}, nil
+				}
+
+				if err := patchTimelineStep(ctx, d.Client, m, TimelineDrainStarted, d.now()); err != nil {
+					return reconcile.Result{}, fmt.Errorf("could not record the start of the drain: %w", err)
+				}
+
+				// Persist the start of the drain straight away so that the timeout is measured from
+				// the first attempt, and so the drain counts against its budgets, even across controller restarts.
+				conditions.MarkTrue(m, MachineDrainStarted)
+				if err := d.Client.Status().Update(ctx, m); err != nil {
+					return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
+				}
 			}
 			d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainProceeds", "Node drain proceeds")
-			if err := d.drainNode(ctx, m); err != nil {
-				klog.Errorf("%v: failed to drain node for machine: %v", m.Name, err)
-				conditions.Set(m, conditions.FalseCondition(
+
+			drainResult = TimelineDrainSucceeded
+			if d.isDrainTimeoutExceeded(m, policy) {
+				drainResult = TimelineDrainTimedOut
+				klog.Warningf("%v: node drain did not complete within %v, proceeding with machine deletion", m.Name, policy.Timeout)
+				d.eventRecorder.Eventf(m, corev1.EventTypeWarning, "DrainTimeoutExceeded", "Node drain did not complete within %v, proceeding with machine deletion", policy.Timeout)
+				message := fmt.Sprintf("Node drain did not complete within %v", policy.Timeout)
+				if progress := getDrainProgress(m); progress != nil {
+					message = fmt.Sprintf("%s: %v", message, progress)
+				}
+				drainFinishedCondition = conditions.FalseCondition(
 					machinev1.MachineDrained,
-					machinev1.MachineDrainError,
+					MachineDrainTimeoutExceeded,
 					machinev1.ConditionSeverityWarning,
-					"could not drain machine: %v", err,
-				))
-				d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainRequeued", "Node drain requeued: %v", err.Error())
-				return delayIfRequeueAfterError(err)
+					"%s", message,
+				)
+			} else {
+				progress, err := d.drainNode(ctx, m, policy)
+				if err != nil {
+					klog.Errorf("%v: failed to drain node for machine: %v", m.Name, err)
+					message := err.Error()
+					if progress != nil {
+						message = fmt.Sprintf("%v: %v", progress, err)
+						if err := d.patchDrainProgress(ctx, m, progress); err != nil {
+							klog.Errorf("%v: could not record drain progress: %v", m.Name, err)
+						}
+					}
+					conditions.Set(m, conditions.FalseCondition(
+						machinev1.MachineDrained,
+						machinev1.MachineDrainError,
+						machinev1.ConditionSeverityWarning,
+						"could not drain machine: %s", message,
+					))
+					// The update is ignored by the drain controller's watch,
+					// the retry is driven by the rate limiter.
+					if err := d.Client.Status().Update(ctx, m); err != nil {
+						klog.Errorf("%v: could not update machine status: %v", m.Name, err)
+					}
+					d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainRequeued", "Node drain requeued: %s", message)
+					return delayIfRequeueAfterError(err)
+				}
+				d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainSucceeded", "Node drain succeeded")
+				drainFinishedCondition.Message = "Drain finished successfully"
+
+				if _, ok := m.Annotations[DrainProgressAnnotation]; ok {
+					if err := d.patchDrainProgress(ctx, m, nil); err != nil {
+						return reconcile.Result{}, fmt.Errorf("could not clear drain progress: %w", err)
+					}
+				}
+			}
+
+			// The end of the drain is patched before its condition is set, as the patch resets the status.
+			if timelineStepTime(m, drainResult) == nil {
+				if err := patchTimelineStep(ctx, d.Client, m, drainResult, d.now()); err != nil {
+					return reconcile.Result{}, fmt.Errorf("could not record the end of the drain: %w", err)
+				}
 			}
-			d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainSucceeded", "Node drain succeeded")
-			drainFinishedCondition.Message = "Drain finished successfully"
 		} else {
 			d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainSkipped", "Node drain skipped")
 			drainFinishedCondition.Message = "Node drain skipped"
@@ -113,52 +249,51 @@ func (d *machineDrainController) Reconcile(ctx context.Context, request reconcil
 		if err := d.Client.Status().Update(ctx, m); err != nil {
 			return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
 		}
+		if drainResult != "" {
+			d.observeDrainDuration(m, drainResult)
+		}
 		return reconcile.Result{}, nil
 	}
 
 	return reconcile.Result{}, nil
 }
 
-func (d *machineDrainController) drainNode(ctx context.Context, machine *machinev1.Machine) error {
+// drainPolicy returns the drain policy set by the annotations of the Machine. Annotations set before the webhook
+// validated them may not parse, in which case the default drain policy is used rather than blocking the deletion forever.
+func drainPolicy(m *machinev1.Machine, eventRecorder record.EventRecorder) *drainpolicy.Policy {
+	policy, errs := drainpolicy.Parse(m.GetAnnotations(), field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		klog.Warningf("%v: invalid drain policy, using the default drain policy: %v", m.Name, errs.ToAggregate())
+		eventRecorder.Eventf(m, corev1.EventTypeWarning, "DrainPolicyInvalid", "Invalid drain policy, using the default drain policy: %v", errs.ToAggregate())
+		return drainpolicy.DefaultPolicy()
+	}
+	return policy
+}
+
+// drainNode cordons and drains the Node of the Machine.
+// When pods remain on the Node after a drain attempt, the progress of the drain is returned alongside the error.
+func (d *machineDrainController) drainNode(ctx context.Context, machine *machinev1.Machine, policy *drainpolicy.Policy) (progress *DrainProgress, err error) {
+	ctx, span := tracing.Start(ctx, "drainNode", machine, tracing.MachineAttributes(machine)...)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	kubeClient, err := kubernetes.NewForConfig(d.config)
 	if err != nil {
-		return fmt.Errorf("unable to build kube client: %v", err)
+		return nil, fmt.Errorf("unable to build kube client: %v", err)
 	}
 	node, err := kubeClient.CoreV1().Nodes().Get(ctx, machine.Status.NodeRef.Name, metav1.GetOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			// If an admin deletes the node directly, we'll end up here.
 			klog.Infof("Could not find node from noderef, it may have already been deleted: %v", machine.Status.NodeRef.Name)
-			return nil
+			return nil, nil
 		}
-		return fmt.Errorf("unable to get node %q: %v", machine.Status.NodeRef.Name, err)
+		return nil, fmt.Errorf("unable to get node %q: %v", machine.Status.NodeRef.Name, err)
 	}
 
-	if err := d.isDrainAllowed(ctx, node); err != nil {
-		return fmt.Errorf("drain not permitted: %w", err)
-	}
-
-	drainer := &drain.Helper{
-		Ctx:                 ctx,
-		Client:              kubeClient,
-		Force:               true,
-		IgnoreAllDaemonSets: true,
-		DeleteEmptyDirData:  true,
-		GracePeriodSeconds:  -1,
-		// If a pod is not evicted in 20 seconds, retry the eviction next time the
-		// machine gets reconciled again (to allow other machines to be reconciled).
-		Timeout: 20 * time.Second,
-		OnPodDeletedOrEvicted: func(pod *corev1.Pod, usingEviction bool) {
-			verbStr := "Deleted"
-			if usingEviction {
-				verbStr = "Evicted"
-			}
-			klog.Info(fmt.Sprintf("%s pod from Node", verbStr),
-				"pod", fmt.Sprintf("%s/%s", pod.Name, pod.Namespace))
-		},
-		Out:    writer{klog.Info},
-		ErrOut: writer{klog.Error},
-	}
+	drainer := newDrainHelper(ctx, kubeClient, policy)
 
 	if nodeIsUnreachable(node) {
 		klog.Infof("%q: Node %q is unreachable, draining will ignore gracePeriod. PDBs are still honored.",
@@ -172,7 +307,7 @@ func (d *machineDrainController) drainNode(ctx context.Context, machine *machine
 	if err := drain.RunCordonOrUncordon(drainer, node, true); err != nil {
 		// Can't cordon a node
 		klog.Warningf("cordon failed for node %q: %v", node.Name, err)
-		return &RequeueAfterError{RequeueAfter: 20 * time.Second}
+		return nil, &RequeueAfterError{RequeueAfter: 20 * time.Second}
 	}
 
 	if err := drain.RunNodeDrain(drainer, node.Name); err != nil {
@@ -183,43 +318,115 @@ func (d *machineDrainController) drainNode(ctx context.Context, machine *machine
 		// installer pods) to complete even when being drained.
 		// If we never allow the pods to complete, this can cause a deadlock between the
 		// drain controller and installer pods.
-		return err
+		return newDrainProgress(ctx, kubeClient, drainer, machine, node.Name), err
 	}
 
 	klog.Infof("drain successful for machine %q", machine.Name)
 	d.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleted", "Node %q drained", node.Name)
 
-	return nil
+	return nil, nil
 }
 
-// isDrainAllowed checks whether the drain is permitted at this time.
-// It checks the following:
-// - Is the node cordoned, if so allow draining to complete any previous attempt to drain.
-// - Is the node a control plane node, if so, only allow draining if no other control plane node is already being drained.
-func (d *machineDrainController) isDrainAllowed(ctx context.Context, node *corev1.Node) error {
-	if node.Spec.Unschedulable {
-		// If the node has already been cordoned, continue to drain.
-		return nil
+// patchDrainProgress records the drain progress on the Machine, or removes it when progress is nil.
+func (d *machineDrainController) patchDrainProgress(ctx context.Context, m *machinev1.Machine, progress *DrainProgress) error {
+	patchBase := client.MergeFrom(m.DeepCopy())
+
+	if progress == nil {
+		delete(m.Annotations, DrainProgressAnnotation)
+	} else if err := setDrainProgress(m, progress); err != nil {
+		return err
 	}
 
-	if !isControlPlaneNode(*node) {
-		// We always allow draining of worker nodes.
-		return nil
+	return d.Client.Patch(ctx, m, patchBase)
+}
+
+// newDrainHelper builds the drain.Helper used to drain a Node according to the given drain policy.
+func newDrainHelper(ctx context.Context, kubeClient kubernetes.Interface, policy *drainpolicy.Policy) *drain.Helper {
+	drainer := &drain.Helper{
+		Ctx:                 ctx,
+		Client:              kubeClient,
+		Force:               policy.Force,
+		IgnoreAllDaemonSets: true,
+		DeleteEmptyDirData:  policy.DeleteEmptyDirData,
+		GracePeriodSeconds:  policy.GracePeriodSeconds,
+		// If a pod is not evicted within the eviction timeout, retry the eviction next time the
+		// machine gets reconciled again (to allow other machines to be reconciled).
+		Timeout: policy.EvictionTimeout,
+		OnPodDeletedOrEvicted: func(pod *corev1.Pod, usingEviction bool) {
+			verbStr := "Deleted"
+			if usingEviction {
+				verbStr = "Evicted"
+			}
+			klog.Info(fmt.Sprintf("%s pod from Node", verbStr),
+				"pod", fmt.Sprintf("%s/%s", pod.Name, pod.Namespace))
+		},
+		Out:    writer{klog.Info},
+		ErrOut: writer{klog.Error},
 	}
 
-	nodes := &corev1.NodeList{}
-	if err := d.Client.List(ctx, nodes); err != nil {
-		return fmt.Errorf("could not list control plane nodes: %v", err)
+	if policy.SkipPodSelector != nil {
+		drainer.AdditionalFilters = append(drainer.AdditionalFilters, skipPodsFilter(policy.SkipPodSelector))
 	}
 
-	for _, otherNode := range nodes.Items {
-		if isControlPlaneNode(otherNode) && otherNode.Spec.Unschedulable {
-			klog.Warningf("Drain not permitted for node %q: found other control plane node (%s) already cordoned: other node may be being drained, do not continue until the other node is removed", node.Name, otherNode.Name)
-			return &RequeueAfterError{RequeueAfter: 20 * time.Second}
+	return drainer
+}
+
+// skipPodsFilter returns a drain.PodFilter which leaves the pods matching the selector on the Node.
+func skipPodsFilter(selector labels.Selector) drain.PodFilter {
+	return func(pod corev1.Pod) drain.PodDeleteStatus {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return drain.MakePodDeleteStatusSkip()
 		}
+		return drain.MakePodDeleteStatusOkay()
+	}
+}
+
+// isDrainTimeoutExceeded checks whether the drain of the Machine's Node has been running for longer than
+// the timeout set by the drain policy. The start of the drain is taken from the DrainStarted condition.
+func (d *machineDrainController) isDrainTimeoutExceeded(m *machinev1.Machine, policy *drainpolicy.Policy) bool {
+	if policy.Timeout == 0 {
+		return false
+	}
+
+	drainStarted := conditions.Get(m, MachineDrainStarted)
+	if drainStarted == nil || drainStarted.LastTransitionTime.IsZero() {
+		return false
+	}
+
+	return d.now().Sub(drainStarted.LastTransitionTime.Time) > policy.Timeout
+}
+
+// observeDrainDuration updates the drain duration metric with the time since the start of the drain of the Machine.
+func (d *machineDrainController) observeDrainDuration(m *machinev1.Machine, drainResult string) {
+	drainStarted := conditions.Get(m, MachineDrainStarted)
+	if drainStarted == nil || drainStarted.LastTransitionTime.IsZero() {
+		return
+	}
+
+	result := "succeeded"
+	if drainResult == TimelineDrainTimedOut {
+		result = "timed_out"
+	}
+	metrics.MachineDrainDurationSeconds.WithLabelValues(result).Observe(d.now().Sub(drainStarted.LastTransitionTime.Time).Seconds())
+}
+
+// isDrainFinished returns true once the drain controller is done with the Machine, either because
+// the Node has been drained, the drain was skipped, or because the drain timeout was exceeded.
+func isDrainFinished(m *machinev1.Machine) bool {
+	drainedCondition := conditions.Get(m, machinev1.MachineDrained)
+	if drainedCondition == nil {
+		return false
 	}
 
-	return nil
+	return drainedCondition.Status == corev1.ConditionTrue || drainedCondition.Reason == MachineDrainTimeoutExceeded
+}
+
+// now is used to get the current time. If the drain controller nowFunc is not nil this will be used instead of time.Now().
+func (d *machineDrainController) now() time.Time {
+	if d.nowFunc != nil {
+		return d.nowFunc()
+	}
+	return time.Now()
 }
 
 // isControlPlaneNode checks if the Node is labelled as a control plane node.
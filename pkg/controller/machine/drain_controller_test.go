@@ -2,6 +2,8 @@ package machine
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,7 +13,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -19,6 +23,7 @@ import (
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
 )
 
 func getMachine(name string, phase string) *machinev1.Machine {
@@ -159,6 +164,64 @@ func TestDrainControllerReconcileRequest(t *testing.T) {
 		g.Expect(updatedMachine.Status.Conditions).To(conditions.MatchConditions(expectedConditions))
 	})
 
+	t.Run("proceed with deletion once the drain timeout is exceeded", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		machine := getMachine("drain-timeout", phaseDeleting)
+		machine.ObjectMeta.Annotations[drainpolicy.DrainTimeoutAnnotation] = "10m"
+
+		drainController, recorder := getDrainControllerReconciler(machine)
+		drainController.nowFunc = func() time.Time {
+			return time.Now().Add(time.Hour)
+		}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: machine.Name, Namespace: machine.Namespace}}
+
+		_, err := drainController.Reconcile(context.TODO(), request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Eventually(recorder.Events).Should(Receive(ContainSubstring("Node drain proceeds")))
+		g.Eventually(recorder.Events).Should(Receive(ContainSubstring("Node drain did not complete within 10m0s")))
+
+		updatedMachine := &machinev1.Machine{}
+		g.Expect(drainController.Client.Get(context.TODO(), request.NamespacedName, updatedMachine)).To(Succeed())
+		g.Expect(conditions.Get(updatedMachine, MachineDrainStarted)).ToNot(BeNil())
+
+		drainedCondition := conditions.Get(updatedMachine, machinev1.MachineDrained)
+		g.Expect(drainedCondition).ToNot(BeNil())
+		g.Expect(drainedCondition.Status).To(Equal(corev1.ConditionFalse))
+		g.Expect(drainedCondition.Reason).To(Equal(MachineDrainTimeoutExceeded))
+		g.Expect(isDrainFinished(updatedMachine)).To(BeTrue())
+
+		g.Expect(getTimeline(updatedMachine)).To(HaveLen(3), "the drain steps should be preceded by the Deleting phase")
+		g.Expect(timelinePhase(updatedMachine)).To(Equal(phaseDeleting))
+		g.Expect(timelineStepTime(updatedMachine, TimelineDrainStarted)).ToNot(BeNil())
+		g.Expect(timelineStepTime(updatedMachine, TimelineDrainTimedOut)).ToNot(BeNil())
+	})
+
+	t.Run("drain machine with the default drain policy when its drain policy is invalid", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		machine := getMachine("invalid-drain-timeout", phaseDeleting)
+		machine.ObjectMeta.Annotations[drainpolicy.DrainTimeoutAnnotation] = "forever"
+
+		// The node of the machine is already gone, so the drain succeeds straight away.
+		apiServer := httptest.NewServer(http.NotFoundHandler())
+		defer apiServer.Close()
+
+		drainController, recorder := getDrainControllerReconciler(machine)
+		drainController.config = &rest.Config{Host: apiServer.URL}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: machine.Name, Namespace: machine.Namespace}}
+
+		_, err := drainController.Reconcile(context.TODO(), request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Eventually(recorder.Events).Should(Receive(ContainSubstring("Invalid drain policy, using the default drain policy")))
+		g.Eventually(recorder.Events).Should(Receive(ContainSubstring("Node drain proceeds")))
+		g.Eventually(recorder.Events).Should(Receive(ContainSubstring("Node drain succeeded")))
+
+		updatedMachine := &machinev1.Machine{}
+		g.Expect(drainController.Client.Get(context.TODO(), request.NamespacedName, updatedMachine)).To(Succeed())
+		g.Expect(isDrainFinished(updatedMachine)).To(BeTrue())
+	})
+
 	t.Run("ignore already drained machine", func(t *testing.T) {
 		g := NewGomegaWithT(t)
 
@@ -179,123 +242,42 @@ func TestDrainControllerReconcileRequest(t *testing.T) {
 	})
 }
 
-func TestIsDrainAllowed(t *testing.T) {
-	cordonedNode := newNode("cordoned", cordoned)
-	workerNode := newNode("worker")
-	masterNode := newNode("master", masterLabel)
-	masterNodeCordoned := newNode("master-cordoned", masterLabel, cordoned)
-	controlPlaneNode := newNode("controlplane", controlPlaneLabel)
-	controlPlaneNodeCordoned := newNode("controlplane", controlPlaneLabel, cordoned)
+func TestIsDrainTimeoutExceeded(t *testing.T) {
+	now := time.Now()
+
+	drainStartedAt := func(startedAt time.Time) machinev1.Conditions {
+		condition := conditions.TrueCondition(MachineDrainStarted)
+		condition.LastTransitionTime = metav1.NewTime(startedAt)
+		return machinev1.Conditions{*condition}
+	}
 
 	testCases := []struct {
-		name          string
-		node          *corev1.Node
-		nodes         []runtime.Object
-		expectedError error
+		name       string
+		conditions machinev1.Conditions
+		timeout    time.Duration
+		expected   bool
 	}{
 		{
-			name: "With a node that is already cordoned",
-			node: cordonedNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a node not labelled as a control plane or master",
-			node: workerNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a cordoned control plane node",
-			node: controlPlaneNodeCordoned,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a cordoned master node",
-			node: masterNodeCordoned,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a control plane node",
-			node: controlPlaneNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a master node",
-			node: masterNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-		},
-		{
-			name: "With a control plane node and another control plane node is already cordoned",
-			node: controlPlaneNode,
-			nodes: []runtime.Object{
-				controlPlaneNodeCordoned,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-			expectedError: &RequeueAfterError{RequeueAfter: 20 * time.Second},
+			name:       "with no timeout",
+			conditions: drainStartedAt(now.Add(-time.Hour)),
+			expected:   false,
 		},
 		{
-			name: "With a control plane node and another master node is already cordoned",
-			node: controlPlaneNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNodeCordoned,
-				workerNode,
-				cordonedNode,
-			},
-			expectedError: &RequeueAfterError{RequeueAfter: 20 * time.Second},
+			name:     "with a timeout and the drain not started",
+			timeout:  10 * time.Minute,
+			expected: false,
 		},
 		{
-			name: "With a master node and another control plane node is already cordoned",
-			node: masterNode,
-			nodes: []runtime.Object{
-				controlPlaneNodeCordoned,
-				masterNode,
-				workerNode,
-				cordonedNode,
-			},
-			expectedError: &RequeueAfterError{RequeueAfter: 20 * time.Second},
+			name:       "with a timeout not yet exceeded",
+			conditions: drainStartedAt(now.Add(-5 * time.Minute)),
+			timeout:    10 * time.Minute,
+			expected:   false,
 		},
 		{
-			name: "With a master node and another master node is already cordoned",
-			node: masterNode,
-			nodes: []runtime.Object{
-				controlPlaneNode,
-				masterNodeCordoned,
-				workerNode,
-				cordonedNode,
-			},
-			expectedError: &RequeueAfterError{RequeueAfter: 20 * time.Second},
+			name:       "with a timeout exceeded",
+			conditions: drainStartedAt(now.Add(-15 * time.Minute)),
+			timeout:    10 * time.Minute,
+			expected:   true,
 		},
 	}
 
@@ -303,22 +285,44 @@ func TestIsDrainAllowed(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			g := NewGomegaWithT(t)
 
-			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, tc.nodes...)
+			machine := getMachine("drain-timeout", phaseDeleting)
+			machine.Status.Conditions = tc.conditions
 
 			d := &machineDrainController{
-				Client: fakeClient,
+				nowFunc: func() time.Time { return now },
 			}
 
-			err := d.isDrainAllowed(ctx, tc.node)
-			if tc.expectedError != nil {
-				g.Expect(err).To(MatchError(tc.expectedError))
-			} else {
-				g.Expect(err).ToNot(HaveOccurred())
-			}
+			g.Expect(d.isDrainTimeoutExceeded(machine, &drainpolicy.Policy{Timeout: tc.timeout})).To(Equal(tc.expected))
 		})
 	}
 }
 
+func TestNewDrainHelper(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	policy, errs := drainpolicy.Parse(map[string]string{
+		drainpolicy.DrainForceAnnotation:              "false",
+		drainpolicy.DrainGracePeriodSecondsAnnotation: "60",
+		drainpolicy.DrainEvictionTimeoutAnnotation:    "2m",
+		drainpolicy.DrainSkipPodSelectorAnnotation:    "app=database",
+	}, field.NewPath("metadata", "annotations"))
+	g.Expect(errs).To(BeEmpty())
+
+	drainer := newDrainHelper(ctx, nil, policy)
+	g.Expect(drainer.Force).To(BeFalse())
+	g.Expect(drainer.DeleteEmptyDirData).To(BeTrue())
+	g.Expect(drainer.IgnoreAllDaemonSets).To(BeTrue())
+	g.Expect(drainer.GracePeriodSeconds).To(Equal(60))
+	g.Expect(drainer.Timeout).To(Equal(2 * time.Minute))
+	g.Expect(drainer.AdditionalFilters).To(HaveLen(1))
+
+	skipped := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "database"}}}
+	g.Expect(drainer.AdditionalFilters[0](skipped).Delete).To(BeFalse())
+
+	evicted := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}}
+	g.Expect(drainer.AdditionalFilters[0](evicted).Delete).To(BeTrue())
+}
+
 func newNode(name string, transforms ...func(n *corev1.Node)) *corev1.Node {
 	n := &corev1.Node{
 		ObjectMeta: metav1.ObjectMeta{
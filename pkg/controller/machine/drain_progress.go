@@ -0,0 +1,234 @@
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/kubectl/pkg/drain"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+// DrainProgressAnnotation holds the progress of a blocked drain, serialised as a DrainProgress.
+// It is maintained by the drain controller and removed once the drain succeeds.
+// The progress belongs in the status of the Machine, which has no field for it yet, so it is recorded in an annotation.
+// Writing it updates the Machine, which is why the drain controller ignores updates which only change the progress.
+const DrainProgressAnnotation = "machine.openshift.io/drain-progress"
+
+// maxBlockedPodsInMessage limits how many blocked pods are listed in the MachineDrained condition message.
+// The full list is always available in the drain progress annotation.
+const maxBlockedPodsInMessage = 5
+
+// DrainProgress describes how far the drain of the Node of a Machine has got.
+type DrainProgress struct {
+	// StartTime is when the drain controller started to drain the Node.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// EvictionAttempts is the number of drain attempts that failed to evict all of the pods.
+	EvictionAttempts int `json:"evictionAttempts"`
+
+	// PodsRemaining is the number of pods that still have to be evicted from the Node.
+	PodsRemaining int `json:"podsRemaining"`
+
+	// BlockedPods lists the pods that cannot be evicted because of a PodDisruptionBudget.
+	BlockedPods []BlockedPod `json:"blockedPods,omitempty"`
+}
+
+// BlockedPod is a pod whose eviction is blocked by a PodDisruptionBudget.
+type BlockedPod struct {
+	// Pod is the namespaced name of the pod.
+	Pod string `json:"pod"`
+
+	// PodDisruptionBudget is the name of the PodDisruptionBudget which does not allow any more disruptions.
+	PodDisruptionBudget string `json:"podDisruptionBudget"`
+}
+
+// String summarises the drain progress in a form suitable for condition messages and events.
+func (p *DrainProgress) String() string {
+	pods := "pods"
+	if p.PodsRemaining == 1 {
+		pods = "pod"
+	}
+	attempts := "attempts"
+	if p.EvictionAttempts == 1 {
+		attempts = "attempt"
+	}
+	msg := fmt.Sprintf("%d %s remaining after %d eviction %s", p.PodsRemaining, pods, p.EvictionAttempts, attempts)
+
+	if len(p.BlockedPods) == 0 {
+		return msg
+	}
+
+	blocked := []string{}
+	for i, bp := range p.BlockedPods {
+		if i == maxBlockedPodsInMessage {
+			blocked = append(blocked, fmt.Sprintf("and %d more", len(p.BlockedPods)-maxBlockedPodsInMessage))
+			break
+		}
+		blocked = append(blocked, fmt.Sprintf("%s (%s)", bp.Pod, bp.PodDisruptionBudget))
+	}
+	return fmt.Sprintf("%s, blocked by PodDisruptionBudgets: %s", msg, strings.Join(blocked, ", "))
+}
+
+// getDrainProgress returns the drain progress recorded on the Machine, or nil if there is none.
+func getDrainProgress(m *machinev1.Machine) *DrainProgress {
+	value, ok := m.GetAnnotations()[DrainProgressAnnotation]
+	if !ok {
+		return nil
+	}
+
+	progress := &DrainProgress{}
+	if err := json.Unmarshal([]byte(value), progress); err != nil {
+		klog.Warningf("%v: ignoring invalid drain progress annotation: %v", m.GetName(), err)
+		return nil
+	}
+	return progress
+}
+
+// setDrainProgress records the drain progress on the Machine. It does not persist the Machine.
+func setDrainProgress(m *machinev1.Machine, progress *DrainProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("could not marshal drain progress: %w", err)
+	}
+
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[DrainProgressAnnotation] = string(data)
+	return nil
+}
+
+// newDrainProgress works out the progress of a failed drain attempt, building on the progress of the previous attempts.
+// Failures to look up the remaining pods or PodDisruptionBudgets are logged, as the progress is informational only.
+func newDrainProgress(ctx context.Context, kubeClient kubernetes.Interface, drainer *drain.Helper, m *machinev1.Machine, nodeName string) *DrainProgress {
+	progress := &DrainProgress{}
+	if previous := getDrainProgress(m); previous != nil {
+		progress.EvictionAttempts = previous.EvictionAttempts
+	}
+	progress.EvictionAttempts++
+
+	if drainStarted := conditions.Get(m, MachineDrainStarted); drainStarted != nil {
+		startTime := drainStarted.LastTransitionTime
+		progress.StartTime = &startTime
+	}
+
+	podList, errs := drainer.GetPodsForDeletion(nodeName)
+	if podList == nil {
+		klog.Warningf("%v: could not list the pods remaining on node %q: %v", m.GetName(), nodeName, errs)
+		return progress
+	}
+	pods := podList.Pods()
+	progress.PodsRemaining = len(pods)
+
+	pdbs := map[string][]blockingPDB{}
+	for _, pod := range pods {
+		namespacePDBs, ok := pdbs[pod.Namespace]
+		if !ok {
+			var err error
+			if namespacePDBs, err = listBlockingPDBs(ctx, kubeClient, pod.Namespace); err != nil {
+				klog.Warningf("%v: could not list pod disruption budgets in namespace %q: %v", m.GetName(), pod.Namespace, err)
+			}
+			pdbs[pod.Namespace] = namespacePDBs
+		}
+
+		for _, pdb := range namespacePDBs {
+			if pdb.selector.Matches(labels.Set(pod.Labels)) {
+				progress.BlockedPods = append(progress.BlockedPods, BlockedPod{
+					Pod:                 fmt.Sprintf("%s/%s", pod.Namespace, pod.Name),
+					PodDisruptionBudget: pdb.name,
+				})
+				break
+			}
+		}
+	}
+
+	return progress
+}
+
+// blockingPDB is a PodDisruptionBudget that does not currently allow any disruptions.
+type blockingPDB struct {
+	name     string
+	selector labels.Selector
+}
+
+// listBlockingPDBs lists the PodDisruptionBudgets in the namespace that do not currently allow any disruptions.
+func listBlockingPDBs(ctx context.Context, kubeClient kubernetes.Interface, namespace string) ([]blockingPDB, error) {
+	pdbList, err := kubeClient.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	blocking := []blockingPDB{}
+	for _, pdb := range pdbList.Items {
+		if pdb.Status.DisruptionsAllowed > 0 {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			klog.Warningf("ignoring pod disruption budget %s/%s with invalid selector: %v", pdb.Namespace, pdb.Name, err)
+			continue
+		}
+		if selector.Empty() {
+			// An empty selector matches no pods for a PodDisruptionBudget in policy/v1.
+			continue
+		}
+		blocking = append(blocking, blockingPDB{name: pdb.Name, selector: selector})
+	}
+	return blocking, nil
+}
+
+// ignoreDrainProgressUpdates filters out the Machine update events which only record the progress of the drain.
+// The drain controller records its progress after each failed attempt and relies on the rate limiter to back off
+// between attempts, so these updates must not trigger another attempt straight away.
+func ignoreDrainProgressUpdates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldMachine, ok := e.ObjectOld.(*machinev1.Machine)
+			if !ok {
+				return true
+			}
+			newMachine, ok := e.ObjectNew.(*machinev1.Machine)
+			if !ok {
+				return true
+			}
+			return !onlyDrainProgressChanged(oldMachine, newMachine)
+		},
+	}
+}
+
+// onlyDrainProgressChanged returns true when the only differences between the Machines are in the drain progress
+// annotation, the MachineDrained and Maintenance conditions and the metadata maintained by the API server.
+func onlyDrainProgressChanged(oldMachine, newMachine *machinev1.Machine) bool {
+	return equality.Semantic.DeepEqual(withoutDrainProgress(oldMachine), withoutDrainProgress(newMachine))
+}
+
+func withoutDrainProgress(m *machinev1.Machine) *machinev1.Machine {
+	m = m.DeepCopy()
+	m.ResourceVersion = ""
+	m.ManagedFields = nil
+	delete(m.Annotations, DrainProgressAnnotation)
+	if len(m.Annotations) == 0 {
+		m.Annotations = nil
+	}
+
+	machineConditions := machinev1.Conditions{}
+	for _, c := range m.Status.Conditions {
+		if c.Type != machinev1.MachineDrained && c.Type != MachineMaintenance {
+			machineConditions = append(machineConditions, c)
+		}
+	}
+	m.Status.Conditions = machineConditions
+	return m
+}
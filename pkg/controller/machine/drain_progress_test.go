@@ -0,0 +1,185 @@
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+func TestDrainProgressString(t *testing.T) {
+	testCases := []struct {
+		name     string
+		progress DrainProgress
+		expected string
+	}{
+		{
+			name:     "with no blocked pods",
+			progress: DrainProgress{EvictionAttempts: 1, PodsRemaining: 2},
+			expected: "2 pods remaining after 1 eviction attempt",
+		},
+		{
+			name: "with blocked pods",
+			progress: DrainProgress{
+				EvictionAttempts: 3,
+				PodsRemaining:    1,
+				BlockedPods:      []BlockedPod{{Pod: "default/database-0", PodDisruptionBudget: "database"}},
+			},
+			expected: "1 pod remaining after 3 eviction attempts, blocked by PodDisruptionBudgets: default/database-0 (database)",
+		},
+		{
+			name: "with more blocked pods than fit in the message",
+			progress: DrainProgress{
+				EvictionAttempts: 2,
+				PodsRemaining:    6,
+				BlockedPods: []BlockedPod{
+					{Pod: "default/a", PodDisruptionBudget: "pdb"},
+					{Pod: "default/b", PodDisruptionBudget: "pdb"},
+					{Pod: "default/c", PodDisruptionBudget: "pdb"},
+					{Pod: "default/d", PodDisruptionBudget: "pdb"},
+					{Pod: "default/e", PodDisruptionBudget: "pdb"},
+					{Pod: "default/f", PodDisruptionBudget: "pdb"},
+				},
+			},
+			expected: "6 pods remaining after 2 eviction attempts, blocked by PodDisruptionBudgets: default/a (pdb), default/b (pdb), default/c (pdb), default/d (pdb), default/e (pdb), and 1 more",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tc.progress.String()).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestNewDrainProgress(t *testing.T) {
+	g := NewWithT(t)
+
+	newPod := func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "owner", Controller: pointer.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		}
+	}
+
+	newPDB := func(name string, labels map[string]string, disruptionsAllowed int32) *policyv1.PodDisruptionBudget {
+		return &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: policyv1.PodDisruptionBudgetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+			},
+			Status: policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: disruptionsAllowed},
+		}
+	}
+
+	kubeClient := kubefake.NewSimpleClientset(
+		newPod("database-0", map[string]string{"app": "database"}),
+		newPod("web-0", map[string]string{"app": "web"}),
+		newPod("cache-0", map[string]string{"app": "cache"}),
+		newPDB("database", map[string]string{"app": "database"}, 0),
+		newPDB("web", map[string]string{"app": "web"}, 1),
+	)
+
+	machine := getMachine("machine", phaseDeleting)
+	conditions.MarkTrue(machine, MachineDrainStarted)
+	g.Expect(setDrainProgress(machine, &DrainProgress{EvictionAttempts: 2})).To(Succeed())
+
+	drainer := newDrainHelper(context.Background(), kubeClient, drainpolicy.DefaultPolicy())
+	progress := newDrainProgress(context.Background(), kubeClient, drainer, machine, "node")
+
+	g.Expect(progress.StartTime).ToNot(BeNil())
+	g.Expect(progress.StartTime.Time).To(Equal(conditions.Get(machine, MachineDrainStarted).LastTransitionTime.Time))
+	g.Expect(progress.EvictionAttempts).To(Equal(3))
+	g.Expect(progress.PodsRemaining).To(Equal(3))
+	g.Expect(progress.BlockedPods).To(ConsistOf(BlockedPod{Pod: "default/database-0", PodDisruptionBudget: "database"}))
+
+	g.Expect(setDrainProgress(machine, progress)).To(Succeed())
+	recorded := getDrainProgress(machine)
+	g.Expect(recorded).ToNot(BeNil())
+	g.Expect(recorded.StartTime.Equal(progress.StartTime)).To(BeTrue())
+	g.Expect(recorded.String()).To(Equal(progress.String()))
+}
+
+func TestIgnoreDrainProgressUpdates(t *testing.T) {
+	oldMachine := getMachine("machine", phaseDeleting)
+	oldMachine.ResourceVersion = "1"
+
+	testCases := []struct {
+		name     string
+		update   func(m *machinev1.Machine)
+		expected bool
+	}{
+		{
+			name: "with only the drain progress updated",
+			update: func(m *machinev1.Machine) {
+				m.ResourceVersion = "2"
+				m.Annotations[DrainProgressAnnotation] = `{"evictionAttempts":1,"podsRemaining":1}`
+				conditions.MarkFalse(m, machinev1.MachineDrained, machinev1.MachineDrainError, machinev1.ConditionSeverityWarning, "could not drain machine")
+			},
+			expected: false,
+		},
+		{
+			name: "with a pre-drain hook removed",
+			update: func(m *machinev1.Machine) {
+				m.ResourceVersion = "2"
+				m.Spec.LifecycleHooks.PreDrain = nil
+			},
+			expected: true,
+		},
+		{
+			name: "with a drain annotation added",
+			update: func(m *machinev1.Machine) {
+				m.ResourceVersion = "2"
+				m.Annotations[drainpolicy.DrainTimeoutAnnotation] = "10m"
+			},
+			expected: true,
+		},
+		{
+			name: "with the drain started",
+			update: func(m *machinev1.Machine) {
+				m.ResourceVersion = "2"
+				m.Status.Conditions = append(m.Status.Conditions, machinev1.Condition{
+					Type:               MachineDrainStarted,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(time.Now()),
+				})
+			},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			oldMachine.Spec.LifecycleHooks.PreDrain = []machinev1.LifecycleHook{{Name: "hook", Owner: "owner"}}
+			newMachine := oldMachine.DeepCopy()
+			tc.update(newMachine)
+
+			g.Expect(ignoreDrainProgressUpdates().Update(event.UpdateEvent{
+				ObjectOld: oldMachine,
+				ObjectNew: newMachine,
+			})).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
+)
+
+const (
+	// MachineFailureRetried records the retries of a Machine which reached the Failed phase.
+	// It is only set on Machines which opted in to being retried through their retry policy.
+	MachineFailureRetried machinev1.ConditionType = "FailureRetried"
+
+	// MachineWaitingForRetry is the reason set on the FailureRetried condition while the machine controller
+	// waits for the backoff to pass before the next retry. Its LastTransitionTime marks the start of the wait.
+	MachineWaitingForRetry = "WaitingForRetry"
+
+	// MachineRetryAttempted is the reason set on the FailureRetried condition once the Machine has been retried.
+	MachineRetryAttempted = "RetryAttempted"
+
+	// MachineRetryLimitExceeded is the reason set on the FailureRetried condition when the Machine failed again
+	// after it was retried as many times as its retry policy allows.
+	MachineRetryLimitExceeded = "RetryLimitExceeded"
+)
+
+// reconcileFailedMachine retries a Machine in the Failed phase when its retry policy allows it.
+// Once the backoff has passed, the Machine is put back in the Provisioning phase so that its instance is created again.
+// When the instance had already been created, and was then lost, its Node is deleted and the Machine is first cleared
+// of the details of the lost instance so that a new one is created in its place.
+// Without a retry policy, Failed Machines are left alone, as they always have been.
+func (r *ReconcileMachine) reconcileFailedMachine(ctx context.Context, m *machinev1.Machine, originalConditions machinev1.Conditions) (reconcile.Result, error) {
+	machineName := m.GetName()
+
+	// Annotations set before the webhook validated them may not parse, in which case the Machine is not retried
+	// rather than failing every reconcile.
+	policy, errs := retrypolicy.Parse(m.GetAnnotations(), field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		klog.Warningf("%v: invalid retry policy, not retrying the machine: %v", machineName, errs.ToAggregate())
+		r.eventRecorder.Eventf(m, corev1.EventTypeWarning, "RetryPolicyInvalid", "Invalid retry policy, not retrying the machine: %v", errs.ToAggregate())
+		policy.Limit = 0
+	}
+
+	if policy.Limit == 0 {
+		klog.Warningf("%v: machine has gone %q phase. It won't reconcile", machineName, phaseFailed)
+		return reconcile.Result{}, nil
+	}
+
+	cause := failureCause(m)
+	attempts := retrypolicy.Attempts(m.GetAnnotations())
+	if attempts >= policy.Limit {
+		if retried := conditions.Get(m, MachineFailureRetried); retried != nil && retried.Reason == MachineRetryLimitExceeded {
+			klog.Warningf("%v: machine has gone %q phase and exhausted its %d retries. It won't reconcile", machineName, phaseFailed, policy.Limit)
+			return reconcile.Result{}, nil
+		}
+
+		klog.Warningf("%v: machine is still failing after %d retries, giving up: %v", machineName, attempts, cause)
+		r.eventRecorder.Eventf(m, corev1.EventTypeWarning, "RetryLimitExceeded", "Machine is still failing after %d retries: %v", attempts, cause)
+		conditions.Set(m, conditions.FalseCondition(
+			MachineFailureRetried,
+			MachineRetryLimitExceeded,
+			machinev1.ConditionSeverityError,
+			"Machine is still failing after %d retries: %v", attempts, cause,
+		))
+		return reconcile.Result{}, r.updateStatus(ctx, m, phaseFailed, cause, originalConditions)
+	}
+
+	// The message must not change while waiting, so that the LastTransitionTime marks the start of the wait.
+	backoff := policy.BackoffFor(attempts)
+	conditions.Set(m, conditions.FalseCondition(
+		MachineFailureRetried,
+		MachineWaitingForRetry,
+		machinev1.ConditionSeverityWarning,
+		"Waiting %v before retry %d of %d", backoff, attempts+1, policy.Limit,
+	))
+	waitingSince := conditions.Get(m, MachineFailureRetried).LastTransitionTime
+	if remaining := backoff - r.now().Sub(waitingSince.Time); remaining > 0 {
+		klog.Infof("%v: waiting %v before retry %d of %d of failed machine", machineName, remaining, attempts+1, policy.Limit)
+		if err := r.updateStatus(ctx, m, phaseFailed, cause, originalConditions); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+
+	attempts++
+	// Adopted instances are never recreated, the retry looks for the instance again instead.
+	// The instances of Machines failed by a provisioning timeout still exist, the retry waits for them again instead.
+	recreate := machineIsProvisioned(m) && !machines.IsAdoptingInstance(m) && !isProvisioningTimeout(cause)
+
+	// The Node of the lost instance would otherwise be left behind, unlinked from any Machine.
+	if recreate && m.Status.NodeRef != nil {
+		klog.Infof("%v: deleting node %q of the lost instance", machineName, m.Status.NodeRef.Name)
+		if err := r.deleteNode(ctx, m.Status.NodeRef.Name); err != nil {
+			return reconcile.Result{}, fmt.Errorf("%v: could not delete the node of the lost instance: %w", machineName, err)
+		}
+	}
+
+	patchBase := client.MergeFrom(m.DeepCopy())
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[retrypolicy.FailedRetryAttemptsAnnotation] = strconv.Itoa(attempts)
+	if recreate {
+		m.Spec.ProviderID = nil
+	}
+	if err := r.Client.Patch(ctx, m, patchBase); err != nil {
+		return reconcile.Result{}, fmt.Errorf("%v: could not record retry attempt: %w", machineName, err)
+	}
+
+	if recreate {
+		// The lost instance must be forgotten, otherwise the machine would be failed again straight away.
+		statusPatchBase := client.MergeFrom(m.DeepCopy())
+		m.Status.Addresses = nil
+		m.Status.NodeRef = nil
+		if err := r.Client.Status().Patch(ctx, m, statusPatchBase); err != nil {
+			return reconcile.Result{}, fmt.Errorf("%v: could not clear the lost instance from the machine status: %w", machineName, err)
+		}
+		// The provisioning timeouts apply again to the new instance and to the registration of its Node.
+		conditions.Delete(m, MachineNodeRegistrationTimeout)
+	}
+
+	action := "Retrying"
+	if recreate {
+		action = "Recreating"
+	}
+	klog.Infof("%v: %s failed machine, attempt %d of %d: %v", machineName, action, attempts, policy.Limit, cause)
+	r.eventRecorder.Eventf(m, corev1.EventTypeNormal, action+"FailedMachine", "%s failed machine, attempt %d of %d: %v", action, attempts, policy.Limit, cause)
+	conditions.Set(m, &machinev1.Condition{
+		Type:     MachineFailureRetried,
+		Status:   corev1.ConditionTrue,
+		Reason:   MachineRetryAttempted,
+		Severity: machinev1.ConditionSeverityNone,
+		Message:  fmt.Sprintf("%s failed machine, attempt %d of %d: %v", action, attempts, policy.Limit, cause),
+	})
+
+	return reconcile.Result{}, r.updateStatus(ctx, m, phaseProvisioning, nil, originalConditions)
+}
+
+// failureCause rebuilds the error which caused the Machine to fail from its status,
+// so that it is preserved by status updates made while the Machine remains Failed.
+func failureCause(m *machinev1.Machine) error {
+	message := pointer.StringDeref(m.Status.ErrorMessage, "unknown failure")
+	if m.Status.ErrorReason != nil {
+		return &MachineError{Reason: *m.Status.ErrorReason, Message: message}
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,181 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
+)
+
+func TestReconcileFailedMachine(t *testing.T) {
+	waitedLongEnough := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+
+	failedMachine := func(transforms ...func(m *machinev1.Machine)) *machinev1.Machine {
+		m := getMachine("failed", phaseFailed)
+		m.Status.NodeRef = nil
+		m.Status.ErrorReason = machineStatusErrorPtr(machinev1.InvalidConfigurationMachineError)
+		m.Status.ErrorMessage = pointer.String("subnet not found")
+		for _, transform := range transforms {
+			transform(m)
+		}
+		return m
+	}
+	withRetryLimit := func(limit string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.Annotations[retrypolicy.FailedRetryLimitAnnotation] = limit
+		}
+	}
+	withAttempts := func(attempts string) func(m *machinev1.Machine) {
+		return func(m *machinev1.Machine) {
+			m.Annotations[retrypolicy.FailedRetryAttemptsAnnotation] = attempts
+		}
+	}
+	waitedForRetry := func(m *machinev1.Machine) {
+		m.Status.Conditions = machinev1.Conditions{{
+			Type:               MachineFailureRetried,
+			Status:             corev1.ConditionFalse,
+			Reason:             MachineWaitingForRetry,
+			Severity:           machinev1.ConditionSeverityWarning,
+			Message:            "Waiting 1m0s before retry 1 of 3",
+			LastTransitionTime: waitedLongEnough,
+		}}
+	}
+	provisioned := func(m *machinev1.Machine) {
+		m.Spec.ProviderID = pointer.String("aws:///us-east-1a/i-lost")
+		m.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}
+		m.Status.NodeRef = &corev1.ObjectReference{Name: "lost"}
+	}
+
+	testCases := []struct {
+		name             string
+		machine          *machinev1.Machine
+		expectRequeue    bool
+		expectedPhase    string
+		expectedAttempts string
+		expectedReason   string
+		expectedEvent    string
+		expectRecreated  bool
+	}{
+		{
+			name:          "without a retry policy",
+			machine:       failedMachine(),
+			expectedPhase: phaseFailed,
+		},
+		{
+			name:             "with an invalid retry policy",
+			machine:          failedMachine(withRetryLimit("3"), withAttempts("none"), waitedForRetry),
+			expectedPhase:    phaseFailed,
+			expectedAttempts: "none",
+			expectedReason:   MachineWaitingForRetry,
+			expectedEvent:    "RetryPolicyInvalid",
+		},
+		{
+			name:           "with a retry policy, before the backoff has passed",
+			machine:        failedMachine(withRetryLimit("3")),
+			expectRequeue:  true,
+			expectedPhase:  phaseFailed,
+			expectedReason: MachineWaitingForRetry,
+		},
+		{
+			name:             "with a retry policy, once the backoff has passed",
+			machine:          failedMachine(withRetryLimit("3"), waitedForRetry),
+			expectedPhase:    phaseProvisioning,
+			expectedAttempts: "1",
+			expectedReason:   MachineRetryAttempted,
+			expectedEvent:    "RetryingFailedMachine",
+		},
+		{
+			name:             "with a retry policy, once the backoff has passed and the instance was lost",
+			machine:          failedMachine(withRetryLimit("3"), waitedForRetry, provisioned),
+			expectedPhase:    phaseProvisioning,
+			expectedAttempts: "1",
+			expectedReason:   MachineRetryAttempted,
+			expectedEvent:    "RecreatingFailedMachine",
+			expectRecreated:  true,
+		},
+		{
+			name:             "with a retry policy, once all the retries have been attempted",
+			machine:          failedMachine(withRetryLimit("3"), withAttempts("3")),
+			expectedPhase:    phaseFailed,
+			expectedAttempts: "3",
+			expectedReason:   MachineRetryLimitExceeded,
+			expectedEvent:    "RetryLimitExceeded",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			lostNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "lost"}}
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileMachine{
+				Client:        fake.NewFakeClientWithScheme(scheme.Scheme, tc.machine, lostNode),
+				scheme:        scheme.Scheme,
+				eventRecorder: recorder,
+				actuator:      newTestActuator(),
+			}
+
+			result, err := r.reconcileFailedMachine(ctx, tc.machine, tc.machine.Status.Conditions.DeepCopy())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.RequeueAfter > 0).To(Equal(tc.expectRequeue))
+
+			updated := &machinev1.Machine{}
+			g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: tc.machine.Namespace, Name: tc.machine.Name}, updated)).To(Succeed())
+			g.Expect(updated.Status.Phase).To(Equal(pointer.String(tc.expectedPhase)))
+			g.Expect(updated.Annotations[retrypolicy.FailedRetryAttemptsAnnotation]).To(Equal(tc.expectedAttempts))
+
+			if tc.expectedPhase == phaseFailed {
+				g.Expect(updated.Status.ErrorReason).To(Equal(machineStatusErrorPtr(machinev1.InvalidConfigurationMachineError)))
+				g.Expect(updated.Status.ErrorMessage).To(Equal(pointer.String("subnet not found")))
+			} else {
+				g.Expect(updated.Status.ErrorReason).To(BeNil())
+				g.Expect(updated.Status.ErrorMessage).To(BeNil())
+			}
+
+			retried := conditions.Get(updated, MachineFailureRetried)
+			if tc.expectedReason == "" {
+				g.Expect(retried).To(BeNil())
+			} else {
+				g.Expect(retried).ToNot(BeNil())
+				g.Expect(retried.Reason).To(Equal(tc.expectedReason))
+			}
+
+			if tc.expectedEvent == "" {
+				g.Expect(recorder.Events).ToNot(Receive())
+			} else {
+				g.Expect(recorder.Events).To(Receive(ContainSubstring(tc.expectedEvent)))
+			}
+
+			if tc.expectRecreated {
+				g.Expect(updated.Spec.ProviderID).To(BeNil())
+				g.Expect(updated.Status.Addresses).To(BeEmpty())
+				g.Expect(updated.Status.NodeRef).To(BeNil())
+			}
+
+			err = r.Client.Get(ctx, types.NamespacedName{Name: lostNode.Name}, &corev1.Node{})
+			if tc.expectRecreated {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "the node of the lost instance should be deleted")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func machineStatusErrorPtr(err machinev1.MachineStatusError) *machinev1.MachineStatusError {
+	return &err
+}
@@ -0,0 +1,113 @@
+package machine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+)
+
+const (
+	instanceSnapshotHit      = "hit"
+	instanceSnapshotMiss     = "miss"
+	instanceSnapshotFallback = "fallback"
+)
+
+// instanceSnapshotTTL is how long a snapshot of the instances is used before the instances are listed again.
+// It is shorter than the requeue of the machines, so that each periodic check sees a fresh snapshot.
+var instanceSnapshotTTL = 20 * time.Second
+
+// instanceSnapshot serves the existence of instances from a list of all the instances of the cluster, shared by all
+// machines and listed again once it is older than its TTL.
+// Only instances found in the snapshot are trusted: an instance missing from the snapshot may have been created
+// after it was listed, so it is looked up individually.
+type instanceSnapshot struct {
+	lister InstanceLister
+	ttl    time.Duration
+
+	// nowFunc is used to mock time in testing. It should be nil in production.
+	nowFunc func() time.Time
+
+	lock      sync.Mutex
+	instances sets.String
+	listed    bool
+	takenAt   time.Time
+}
+
+func newInstanceSnapshot(lister InstanceLister) *instanceSnapshot {
+	return &instanceSnapshot{
+		lister: lister,
+		ttl:    instanceSnapshotTTL,
+	}
+}
+
+// now is used to get the current time. If the snapshot nowFunc is not nil this will be used instead of time.Now().
+func (s *instanceSnapshot) now() time.Time {
+	if s.nowFunc != nil {
+		return s.nowFunc()
+	}
+	return time.Now()
+}
+
+// contains returns true if the instance of the machine is in the snapshot, listing the instances again if the
+// snapshot has expired. When it returns false, the instance must be looked up individually.
+func (s *instanceSnapshot) contains(ctx context.Context, m *machinev1.Machine) bool {
+	id := s.lister.InstanceID(ctx, m)
+	if id == "" {
+		metrics.InstanceSnapshotLookupsTotal.WithLabelValues(instanceSnapshotMiss).Inc()
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	if now.Sub(s.takenAt) >= s.ttl {
+		instances, err := s.lister.ListInstances(ctx)
+		if throttled := asThrottledError(err); throttled != nil {
+			// A throttled list is not a failure, the instances are listed again by the next lookup.
+			klog.V(3).Infof("not listing instances: %v", throttled)
+			s.instances = nil
+			s.listed = false
+			metrics.InstanceSnapshotLookupsTotal.WithLabelValues(instanceSnapshotFallback).Inc()
+			return false
+		}
+		// A failed list is not retried before the TTL has passed, so that a provider API outage does not
+		// add a list call to each lookup.
+		s.takenAt = now
+		s.instances = instances
+		s.listed = err == nil
+		if err != nil {
+			klog.Errorf("failed to list instances, falling back to checking instances individually: %v", err)
+			metrics.InstanceSnapshotListFailuresTotal.Inc()
+		}
+	}
+
+	if !s.listed {
+		metrics.InstanceSnapshotLookupsTotal.WithLabelValues(instanceSnapshotFallback).Inc()
+		return false
+	}
+
+	metrics.InstanceSnapshotAgeSeconds.Set(now.Sub(s.takenAt).Seconds())
+	if !s.instances.Has(id) {
+		metrics.InstanceSnapshotLookupsTotal.WithLabelValues(instanceSnapshotMiss).Inc()
+		return false
+	}
+	metrics.InstanceSnapshotLookupsTotal.WithLabelValues(instanceSnapshotHit).Inc()
+	return true
+}
+
+// instanceExists checks if the instance of the machine exists, from the instance snapshot when the actuator
+// can list instances, or with the actuator otherwise.
+func (r *ReconcileMachine) instanceExists(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	if r.instanceSnapshot != nil && r.instanceSnapshot.contains(ctx, m) {
+		klog.V(4).Infof("%v: instance found in the instance snapshot", m.GetName())
+		return true, nil
+	}
+	return r.actuator.Exists(ctx, m)
+}
@@ -0,0 +1,159 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+)
+
+type fakeInstanceLister struct {
+	instances sets.String
+	err       error
+	listCount int
+}
+
+func (l *fakeInstanceLister) ListInstances(context.Context) (sets.String, error) {
+	l.listCount++
+	return l.instances, l.err
+}
+
+func (l *fakeInstanceLister) InstanceID(_ context.Context, m *machinev1.Machine) string {
+	return pointer.StringDeref(m.Spec.ProviderID, "")
+}
+
+func TestInstanceExists(t *testing.T) {
+	machine := func(providerID string) *machinev1.Machine {
+		m := getMachine("machine", phaseRunning)
+		if providerID != "" {
+			m.Spec.ProviderID = pointer.String(providerID)
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name                    string
+		lister                  *fakeInstanceLister
+		machine                 *machinev1.Machine
+		existsValue             bool
+		expectedExists          bool
+		expectedExistsCallCount int64
+	}{
+		{
+			name:                    "without an instance lister",
+			machine:                 machine("fake://a"),
+			existsValue:             true,
+			expectedExists:          true,
+			expectedExistsCallCount: 1,
+		},
+		{
+			name:           "with an instance in the snapshot",
+			lister:         &fakeInstanceLister{instances: sets.NewString("fake://a", "fake://b")},
+			machine:        machine("fake://a"),
+			expectedExists: true,
+		},
+		{
+			name:                    "with an instance which is not in the snapshot",
+			lister:                  &fakeInstanceLister{instances: sets.NewString("fake://b")},
+			machine:                 machine("fake://a"),
+			existsValue:             true,
+			expectedExists:          true,
+			expectedExistsCallCount: 1,
+		},
+		{
+			name:                    "with an instance which does not exist",
+			lister:                  &fakeInstanceLister{instances: sets.NewString("fake://b")},
+			machine:                 machine("fake://a"),
+			expectedExistsCallCount: 1,
+		},
+		{
+			name:                    "with a machine without instance ID",
+			lister:                  &fakeInstanceLister{instances: sets.NewString("fake://a")},
+			machine:                 machine(""),
+			existsValue:             true,
+			expectedExists:          true,
+			expectedExistsCallCount: 1,
+		},
+		{
+			name:                    "when the instances can not be listed",
+			lister:                  &fakeInstanceLister{err: errors.New("quota exceeded")},
+			machine:                 machine("fake://a"),
+			existsValue:             true,
+			expectedExists:          true,
+			expectedExistsCallCount: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			act := newTestActuator()
+			act.ExistsValue = tc.existsValue
+			r := &ReconcileMachine{actuator: act}
+			if tc.lister != nil {
+				r.instanceSnapshot = newInstanceSnapshot(tc.lister)
+			}
+
+			exists, err := r.instanceExists(ctx, tc.machine)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(exists).To(Equal(tc.expectedExists))
+			g.Expect(act.ExistsCallCount).To(Equal(tc.expectedExistsCallCount))
+		})
+	}
+}
+
+func TestInstanceSnapshotTTL(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	lister := &fakeInstanceLister{instances: sets.NewString("fake://a", "fake://b")}
+	snapshot := newInstanceSnapshot(lister)
+	snapshot.nowFunc = func() time.Time { return now }
+
+	a := getMachine("a", phaseRunning)
+	a.Spec.ProviderID = pointer.String("fake://a")
+	b := getMachine("b", phaseRunning)
+	b.Spec.ProviderID = pointer.String("fake://b")
+
+	g.Expect(snapshot.contains(ctx, a)).To(BeTrue())
+	g.Expect(snapshot.contains(ctx, b)).To(BeTrue())
+	g.Expect(lister.listCount).To(Equal(1), "the snapshot should be shared by all machines")
+
+	// Instances deleted since the snapshot was listed are only seen once it has expired.
+	lister.instances = sets.NewString("fake://b")
+	now = now.Add(instanceSnapshotTTL - time.Second)
+	g.Expect(snapshot.contains(ctx, a)).To(BeTrue())
+	g.Expect(lister.listCount).To(Equal(1))
+
+	now = now.Add(time.Second)
+	g.Expect(snapshot.contains(ctx, a)).To(BeFalse())
+	g.Expect(lister.listCount).To(Equal(2))
+
+	// Failed lists are not retried before the TTL has passed.
+	lister.err = errors.New("quota exceeded")
+	now = now.Add(instanceSnapshotTTL)
+	g.Expect(snapshot.contains(ctx, b)).To(BeFalse())
+	g.Expect(snapshot.contains(ctx, b)).To(BeFalse())
+	g.Expect(lister.listCount).To(Equal(3))
+
+	lister.err = nil
+	now = now.Add(instanceSnapshotTTL)
+	g.Expect(snapshot.contains(ctx, b)).To(BeTrue())
+	g.Expect(lister.listCount).To(Equal(4))
+
+	// Throttled lists are retried by the next lookup.
+	lister.err = &ThrottledError{Operation: operationListInstances, Reason: MachineActuatorMaxInFlight, RequeueAfter: maxInFlightRequeueAfter}
+	now = now.Add(instanceSnapshotTTL)
+	g.Expect(snapshot.contains(ctx, b)).To(BeFalse())
+	g.Expect(lister.listCount).To(Equal(5))
+
+	lister.err = nil
+	g.Expect(snapshot.contains(ctx, b)).To(BeTrue())
+	g.Expect(lister.listCount).To(Equal(6))
+}
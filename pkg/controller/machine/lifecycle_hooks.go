@@ -0,0 +1,155 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+)
+
+const (
+	// MachineLifecycleHookTimedOut is set on the Machine when one of its lifecycle hooks held
+	// the deletion of the Machine for longer than the hook's timeout.
+	MachineLifecycleHookTimedOut machinev1.ConditionType = "LifecycleHookTimedOut"
+
+	// MachineLifecycleHookRemoved is the reason set on the LifecycleHookTimedOut condition
+	// when the expired hooks were removed, following the Remove timeout policy.
+	MachineLifecycleHookRemoved = "HookRemoved"
+
+	// MachineLifecycleHookFailed is the reason set on the LifecycleHookTimedOut condition
+	// when the expired hooks were left in place, following the Fail timeout policy.
+	MachineLifecycleHookFailed = "HookFailed"
+
+	// MachinePreCreateHookSucceeded is set to false on the Machine while pre-create hooks hold the creation of its instance.
+	MachinePreCreateHookSucceeded machinev1.ConditionType = "PreCreateHookSucceeded"
+
+	// MachinePostProvisionHookSucceeded is set to false on the Machine while post-provision hooks keep it out of the Running phase.
+	MachinePostProvisionHookSucceeded machinev1.ConditionType = "PostProvisionHookSucceeded"
+)
+
+// lifecycleHookTimeouts enforces the timeouts of the lifecycle hooks holding the deletion of a Machine.
+type lifecycleHookTimeouts struct {
+	client        client.Client
+	eventRecorder record.EventRecorder
+	now           time.Time
+}
+
+// reconcile applies the timeout policy to the hooks of the given stage which have expired.
+// It returns whether the hooks of the stage still hold the Machine and, when some of the remaining
+// hooks have a timeout, how long until the next one expires.
+func (t *lifecycleHookTimeouts) reconcile(ctx context.Context, m *machinev1.Machine, stage lifecyclehooks.Stage) (bool, time.Duration, error) {
+	hooks := lifecyclehooks.Hooks(m, stage)
+	if len(hooks) == 0 {
+		return false, 0, nil
+	}
+
+	// Annotations set before the webhook validated them may not parse, in which case the hooks
+	// hold the Machine without a timeout rather than failing every reconcile.
+	timeouts, errs := lifecyclehooks.ParseTimeouts(m.GetAnnotations(), field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		klog.Warningf("%v: invalid lifecycle hook timeouts, ignoring them: %v", m.GetName(), errs.ToAggregate())
+		t.eventRecorder.Eventf(m, corev1.EventTypeWarning, "LifecycleHookTimeoutsInvalid", "Invalid lifecycle hook timeouts, ignoring them: %v", errs.ToAggregate())
+		return true, 0, nil
+	}
+
+	heldSince, held := lifecyclehooks.HeldSince(m, stage)
+	if !held {
+		return true, 0, nil
+	}
+	heldFor := t.now.Sub(heldSince)
+
+	var expired, remaining []machinev1.LifecycleHook
+	var nextExpiry time.Duration
+	for _, hook := range hooks {
+		timeout, ok := timeouts.For(stage)[hook.Name]
+		switch {
+		case !ok:
+			remaining = append(remaining, hook)
+		case heldFor > timeout:
+			expired = append(expired, hook)
+		default:
+			remaining = append(remaining, hook)
+			if untilExpiry := timeout - heldFor; nextExpiry == 0 || untilExpiry < nextExpiry {
+				nextExpiry = untilExpiry
+			}
+		}
+	}
+
+	if len(expired) == 0 {
+		return true, nextExpiry, nil
+	}
+
+	descriptions := []string{}
+	for _, hook := range expired {
+		descriptions = append(descriptions, fmt.Sprintf("%s hook %q owned by %q (timeout %v)", stage, hook.Name, hook.Owner, timeouts.For(stage)[hook.Name]))
+	}
+
+	if timeouts.Policy == lifecyclehooks.TimeoutPolicyFail {
+		message := fmt.Sprintf("Lifecycle hooks held the machine for longer than their timeout: %s", strings.Join(descriptions, ", "))
+		if !t.setTimedOutCondition(m, MachineLifecycleHookFailed, message) {
+			// The expired hooks have already been reported.
+			return true, nextExpiry, nil
+		}
+
+		klog.Warningf("%v: %s", m.GetName(), message)
+		t.eventRecorder.Eventf(m, corev1.EventTypeWarning, "LifecycleHookTimedOut", "%s", message)
+		for range expired {
+			metrics.RegisterLifecycleHookTimeout(stage, timeouts.Policy)
+		}
+		if err := t.client.Status().Update(ctx, m); err != nil {
+			return true, 0, fmt.Errorf("could not update machine status: %w", err)
+		}
+		return true, nextExpiry, nil
+	}
+
+	patchBase := client.MergeFrom(m.DeepCopy())
+	if stage == lifecyclehooks.PreDrain {
+		m.Spec.LifecycleHooks.PreDrain = remaining
+	} else {
+		m.Spec.LifecycleHooks.PreTerminate = remaining
+	}
+	if err := t.client.Patch(ctx, m, patchBase); err != nil {
+		return true, 0, fmt.Errorf("could not remove expired lifecycle hooks: %w", err)
+	}
+
+	message := fmt.Sprintf("Lifecycle hooks removed after holding the machine for longer than their timeout: %s", strings.Join(descriptions, ", "))
+	klog.Warningf("%v: %s", m.GetName(), message)
+	t.eventRecorder.Eventf(m, corev1.EventTypeWarning, "LifecycleHookTimedOut", "%s", message)
+	for range expired {
+		metrics.RegisterLifecycleHookTimeout(stage, timeouts.Policy)
+	}
+
+	t.setTimedOutCondition(m, MachineLifecycleHookRemoved, message)
+	if err := t.client.Status().Update(ctx, m); err != nil {
+		return len(remaining) > 0, 0, fmt.Errorf("could not update machine status: %w", err)
+	}
+
+	return len(remaining) > 0, nextExpiry, nil
+}
+
+// setTimedOutCondition sets the LifecycleHookTimedOut condition and reports whether it changed.
+func (t *lifecycleHookTimeouts) setTimedOutCondition(m *machinev1.Machine, reason, message string) bool {
+	if existing := conditions.Get(m, MachineLifecycleHookTimedOut); existing != nil && existing.Reason == reason && existing.Message == message {
+		return false
+	}
+
+	conditions.Set(m, &machinev1.Condition{
+		Type:     MachineLifecycleHookTimedOut,
+		Status:   corev1.ConditionTrue,
+		Reason:   reason,
+		Severity: machinev1.ConditionSeverityWarning,
+		Message:  message,
+	})
+	return true
+}
@@ -0,0 +1,190 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+)
+
+func TestLifecycleHookTimeouts(t *testing.T) {
+	expiredHook := machinev1.LifecycleHook{Name: "MigrateData", Owner: "storage-operator"}
+	pendingHook := machinev1.LifecycleHook{Name: "example.com/Backup", Owner: "backup-operator"}
+	unboundedHook := machinev1.LifecycleHook{Name: "Unbounded", Owner: "other-operator"}
+
+	testCases := []struct {
+		name                 string
+		hooks                []machinev1.LifecycleHook
+		annotations          map[string]string
+		expectedHeld         bool
+		expectedRequeueAfter time.Duration
+		expectedHooks        []machinev1.LifecycleHook
+		expectedReason       string
+		expectedEvent        bool
+	}{
+		{
+			name:          "with no hooks",
+			expectedHooks: nil,
+		},
+		{
+			name:          "with hooks without timeouts",
+			hooks:         []machinev1.LifecycleHook{unboundedHook},
+			expectedHeld:  true,
+			expectedHooks: []machinev1.LifecycleHook{unboundedHook},
+		},
+		{
+			name:  "with a hook which has not expired yet",
+			hooks: []machinev1.LifecycleHook{pendingHook},
+			annotations: map[string]string{
+				lifecyclehooks.PreDrainHookTimeoutsAnnotation: "example.com/Backup=1h",
+			},
+			expectedHeld:         true,
+			expectedRequeueAfter: 30 * time.Minute,
+			expectedHooks:        []machinev1.LifecycleHook{pendingHook},
+		},
+		{
+			name:  "with an expired hook and the Remove policy",
+			hooks: []machinev1.LifecycleHook{expiredHook, pendingHook},
+			annotations: map[string]string{
+				lifecyclehooks.PreDrainHookTimeoutsAnnotation: "MigrateData=10m,example.com/Backup=1h",
+			},
+			expectedHeld:         true,
+			expectedRequeueAfter: 30 * time.Minute,
+			expectedHooks:        []machinev1.LifecycleHook{pendingHook},
+			expectedReason:       MachineLifecycleHookRemoved,
+			expectedEvent:        true,
+		},
+		{
+			name:  "with the only hook expired and the Remove policy",
+			hooks: []machinev1.LifecycleHook{expiredHook},
+			annotations: map[string]string{
+				lifecyclehooks.PreDrainHookTimeoutsAnnotation: "MigrateData=10m",
+			},
+			expectedHeld:   false,
+			expectedHooks:  []machinev1.LifecycleHook{},
+			expectedReason: MachineLifecycleHookRemoved,
+			expectedEvent:  true,
+		},
+		{
+			name:  "with an expired hook and the Fail policy",
+			hooks: []machinev1.LifecycleHook{expiredHook},
+			annotations: map[string]string{
+				lifecyclehooks.PreDrainHookTimeoutsAnnotation: "MigrateData=10m",
+				lifecyclehooks.HookTimeoutPolicyAnnotation:    string(lifecyclehooks.TimeoutPolicyFail),
+			},
+			expectedHeld:   true,
+			expectedHooks:  []machinev1.LifecycleHook{expiredHook},
+			expectedReason: MachineLifecycleHookFailed,
+			expectedEvent:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := getMachine("machine", phaseDeleting)
+			m.Spec.LifecycleHooks.PreDrain = tc.hooks
+			for key, value := range tc.annotations {
+				m.Annotations[key] = value
+			}
+
+			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, m)
+			recorder := record.NewFakeRecorder(10)
+			timeouts := &lifecycleHookTimeouts{
+				client:        fakeClient,
+				eventRecorder: recorder,
+				now:           m.DeletionTimestamp.Add(30 * time.Minute),
+			}
+
+			held, requeueAfter, err := timeouts.reconcile(ctx, m, lifecyclehooks.PreDrain)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(held).To(Equal(tc.expectedHeld))
+			g.Expect(requeueAfter).To(Equal(tc.expectedRequeueAfter))
+
+			updated := &machinev1.Machine{}
+			g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: m.Name}, updated)).To(Succeed())
+			if len(tc.expectedHooks) == 0 {
+				g.Expect(updated.Spec.LifecycleHooks.PreDrain).To(BeEmpty())
+			} else {
+				g.Expect(updated.Spec.LifecycleHooks.PreDrain).To(Equal(tc.expectedHooks))
+			}
+
+			timedOut := conditions.Get(updated, MachineLifecycleHookTimedOut)
+			if tc.expectedReason == "" {
+				g.Expect(timedOut).To(BeNil())
+			} else {
+				g.Expect(timedOut).ToNot(BeNil())
+				g.Expect(timedOut.Status).To(Equal(corev1.ConditionTrue))
+				g.Expect(timedOut.Reason).To(Equal(tc.expectedReason))
+				g.Expect(timedOut.Message).To(ContainSubstring(`pre-drain hook "MigrateData" owned by "storage-operator" (timeout 10m0s)`))
+			}
+
+			if tc.expectedEvent {
+				g.Expect(recorder.Events).To(Receive(ContainSubstring("LifecycleHookTimedOut")))
+			} else {
+				g.Expect(recorder.Events).ToNot(Receive())
+			}
+		})
+	}
+
+	t.Run("reports a failed hook only once", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := getMachine("machine", phaseDeleting)
+		m.Spec.LifecycleHooks.PreDrain = []machinev1.LifecycleHook{expiredHook}
+		m.Annotations[lifecyclehooks.PreDrainHookTimeoutsAnnotation] = "MigrateData=10m"
+		m.Annotations[lifecyclehooks.HookTimeoutPolicyAnnotation] = string(lifecyclehooks.TimeoutPolicyFail)
+
+		recorder := record.NewFakeRecorder(10)
+		timeouts := &lifecycleHookTimeouts{
+			client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+			eventRecorder: recorder,
+			now:           m.DeletionTimestamp.Add(30 * time.Minute),
+		}
+
+		for i := 0; i < 2; i++ {
+			held, _, err := timeouts.reconcile(ctx, m, lifecyclehooks.PreDrain)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(held).To(BeTrue())
+		}
+		g.Expect(recorder.Events).To(HaveLen(1))
+	})
+
+	t.Run("ignores invalid timeouts", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := getMachine("machine", phaseDeleting)
+		m.Spec.LifecycleHooks.PreDrain = []machinev1.LifecycleHook{expiredHook}
+		m.Annotations[lifecyclehooks.PreDrainHookTimeoutsAnnotation] = "MigrateData=soon"
+
+		fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, m)
+		recorder := record.NewFakeRecorder(10)
+		timeouts := &lifecycleHookTimeouts{
+			client:        fakeClient,
+			eventRecorder: recorder,
+			now:           m.DeletionTimestamp.Add(30 * time.Minute),
+		}
+
+		held, requeueAfter, err := timeouts.reconcile(ctx, m, lifecyclehooks.PreDrain)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(held).To(BeTrue())
+		g.Expect(requeueAfter).To(BeZero())
+		g.Expect(recorder.Events).To(Receive(ContainSubstring("LifecycleHookTimeoutsInvalid")))
+
+		updated := &machinev1.Machine{}
+		g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: m.Name}, updated)).To(Succeed())
+		g.Expect(updated.Spec.LifecycleHooks.PreDrain).To(Equal([]machinev1.LifecycleHook{expiredHook}))
+		g.Expect(conditions.Get(updated, MachineLifecycleHookTimedOut)).To(BeNil())
+	})
+}
@@ -61,7 +61,7 @@ func TestReconcile(t *testing.T) {
 	c = mgr.GetClient()
 
 	a := newTestActuator()
-	recFn := newReconciler(mgr, a)
+	recFn := newReconciler(mgr, a, Options{})
 	if err := add(mgr, recFn, "dummy"); err != nil {
 		t.Fatalf("error adding controller to manager: %v", err)
 	}
@@ -0,0 +1,233 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/kubectl/pkg/drain"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+)
+
+const (
+	// MachineMaintenance reports the maintenance of a Machine, requested by the maintenance annotation.
+	// It is true once the Node of the Machine has been cordoned and drained, and false while the drain is held by a
+	// drain budget, while the Node is being drained, or once the maintenance has ended and the Node has been uncordoned.
+	MachineMaintenance machinev1.ConditionType = "Maintenance"
+
+	// MachineMaintenanceNodeDrained is the reason set on the Maintenance condition once the Node has been cordoned and drained.
+	MachineMaintenanceNodeDrained = "NodeDrained"
+
+	// MachineMaintenanceDraining is the reason set on the Maintenance condition while the Node is being drained.
+	// The progress of the drain is recorded in the drain progress annotation.
+	MachineMaintenanceDraining = "Draining"
+
+	// MachineMaintenanceEnded is the reason set on the Maintenance condition once the maintenance annotation has been
+	// removed and the Node has been uncordoned.
+	MachineMaintenanceEnded = "MaintenanceEnded"
+
+	// MaintenanceCordonedNodeAnnotation records the name of the Node cordoned by the maintenance of the Machine.
+	// It is only set when the Node was schedulable before the maintenance, so that a Node cordoned by an administrator
+	// is left cordoned once the maintenance ends.
+	MaintenanceCordonedNodeAnnotation = "machine.openshift.io/maintenance-cordoned-node"
+)
+
+// reconcileMaintenance cordons and drains the Node of a Machine in maintenance, and uncordons it once the maintenance
+// annotation is removed. The Node is drained according to the drain policy and the drain budgets of the Machine,
+// but the drain timeout and the pre-drain lifecycle hooks, which only apply to deleted Machines, are ignored.
+func (d *machineDrainController) reconcileMaintenance(ctx context.Context, m *machinev1.Machine) (reconcile.Result, error) {
+	maintenance := conditions.Get(m, MachineMaintenance)
+
+	if !machines.IsInMaintenance(m) {
+		if maintenance == nil || maintenance.Reason == MachineMaintenanceEnded {
+			return reconcile.Result{}, nil
+		}
+
+		cordonedNode, cordoned := m.Annotations[MaintenanceCordonedNodeAnnotation]
+		if m.Status.NodeRef != nil {
+			if cordoned && cordonedNode == m.Status.NodeRef.Name {
+				if err := d.uncordonNode(ctx, m.Status.NodeRef.Name); err != nil {
+					klog.Errorf("%v: failed to uncordon node after maintenance: %v", m.Name, err)
+					return reconcile.Result{}, err
+				}
+				d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "MaintenanceEnded", "Node %q uncordoned after maintenance", m.Status.NodeRef.Name)
+			} else {
+				klog.Infof("%v: not uncordoning node %q after maintenance: the maintenance did not cordon it", m.Name, m.Status.NodeRef.Name)
+			}
+		}
+
+		// The annotation is patched before the condition is set, as the patch resets the status.
+		if cordoned {
+			patchBase := client.MergeFrom(m.DeepCopy())
+			delete(m.Annotations, MaintenanceCordonedNodeAnnotation)
+			if err := d.Client.Patch(ctx, m, patchBase); err != nil {
+				return reconcile.Result{}, fmt.Errorf("could not clear the cordoned node: %w", err)
+			}
+		}
+
+		klog.Infof("%v: maintenance has ended", m.Name)
+		conditions.MarkFalse(m, MachineMaintenance, MachineMaintenanceEnded, machinev1.ConditionSeverityNone, "Maintenance has ended")
+		if err := d.Client.Status().Update(ctx, m); err != nil {
+			return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if maintenance != nil && maintenance.Status == corev1.ConditionTrue {
+		return reconcile.Result{}, nil
+	}
+
+	if m.Status.NodeRef == nil {
+		// The Machine is reconciled again once it is linked to its Node.
+		klog.V(3).Infof("%v: not draining machine for maintenance: the machine has no node yet", m.Name)
+		return reconcile.Result{}, nil
+	}
+	nodeName := m.Status.NodeRef.Name
+
+	policy := drainPolicy(m, d.eventRecorder)
+
+	// The drain budgets are only checked before the drain starts, as a drain which was let through keeps its place in them.
+	if maintenance == nil || maintenance.Reason != MachineMaintenanceDraining {
+		budgets, err := d.drainBudgetsFor(ctx, m, policy)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("could not determine drain budgets: %w", err)
+		}
+		budget, draining, err := d.blockingDrainBudget(ctx, m, budgets)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("could not check drain budgets: %w", err)
+		}
+		if budget != nil {
+			message := fmt.Sprintf("Drain for maintenance held by the %s drain budget, which allows %d concurrent drains: already draining %s",
+				budget.name, budget.maxConcurrent, strings.Join(draining, ", "))
+			klog.Infof("%v: not draining machine for maintenance: %s", m.Name, message)
+			d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "DrainBudgetExceeded", "%s", message)
+			conditions.Set(m, conditions.FalseCondition(
+				MachineMaintenance,
+				MachineDrainBudgetExceeded,
+				machinev1.ConditionSeverityInfo,
+				"%s", message,
+			))
+			if err := d.Client.Status().Update(ctx, m); err != nil {
+				return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
+			}
+			return reconcile.Result{RequeueAfter: 20 * time.Second}, nil
+		}
+
+		if err := d.recordMaintenanceCordon(ctx, m, nodeName); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// The message must not change between attempts, so that a failed attempt does not trigger another one straight away.
+	conditions.Set(m, conditions.FalseCondition(
+		MachineMaintenance,
+		MachineMaintenanceDraining,
+		machinev1.ConditionSeverityInfo,
+		"Draining node %q for maintenance", nodeName,
+	))
+
+	progress, err := d.drainNode(ctx, m, policy)
+	if err != nil {
+		klog.Errorf("%v: failed to drain node for maintenance: %v", m.Name, err)
+		message := err.Error()
+		if progress != nil {
+			message = fmt.Sprintf("%v: %v", progress, err)
+			if err := d.patchDrainProgress(ctx, m, progress); err != nil {
+				klog.Errorf("%v: could not record drain progress: %v", m.Name, err)
+			}
+		}
+		if err := d.Client.Status().Update(ctx, m); err != nil {
+			klog.Errorf("%v: could not update machine status: %v", m.Name, err)
+		}
+		d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "MaintenanceDrainRequeued", "Node drain for maintenance requeued: %s", message)
+		return delayIfRequeueAfterError(err)
+	}
+
+	if _, ok := m.Annotations[DrainProgressAnnotation]; ok {
+		if err := d.patchDrainProgress(ctx, m, nil); err != nil {
+			return reconcile.Result{}, fmt.Errorf("could not clear drain progress: %w", err)
+		}
+	}
+
+	klog.Infof("%v: node %q drained for maintenance", m.Name, nodeName)
+	d.eventRecorder.Eventf(m, corev1.EventTypeNormal, "MaintenanceStarted", "Node %q cordoned and drained for maintenance", nodeName)
+	conditions.Set(m, &machinev1.Condition{
+		Type:    MachineMaintenance,
+		Status:  corev1.ConditionTrue,
+		Reason:  MachineMaintenanceNodeDrained,
+		Message: fmt.Sprintf("Node %q is cordoned and drained for maintenance", nodeName),
+	})
+	if err := d.Client.Status().Update(ctx, m); err != nil {
+		return reconcile.Result{}, fmt.Errorf("could not update machine status: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// recordMaintenanceCordon records that the maintenance cordons the Node, unless the Node is already cordoned.
+// The Node is read straight from the API, so that a Node cordoned by an administrator just before is not uncordoned later.
+func (d *machineDrainController) recordMaintenanceCordon(ctx context.Context, m *machinev1.Machine, nodeName string) error {
+	if m.Annotations[MaintenanceCordonedNodeAnnotation] == nodeName {
+		// A previous attempt cordoned the Node already.
+		return nil
+	}
+
+	node := &corev1.Node{}
+	if err := d.apiReader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get node %q: %w", nodeName, err)
+	}
+	if node.Spec.Unschedulable {
+		klog.Infof("%v: node %q is already cordoned, it will be left cordoned after maintenance", m.Name, nodeName)
+		return nil
+	}
+
+	patchBase := client.MergeFrom(m.DeepCopy())
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[MaintenanceCordonedNodeAnnotation] = nodeName
+	if err := d.Client.Patch(ctx, m, patchBase); err != nil {
+		return fmt.Errorf("could not record the cordoned node: %w", err)
+	}
+	return nil
+}
+
+// uncordonNode makes the Node schedulable again once the maintenance of its Machine has ended.
+func (d *machineDrainController) uncordonNode(ctx context.Context, nodeName string) error {
+	kubeClient, err := kubernetes.NewForConfig(d.config)
+	if err != nil {
+		return fmt.Errorf("unable to build kube client: %v", err)
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			klog.Infof("Could not find node from noderef, it may have been deleted during the maintenance: %v", nodeName)
+			return nil
+		}
+		return fmt.Errorf("unable to get node %q: %v", nodeName, err)
+	}
+
+	drainer := &drain.Helper{
+		Ctx:    ctx,
+		Client: kubeClient,
+		Out:    writer{klog.Info},
+		ErrOut: writer{klog.Error},
+	}
+	if err := drain.RunCordonOrUncordon(drainer, node, false); err != nil {
+		return fmt.Errorf("unable to uncordon node %q: %v", nodeName, err)
+	}
+	return nil
+}
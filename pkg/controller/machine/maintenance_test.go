@@ -0,0 +1,217 @@
+package machine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+)
+
+func TestReconcileMaintenance(t *testing.T) {
+	drainedForMaintenance := func(m *machinev1.Machine) {
+		m.Status.Conditions = machinev1.Conditions{{
+			Type:               MachineMaintenance,
+			Status:             corev1.ConditionTrue,
+			Reason:             MachineMaintenanceNodeDrained,
+			Message:            "Node \"foo\" is cordoned and drained for maintenance",
+			LastTransitionTime: metav1.Now(),
+		}}
+	}
+	inMaintenance := func(m *machinev1.Machine) {
+		m.Annotations[machines.MaintenanceAnnotation] = "hypervisor upgrade"
+	}
+	withoutNode := func(m *machinev1.Machine) {
+		m.Status.NodeRef = nil
+	}
+	cordonedByMaintenance := func(m *machinev1.Machine) {
+		m.Annotations[MaintenanceCordonedNodeAnnotation] = m.Status.NodeRef.Name
+	}
+	// The other control plane machine is drained for maintenance already.
+	otherMaster := getMachine("master", phaseRunning)
+	otherMaster.Status.NodeRef = &corev1.ObjectReference{Name: "master"}
+	conditions.Set(otherMaster, &machinev1.Condition{Type: MachineMaintenance, Status: corev1.ConditionTrue, Reason: MachineMaintenanceNodeDrained})
+
+	testCases := []struct {
+		name                        string
+		transforms                  []func(m *machinev1.Machine)
+		objects                     []runtime.Object
+		expectedCondition           *machinev1.Condition
+		expectedEvent               string
+		expectedCordonedAnnotation  bool
+		expectedNodeAPIRequests     bool
+		expectedRequeueAfterNonZero bool
+	}{
+		{
+			name: "with a machine which is not in maintenance",
+		},
+		{
+			name:       "with a machine in maintenance which has no node yet",
+			transforms: []func(m *machinev1.Machine){inMaintenance, withoutNode},
+		},
+		{
+			name:       "with a machine in maintenance which has already been drained",
+			transforms: []func(m *machinev1.Machine){inMaintenance, drainedForMaintenance},
+			expectedCondition: &machinev1.Condition{
+				Type:   MachineMaintenance,
+				Status: corev1.ConditionTrue,
+				Reason: MachineMaintenanceNodeDrained,
+			},
+		},
+		{
+			name:       "with a machine in maintenance which has an invalid drain policy",
+			transforms: []func(m *machinev1.Machine){inMaintenance, func(m *machinev1.Machine) { m.Annotations["machine.openshift.io/drain-timeout"] = "forever" }},
+			// The node is drained with the default drain policy, it is already gone so the drain succeeds straight away.
+			expectedCondition: &machinev1.Condition{
+				Type:   MachineMaintenance,
+				Status: corev1.ConditionTrue,
+				Reason: MachineMaintenanceNodeDrained,
+			},
+			expectedEvent:           "DrainPolicyInvalid",
+			expectedNodeAPIRequests: true,
+		},
+		{
+			name:       "with a machine in maintenance whose node is schedulable",
+			transforms: []func(m *machinev1.Machine){inMaintenance},
+			objects:    []runtime.Object{newNode("foo")},
+			expectedCondition: &machinev1.Condition{
+				Type:   MachineMaintenance,
+				Status: corev1.ConditionTrue,
+				Reason: MachineMaintenanceNodeDrained,
+			},
+			expectedEvent:              "MaintenanceStarted",
+			expectedCordonedAnnotation: true,
+			expectedNodeAPIRequests:    true,
+		},
+		{
+			name:       "with a machine in maintenance whose node is already cordoned",
+			transforms: []func(m *machinev1.Machine){inMaintenance},
+			objects:    []runtime.Object{newNode("foo", cordoned)},
+			expectedCondition: &machinev1.Condition{
+				Type:   MachineMaintenance,
+				Status: corev1.ConditionTrue,
+				Reason: MachineMaintenanceNodeDrained,
+			},
+			expectedEvent:           "MaintenanceStarted",
+			expectedNodeAPIRequests: true,
+		},
+		{
+			name:       "with a control plane machine in maintenance while another control plane machine is in maintenance",
+			transforms: []func(m *machinev1.Machine){inMaintenance},
+			objects:    []runtime.Object{newNode("foo", controlPlaneLabel), newNode("master", controlPlaneLabel, cordoned), otherMaster},
+			expectedCondition: &machinev1.Condition{
+				Type:     MachineMaintenance,
+				Status:   corev1.ConditionFalse,
+				Reason:   MachineDrainBudgetExceeded,
+				Severity: machinev1.ConditionSeverityInfo,
+			},
+			expectedEvent:               "DrainBudgetExceeded",
+			expectedRequeueAfterNonZero: true,
+		},
+		{
+			name:       "once the maintenance has ended, and the node is gone",
+			transforms: []func(m *machinev1.Machine){drainedForMaintenance, withoutNode},
+			expectedCondition: &machinev1.Condition{
+				Type:     MachineMaintenance,
+				Status:   corev1.ConditionFalse,
+				Reason:   MachineMaintenanceEnded,
+				Severity: machinev1.ConditionSeverityNone,
+			},
+		},
+		{
+			name:       "once the maintenance has ended, when the maintenance cordoned the node",
+			transforms: []func(m *machinev1.Machine){drainedForMaintenance, cordonedByMaintenance},
+			expectedCondition: &machinev1.Condition{
+				Type:     MachineMaintenance,
+				Status:   corev1.ConditionFalse,
+				Reason:   MachineMaintenanceEnded,
+				Severity: machinev1.ConditionSeverityNone,
+			},
+			expectedEvent:           "MaintenanceEnded",
+			expectedNodeAPIRequests: true,
+		},
+		{
+			name:       "once the maintenance has ended, when the node was cordoned before the maintenance",
+			transforms: []func(m *machinev1.Machine){drainedForMaintenance},
+			expectedCondition: &machinev1.Condition{
+				Type:     MachineMaintenance,
+				Status:   corev1.ConditionFalse,
+				Reason:   MachineMaintenanceEnded,
+				Severity: machinev1.ConditionSeverityNone,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := getMachine("maintenance", phaseRunning)
+			for _, transform := range tc.transforms {
+				transform(m)
+			}
+
+			// The node is cordoned, drained and uncordoned through the API server, which does not know about it.
+			nodeAPIRequests := 0
+			apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nodeAPIRequests++
+				http.NotFound(w, r)
+			}))
+			defer apiServer.Close()
+
+			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, append([]runtime.Object{m}, tc.objects...)...)
+			recorder := record.NewFakeRecorder(10)
+			d := &machineDrainController{
+				Client:        fakeClient,
+				apiReader:     fakeClient,
+				config:        &rest.Config{Host: apiServer.URL},
+				scheme:        scheme.Scheme,
+				eventRecorder: recorder,
+			}
+
+			key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+			result, err := d.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.RequeueAfter > 0).To(Equal(tc.expectedRequeueAfterNonZero))
+			g.Expect(nodeAPIRequests > 0).To(Equal(tc.expectedNodeAPIRequests))
+
+			updated := &machinev1.Machine{}
+			g.Expect(d.Client.Get(ctx, key, updated)).To(Succeed())
+			maintenance := conditions.Get(updated, MachineMaintenance)
+			if tc.expectedCondition == nil {
+				g.Expect(maintenance).To(BeNil())
+			} else {
+				g.Expect(maintenance).ToNot(BeNil())
+				g.Expect(maintenance.Status).To(Equal(tc.expectedCondition.Status))
+				g.Expect(maintenance.Reason).To(Equal(tc.expectedCondition.Reason))
+				g.Expect(maintenance.Severity).To(Equal(tc.expectedCondition.Severity))
+			}
+
+			if tc.expectedCordonedAnnotation {
+				g.Expect(updated.Annotations).To(HaveKeyWithValue(MaintenanceCordonedNodeAnnotation, "foo"))
+			} else {
+				g.Expect(updated.Annotations).ToNot(HaveKey(MaintenanceCordonedNodeAnnotation))
+			}
+
+			if tc.expectedEvent == "" {
+				g.Expect(recorder.Events).ToNot(Receive())
+			} else {
+				g.Expect(recorder.Events).To(Receive(ContainSubstring(tc.expectedEvent)))
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package machine
+
+import (
+	"context"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+)
+
+// orphanMachine removes the finalizer of a Machine deleted with the orphan deletion mode,
+// without draining its Node or deleting its instance and Node, so that they can be adopted elsewhere.
+// An event records which instance and Node were left behind.
+func (r *ReconcileMachine) orphanMachine(ctx context.Context, m *machinev1.Machine) error {
+	machineName := m.GetName()
+
+	providerID := pointer.StringDeref(m.Spec.ProviderID, "")
+	nodeName := ""
+	if m.Status.NodeRef != nil {
+		nodeName = m.Status.NodeRef.Name
+	}
+
+	klog.Infof("%v: orphaning instance %q and node %q as requested by the %s annotation", machineName, providerID, nodeName, deletionmode.DeletionModeAnnotation)
+
+	m.ObjectMeta.Finalizers = util.Filter(m.ObjectMeta.Finalizers, machinev1.MachineFinalizer)
+	if err := r.Client.Update(ctx, m); err != nil {
+		klog.Errorf("%v: failed to remove finalizer from machine: %v", machineName, err)
+		return err
+	}
+
+	r.eventRecorder.Eventf(m, corev1.EventTypeWarning, "Orphaned",
+		"Machine deleted without deleting its instance %q or node %q, as requested by the %s annotation", providerID, nodeName, deletionmode.DeletionModeAnnotation)
+	klog.Infof("%v: machine deletion successful, instance and node were orphaned", machineName)
+	return nil
+}
@@ -0,0 +1,74 @@
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+)
+
+func TestReconcileOrphanedMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("orphaned", phaseDeleting)
+	m.Spec.ProviderID = pointer.String("aws:///us-east-1a/i-kept")
+	m.Annotations[deletionmode.DeletionModeAnnotation] = string(deletionmode.Orphan)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: m.Status.NodeRef.Name}}
+
+	act := newTestActuator()
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileMachine{
+		Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m, node),
+		scheme:        scheme.Scheme,
+		eventRecorder: recorder,
+		actuator:      act,
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{}))
+	g.Expect(act.DeleteCallCount).To(BeZero(), "the instance should not be deleted")
+	g.Expect(act.ExistsCallCount).To(BeZero())
+
+	updated := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(util.Contains(updated.Finalizers, machinev1.MachineFinalizer)).To(BeFalse(), "the finalizer should be removed")
+	g.Expect(conditions.Get(updated, machinev1.MachineDrained)).To(BeNil(), "the node should not be drained")
+
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Name: node.Name}, &corev1.Node{})).To(Succeed(), "the node should not be deleted")
+	g.Expect(recorder.Events).To(Receive(ContainSubstring("Orphaned Machine deleted without deleting its instance \"aws:///us-east-1a/i-kept\" or node \"foo\"")))
+}
+
+func TestDrainOrphanedMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("orphaned", phaseDeleting)
+	m.Annotations[deletionmode.DeletionModeAnnotation] = string(deletionmode.Orphan)
+
+	recorder := record.NewFakeRecorder(10)
+	d := &machineDrainController{
+		Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+		scheme:        scheme.Scheme,
+		eventRecorder: recorder,
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := d.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{}))
+	g.Expect(recorder.Events).ToNot(Receive(), "the node should not be drained")
+}
@@ -0,0 +1,111 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+const (
+	// MachineReconciliationPaused is the reason set on the Paused condition while the Machine is paused.
+	MachineReconciliationPaused = "ReconciliationPaused"
+
+	// MachineReconciliationResumed is the reason set on the Paused condition once the Machine is no longer paused.
+	MachineReconciliationResumed = "ReconciliationResumed"
+)
+
+// machinePausedBy checks whether the reconciliation of the Machine is paused, either by the paused annotation on the Machine
+// or on the MachineSet which owns it. It returns a description of what paused the Machine, or an empty string.
+func machinePausedBy(ctx context.Context, c client.Client, m *machinev1.Machine) (string, error) {
+	if annotations.IsPaused(m) {
+		return fmt.Sprintf("the %s annotation on the machine", annotations.PausedAnnotation), nil
+	}
+
+	owner := metav1.GetControllerOf(m)
+	if owner == nil || owner.Kind != "MachineSet" {
+		return "", nil
+	}
+
+	machineSet := &machinev1.MachineSet{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: m.Namespace, Name: owner.Name}, machineSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("could not get machineset %q: %w", owner.Name, err)
+	}
+	if machineSet.UID != owner.UID || !annotations.IsPaused(machineSet) {
+		return "", nil
+	}
+
+	return fmt.Sprintf("the %s annotation on machineset %q", annotations.PausedAnnotation, machineSet.Name), nil
+}
+
+// setPausedCondition records whether the Machine is paused in the Paused condition.
+// The condition is only set to false when the Machine was paused before, so that Machines which were never paused are left untouched.
+func setPausedCondition(m *machinev1.Machine, pausedBy string) {
+	if pausedBy != "" {
+		conditions.Set(m, &machinev1.Condition{
+			Type:     conditions.MachinePaused,
+			Status:   corev1.ConditionTrue,
+			Reason:   MachineReconciliationPaused,
+			Severity: machinev1.ConditionSeverityInfo,
+			Message:  fmt.Sprintf("Reconciliation is paused by %s", pausedBy),
+		})
+		return
+	}
+
+	if paused := conditions.Get(m, conditions.MachinePaused); paused != nil && paused.Status == corev1.ConditionTrue {
+		conditions.MarkFalse(m, conditions.MachinePaused, MachineReconciliationResumed, machinev1.ConditionSeverityNone, "Reconciliation has been resumed")
+	}
+}
+
+// watchMachineSetPause reconciles the Machines owned by a MachineSet whenever the MachineSet is paused or resumed,
+// as the Machines themselves do not change.
+func watchMachineSetPause(c controller.Controller, cl client.Client) error {
+	return c.Watch(
+		&source.Kind{Type: &machinev1.MachineSet{}},
+		handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			return machinesOwnedBy(cl, obj)
+		}),
+		predicate.Funcs{
+			CreateFunc:  func(event.CreateEvent) bool { return false },
+			DeleteFunc:  func(event.DeleteEvent) bool { return false },
+			GenericFunc: func(event.GenericEvent) bool { return false },
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return annotations.IsPaused(e.ObjectOld) != annotations.IsPaused(e.ObjectNew)
+			},
+		},
+	)
+}
+
+func machinesOwnedBy(c client.Client, owner client.Object) []reconcile.Request {
+	machines := &machinev1.MachineList{}
+	if err := c.List(context.Background(), machines, client.InNamespace(owner.GetNamespace())); err != nil {
+		klog.Errorf("Could not list machines owned by %q: %v", owner.GetName(), err)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		if ref := metav1.GetControllerOf(machine); ref != nil && ref.UID == owner.GetUID() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(machine)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,174 @@
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+func TestMachinePausedBy(t *testing.T) {
+	machineSet := func(paused bool) *machinev1.MachineSet {
+		ms := &machinev1.MachineSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "owner",
+				Namespace:   "default",
+				UID:         "owner-uid",
+				Annotations: map[string]string{},
+			},
+		}
+		if paused {
+			ms.Annotations[annotations.PausedAnnotation] = ""
+		}
+		return ms
+	}
+	ownedMachine := func(uid types.UID) *machinev1.Machine {
+		m := getMachine("owned", phaseRunning)
+		m.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: machinev1.SchemeGroupVersion.String(),
+			Kind:       "MachineSet",
+			Name:       "owner",
+			UID:        uid,
+			Controller: pointer.Bool(true),
+		}}
+		return m
+	}
+	pausedMachine := getMachine("paused", phaseRunning)
+	pausedMachine.Annotations[annotations.PausedAnnotation] = ""
+
+	testCases := []struct {
+		name             string
+		machine          *machinev1.Machine
+		objects          []client.Object
+		expectedPausedBy string
+	}{
+		{
+			name:    "with a machine which is not paused",
+			machine: getMachine("running", phaseRunning),
+		},
+		{
+			name:             "with a paused machine",
+			machine:          pausedMachine,
+			expectedPausedBy: "the cluster.x-k8s.io/paused annotation on the machine",
+		},
+		{
+			name:             "with a machine owned by a paused machineset",
+			machine:          ownedMachine("owner-uid"),
+			objects:          []client.Object{machineSet(true)},
+			expectedPausedBy: "the cluster.x-k8s.io/paused annotation on machineset \"owner\"",
+		},
+		{
+			name:    "with a machine owned by a machineset which is not paused",
+			machine: ownedMachine("owner-uid"),
+			objects: []client.Object{machineSet(false)},
+		},
+		{
+			name:    "with a machine owned by a machineset which no longer exists",
+			machine: ownedMachine("owner-uid"),
+		},
+		{
+			name:    "with a machine owned by a previous machineset with the same name",
+			machine: ownedMachine("previous-uid"),
+			objects: []client.Object{machineSet(true)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tc.objects...).Build()
+			pausedBy, err := machinePausedBy(ctx, c, tc.machine)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(pausedBy).To(Equal(tc.expectedPausedBy))
+		})
+	}
+}
+
+func TestSetPausedCondition(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("machine", phaseRunning)
+	setPausedCondition(m, "")
+	g.Expect(conditions.Get(m, conditions.MachinePaused)).To(BeNil(), "machines which were never paused should not have the condition")
+
+	setPausedCondition(m, "the test")
+	paused := conditions.Get(m, conditions.MachinePaused)
+	g.Expect(paused).ToNot(BeNil())
+	g.Expect(paused.Status).To(Equal(corev1.ConditionTrue))
+	g.Expect(paused.Reason).To(Equal(MachineReconciliationPaused))
+	g.Expect(paused.Message).To(Equal("Reconciliation is paused by the test"))
+
+	setPausedCondition(m, "")
+	paused = conditions.Get(m, conditions.MachinePaused)
+	g.Expect(paused).ToNot(BeNil())
+	g.Expect(paused.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(paused.Reason).To(Equal(MachineReconciliationResumed))
+}
+
+func TestReconcilePausedMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("paused", phaseProvisioning)
+	m.Status.NodeRef = nil
+	m.Annotations[annotations.PausedAnnotation] = ""
+
+	act := newTestActuator()
+	r := &ReconcileMachine{
+		Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+		scheme:        scheme.Scheme,
+		eventRecorder: record.NewFakeRecorder(10),
+		actuator:      act,
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{}))
+	g.Expect(act.ExistsCallCount).To(BeZero())
+	g.Expect(act.CreateCallCount).To(BeZero())
+	g.Expect(act.UpdateCallCount).To(BeZero())
+	g.Expect(act.DeleteCallCount).To(BeZero())
+
+	updated := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseProvisioning)))
+	paused := conditions.Get(updated, conditions.MachinePaused)
+	g.Expect(paused).ToNot(BeNil())
+	g.Expect(paused.Status).To(Equal(corev1.ConditionTrue))
+}
+
+func TestDrainPausedMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("paused", phaseDeleting)
+	m.Annotations[annotations.PausedAnnotation] = ""
+
+	d := &machineDrainController{
+		Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+		scheme:        scheme.Scheme,
+		eventRecorder: record.NewFakeRecorder(10),
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := d.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{}))
+
+	updated := &machinev1.Machine{}
+	g.Expect(d.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(conditions.Get(updated, machinev1.MachineDrained)).To(BeNil(), "a paused machine should not be drained")
+}
@@ -0,0 +1,162 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+const (
+	// MachineNodeRegistrationTimeout reports the wait of a Machine for its instance to be provisioned and for its Node
+	// to register. It is only set when the provisioning timeouts of the machine controller are enabled.
+	// While the Machine waits, the condition is false and its LastTransitionTime marks the start of the current wait:
+	// the start of the provisioning of the instance, then the time the instance was provisioned.
+	// It is true once the Machine has been failed because a wait has exceeded its timeout.
+	MachineNodeRegistrationTimeout machinev1.ConditionType = "NodeRegistrationTimeout"
+
+	// MachineWaitingForInstance is the reason set on the NodeRegistrationTimeout condition while the instance
+	// of the Machine is being provisioned.
+	MachineWaitingForInstance = "WaitingForInstance"
+
+	// MachineWaitingForNodeRegistration is the reason set on the NodeRegistrationTimeout condition once the instance
+	// of the Machine has been provisioned, while its Node has not registered yet.
+	MachineWaitingForNodeRegistration = "WaitingForNodeRegistration"
+
+	// MachineNodeRegistered is the reason set on the NodeRegistrationTimeout condition once the Node of the Machine
+	// has registered in time.
+	MachineNodeRegistered = "NodeRegistered"
+
+	// MachineProvisioningTimedOut is the reason set on the NodeRegistrationTimeout condition when the instance of
+	// the Machine was not provisioned within the provisioning timeout.
+	MachineProvisioningTimedOut = "ProvisioningTimedOut"
+
+	// MachineNodeRegistrationTimedOut is the reason set on the NodeRegistrationTimeout condition when the Node of
+	// the Machine did not register within the node registration timeout.
+	MachineNodeRegistrationTimedOut = "NodeRegistrationTimedOut"
+
+	// ProvisioningTimeoutMachineError is the ErrorReason of the Machines which were failed because their instance
+	// was not provisioned within the provisioning timeout.
+	ProvisioningTimeoutMachineError machinev1.MachineStatusError = "ProvisioningTimeout"
+
+	// NodeRegistrationTimeoutMachineError is the ErrorReason of the Machines which were failed because their Node
+	// did not register within the node registration timeout.
+	NodeRegistrationTimeoutMachineError machinev1.MachineStatusError = "NodeRegistrationTimeout"
+)
+
+// ProvisioningTimeouts are the times allowed for the instance of a Machine to be provisioned, and for its Node to register.
+// A zero timeout disables the corresponding check.
+type ProvisioningTimeouts struct {
+	// Provisioning is the time allowed between the first attempt to create the instance of a Machine and the instance
+	// being provisioned, that is the Machine being given its provider ID and addresses.
+	Provisioning time.Duration
+
+	// NodeRegistration is the time allowed between the instance of a Machine being provisioned and its Node registering.
+	NodeRegistration time.Duration
+}
+
+// provisioningTimedOut records that the Machine is waiting for its instance or for its Node, according to the given
+// reason, and returns the error to fail the Machine with once the wait has exceeded its timeout.
+func (r *ReconcileMachine) provisioningTimedOut(m *machinev1.Machine, waitingFor string) *MachineError {
+	var timeout time.Duration
+	var waitingMessage, timedOutReason string
+	var errorReason machinev1.MachineStatusError
+	switch waitingFor {
+	case MachineWaitingForInstance:
+		timeout = r.provisioningTimeouts.Provisioning
+		waitingMessage = "Waiting up to %v for the instance of the machine to be provisioned"
+		timedOutReason = MachineProvisioningTimedOut
+		errorReason = ProvisioningTimeoutMachineError
+	case MachineWaitingForNodeRegistration:
+		timeout = r.provisioningTimeouts.NodeRegistration
+		waitingMessage = "Waiting up to %v for the node of the machine to register"
+		timedOutReason = MachineNodeRegistrationTimedOut
+		errorReason = NodeRegistrationTimeoutMachineError
+	}
+	if timeout <= 0 {
+		return nil
+	}
+	// The timeouts only apply to the first registration of the Node of the instance. The condition is removed when
+	// a failed Machine is recreated, so that they apply again to its new instance.
+	if registered := conditions.Get(m, MachineNodeRegistrationTimeout); registered != nil && registered.Reason == MachineNodeRegistered {
+		return nil
+	}
+
+	// The message must not change while waiting, so that the LastTransitionTime marks the start of the wait.
+	conditions.Set(m, conditions.FalseCondition(
+		MachineNodeRegistrationTimeout,
+		waitingFor,
+		machinev1.ConditionSeverityInfo,
+		waitingMessage, timeout,
+	))
+	waitingSince := conditions.Get(m, MachineNodeRegistrationTimeout).LastTransitionTime
+	if r.now().Sub(waitingSince.Time) < timeout {
+		return nil
+	}
+
+	var message string
+	if waitingFor == MachineWaitingForInstance {
+		message = fmt.Sprintf("Instance was not provisioned within %v of the start of its provisioning at %s",
+			timeout, waitingSince.UTC().Format(time.RFC3339))
+	} else {
+		message = fmt.Sprintf("Node did not register within %v of the instance being provisioned at %s",
+			timeout, waitingSince.UTC().Format(time.RFC3339))
+	}
+	conditions.Set(m, &machinev1.Condition{
+		Type:     MachineNodeRegistrationTimeout,
+		Status:   corev1.ConditionTrue,
+		Reason:   timedOutReason,
+		Severity: machinev1.ConditionSeverityError,
+		Message:  message,
+	})
+	return &MachineError{Reason: errorReason, Message: message}
+}
+
+// failProvisioningTimeout moves a Machine whose wait for its instance or its Node has timed out to the Failed phase.
+func (r *ReconcileMachine) failProvisioningTimeout(ctx context.Context, m *machinev1.Machine, timedOut *MachineError, originalConditions machinev1.Conditions) (reconcile.Result, error) {
+	klog.Warningf("%v: failing machine: %v", m.GetName(), timedOut)
+	r.eventRecorder.Eventf(m, corev1.EventTypeWarning, string(timedOut.Reason), "%v", timedOut)
+	return reconcile.Result{}, r.updateStatus(ctx, m, phaseFailed, timedOut, originalConditions)
+}
+
+// setNodeRegistered records that the Node of a Machine which was waiting for it has registered in time.
+func setNodeRegistered(m *machinev1.Machine) {
+	condition := conditions.Get(m, MachineNodeRegistrationTimeout)
+	if condition == nil || (condition.Reason != MachineWaitingForInstance && condition.Reason != MachineWaitingForNodeRegistration) {
+		return
+	}
+	conditions.MarkFalse(m, MachineNodeRegistrationTimeout, MachineNodeRegistered, machinev1.ConditionSeverityNone,
+		"Node %q registered", m.Status.NodeRef.Name)
+}
+
+// provisioningWaitStarted returns whether the Machine started to wait for its instance during this reconcile,
+// in which case the start of the wait must be persisted before the instance is created, so that the timeout
+// expires even when the creation keeps failing.
+func provisioningWaitStarted(m *machinev1.Machine, originalConditions machinev1.Conditions) bool {
+	current := conditions.Get(m, MachineNodeRegistrationTimeout)
+	if current == nil {
+		return false
+	}
+	for i := range originalConditions {
+		if originalConditions[i].Type == MachineNodeRegistrationTimeout {
+			return !originalConditions[i].LastTransitionTime.Equal(&current.LastTransitionTime)
+		}
+	}
+	return true
+}
+
+// isProvisioningTimeout returns whether the Machine was failed by one of the provisioning timeouts.
+func isProvisioningTimeout(cause error) bool {
+	var machineError *MachineError
+	if !errors.As(cause, &machineError) {
+		return false
+	}
+	return machineError.Reason == ProvisioningTimeoutMachineError || machineError.Reason == NodeRegistrationTimeoutMachineError
+}
@@ -0,0 +1,275 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
+)
+
+func TestReconcileProvisioningTimeouts(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	errorReason := func(reason machinev1.MachineStatusError) *machinev1.MachineStatusError {
+		return &reason
+	}
+	timeouts := ProvisioningTimeouts{Provisioning: 20 * time.Minute, NodeRegistration: 10 * time.Minute}
+
+	waiting := func(reason string, since time.Duration) *machinev1.Condition {
+		message := "Waiting up to 20m0s for the instance of the machine to be provisioned"
+		if reason == MachineWaitingForNodeRegistration {
+			message = "Waiting up to 10m0s for the node of the machine to register"
+		}
+		return &machinev1.Condition{
+			Type:               MachineNodeRegistrationTimeout,
+			Status:             corev1.ConditionFalse,
+			Reason:             reason,
+			Severity:           machinev1.ConditionSeverityInfo,
+			Message:            message,
+			LastTransitionTime: metav1.NewTime(now.Add(-since)),
+		}
+	}
+
+	provisioning := func(condition *machinev1.Condition) *machinev1.Machine {
+		m := getMachine("machine", phaseProvisioning)
+		m.Status.NodeRef = nil
+		if condition != nil {
+			m.Status.Conditions = machinev1.Conditions{*condition}
+		}
+		return m
+	}
+	provisioned := func(condition *machinev1.Condition) *machinev1.Machine {
+		m := provisioning(condition)
+		m.Status.Phase = pointer.String(phaseProvisioned)
+		m.Spec.ProviderID = pointer.String("test://machine")
+		return m
+	}
+	registered := func(condition *machinev1.Condition) *machinev1.Machine {
+		m := provisioned(condition)
+		m.Status.NodeRef = &corev1.ObjectReference{Name: "node"}
+		return m
+	}
+
+	testCases := []struct {
+		name                string
+		machine             *machinev1.Machine
+		timeouts            ProvisioningTimeouts
+		instanceExists      bool
+		expectedPhase       string
+		expectedErrorReason *machinev1.MachineStatusError
+		expectedReason      string
+		expectedStatus      corev1.ConditionStatus
+		expectedSince       *time.Time
+		expectedCreateCalls int64
+	}{
+		{
+			name:                "with the timeouts disabled",
+			machine:             provisioning(nil),
+			expectedPhase:       phaseProvisioning,
+			expectedCreateCalls: 1,
+		},
+		{
+			name:                "when the creation of the instance is first attempted",
+			machine:             provisioning(nil),
+			timeouts:            timeouts,
+			expectedPhase:       phaseProvisioning,
+			expectedReason:      MachineWaitingForInstance,
+			expectedStatus:      corev1.ConditionFalse,
+			expectedCreateCalls: 1,
+		},
+		{
+			name:                "when the instance is still being provisioned within the timeout",
+			machine:             provisioning(waiting(MachineWaitingForInstance, 15*time.Minute)),
+			timeouts:            timeouts,
+			expectedPhase:       phaseProvisioning,
+			expectedReason:      MachineWaitingForInstance,
+			expectedStatus:      corev1.ConditionFalse,
+			expectedSince:       ago(15 * time.Minute),
+			expectedCreateCalls: 1,
+		},
+		{
+			name:                "when the instance is not provisioned within the timeout",
+			machine:             provisioning(waiting(MachineWaitingForInstance, 25*time.Minute)),
+			timeouts:            timeouts,
+			expectedPhase:       phaseFailed,
+			expectedErrorReason: errorReason(ProvisioningTimeoutMachineError),
+			expectedReason:      MachineProvisioningTimedOut,
+			expectedStatus:      corev1.ConditionTrue,
+		},
+		{
+			name:           "when the instance has just been provisioned",
+			machine:        provisioned(waiting(MachineWaitingForInstance, 15*time.Minute)),
+			timeouts:       timeouts,
+			instanceExists: true,
+			expectedPhase:  phaseProvisioned,
+			expectedReason: MachineWaitingForNodeRegistration,
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:           "when the node is still expected to register within the timeout",
+			machine:        provisioned(waiting(MachineWaitingForNodeRegistration, 5*time.Minute)),
+			timeouts:       timeouts,
+			instanceExists: true,
+			expectedPhase:  phaseProvisioned,
+			expectedReason: MachineWaitingForNodeRegistration,
+			expectedStatus: corev1.ConditionFalse,
+			expectedSince:  ago(5 * time.Minute),
+		},
+		{
+			name:                "when the node does not register within the timeout",
+			machine:             provisioned(waiting(MachineWaitingForNodeRegistration, 11*time.Minute)),
+			timeouts:            timeouts,
+			instanceExists:      true,
+			expectedPhase:       phaseFailed,
+			expectedErrorReason: errorReason(NodeRegistrationTimeoutMachineError),
+			expectedReason:      MachineNodeRegistrationTimedOut,
+			expectedStatus:      corev1.ConditionTrue,
+		},
+		{
+			name:           "when the node registers",
+			machine:        registered(waiting(MachineWaitingForNodeRegistration, 11*time.Minute)),
+			timeouts:       timeouts,
+			instanceExists: true,
+			expectedPhase:  phaseRunning,
+			expectedReason: MachineNodeRegistered,
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name: "when a machine whose node registered has lost it",
+			machine: provisioned(&machinev1.Condition{
+				Type:               MachineNodeRegistrationTimeout,
+				Status:             corev1.ConditionFalse,
+				Reason:             MachineNodeRegistered,
+				LastTransitionTime: metav1.NewTime(now.Add(-time.Hour)),
+			}),
+			timeouts:       timeouts,
+			instanceExists: true,
+			expectedPhase:  phaseProvisioned,
+			expectedReason: MachineNodeRegistered,
+			expectedStatus: corev1.ConditionFalse,
+			expectedSince:  ago(time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			act := newTestActuator()
+			act.ExistsValue = tc.instanceExists
+			r := &ReconcileMachine{
+				Client:               fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tc.machine).Build(),
+				scheme:               scheme.Scheme,
+				eventRecorder:        record.NewFakeRecorder(10),
+				actuator:             act,
+				provisioningTimeouts: tc.timeouts,
+				nowFunc:              func() time.Time { return now },
+			}
+
+			key := types.NamespacedName{Namespace: tc.machine.Namespace, Name: tc.machine.Name}
+			_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(act.CreateCallCount).To(Equal(tc.expectedCreateCalls))
+
+			updated := &machinev1.Machine{}
+			g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+			g.Expect(updated.Status.Phase).To(Equal(pointer.String(tc.expectedPhase)))
+			g.Expect(updated.Status.ErrorReason).To(Equal(tc.expectedErrorReason))
+
+			condition := conditions.Get(updated, MachineNodeRegistrationTimeout)
+			if tc.expectedReason == "" {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Reason).To(Equal(tc.expectedReason))
+			g.Expect(condition.Status).To(Equal(tc.expectedStatus))
+			if tc.expectedSince != nil {
+				g.Expect(condition.LastTransitionTime.Time).To(BeTemporally("==", *tc.expectedSince))
+			}
+			if tc.expectedErrorReason != nil {
+				g.Expect(updated.Status.ErrorMessage).To(Equal(pointer.String(condition.Message)))
+			}
+		})
+	}
+}
+
+func TestReconcileRecreatedMachineNodeRegistrationTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	var offset time.Duration
+	m := getMachine("machine", phaseRunning)
+	m.Annotations[retrypolicy.FailedRetryLimitAnnotation] = "3"
+	m.Annotations[retrypolicy.FailedRetryBackoffAnnotation] = "1m"
+	m.Spec.ProviderID = pointer.String("test://lost")
+	m.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}
+	m.Status.NodeRef = &corev1.ObjectReference{Name: "lost"}
+	m.Status.Conditions = machinev1.Conditions{{
+		Type:               MachineNodeRegistrationTimeout,
+		Status:             corev1.ConditionFalse,
+		Reason:             MachineNodeRegistered,
+		LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+	}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "lost"}}
+
+	act := newTestActuator()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(m, node).Build()
+	r := &ReconcileMachine{
+		Client:               fakeClient,
+		apiReader:            fakeClient,
+		scheme:               scheme.Scheme,
+		eventRecorder:        record.NewFakeRecorder(20),
+		actuator:             act,
+		provisioningTimeouts: ProvisioningTimeouts{NodeRegistration: 10 * time.Minute},
+		nowFunc:              func() time.Time { return time.Now().Add(offset) },
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	updated := &machinev1.Machine{}
+	reconcileMachine := func() {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	}
+
+	// The instance is lost, the Machine fails.
+	reconcileMachine()
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseFailed)))
+
+	// Once the backoff has passed, the Machine is recreated.
+	offset = 2 * time.Minute
+	reconcileMachine()
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseProvisioning)))
+	g.Expect(conditions.Get(updated, MachineNodeRegistrationTimeout)).To(BeNil(), "the registration of the lost node should be forgotten")
+
+	// The new instance is provisioned, its Node never registers.
+	updated.Spec.ProviderID = pointer.String("test://new")
+	g.Expect(r.Client.Update(ctx, updated)).To(Succeed())
+	updated.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}}
+	g.Expect(r.Client.Status().Update(ctx, updated)).To(Succeed())
+	act.ExistsValue = true
+	reconcileMachine()
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseProvisioned)))
+	g.Expect(conditions.Get(updated, MachineNodeRegistrationTimeout).Reason).To(Equal(MachineWaitingForNodeRegistration))
+
+	offset = 13 * time.Minute
+	reconcileMachine()
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseFailed)))
+	g.Expect(updated.Status.ErrorReason).To(Equal(machineStatusErrorPtr(NodeRegistrationTimeoutMachineError)))
+	g.Expect(conditions.Get(updated, MachineNodeRegistrationTimeout).Reason).To(Equal(MachineNodeRegistrationTimedOut))
+}
@@ -0,0 +1,199 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+var _ machine.Actuator = &Actuator{}
+var _ machine.InstanceLister = &Actuator{}
+
+// Actuator is an Actuator which forwards all calls to an actuator server.
+// The connection to the server is opened on the first call, and opened again after it is lost.
+type Actuator struct {
+	address string
+	network string
+	addr    string
+
+	lock   sync.Mutex
+	client *rpc.Client
+
+	// listsInstances records whether the actuator of the server lists instances, once the server has told.
+	// It is reset when the connection is lost, as the server may be replaced by one serving another actuator.
+	listsInstances *bool
+}
+
+// NewActuator returns an Actuator calling the actuator server at the given address,
+// either unix:///path/to/socket or tcp://host:port.
+func NewActuator(address string) (*Actuator, error) {
+	network, addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Actuator{address: address, network: network, addr: addr}, nil
+}
+
+// Create the machine.
+func (a *Actuator) Create(ctx context.Context, m *machinev1.Machine) error {
+	_, err := a.call(ctx, "Create", m)
+	return err
+}
+
+// Update the machine to the provided definition.
+func (a *Actuator) Update(ctx context.Context, m *machinev1.Machine) error {
+	_, err := a.call(ctx, "Update", m)
+	return err
+}
+
+// Exists checks if the machine currently exists.
+func (a *Actuator) Exists(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	resp, err := a.call(ctx, "Exists", m)
+	if resp == nil {
+		return false, err
+	}
+	return resp.Exists, err
+}
+
+// Delete the machine.
+func (a *Actuator) Delete(ctx context.Context, m *machinev1.Machine) error {
+	_, err := a.call(ctx, "Delete", m)
+	return err
+}
+
+// ListInstances returns the IDs of all the existing instances of the cluster.
+// It fails when the actuator of the server does not list instances.
+func (a *Actuator) ListInstances(ctx context.Context) (sets.String, error) {
+	resp, err := a.call(ctx, "ListInstances", nil)
+	if err != nil {
+		return nil, err
+	}
+	return sets.NewString(resp.Instances...), nil
+}
+
+// InstanceID returns the ID of the instance of the machine, as returned by ListInstances.
+// It is empty when the actuator of the server does not list instances, or when the server could not be called,
+// so that the instance is looked up with Exists. The server is not called again once it has told that its actuator
+// does not list instances.
+func (a *Actuator) InstanceID(ctx context.Context, m *machinev1.Machine) string {
+	if lists, known := a.listsInstancesKnown(); known && !lists {
+		return ""
+	}
+
+	resp, err := a.call(ctx, "InstanceID", m)
+	if err != nil {
+		klog.V(3).Infof("%v: failed to get the instance ID: %v", m.GetName(), err)
+		return ""
+	}
+	a.setListsInstances(resp.ListsInstances)
+	return resp.InstanceID
+}
+
+// Close closes the connection to the actuator server.
+func (a *Actuator) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.client == nil {
+		return nil
+	}
+	err := a.client.Close()
+	a.client = nil
+	a.listsInstances = nil
+	return err
+}
+
+// listsInstancesKnown returns whether the actuator of the server lists instances, and whether the server has told yet.
+func (a *Actuator) listsInstancesKnown() (lists bool, known bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.listsInstances == nil {
+		return false, false
+	}
+	return *a.listsInstances, true
+}
+
+func (a *Actuator) setListsInstances(lists bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.listsInstances = &lists
+}
+
+// call calls the given method of the actuator server and copies the Machine it returns into m.
+// The response is nil when the server could not be called, otherwise the error is the error of the actuator.
+func (a *Actuator) call(ctx context.Context, method string, m *machinev1.Machine) (*Response, error) {
+	client, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := Request{Machine: m}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Timeout = time.Until(deadline)
+	}
+	resp := &Response{}
+
+	call := client.Go(ServiceName+"."+method, req, resp, nil)
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s call to actuator at %q: %w", method, a.address, ctx.Err())
+	case <-call.Done:
+	}
+
+	if call.Error != nil {
+		var serverError rpc.ServerError
+		if !errors.As(call.Error, &serverError) {
+			// The connection is broken, a new one is opened by the next call.
+			a.disconnect(client)
+		}
+		return nil, fmt.Errorf("%s call to actuator at %q failed: %w", method, a.address, call.Error)
+	}
+
+	if resp.Machine != nil && m != nil {
+		resp.Machine.DeepCopyInto(m)
+	}
+	return resp, resp.Error.err()
+}
+
+// connect returns the client connected to the actuator server, connecting it if needed.
+func (a *Actuator) connect(ctx context.Context) (*rpc.Client, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, a.network, a.addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to actuator at %q: %w", a.address, err)
+	}
+	a.client = jsonrpc.NewClient(conn)
+	return a.client, nil
+}
+
+// disconnect closes the given client, unless it has already been replaced.
+func (a *Actuator) disconnect(client *rpc.Client) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.client == client {
+		a.client.Close()
+		a.client = nil
+		a.listsInstances = nil
+	}
+}
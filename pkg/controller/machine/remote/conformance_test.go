@@ -0,0 +1,393 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+// fakeActuator sets the provider ID of the machines it creates, records whether it was called with a deadline,
+// and returns the configured results.
+type fakeActuator struct {
+	lock        sync.Mutex
+	exists      bool
+	err         error
+	block       chan struct{}
+	hadDeadline bool
+}
+
+func (a *fakeActuator) record(ctx context.Context) error {
+	a.lock.Lock()
+	_, a.hadDeadline = ctx.Deadline()
+	block := a.block
+	a.lock.Unlock()
+
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return a.err
+}
+
+func (a *fakeActuator) lastCallHadDeadline() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.hadDeadline
+}
+
+func (a *fakeActuator) Create(ctx context.Context, m *machinev1.Machine) error {
+	m.Spec.ProviderID = pointer.String("fake://" + m.Name)
+	m.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}
+	return a.record(ctx)
+}
+
+func (a *fakeActuator) Update(ctx context.Context, m *machinev1.Machine) error {
+	if m.Labels == nil {
+		m.Labels = map[string]string{}
+	}
+	m.Labels["updated"] = "true"
+	return a.record(ctx)
+}
+
+func (a *fakeActuator) Exists(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	return a.exists, a.record(ctx)
+}
+
+func (a *fakeActuator) Delete(ctx context.Context, m *machinev1.Machine) error {
+	return a.record(ctx)
+}
+
+// fakeInstanceLister is a fakeActuator which lists the configured instances, identified by the provider IDs
+// of the machines.
+type fakeInstanceLister struct {
+	fakeActuator
+	instances []string
+}
+
+func (a *fakeInstanceLister) ListInstances(ctx context.Context) (sets.String, error) {
+	return sets.NewString(a.instances...), a.record(ctx)
+}
+
+func (a *fakeInstanceLister) InstanceID(_ context.Context, m *machinev1.Machine) string {
+	return pointer.StringDeref(m.Spec.ProviderID, "")
+}
+
+// serve serves the actuator on the given listener until the test ends.
+func serve(t *testing.T, actuator machine.Actuator, listener net.Listener) {
+	server, err := NewServer(actuator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+}
+
+// newClient serves the actuator on localhost and returns a client connected to it.
+func newClient(t *testing.T, actuator machine.Actuator) *Actuator {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, actuator, listener)
+
+	client, err := NewActuator("tcp://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newMachine() *machinev1.Machine {
+	return &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "machine",
+			Namespace: "default",
+		},
+	}
+}
+
+func TestConformance(t *testing.T) {
+	testCases := []struct {
+		name      string
+		call      func(context.Context, machine.Actuator, *machinev1.Machine) error
+		actuator  *fakeActuator
+		expectErr func(*WithT, error)
+		expect    func(*WithT, *machinev1.Machine)
+	}{
+		{
+			name: "Create returns the machine updated by the actuator",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				return a.Create(ctx, m)
+			},
+			actuator: &fakeActuator{},
+			expect: func(g *WithT, m *machinev1.Machine) {
+				g.Expect(m.Spec.ProviderID).To(Equal(pointer.String("fake://machine")))
+				g.Expect(m.Status.Addresses).To(HaveLen(1))
+			},
+		},
+		{
+			name: "Update returns the machine updated by the actuator",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				return a.Update(ctx, m)
+			},
+			actuator: &fakeActuator{},
+			expect: func(g *WithT, m *machinev1.Machine) {
+				g.Expect(m.Labels).To(HaveKeyWithValue("updated", "true"))
+			},
+		},
+		{
+			name: "Exists returns whether the instance exists",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				exists, err := a.Exists(ctx, m)
+				if err == nil && !exists {
+					return errors.New("the instance should exist")
+				}
+				return err
+			},
+			actuator: &fakeActuator{exists: true},
+		},
+		{
+			name: "Delete returns the errors of the actuator",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				return a.Delete(ctx, m)
+			},
+			actuator: &fakeActuator{err: errors.New("instance is protected")},
+			expectErr: func(g *WithT, err error) {
+				g.Expect(err).To(MatchError("instance is protected"))
+			},
+		},
+		{
+			name: "machine errors keep their reason",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				return a.Create(ctx, m)
+			},
+			actuator: &fakeActuator{err: machine.InvalidMachineConfiguration("unknown template %q", "rhcos")},
+			expectErr: func(g *WithT, err error) {
+				var machineError *machine.MachineError
+				g.Expect(errors.As(err, &machineError)).To(BeTrue())
+				g.Expect(machineError.Reason).To(Equal(machinev1.InvalidConfigurationMachineError))
+				g.Expect(machineError.Message).To(Equal("unknown template \"rhcos\""))
+			},
+		},
+		{
+			name: "requeue after errors keep their delay",
+			call: func(ctx context.Context, a machine.Actuator, m *machinev1.Machine) error {
+				return a.Update(ctx, m)
+			},
+			actuator: &fakeActuator{err: &machine.RequeueAfterError{RequeueAfter: 20 * time.Second}},
+			expectErr: func(g *WithT, err error) {
+				var requeueAfterError *machine.RequeueAfterError
+				g.Expect(errors.As(err, &requeueAfterError)).To(BeTrue())
+				g.Expect(requeueAfterError.RequeueAfter).To(Equal(20 * time.Second))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			// The results of the remote actuator must match those of the actuator called in-process.
+			for _, actuator := range []machine.Actuator{tc.actuator, newClient(t, tc.actuator)} {
+				m := newMachine()
+				err := tc.call(context.Background(), actuator, m)
+				if tc.expectErr != nil {
+					tc.expectErr(g, err)
+				} else {
+					g.Expect(err).ToNot(HaveOccurred())
+				}
+				if tc.expect != nil {
+					tc.expect(g, m)
+				}
+			}
+		})
+	}
+}
+
+func TestConformanceInstanceLister(t *testing.T) {
+	g := NewWithT(t)
+
+	actuator := &fakeInstanceLister{instances: []string{"fake://a", "fake://b"}}
+	client := newClient(t, actuator)
+
+	// The results of the remote actuator must match those of the actuator called in-process.
+	for _, lister := range []machine.InstanceLister{actuator, client} {
+		instances, err := lister.ListInstances(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(instances).To(Equal(sets.NewString("fake://a", "fake://b")))
+
+		m := newMachine()
+		g.Expect(lister.InstanceID(context.Background(), m)).To(BeEmpty())
+		m.Spec.ProviderID = pointer.String("fake://a")
+		g.Expect(lister.InstanceID(context.Background(), m)).To(Equal("fake://a"))
+	}
+
+	lists, known := client.listsInstancesKnown()
+	g.Expect(known).To(BeTrue())
+	g.Expect(lists).To(BeTrue())
+
+	actuator.err = errors.New("provider API unavailable")
+	_, err := client.ListInstances(context.Background())
+	g.Expect(err).To(MatchError("provider API unavailable"))
+}
+
+func TestConformanceInstanceListerUnsupported(t *testing.T) {
+	g := NewWithT(t)
+
+	client := newClient(t, &fakeActuator{})
+
+	m := newMachine()
+	m.Spec.ProviderID = pointer.String("fake://a")
+	g.Expect(client.InstanceID(context.Background(), m)).To(BeEmpty(), "the instances of actuators which do not list instances should be looked up with Exists")
+	lists, known := client.listsInstancesKnown()
+	g.Expect(known).To(BeTrue(), "the client should not call InstanceID again once the server has told it does not list instances")
+	g.Expect(lists).To(BeFalse())
+	_, err := client.ListInstances(context.Background())
+	g.Expect(err).To(MatchError("the actuator does not list instances"))
+}
+
+func TestConformanceDeadline(t *testing.T) {
+	g := NewWithT(t)
+
+	actuator := &fakeActuator{}
+	client := newClient(t, actuator)
+
+	g.Expect(client.Delete(context.Background(), newMachine())).To(Succeed())
+	g.Expect(actuator.lastCallHadDeadline()).To(BeFalse())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	g.Expect(client.Delete(ctx, newMachine())).To(Succeed())
+	g.Expect(actuator.lastCallHadDeadline()).To(BeTrue(), "the deadline of the client should be passed to the actuator")
+}
+
+func TestConformanceCancel(t *testing.T) {
+	g := NewWithT(t)
+
+	actuator := &fakeActuator{block: make(chan struct{})}
+	defer close(actuator.block)
+	client := newClient(t, actuator)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := client.Delete(ctx, newMachine())
+	g.Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue(), "unexpected error: %v", err)
+}
+
+func TestConformanceReconnect(t *testing.T) {
+	g := NewWithT(t)
+
+	address := "unix://" + filepath.Join(t.TempDir(), "actuator.sock")
+	actuator := &fakeActuator{exists: true}
+	client, err := NewActuator(address)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer client.Close()
+
+	_, err = client.Exists(context.Background(), newMachine())
+	g.Expect(err).To(MatchError(ContainSubstring("unable to connect to actuator")), "no server is listening yet")
+
+	start := func() *Server {
+		server, err := NewServer(actuator)
+		g.Expect(err).ToNot(HaveOccurred())
+		go server.ListenAndServe(address)
+		g.Eventually(func() error {
+			_, err := client.Exists(context.Background(), newMachine())
+			return err
+		}).Should(Succeed())
+		return server
+	}
+
+	server := start()
+	g.Expect(server.Close()).To(Succeed())
+	_, err = client.Exists(context.Background(), newMachine())
+	g.Expect(err).To(HaveOccurred(), "the server has been closed")
+
+	// A restarted server replaces the socket left behind, and the client connects to it again.
+	server = start()
+	defer server.Close()
+	exists, err := client.Exists(context.Background(), newMachine())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+}
+
+func TestParseAddress(t *testing.T) {
+	testCases := []struct {
+		address         string
+		expectedNetwork string
+		expectedAddr    string
+		expectedError   string
+	}{
+		{
+			address:         "unix:///var/run/machine-api/actuator.sock",
+			expectedNetwork: "unix",
+			expectedAddr:    "/var/run/machine-api/actuator.sock",
+		},
+		{
+			address:         "tcp://127.0.0.1:9000",
+			expectedNetwork: "tcp",
+			expectedAddr:    "127.0.0.1:9000",
+		},
+		{
+			address:         "tcp://localhost:9000",
+			expectedNetwork: "tcp",
+			expectedAddr:    "localhost:9000",
+		},
+		{
+			address:         "tcp://[::1]:9000",
+			expectedNetwork: "tcp",
+			expectedAddr:    "[::1]:9000",
+		},
+		{
+			address:       "tcp://10.0.0.1:9000",
+			expectedError: "invalid actuator address \"tcp://10.0.0.1:9000\": the host must be localhost or a loopback address",
+		},
+		{
+			address:       "tcp://:9000",
+			expectedError: "invalid actuator address \"tcp://:9000\": the host must be localhost or a loopback address",
+		},
+		{
+			address:       "unix://",
+			expectedError: "invalid actuator address \"unix://\": the path of the socket is missing",
+		},
+		{
+			address:       "tcp://",
+			expectedError: "invalid actuator address \"tcp://\": the host and port are missing",
+		},
+		{
+			address:       "http://127.0.0.1:9000",
+			expectedError: "invalid actuator address \"http://127.0.0.1:9000\": the scheme must be unix or tcp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.address, func(t *testing.T) {
+			g := NewWithT(t)
+
+			network, addr, err := ParseAddress(tc.address)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(network).To(Equal(tc.expectedNetwork))
+			g.Expect(addr).To(Equal(tc.expectedAddr))
+		})
+	}
+}
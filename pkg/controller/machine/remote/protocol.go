@@ -0,0 +1,138 @@
+// Package remote runs an Actuator in a separate process. The machine controller is started with an Actuator client,
+// which forwards every call to an actuator server over JSON-RPC, on a unix socket or a loopback TCP socket.
+// The server wraps the provider Actuator, so any Actuator can be served without change.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+// ServiceName is the name of the JSON-RPC service served by actuator servers.
+// Its methods are Create, Update, Exists and Delete, and ListInstances and InstanceID for the actuators which
+// implement the machine.InstanceLister interface, all taking a Request and replying with a Response.
+const ServiceName = "Actuator"
+
+// Request is the argument of all the methods of the actuator service.
+type Request struct {
+	// Machine is the Machine the actuator is called for. It is not set for ListInstances calls.
+	Machine *machinev1.Machine `json:"machine,omitempty"`
+
+	// Timeout is the time left before the deadline of the call on the client, if it has one.
+	// The server cancels the call once it has passed.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Response is the reply of all the methods of the actuator service.
+type Response struct {
+	// Machine is the Machine as left by the actuator, which is copied back into the Machine of the client,
+	// as the actuator may set fields on it or update it on the API server.
+	Machine *machinev1.Machine `json:"machine,omitempty"`
+
+	// Exists is the result of Exists calls.
+	Exists bool `json:"exists,omitempty"`
+
+	// Instances is the result of ListInstances calls.
+	Instances []string `json:"instances,omitempty"`
+
+	// InstanceID is the result of InstanceID calls. It is empty when the actuator does not list instances.
+	InstanceID string `json:"instanceID,omitempty"`
+
+	// ListsInstances is set on the replies to InstanceID calls when the actuator lists instances, so that clients
+	// stop calling InstanceID and ListInstances when it does not.
+	ListsInstances bool `json:"listsInstances,omitempty"`
+
+	// Error is the error returned by the actuator, if any.
+	Error *Error `json:"error,omitempty"`
+}
+
+// Error is an error returned by an actuator. The errors the machine controller acts upon are preserved, so that
+// they are handled the same way as the errors of an in-process actuator.
+type Error struct {
+	// Message is the message of the error.
+	Message string `json:"message"`
+
+	// Reason is set when the error is a machine.MachineError.
+	Reason machinev1.MachineStatusError `json:"reason,omitempty"`
+
+	// RequeueAfter is set when the error is a machine.RequeueAfterError.
+	RequeueAfter time.Duration `json:"requeueAfter,omitempty"`
+}
+
+// newError converts an error returned by an actuator to be sent to the client.
+func newError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var machineError *machine.MachineError
+	if errors.As(err, &machineError) {
+		return &Error{Message: machineError.Message, Reason: machineError.Reason}
+	}
+
+	var requeueAfterError *machine.RequeueAfterError
+	if errors.As(err, &requeueAfterError) {
+		return &Error{Message: err.Error(), RequeueAfter: requeueAfterError.RequeueAfter}
+	}
+
+	return &Error{Message: err.Error()}
+}
+
+// err converts an error received from the server back to the error returned by the actuator.
+func (e *Error) err() error {
+	switch {
+	case e == nil:
+		return nil
+	case e.Reason != "":
+		return &machine.MachineError{Reason: e.Reason, Message: e.Message}
+	case e.RequeueAfter > 0:
+		return &machine.RequeueAfterError{RequeueAfter: e.RequeueAfter}
+	default:
+		return errors.New(e.Message)
+	}
+}
+
+// ParseAddress parses the address of an actuator server, either unix:///path/to/socket or tcp://host:port,
+// into the network and address to listen on or dial.
+// The protocol has no authentication, so TCP addresses are restricted to loopback hosts: the server must run
+// alongside the machine controller, for example in the same pod.
+func ParseAddress(address string) (string, string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid actuator address %q: %w", address, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid actuator address %q: the path of the socket is missing", address)
+		}
+		return "unix", u.Path, nil
+	case "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid actuator address %q: the host and port are missing", address)
+		}
+		if !isLoopback(u.Hostname()) {
+			return "", "", fmt.Errorf("invalid actuator address %q: the host must be localhost or a loopback address", address)
+		}
+		return "tcp", u.Host, nil
+	default:
+		return "", "", fmt.Errorf("invalid actuator address %q: the scheme must be unix or tcp", address)
+	}
+}
+
+// isLoopback returns true if the host is localhost or a loopback IP address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,210 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+// Server serves an Actuator to the Actuator clients of machine controllers.
+type Server struct {
+	rpc *rpc.Server
+
+	lock      sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server for the given Actuator.
+func NewServer(actuator machine.Actuator) (*Server, error) {
+	s := &Server{
+		rpc:   rpc.NewServer(),
+		conns: map[net.Conn]struct{}{},
+	}
+	if err := s.rpc.RegisterName(ServiceName, &service{actuator: actuator}); err != nil {
+		return nil, fmt.Errorf("unable to register actuator service: %w", err)
+	}
+	return s, nil
+}
+
+// ListenAndServe listens on the given address, either unix:///path/to/socket or tcp://host:port, and serves the
+// actuator until the server is closed.
+func (s *Server) ListenAndServe(address string) error {
+	network, addr, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		// A socket left behind by a previous server would prevent listening.
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove socket %q: %w", addr, err)
+		}
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %q: %w", address, err)
+	}
+	return s.Serve(listener)
+}
+
+// Serve serves the actuator on connections accepted by the listener, until the server is closed.
+// It always returns a non-nil error, which is ErrServerClosed once the server has been closed.
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = struct{}{}
+		s.lock.Unlock()
+
+		go func() {
+			s.rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+			s.lock.Lock()
+			delete(s.conns, conn)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// Close stops the server, closing its listeners and connections. Calls in progress are not cancelled.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// ErrServerClosed is returned by Serve and ListenAndServe once the server has been closed.
+var ErrServerClosed = errors.New("actuator server closed")
+
+// service is the JSON-RPC service calling the Actuator.
+type service struct {
+	actuator machine.Actuator
+}
+
+func (s *service) Create(req Request, resp *Response) error {
+	return s.call(req, resp, "create", func(ctx context.Context, m *machinev1.Machine) error {
+		return s.actuator.Create(ctx, m)
+	})
+}
+
+func (s *service) Update(req Request, resp *Response) error {
+	return s.call(req, resp, "update", func(ctx context.Context, m *machinev1.Machine) error {
+		return s.actuator.Update(ctx, m)
+	})
+}
+
+func (s *service) Exists(req Request, resp *Response) error {
+	return s.call(req, resp, "exists", func(ctx context.Context, m *machinev1.Machine) error {
+		exists, err := s.actuator.Exists(ctx, m)
+		resp.Exists = exists
+		return err
+	})
+}
+
+func (s *service) Delete(req Request, resp *Response) error {
+	return s.call(req, resp, "delete", func(ctx context.Context, m *machinev1.Machine) error {
+		return s.actuator.Delete(ctx, m)
+	})
+}
+
+func (s *service) ListInstances(req Request, resp *Response) error {
+	lister, ok := s.actuator.(machine.InstanceLister)
+	if !ok {
+		resp.Error = &Error{Message: "the actuator does not list instances"}
+		return nil
+	}
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	klog.V(3).Info("remote list instances")
+	instances, err := lister.ListInstances(ctx)
+	if err != nil {
+		klog.V(3).Infof("remote list instances failed: %v", err)
+	}
+	resp.Instances = instances.List()
+	resp.Error = newError(err)
+	return nil
+}
+
+func (s *service) InstanceID(req Request, resp *Response) error {
+	if req.Machine == nil {
+		return errors.New("the request has no machine")
+	}
+	// Actuators which do not list instances have no instance IDs, so that their instances are looked up with Exists.
+	lister, ok := s.actuator.(machine.InstanceLister)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	resp.InstanceID = lister.InstanceID(ctx, req.Machine)
+	resp.ListsInstances = true
+	return nil
+}
+
+// requestContext returns the context of a call, cancelled once the timeout of the request has passed.
+func requestContext(req Request) (context.Context, context.CancelFunc) {
+	if req.Timeout > 0 {
+		return context.WithTimeout(context.Background(), req.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// call calls the actuator with the Machine of the request, within the timeout of the request.
+// Errors of the actuator are sent in the response, the returned error is reserved to invalid requests.
+func (s *service) call(req Request, resp *Response, operation string, fn func(context.Context, *machinev1.Machine) error) error {
+	if req.Machine == nil {
+		return errors.New("the request has no machine")
+	}
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	klog.V(3).Infof("%v: remote %s", req.Machine.Name, operation)
+	err := fn(ctx, req.Machine)
+	if err != nil {
+		klog.V(3).Infof("%v: remote %s failed: %v", req.Machine.Name, operation, err)
+	}
+	resp.Machine = req.Machine
+	resp.Error = newError(err)
+	return nil
+}
@@ -0,0 +1,258 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+const (
+	// MachineThrottled reports that an actuator operation of the Machine was not started, because it would have
+	// exceeded the actuator limits of the machine controller. It is false once the operation has been started.
+	MachineThrottled machinev1.ConditionType = "Throttled"
+
+	// MachineActuatorRateLimited is the reason set on the Throttled condition when the actuator calls exceed the rate limit.
+	MachineActuatorRateLimited = "ActuatorRateLimited"
+
+	// MachineActuatorMaxInFlight is the reason set on the Throttled condition when the maximum number of concurrent
+	// actuator calls has been reached.
+	MachineActuatorMaxInFlight = "ActuatorMaxInFlight"
+
+	// MachineActuatorCallsResumed is the reason set on the Throttled condition once an actuator operation of a
+	// previously throttled Machine has been started.
+	MachineActuatorCallsResumed = "ActuatorCallsResumed"
+
+	operationCreate = "Create"
+	operationUpdate = "Update"
+	operationExists = "Exists"
+	operationDelete = "Delete"
+
+	operationListInstances = "ListInstances"
+	operationInstanceID    = "InstanceID"
+)
+
+// maxInFlightRequeueAfter is the delay before an operation throttled by the maximum number of concurrent actuator
+// calls is tried again.
+var maxInFlightRequeueAfter = 5 * time.Second
+
+// ActuatorLimits limits the calls of the machine controller to its actuator, across all Machines and operations,
+// so that providers do not each have to limit their calls to their API. A zero value disables a limit.
+type ActuatorLimits struct {
+	// QPS is the rate of actuator calls per second allowed on average.
+	QPS float64
+	// Burst is the number of actuator calls allowed above the rate, it is at least 1 when the rate is limited.
+	Burst int
+	// MaxInFlight is the maximum number of concurrent actuator calls.
+	MaxInFlight int
+}
+
+// ThrottledError is returned by an actuator operation which was not started because of the actuator limits.
+// It wraps a RequeueAfterError, as the operation can be tried again once the limits allow it.
+type ThrottledError struct {
+	Operation    string
+	Reason       string
+	RequeueAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s throttled by the actuator limits (%s), requeue in: %s", e.Operation, e.Reason, e.RequeueAfter)
+}
+
+// Unwrap returns the RequeueAfterError of the throttled operation.
+func (e *ThrottledError) Unwrap() error {
+	return &RequeueAfterError{RequeueAfter: e.RequeueAfter}
+}
+
+// limitedActuator calls an Actuator within the actuator limits. It sets the Throttled condition of the Machines
+// whose operations are throttled, which must then be persisted by the machine controller.
+type limitedActuator struct {
+	actuator    Actuator
+	limiter     *rate.Limiter
+	maxInFlight int
+
+	// nowFunc is used to mock time in testing. It should be nil in production.
+	nowFunc func() time.Time
+
+	lock     sync.Mutex
+	inFlight int
+}
+
+var _ Actuator = &limitedActuator{}
+
+// newLimitedActuator returns the actuator limited by the given limits, or the actuator itself when it is not limited.
+func newLimitedActuator(actuator Actuator, limits ActuatorLimits) Actuator {
+	if limits.QPS <= 0 && limits.MaxInFlight <= 0 {
+		return actuator
+	}
+
+	l := &limitedActuator{
+		actuator:    actuator,
+		maxInFlight: limits.MaxInFlight,
+	}
+	if limits.QPS > 0 {
+		burst := limits.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		l.limiter = rate.NewLimiter(rate.Limit(limits.QPS), burst)
+	}
+	return l
+}
+
+func (l *limitedActuator) Create(ctx context.Context, m *machinev1.Machine) error {
+	return l.call(m, operationCreate, func() error { return l.actuator.Create(ctx, m) })
+}
+
+func (l *limitedActuator) Update(ctx context.Context, m *machinev1.Machine) error {
+	return l.call(m, operationUpdate, func() error { return l.actuator.Update(ctx, m) })
+}
+
+func (l *limitedActuator) Exists(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	var exists bool
+	err := l.call(m, operationExists, func() error {
+		var err error
+		exists, err = l.actuator.Exists(ctx, m)
+		return err
+	})
+	return exists, err
+}
+
+func (l *limitedActuator) Delete(ctx context.Context, m *machinev1.Machine) error {
+	return l.call(m, operationDelete, func() error { return l.actuator.Delete(ctx, m) })
+}
+
+// limitedInstanceLister calls an InstanceLister within the limits of the actuator it belongs to, as its calls reach
+// the same provider API as those of the actuator.
+type limitedInstanceLister struct {
+	lister  InstanceLister
+	limited *limitedActuator
+}
+
+var _ InstanceLister = &limitedInstanceLister{}
+
+// newLimitedInstanceLister returns the lister limited by the limits of the given actuator, as returned by
+// newLimitedActuator, or the lister itself when the actuator is not limited.
+func newLimitedInstanceLister(lister InstanceLister, actuator Actuator) InstanceLister {
+	limited, ok := actuator.(*limitedActuator)
+	if !ok {
+		return lister
+	}
+	return &limitedInstanceLister{lister: lister, limited: limited}
+}
+
+// ListInstances lists the instances if the limits allow it, and returns a ThrottledError otherwise.
+func (l *limitedInstanceLister) ListInstances(ctx context.Context) (sets.String, error) {
+	if err := l.limited.acquire(operationListInstances); err != nil {
+		metrics.ActuatorOperationsThrottledTotal.WithLabelValues(operationListInstances, err.Reason).Inc()
+		return nil, err
+	}
+	defer l.limited.release(operationListInstances)
+
+	return l.lister.ListInstances(ctx)
+}
+
+// InstanceID returns the ID of the instance if the limits allow it. It is empty otherwise, so that the instance
+// is looked up with Exists, which is throttled in turn and reports the Throttled condition.
+func (l *limitedInstanceLister) InstanceID(ctx context.Context, m *machinev1.Machine) string {
+	if err := l.limited.acquire(operationInstanceID); err != nil {
+		metrics.ActuatorOperationsThrottledTotal.WithLabelValues(operationInstanceID, err.Reason).Inc()
+		return ""
+	}
+	defer l.limited.release(operationInstanceID)
+
+	return l.lister.InstanceID(ctx, m)
+}
+
+// call starts the operation if the limits allow it, and returns a ThrottledError otherwise.
+func (l *limitedActuator) call(m *machinev1.Machine, operation string, fn func() error) error {
+	if err := l.acquire(operation); err != nil {
+		metrics.ActuatorOperationsThrottledTotal.WithLabelValues(operation, err.Reason).Inc()
+		// The message must not change between attempts, so that the condition keeps its transition time.
+		conditions.Set(m, &machinev1.Condition{
+			Type:    MachineThrottled,
+			Status:  corev1.ConditionTrue,
+			Reason:  err.Reason,
+			Message: fmt.Sprintf("%s of the instance is throttled by the actuator limits of the machine controller", operation),
+		})
+		return err
+	}
+	defer l.release(operation)
+
+	if throttled := conditions.Get(m, MachineThrottled); throttled != nil && throttled.Status == corev1.ConditionTrue {
+		conditions.MarkFalse(m, MachineThrottled, MachineActuatorCallsResumed, machinev1.ConditionSeverityNone, "%s of the instance is no longer throttled", operation)
+	}
+	return fn()
+}
+
+// acquire reserves an in-flight slot and a token of the rate limiter for an operation.
+func (l *limitedActuator) acquire(operation string) *ThrottledError {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.maxInFlight > 0 && l.inFlight >= l.maxInFlight {
+		return &ThrottledError{Operation: operation, Reason: MachineActuatorMaxInFlight, RequeueAfter: maxInFlightRequeueAfter}
+	}
+
+	if l.limiter != nil {
+		now := l.now()
+		reservation := l.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			// The token is given back, the operation reserves another one when it is tried again.
+			reservation.CancelAt(now)
+			return &ThrottledError{Operation: operation, Reason: MachineActuatorRateLimited, RequeueAfter: delay}
+		}
+	}
+
+	l.inFlight++
+	metrics.ActuatorOperationsInFlight.WithLabelValues(operation).Inc()
+	return nil
+}
+
+func (l *limitedActuator) release(operation string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+	metrics.ActuatorOperationsInFlight.WithLabelValues(operation).Dec()
+}
+
+// now is used to get the current time. If the actuator nowFunc is not nil this will be used instead of time.Now().
+func (l *limitedActuator) now() time.Time {
+	if l.nowFunc != nil {
+		return l.nowFunc()
+	}
+	return time.Now()
+}
+
+// asThrottledError returns the ThrottledError of an actuator operation, or nil if it was not throttled.
+func asThrottledError(err error) *ThrottledError {
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled
+	}
+	return nil
+}
+
+// requeueThrottled records the Throttled condition of a Machine whose actuator operation was throttled,
+// and requeues it once the operation can be tried again.
+func (r *ReconcileMachine) requeueThrottled(ctx context.Context, m *machinev1.Machine, throttled *ThrottledError, originalConditions []machinev1.Condition) (reconcile.Result, error) {
+	klog.Infof("%v: %v", m.GetName(), throttled)
+	if err := r.updateStatus(ctx, m, pointer.StringPtrDerefOr(m.Status.Phase, ""), nil, originalConditions); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: throttled.RequeueAfter}, nil
+}
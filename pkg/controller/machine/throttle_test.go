@@ -0,0 +1,162 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+func TestNewLimitedActuator(t *testing.T) {
+	g := NewWithT(t)
+
+	act := newTestActuator()
+	g.Expect(newLimitedActuator(act, ActuatorLimits{})).To(BeIdenticalTo(act), "an actuator without limits should not be wrapped")
+
+	limited, ok := newLimitedActuator(act, ActuatorLimits{QPS: 10}).(*limitedActuator)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(limited.limiter.Burst()).To(Equal(1), "the burst should allow at least one call")
+}
+
+func TestLimitedActuatorRateLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	act := newTestActuator()
+	l := newLimitedActuator(act, ActuatorLimits{QPS: 1, Burst: 2}).(*limitedActuator)
+	l.nowFunc = func() time.Time { return now }
+
+	m := getMachine("machine", phaseProvisioning)
+	g.Expect(l.Create(ctx, m)).To(Succeed())
+	g.Expect(l.Create(ctx, m)).To(Succeed())
+
+	err := l.Create(ctx, m)
+	var throttled *ThrottledError
+	g.Expect(errors.As(err, &throttled)).To(BeTrue())
+	g.Expect(throttled.Reason).To(Equal(MachineActuatorRateLimited))
+	g.Expect(throttled.RequeueAfter).To(Equal(time.Second))
+	var requeueAfterError *RequeueAfterError
+	g.Expect(errors.As(err, &requeueAfterError)).To(BeTrue(), "throttled operations should be requeued")
+	g.Expect(act.CreateCallCount).To(Equal(int64(2)))
+
+	condition := conditions.Get(m, MachineThrottled)
+	g.Expect(condition).ToNot(BeNil())
+	g.Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+	g.Expect(condition.Reason).To(Equal(MachineActuatorRateLimited))
+
+	now = now.Add(time.Second)
+	g.Expect(l.Create(ctx, m)).To(Succeed())
+	g.Expect(act.CreateCallCount).To(Equal(int64(3)))
+	condition = conditions.Get(m, MachineThrottled)
+	g.Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(condition.Reason).To(Equal(MachineActuatorCallsResumed))
+}
+
+func TestLimitedActuatorMaxInFlight(t *testing.T) {
+	g := NewWithT(t)
+
+	act := newTestActuator()
+	act.BlockOnUpdate = true
+	l := newLimitedActuator(act, ActuatorLimits{MaxInFlight: 1}).(*limitedActuator)
+
+	done := make(chan error)
+	go func() {
+		done <- l.Update(ctx, getMachine("blocked", phaseRunning))
+	}()
+	g.Eventually(func() int {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		return l.inFlight
+	}).Should(Equal(1))
+
+	m := getMachine("machine", phaseRunning)
+	_, err := l.Exists(ctx, m)
+	var throttled *ThrottledError
+	g.Expect(errors.As(err, &throttled)).To(BeTrue())
+	g.Expect(throttled.Operation).To(Equal(operationExists))
+	g.Expect(throttled.Reason).To(Equal(MachineActuatorMaxInFlight))
+	g.Expect(throttled.RequeueAfter).To(Equal(maxInFlightRequeueAfter))
+	g.Expect(act.ExistsCallCount).To(BeZero())
+
+	act.Unblock()
+	g.Expect(<-done).To(Succeed())
+
+	_, err = l.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(act.ExistsCallCount).To(Equal(int64(1)))
+}
+
+func TestLimitedInstanceLister(t *testing.T) {
+	g := NewWithT(t)
+
+	lister := &fakeInstanceLister{instances: sets.NewString("fake://a")}
+	g.Expect(newLimitedInstanceLister(lister, newTestActuator())).To(BeIdenticalTo(lister), "a lister of an actuator without limits should not be wrapped")
+
+	l := newLimitedActuator(newTestActuator(), ActuatorLimits{MaxInFlight: 1}).(*limitedActuator)
+	limited := newLimitedInstanceLister(lister, l)
+
+	m := getMachine("machine", phaseRunning)
+	m.Spec.ProviderID = pointer.String("fake://a")
+
+	// The lister shares its in-flight slots with the actuator.
+	g.Expect(l.acquire(operationUpdate)).To(BeNil())
+	g.Expect(limited.InstanceID(ctx, m)).To(BeEmpty())
+	_, err := limited.ListInstances(ctx)
+	throttled := asThrottledError(err)
+	g.Expect(throttled).ToNot(BeNil())
+	g.Expect(throttled.Operation).To(Equal(operationListInstances))
+	g.Expect(lister.listCount).To(BeZero())
+	l.release(operationUpdate)
+
+	g.Expect(limited.InstanceID(ctx, m)).To(Equal("fake://a"))
+	instances, err := limited.ListInstances(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(instances).To(Equal(sets.NewString("fake://a")))
+}
+
+func TestReconcileThrottledMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	m := getMachine("throttled", phaseProvisioning)
+	m.Status.NodeRef = nil
+	m.Finalizers = []string{machinev1.MachineFinalizer}
+
+	now := time.Now()
+	act := newTestActuator()
+	limited := newLimitedActuator(act, ActuatorLimits{QPS: 0.1, Burst: 1}).(*limitedActuator)
+	limited.nowFunc = func() time.Time { return now }
+	r := &ReconcileMachine{
+		Client:        fake.NewFakeClientWithScheme(scheme.Scheme, m),
+		scheme:        scheme.Scheme,
+		eventRecorder: record.NewFakeRecorder(10),
+		actuator:      limited,
+	}
+
+	// The existence check uses the only token, so the creation of the instance is throttled.
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{RequeueAfter: 10 * time.Second}))
+	g.Expect(act.ExistsCallCount).To(Equal(int64(1)))
+	g.Expect(act.CreateCallCount).To(BeZero())
+
+	updated := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	throttled := conditions.Get(updated, MachineThrottled)
+	g.Expect(throttled).ToNot(BeNil())
+	g.Expect(throttled.Status).To(Equal(corev1.ConditionTrue))
+	g.Expect(throttled.Reason).To(Equal(MachineActuatorRateLimited))
+	g.Expect(throttled.Message).To(Equal("Create of the instance is throttled by the actuator limits of the machine controller"))
+}
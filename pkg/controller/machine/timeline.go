@@ -0,0 +1,140 @@
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PhaseTimelineAnnotation holds the timeline of the Machine, serialised as a list of TimelineEvents, oldest first.
+// It records when the Machine entered each of its phases, and when the steps of its deletion started and finished.
+// It is maintained by the machine and drain controllers and is informational only.
+const PhaseTimelineAnnotation = "machine.openshift.io/phase-timeline"
+
+// maxTimelineEvents bounds the size of the timeline. The oldest events are dropped first,
+// for example when a Machine keeps failing and being retried.
+const maxTimelineEvents = 20
+
+// Steps recorded in the timeline of a Machine.
+const (
+	// TimelineDrainStarted is recorded when the drain controller starts to drain the Node of the Machine.
+	TimelineDrainStarted = "DrainStarted"
+
+	// TimelineDrainSucceeded is recorded when the Node of the Machine has been drained.
+	TimelineDrainSucceeded = "DrainSucceeded"
+
+	// TimelineDrainTimedOut is recorded when the drain of the Node was abandoned after exceeding the drain timeout.
+	TimelineDrainTimedOut = "DrainTimedOut"
+
+	// TimelineInstanceDeletionStarted is recorded when the actuator is first asked to delete the instance of the Machine.
+	TimelineInstanceDeletionStarted = "InstanceDeletionStarted"
+
+	// TimelineInstanceDeleted is recorded once the instance of the Machine no longer exists.
+	TimelineInstanceDeleted = "InstanceDeleted"
+
+	// TimelineNodeDeleted is recorded once the Node of the Machine has been deleted.
+	TimelineNodeDeleted = "NodeDeleted"
+)
+
+// TimelineEvent is a phase or a step reached by a Machine. Exactly one of Phase and Step is set.
+type TimelineEvent struct {
+	// Phase is the phase the Machine entered.
+	Phase string `json:"phase,omitempty"`
+
+	// Step is the step of the lifecycle of the Machine which was reached.
+	Step string `json:"step,omitempty"`
+
+	// Time is when the phase was entered or the step was reached.
+	Time metav1.Time `json:"time"`
+}
+
+// getTimeline returns the timeline recorded on the Machine, or nil if there is none.
+func getTimeline(m *machinev1.Machine) []TimelineEvent {
+	value, ok := m.GetAnnotations()[PhaseTimelineAnnotation]
+	if !ok {
+		return nil
+	}
+
+	timeline := []TimelineEvent{}
+	if err := json.Unmarshal([]byte(value), &timeline); err != nil {
+		klog.Warningf("%v: ignoring invalid phase timeline annotation: %v", m.GetName(), err)
+		return nil
+	}
+	return timeline
+}
+
+// addTimelineEvent appends the event to the timeline of the Machine, dropping the oldest events beyond maxTimelineEvents.
+// It does not persist the Machine.
+func addTimelineEvent(m *machinev1.Machine, event TimelineEvent) error {
+	timeline := append(getTimeline(m), event)
+	if len(timeline) > maxTimelineEvents {
+		timeline = timeline[len(timeline)-maxTimelineEvents:]
+	}
+
+	data, err := json.Marshal(timeline)
+	if err != nil {
+		return fmt.Errorf("could not marshal phase timeline: %w", err)
+	}
+
+	// The annotations are copied as they may be shared, for example with the template of a MachineSet.
+	annotations := make(map[string]string, len(m.GetAnnotations())+1)
+	for k, v := range m.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[PhaseTimelineAnnotation] = string(data)
+	m.SetAnnotations(annotations)
+	return nil
+}
+
+// recordTimelineStep records that the Machine reached the step at the given time. It does not persist the Machine.
+// The steps of the deletion of the Machine are preceded by the Deleting phase, recorded at the deletion timestamp
+// of the Machine, as the drain controller may reach them before the machine controller records the phase.
+func recordTimelineStep(m *machinev1.Machine, step string, at time.Time) error {
+	if deleted := m.GetDeletionTimestamp(); deleted != nil && timelinePhase(m) != phaseDeleting {
+		if err := addTimelineEvent(m, TimelineEvent{Phase: phaseDeleting, Time: *deleted}); err != nil {
+			return err
+		}
+	}
+	return addTimelineEvent(m, TimelineEvent{Step: step, Time: metav1.NewTime(at)})
+}
+
+// timelinePhase returns the last phase recorded in the timeline of the Machine, or an empty string if there is none.
+func timelinePhase(m *machinev1.Machine) string {
+	timeline := getTimeline(m)
+	for i := len(timeline) - 1; i >= 0; i-- {
+		if timeline[i].Phase != "" {
+			return timeline[i].Phase
+		}
+	}
+	return ""
+}
+
+// patchTimelineStep records that the Machine reached the step at the given time, and persists it.
+// The Machine is patched before any change to its status, as the patch resets the status to the one stored in the API.
+func patchTimelineStep(ctx context.Context, c client.Client, m *machinev1.Machine, step string, at time.Time) error {
+	patchBase := client.MergeFrom(m.DeepCopy())
+	if err := recordTimelineStep(m, step, at); err != nil {
+		return err
+	}
+	return c.Patch(ctx, m, patchBase)
+}
+
+// timelineStepTime returns when the Machine reached the step since it entered its current phase, or nil if it did not.
+func timelineStepTime(m *machinev1.Machine, step string) *metav1.Time {
+	timeline := getTimeline(m)
+	for i := len(timeline) - 1; i >= 0; i-- {
+		switch {
+		case timeline[i].Step == step:
+			return &timeline[i].Time
+		case timeline[i].Phase != "":
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package machine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+)
+
+func TestAddTimelineEvent(t *testing.T) {
+	g := NewWithT(t)
+
+	shared := map[string]string{"foo": "bar"}
+	m := getMachine("machine", phaseRunning)
+	m.Annotations = shared
+
+	start := time.Now().Truncate(time.Second)
+	for i := 0; i < maxTimelineEvents+5; i++ {
+		g.Expect(recordTimelineStep(m, fmt.Sprintf("Step%d", i), start.Add(time.Duration(i)*time.Second))).To(Succeed())
+	}
+
+	timeline := getTimeline(m)
+	g.Expect(timeline).To(HaveLen(maxTimelineEvents))
+	g.Expect(timeline[0].Step).To(Equal("Step5"), "the oldest events should be dropped")
+	g.Expect(timeline[maxTimelineEvents-1].Step).To(Equal(fmt.Sprintf("Step%d", maxTimelineEvents+4)))
+	g.Expect(timeline[0].Time.Time).To(BeTemporally("==", start.Add(5*time.Second)))
+	g.Expect(shared).ToNot(HaveKey(PhaseTimelineAnnotation), "the original annotations should not be modified")
+
+	m.Annotations[PhaseTimelineAnnotation] = "not json"
+	g.Expect(getTimeline(m)).To(BeNil())
+}
+
+func TestTimelineStepTime(t *testing.T) {
+	g := NewWithT(t)
+
+	first := metav1.NewTime(time.Now().Truncate(time.Second).Add(-time.Hour))
+	second := metav1.NewTime(first.Add(30 * time.Minute))
+
+	m := getMachine("machine", phaseDeleting)
+	g.Expect(timelineStepTime(m, TimelineInstanceDeletionStarted)).To(BeNil())
+
+	g.Expect(addTimelineEvent(m, TimelineEvent{Phase: phaseDeleting, Time: first})).To(Succeed())
+	g.Expect(recordTimelineStep(m, TimelineInstanceDeletionStarted, first.Time)).To(Succeed())
+	g.Expect(timelineStepTime(m, TimelineInstanceDeletionStarted)).To(Equal(&first))
+
+	g.Expect(addTimelineEvent(m, TimelineEvent{Phase: phaseFailed, Time: second})).To(Succeed())
+	g.Expect(timelineStepTime(m, TimelineInstanceDeletionStarted)).To(BeNil(), "the steps of previous phases should be ignored")
+}
+
+func TestReconcileRecordsPhaseTimeline(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now().Truncate(time.Second)
+	m := getMachine("machine", phaseProvisioning)
+	m.Status.NodeRef = nil
+	m.Spec.ProviderID = pointer.String("test://machine")
+	m.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}
+
+	act := newTestActuator()
+	act.ExistsValue = true
+	r := &ReconcileMachine{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(m).Build(),
+		scheme:        scheme.Scheme,
+		eventRecorder: record.NewFakeRecorder(10),
+		actuator:      act,
+		nowFunc:       func() time.Time { return now },
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	updated := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseProvisioned)))
+	g.Expect(getTimeline(updated)).To(Equal([]TimelineEvent{
+		{Phase: phaseProvisioned, Time: metav1.NewTime(now)},
+	}))
+
+	// The instance is lost, the Machine fails.
+	act.ExistsValue = false
+	failedAt := now.Add(time.Minute)
+	r.nowFunc = func() time.Time { return failedAt }
+	for i := 0; i < 2; i++ {
+		_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Status.Phase).To(Equal(pointer.String(phaseFailed)))
+	g.Expect(updated.Annotations).To(HaveKeyWithValue(MachineInstanceStateAnnotationName, unknownInstanceState))
+	g.Expect(getTimeline(updated)).To(Equal([]TimelineEvent{
+		{Phase: phaseProvisioned, Time: metav1.NewTime(now)},
+		{Phase: phaseFailed, Time: metav1.NewTime(failedAt)},
+	}), "the phase should only be recorded when the Machine enters it")
+}
+
+func TestReconcileDeletionRecordsTimeline(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now().Truncate(time.Second)
+	deletingSince := metav1.NewTime(now.Add(-5 * time.Minute))
+
+	m := getMachine("machine", phaseDeleting)
+	m.DeletionTimestamp = &deletingSince
+	m.Status.Conditions = machinev1.Conditions{*conditions.TrueCondition(machinev1.MachineDrained)}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: m.Status.NodeRef.Name}}
+
+	act := newTestActuator()
+	act.ExistsValue = true
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(m, node).Build()
+	r := &ReconcileMachine{
+		Client:        fakeClient,
+		apiReader:     fakeClient,
+		scheme:        scheme.Scheme,
+		eventRecorder: record.NewFakeRecorder(10),
+		actuator:      act,
+		nowFunc:       func() time.Time { return now },
+	}
+
+	key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).ToNot(BeZero(), "the deletion should wait for the instance to be deleted")
+
+	updated := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(timelineStepTime(updated, TimelineInstanceDeletionStarted)).To(Equal(&metav1.Time{Time: now}))
+
+	// The start of the instance deletion is only recorded once.
+	act.ExistsValue = false
+	r.nowFunc = func() time.Time { return now.Add(time.Minute) }
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(act.DeleteCallCount).To(BeEquivalentTo(2))
+
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(getTimeline(updated)).To(Equal([]TimelineEvent{
+		{Phase: phaseDeleting, Time: deletingSince},
+		{Step: TimelineInstanceDeletionStarted, Time: metav1.NewTime(now)},
+		{Step: TimelineInstanceDeleted, Time: metav1.NewTime(now.Add(time.Minute))},
+		{Step: TimelineNodeDeleted, Time: metav1.NewTime(now.Add(time.Minute))},
+	}))
+}
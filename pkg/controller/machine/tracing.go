@@ -0,0 +1,95 @@
+package machine
+
+import (
+	"context"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
+)
+
+const (
+	// machineExistsKey is the attribute reporting the result of the Exists calls of the actuator.
+	machineExistsKey = attribute.Key("machine.exists")
+
+	// instanceCountKey is the attribute reporting the number of instances returned by the ListInstances calls of the actuator.
+	instanceCountKey = attribute.Key("instance.count")
+)
+
+// tracedActuator records a span for each call to the actuator it wraps.
+type tracedActuator struct {
+	actuator Actuator
+}
+
+var _ Actuator = &tracedActuator{}
+
+func newTracedActuator(actuator Actuator) Actuator {
+	return &tracedActuator{actuator: actuator}
+}
+
+// Create records a span around the Create call of the actuator.
+func (t *tracedActuator) Create(ctx context.Context, m *machinev1.Machine) error {
+	return t.call(ctx, m, operationCreate, t.actuator.Create)
+}
+
+// Update records a span around the Update call of the actuator.
+func (t *tracedActuator) Update(ctx context.Context, m *machinev1.Machine) error {
+	return t.call(ctx, m, operationUpdate, t.actuator.Update)
+}
+
+// Delete records a span around the Delete call of the actuator.
+func (t *tracedActuator) Delete(ctx context.Context, m *machinev1.Machine) error {
+	return t.call(ctx, m, operationDelete, t.actuator.Delete)
+}
+
+// Exists records a span around the Exists call of the actuator, with the result of the call.
+func (t *tracedActuator) Exists(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Actuator."+operationExists, m, tracing.MachineAttributes(m)...)
+	defer span.End()
+
+	exists, err := t.actuator.Exists(ctx, m)
+	span.SetAttributes(machineExistsKey.Bool(exists))
+	tracing.RecordError(span, err)
+	return exists, err
+}
+
+func (t *tracedActuator) call(ctx context.Context, m *machinev1.Machine, operation string, fn func(context.Context, *machinev1.Machine) error) error {
+	ctx, span := tracing.Start(ctx, "Actuator."+operation, m, tracing.MachineAttributes(m)...)
+	defer span.End()
+
+	err := fn(ctx, m)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// tracedInstanceLister records a span for each call to the instance lister it wraps.
+type tracedInstanceLister struct {
+	lister InstanceLister
+}
+
+var _ InstanceLister = &tracedInstanceLister{}
+
+func newTracedInstanceLister(lister InstanceLister) InstanceLister {
+	return &tracedInstanceLister{lister: lister}
+}
+
+// ListInstances records a span around the ListInstances call of the lister, with the number of instances listed.
+func (t *tracedInstanceLister) ListInstances(ctx context.Context) (sets.String, error) {
+	ctx, span := tracing.Start(ctx, "Actuator."+operationListInstances, nil)
+	defer span.End()
+
+	instances, err := t.lister.ListInstances(ctx)
+	span.SetAttributes(instanceCountKey.Int(instances.Len()))
+	tracing.RecordError(span, err)
+	return instances, err
+}
+
+// InstanceID records a span around the InstanceID call of the lister.
+func (t *tracedInstanceLister) InstanceID(ctx context.Context, m *machinev1.Machine) string {
+	ctx, span := tracing.Start(ctx, "Actuator."+operationInstanceID, m, tracing.MachineAttributes(m)...)
+	defer span.End()
+
+	return t.lister.InstanceID(ctx, m)
+}
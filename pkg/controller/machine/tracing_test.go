@@ -0,0 +1,63 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
+)
+
+// failingUpdateActuator is a TestActuator whose Update calls fail.
+type failingUpdateActuator struct {
+	*TestActuator
+	err error
+}
+
+func (a *failingUpdateActuator) Update(context.Context, *machinev1.Machine) error {
+	return a.err
+}
+
+func TestTracedActuator(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	// The spans of the other tests must not be sampled, or their Machines would be updated with a trace context.
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	updateErr := errors.New("update failed")
+	traced := newTracedActuator(&failingUpdateActuator{TestActuator: newTestActuator(), err: updateErr})
+
+	m := getMachine("machine", phaseProvisioning)
+	exists, err := traced.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+	g.Expect(traced.Create(ctx, m)).To(Succeed())
+
+	g.Expect(traced.Update(ctx, m)).To(MatchError(updateErr))
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(3))
+
+	g.Expect(spans[0].Name()).To(Equal("Actuator.Exists"))
+	g.Expect(spans[0].Attributes()).To(ContainElements(
+		tracing.MachineNameKey.String("machine"),
+		tracing.MachinePhaseKey.String(phaseProvisioning),
+		machineExistsKey.Bool(false),
+	))
+
+	g.Expect(spans[1].Name()).To(Equal("Actuator.Create"))
+	g.Expect(spans[1].Status().Code).To(Equal(codes.Unset))
+
+	g.Expect(spans[2].Name()).To(Equal("Actuator.Update"))
+	g.Expect(spans[2].Status().Code).To(Equal(codes.Error))
+}
@@ -0,0 +1,120 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+const (
+	// MachineVolumesDetached is set on the Machine once the volumes have been detached from its Node,
+	// or when waiting for them to be detached was skipped.
+	MachineVolumesDetached machinev1.ConditionType = "VolumesDetached"
+
+	// MachineWaitingForVolumeDetach is the reason set on the VolumesDetached condition while volumes
+	// are still attached to the Node. Its LastTransitionTime is used to enforce the volume detach timeout.
+	MachineWaitingForVolumeDetach = "WaitingForVolumeDetach"
+
+	// MachineVolumeDetachTimeoutExceeded is the reason set on the VolumesDetached condition when the
+	// volumes were not detached within the volume detach timeout.
+	MachineVolumeDetachTimeoutExceeded = "VolumeDetachTimeoutExceeded"
+)
+
+// reconcileVolumeDetach checks whether the volumes have been detached from the Node of the deleted Machine
+// and records the outcome in the VolumesDetached condition.
+// Pod deletion and volume detach happen asynchronously, so the pods can be gone before their volumes are detached.
+// Deleting the instance, and with it the Node, before the detach succeeds can lose or corrupt the volumes.
+// For example, with vsphere-volume the underlying VMDK would be deleted together with the VM.
+func (r *ReconcileMachine) reconcileVolumeDetach(ctx context.Context, m *machinev1.Machine) error {
+	if _, exists := m.ObjectMeta.Annotations[ExcludeWaitForVolumeDetachAnnotation]; exists || m.Status.NodeRef == nil {
+		setVolumesDetachedCondition(m, "Waiting for volumes to detach skipped")
+		return nil
+	}
+
+	policy := drainPolicy(m, r.eventRecorder)
+
+	// The Node is read straight from the API: the machine controller does not otherwise watch Nodes, and the
+	// volumes attached to the Node must be up to date, as the instance is deleted as soon as they are detached.
+	node := &corev1.Node{}
+	if err := r.apiReader.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			klog.Infof("%v: could not find node from noderef, it may have already been deleted: %v", m.GetName(), m.Status.NodeRef.Name)
+			setVolumesDetachedCondition(m, "Node not found")
+			return nil
+		}
+		return fmt.Errorf("unable to get node %q: %w", m.Status.NodeRef.Name, err)
+	}
+
+	if nodeIsUnreachable(node) {
+		// The kubelet cannot unmount the volumes, so they would never be reported as detached.
+		klog.Infof("%v: node %q is unreachable, not waiting for volumes to detach", m.GetName(), node.Name)
+		setVolumesDetachedCondition(m, "Node is unreachable")
+		return nil
+	}
+
+	if len(node.Status.VolumesAttached) == 0 {
+		setVolumesDetachedCondition(m, "Volumes detached successfully")
+		return nil
+	}
+
+	if r.isVolumeDetachTimeoutExceeded(m, policy) {
+		klog.Warningf("%v: volumes were not detached from node %q within %v, proceeding with machine deletion", m.GetName(), node.Name, policy.VolumeDetachTimeout)
+		r.eventRecorder.Eventf(m, corev1.EventTypeWarning, "VolumeDetachTimeoutExceeded", "Volumes were not detached within %v, proceeding with machine deletion", policy.VolumeDetachTimeout)
+		conditions.Set(m, conditions.FalseCondition(
+			MachineVolumesDetached,
+			MachineVolumeDetachTimeoutExceeded,
+			machinev1.ConditionSeverityWarning,
+			"%d volumes were not detached from node %q within %v", len(node.Status.VolumesAttached), node.Name, policy.VolumeDetachTimeout,
+		))
+		return nil
+	}
+
+	// The message must not change while waiting, so that the LastTransitionTime marks the start of the wait.
+	conditions.Set(m, conditions.FalseCondition(
+		MachineVolumesDetached,
+		MachineWaitingForVolumeDetach,
+		machinev1.ConditionSeverityInfo,
+		"Waiting for volumes to detach from node %q", node.Name,
+	))
+	return nil
+}
+
+// isVolumeDetachTimeoutExceeded checks whether the Machine has been waiting for its volumes to detach for longer
+// than the timeout set by the drain policy. The start of the wait is taken from the VolumesDetached condition.
+func (r *ReconcileMachine) isVolumeDetachTimeoutExceeded(m *machinev1.Machine, policy *drainpolicy.Policy) bool {
+	if policy.VolumeDetachTimeout == 0 {
+		return false
+	}
+
+	volumesDetached := conditions.Get(m, MachineVolumesDetached)
+	if volumesDetached == nil || volumesDetached.Reason != MachineWaitingForVolumeDetach || volumesDetached.LastTransitionTime.IsZero() {
+		return false
+	}
+
+	return r.now().Sub(volumesDetached.LastTransitionTime.Time) > policy.VolumeDetachTimeout
+}
+
+// isVolumeDetachFinished returns true once the machine controller no longer needs to wait for the volumes of the
+// Machine's Node, either because they are detached, the wait was skipped, or the volume detach timeout was exceeded.
+func isVolumeDetachFinished(m *machinev1.Machine) bool {
+	volumesDetached := conditions.Get(m, MachineVolumesDetached)
+	if volumesDetached == nil {
+		return false
+	}
+
+	return volumesDetached.Status == corev1.ConditionTrue || volumesDetached.Reason == MachineVolumeDetachTimeoutExceeded
+}
+
+func setVolumesDetachedCondition(m *machinev1.Machine, message string) {
+	condition := conditions.TrueCondition(MachineVolumesDetached)
+	condition.Message = message
+	conditions.Set(m, condition)
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/util/annotations"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
 	"github.com/openshift/machine-api-operator/pkg/util/external"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
@@ -24,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	apimachineryutilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -762,8 +765,19 @@ func (t *target) needsRemediation(timeoutForMachineToHaveNode time.Duration) (bo
 	var nextCheckTimes []time.Duration
 	now := time.Now()
 
+	// machine is in maintenance, its node is taken out of service on purpose
+	if machines.IsInMaintenance(&t.Machine) {
+		klog.V(3).Infof("%s: machine is in maintenance, not checking its health", t.string())
+		return false, time.Duration(0), nil
+	}
+
 	// machine has failed
 	if derefStringPointer(t.Machine.Status.Phase) == machinePhaseFailed {
+		if hasRetriesRemaining(t.Machine) {
+			// The machine controller will retry the machine, which takes it out of the Failed phase.
+			klog.V(3).Infof("%s: machine phase is %q but the machine will be retried", t.string(), machinePhaseFailed)
+			return false, time.Duration(0), nil
+		}
 		klog.V(3).Infof("%s: unhealthy: machine phase is %q", t.string(), machinePhaseFailed)
 		return true, time.Duration(0), nil
 	}
@@ -919,3 +933,12 @@ func getIntOrPercentValue(intOrStr *intstr.IntOrString) (int, bool, error) {
 	}
 	return 0, false, fmt.Errorf("invalid type: neither int nor percentage")
 }
+
+// hasRetriesRemaining checks whether the retry policy of a Failed Machine allows the machine controller to retry it again.
+func hasRetriesRemaining(machine machinev1.Machine) bool {
+	policy, errs := retrypolicy.Parse(machine.GetAnnotations(), field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		return false
+	}
+	return retrypolicy.Attempts(machine.GetAnnotations()) < policy.Limit
+}
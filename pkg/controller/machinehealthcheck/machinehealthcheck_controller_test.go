@@ -15,6 +15,8 @@ import (
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
 	maotesting "github.com/openshift/machine-api-operator/pkg/util/testing"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
@@ -1882,6 +1884,112 @@ func TestNeedsRemediation(t *testing.T) {
 			expectedNextCheck:           time.Duration(0),
 			expectedError:               false,
 		},
+		{
+			testCase: "healthy: machine phase failed with retries remaining",
+			target: &target{
+				Machine: machinev1.Machine{
+					TypeMeta: metav1.TypeMeta{Kind: "Machine"},
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations:     map[string]string{retrypolicy.FailedRetryLimitAnnotation: "3", retrypolicy.FailedRetryAttemptsAnnotation: "1"},
+						Name:            "machine",
+						Namespace:       namespace,
+						Labels:          map[string]string{"foo": "bar"},
+						OwnerReferences: []metav1.OwnerReference{{Kind: "MachineSet"}},
+					},
+					Spec: machinev1.MachineSpec{},
+					Status: machinev1.MachineStatus{
+						Phase: &machineFailed,
+					},
+				},
+				Node: nil,
+				MHC: machinev1.MachineHealthCheck{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: namespace,
+					},
+					TypeMeta: metav1.TypeMeta{
+						Kind: "MachineHealthCheck",
+					},
+					Spec: machinev1.MachineHealthCheckSpec{
+						Selector: metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"foo": "bar",
+							},
+						},
+						UnhealthyConditions: []machinev1.UnhealthyCondition{
+							{
+								Type:    "Ready",
+								Status:  "Unknown",
+								Timeout: metav1.Duration{Duration: 300 * time.Second},
+							},
+							{
+								Type:    "Ready",
+								Status:  "False",
+								Timeout: metav1.Duration{Duration: 300 * time.Second},
+							},
+						},
+					},
+					Status: machinev1.MachineHealthCheckStatus{},
+				},
+			},
+			timeoutForMachineToHaveNode: defaultNodeStartupTimeout,
+			expectedNeedsRemediation:    false,
+			expectedNextCheck:           time.Duration(0),
+			expectedError:               false,
+		},
+		{
+			testCase: "healthy: machine phase failed while in maintenance",
+			target: &target{
+				Machine: machinev1.Machine{
+					TypeMeta: metav1.TypeMeta{Kind: "Machine"},
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations:     map[string]string{machines.MaintenanceAnnotation: "hypervisor upgrade"},
+						Name:            "machine",
+						Namespace:       namespace,
+						Labels:          map[string]string{"foo": "bar"},
+						OwnerReferences: []metav1.OwnerReference{{Kind: "MachineSet"}},
+					},
+					Spec: machinev1.MachineSpec{},
+					Status: machinev1.MachineStatus{
+						Phase: &machineFailed,
+					},
+				},
+				Node: nil,
+				MHC: machinev1.MachineHealthCheck{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: namespace,
+					},
+					TypeMeta: metav1.TypeMeta{
+						Kind: "MachineHealthCheck",
+					},
+					Spec: machinev1.MachineHealthCheckSpec{
+						Selector: metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"foo": "bar",
+							},
+						},
+						UnhealthyConditions: []machinev1.UnhealthyCondition{
+							{
+								Type:    "Ready",
+								Status:  "Unknown",
+								Timeout: metav1.Duration{Duration: 300 * time.Second},
+							},
+							{
+								Type:    "Ready",
+								Status:  "False",
+								Timeout: metav1.Duration{Duration: 300 * time.Second},
+							},
+						},
+					},
+					Status: machinev1.MachineHealthCheckStatus{},
+				},
+			},
+			timeoutForMachineToHaveNode: defaultNodeStartupTimeout,
+			expectedNeedsRemediation:    false,
+			expectedNextCheck:           time.Duration(0),
+			expectedError:               false,
+		},
 		{
 			testCase: "healthy: meet conditions criteria but timeout",
 			target: &target{
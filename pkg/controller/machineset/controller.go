@@ -22,11 +22,14 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
-	"time"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
-	"github.com/openshift/machine-api-operator/pkg/util"
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -47,31 +50,36 @@ import (
 var (
 	controllerKind = machinev1.SchemeGroupVersion.WithKind("MachineSet")
 
-	// stateConfirmationTimeout is the amount of time allowed to wait for desired state.
-	stateConfirmationTimeout = 10 * time.Second
-
-	// stateConfirmationInterval is the amount of time between polling for the desired state.
-	// The polling is against a local memory cache.
-	stateConfirmationInterval = 100 * time.Millisecond
-
 	// controllerName is the name of this controller
 	controllerName = "machineset_controller"
 )
 
+// Attributes set on the spans of the MachineSet reconciles.
+const (
+	machineSetNameKey      = attribute.Key("machineset.name")
+	machineSetNamespaceKey = attribute.Key("machineset.namespace")
+)
+
 // Add creates a new MachineSet Controller and adds it to the Manager with default RBAC.
 // The Manager will set fields on the Controller and Start it when the Manager is Started.
 func Add(mgr manager.Manager, opts manager.Options) error {
 	r := newReconciler(mgr)
-	return add(mgr, r, r.MachineToMachineSets)
+	return add(mgr, r, r.MachineToMachineSets, machineEventHandler(r.expectations))
 }
 
 // newReconciler returns a new reconcile.Reconciler.
 func newReconciler(mgr manager.Manager) *ReconcileMachineSet {
-	return &ReconcileMachineSet{Client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor(controllerName)}
+	return &ReconcileMachineSet{
+		Client:       mgr.GetClient(),
+		scheme:       mgr.GetScheme(),
+		apiReader:    mgr.GetAPIReader(),
+		recorder:     mgr.GetEventRecorderFor(controllerName),
+		expectations: newMachineSetExpectations(),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler.
-func add(mgr manager.Manager, r reconcile.Reconciler, mapFn handler.MapFunc) error {
+func add(mgr manager.Manager, r reconcile.Reconciler, mapFn handler.MapFunc, machineHandler handler.EventHandler) error {
 	// Create a new controller.
 	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
@@ -87,15 +95,24 @@ func add(mgr manager.Manager, r reconcile.Reconciler, mapFn handler.MapFunc) err
 		return err
 	}
 
-	// Map Machine changes to MachineSets using ControllerRef.
+	// Map the changes to the MachineSets of the revisions of a rolling update MachineSet to their owner.
 	err = c.Watch(
-		&source.Kind{Type: &machinev1.Machine{}},
+		&source.Kind{Type: &machinev1.MachineSet{}},
 		&handler.EnqueueRequestForOwner{IsController: true, OwnerType: &machinev1.MachineSet{}},
 	)
 	if err != nil {
 		return err
 	}
 
+	// Map Machine changes to MachineSets using ControllerRef, observing the creations and deletions they expect.
+	err = c.Watch(
+		&source.Kind{Type: &machinev1.Machine{}},
+		machineHandler,
+	)
+	if err != nil {
+		return err
+	}
+
 	// Map Machine changes to MachineSets by machining labels.
 	return c.Watch(
 		&source.Kind{Type: &machinev1.Machine{}},
@@ -108,6 +125,12 @@ type ReconcileMachineSet struct {
 	client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
+
+	// apiReader reads straight from the API, bypassing the cache, when looking up the pods of Nodes.
+	apiReader client.Reader
+
+	// expectations tracks the machines created and deleted by each MachineSet until the cache reflects them.
+	expectations *machineSetExpectations
 }
 
 func (r *ReconcileMachineSet) MachineToMachineSets(o client.Object) []reconcile.Request {
@@ -152,6 +175,7 @@ func (r *ReconcileMachineSet) Reconcile(ctx context.Context, request reconcile.R
 		if apierrors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
+			r.expectations.Delete(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -164,7 +188,14 @@ func (r *ReconcileMachineSet) Reconcile(ctx context.Context, request reconcile.R
 		return reconcile.Result{}, nil
 	}
 
+	ctx, span := tracing.Start(ctx, "ReconcileMachineSet.Reconcile", machineSet,
+		machineSetNameKey.String(machineSet.Name),
+		machineSetNamespaceKey.String(machineSet.Namespace),
+	)
+	defer span.End()
+
 	result, err := r.reconcile(ctx, machineSet)
+	tracing.RecordError(span, err)
 	if err != nil {
 		klog.Errorf("Failed to reconcile MachineSet %q: %v", request.NamespacedName, err)
 		r.recorder.Eventf(machineSet, corev1.EventTypeWarning, "ReconcileError", "%v", err)
@@ -197,6 +228,9 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *machine
 		return reconcile.Result{}, fmt.Errorf("failed validation on MachineSet %q label selector, cannot match any machines ", machineSet.Name)
 	}
 
+	// While paused, the machines are neither adopted, created nor deleted, but the status is still reported.
+	paused := annotations.IsPaused(machineSet)
+
 	// Filter out irrelevant machines (deleting/mismatch labels) and claim orphaned machines.
 	var machineNames []string
 	machineSetMachines := make(map[string]*machinev1.Machine)
@@ -208,6 +242,9 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *machine
 
 		// Attempt to adopt machine if it meets previous conditions and it has no controller references.
 		if metav1.GetControllerOf(machine) == nil {
+			if paused {
+				continue
+			}
 			if err := r.adoptOrphan(machineSet, machine); err != nil {
 				klog.Warningf("Failed to adopt Machine %q into MachineSet %q: %v", machine.Name, machineSet.Name, err)
 				continue
@@ -224,11 +261,57 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *machine
 		filteredMachines = append(filteredMachines, machineSetMachines[machineName])
 	}
 
-	syncErr := r.syncReplicas(machineSet, filteredMachines)
+	// MachineSets with the rolling update strategy shift their replicas to the MachineSets of the revisions of their template.
+	if rolloutpolicy.IsRollingUpdate(machineSet.Annotations) {
+		return r.reconcileRollout(ctx, machineSet, filteredMachines, paused)
+	}
+
+	var syncErr error
+	var waitingForReplacement bool
+	var progress scalingpolicy.ScalingProgress
+	var synced bool
+	if paused {
+		klog.V(3).Infof("%v: replica reconciliation is paused by the %s annotation", machineSet.Name, annotations.PausedAnnotation)
+	} else if !r.expectations.Satisfied(client.ObjectKeyFromObject(machineSet)) {
+		// The machines are synced once the cache reflects the machines created and deleted by the previous sync,
+		// the events of these machines trigger the next reconcile.
+		klog.V(4).Infof("%v: waiting for the cache to reflect the machines created and deleted", machineSet.Name)
+	} else {
+		var replicaMachines []*machinev1.Machine
+		replicaMachines, waitingForReplacement, syncErr = r.reconcileReplacements(ctx, machineSet, filteredMachines)
+		if syncErr == nil {
+			progress, syncErr = r.syncReplicas(ctx, machineSet, replicaMachines)
+			synced = syncErr == nil
+		}
+	}
 
 	ms := machineSet.DeepCopy()
 	newStatus := r.calculateStatus(ms, filteredMachines)
 
+	// The template, replacement status and scaling progress are patched first, as patching the MachineSet resets its status
+	// to the one on the server. The scaling progress is left as it is while the replicas are not synced.
+	err = patchStatusAnnotation(ctx, r.Client, machineSet, machines.TemplateStatusAnnotation, calculateTemplateStatus(ms, filteredMachines))
+	if err == nil {
+		var value interface{}
+		if replacementStatus := calculateReplacementStatus(filteredMachines); replacementStatus != nil {
+			value = replacementStatus
+		}
+		err = patchStatusAnnotation(ctx, r.Client, machineSet, machines.ReplacementStatusAnnotation, value)
+	}
+	if err == nil && synced {
+		var value interface{}
+		if !progress.IsZero() {
+			value = progress
+		}
+		err = patchStatusAnnotation(ctx, r.Client, machineSet, scalingpolicy.ScalingProgressAnnotation, value)
+	}
+	if err != nil {
+		if syncErr != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to sync machines: %v. failed to update machine set status annotations: %w", syncErr, err)
+		}
+		return reconcile.Result{}, fmt.Errorf("failed to update machine set status annotations: %w", err)
+	}
+
 	// Always updates status as machines come up or die.
 	updatedMS, err := updateMachineSetStatus(r.Client, machineSet, newStatus)
 	if err != nil {
@@ -261,84 +344,97 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *machine
 		return reconcile.Result{Requeue: true}, nil
 	}
 
+	if waitingForReplacement {
+		return reconcile.Result{RequeueAfter: replacementNodeReadyInterval}, nil
+	}
+
+	if progress.PendingCreates > 0 || progress.PendingDeletes > 0 {
+		return reconcile.Result{RequeueAfter: scalingProgressInterval}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
-// syncReplicas essentially scales machine resources up and down.
-func (r *ReconcileMachineSet) syncReplicas(ms *machinev1.MachineSet, machines []*machinev1.Machine) error {
+// syncReplicas essentially scales machine resources up and down, within the limits set by the scaling policy of the MachineSet.
+// It returns the progress of the MachineSet towards its replicas once the machines have been created or deleted.
+func (r *ReconcileMachineSet) syncReplicas(ctx context.Context, ms *machinev1.MachineSet, machines []*machinev1.Machine) (scalingpolicy.ScalingProgress, error) {
+	progress := scalingpolicy.ScalingProgress{}
 	if ms.Spec.Replicas == nil {
-		return fmt.Errorf("the Replicas field in Spec for machineset %v is nil, this should not be allowed", ms.Name)
+		return progress, fmt.Errorf("the Replicas field in Spec for machineset %v is nil, this should not be allowed", ms.Name)
 	}
 
+	policy, errs := scalingpolicy.Parse(ms.Annotations, field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		return progress, fmt.Errorf("invalid scaling policy: %v", errs.ToAggregate())
+	}
+
+	deleting, err := r.getDeletingMachines(ctx, ms)
+	if err != nil {
+		return progress, fmt.Errorf("failed to list deleting machines: %w", err)
+	}
+	progress.Creating = int32(countProvisioningMachines(machines))
+	progress.Deleting = int32(len(deleting))
+
 	diff := len(machines) - int(*(ms.Spec.Replicas))
 
 	if diff < 0 {
 		diff *= -1
+		allowed := policy.Create.Allowed(diff, int(progress.Creating))
+		progress.PendingCreates = int32(diff - allowed)
 		klog.Infof("Too few replicas for %v %s/%s, need %d, creating %d",
-			controllerKind, ms.Namespace, ms.Name, *(ms.Spec.Replicas), diff)
+			controllerKind, ms.Namespace, ms.Name, *(ms.Spec.Replicas), allowed)
+		if allowed < diff {
+			klog.Infof("%v: deferring the creation of %d machines, %d machines are provisioning", ms.Name, diff-allowed, progress.Creating)
+		}
 
-		var machineList []*machinev1.Machine
+		// The creations are expected before the machines are created, as the cache may observe them straight away.
+		key := client.ObjectKeyFromObject(ms)
+		r.expectations.ExpectCreations(key, allowed)
 		var errstrings []string
-		for i := 0; i < diff; i++ {
+		for i := 0; i < allowed; i++ {
 			klog.Infof("Creating machine %d of %d, ( spec.replicas(%d) > currentMachineCount(%d) )",
-				i+1, diff, *(ms.Spec.Replicas), len(machines))
+				i+1, allowed, *(ms.Spec.Replicas), len(machines))
 
 			machine := r.createMachine(ms)
-			if err := r.Client.Create(context.Background(), machine); err != nil {
+			// The Machine is traced from the reconcile of the MachineSet which created it.
+			tracing.Inject(ctx, machine)
+			if err := r.Client.Create(ctx, machine); err != nil {
 				klog.Errorf("Unable to create Machine %q: %v", machine.Name, err)
 				errstrings = append(errstrings, err.Error())
+				// The machine will never be observed.
+				r.expectations.CreationObserved(key)
 				continue
 			}
 
-			machineList = append(machineList, machine)
+			progress.Creating++
 		}
 
 		if len(errstrings) > 0 {
-			return errors.New(strings.Join(errstrings, "; "))
+			return progress, errors.New(strings.Join(errstrings, "; "))
 		}
 
-		return r.waitForMachineCreation(machineList)
+		return progress, nil
 	} else if diff > 0 {
+		allowed := policy.Delete.Allowed(diff, int(progress.Deleting))
+		progress.PendingDeletes = int32(diff - allowed)
 		klog.Infof("Too many replicas for %v %s/%s, need %d, deleting %d",
-			controllerKind, ms.Namespace, ms.Name, *(ms.Spec.Replicas), diff)
-
-		deletePriorityFunc, err := getDeletePriorityFunc(ms)
-		if err != nil {
-			return err
+			controllerKind, ms.Namespace, ms.Name, *(ms.Spec.Replicas), allowed)
+		if allowed < diff {
+			klog.Infof("%v: deferring the deletion of %d machines, %d machines are deleting", ms.Name, diff-allowed, progress.Deleting)
 		}
-		klog.Infof("Found %s delete policy", ms.Spec.DeletePolicy)
-		// Choose which Machines to delete.
-		machinesToDelete := getMachinesToDeletePrioritized(machines, diff, deletePriorityFunc)
-
-		// TODO: Add cap to limit concurrent delete calls.
-		errCh := make(chan error, diff)
-		var wg sync.WaitGroup
-		wg.Add(diff)
-		for _, machine := range machinesToDelete {
-			go func(targetMachine *machinev1.Machine) {
-				defer wg.Done()
-				err := r.Client.Delete(context.Background(), targetMachine)
-				if err != nil {
-					klog.Errorf("Unable to delete Machine %s: %v", targetMachine.Name, err)
-					errCh <- err
-				}
-			}(machine)
-		}
-		wg.Wait()
 
-		select {
-		case err := <-errCh:
-			// all errors have been reported before and they're likely to be the same, so we'll only return the first one we hit.
-			if err != nil {
-				return err
-			}
-		default:
+		// Choose which Machines to delete.
+		machinesToDelete, err := r.getMachinesToDelete(ctx, ms, machines, allowed)
+		if err != nil {
+			return progress, err
 		}
 
-		return r.waitForMachineDeletion(machinesToDelete)
+		deleted, err := r.deleteMachines(ctx, ms, machinesToDelete)
+		progress.Deleting += int32(deleted)
+		return progress, err
 	}
 
-	return nil
+	return progress, nil
 }
 
 // createMachine creates a machine resource.
@@ -351,7 +447,8 @@ func (r *ReconcileMachineSet) createMachine(machineSet *machinev1.MachineSet) *m
 			APIVersion: gv.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Labels:      machineSet.Spec.Template.ObjectMeta.Labels,
+			// The template hash records which template the machine was created from, to report outdated machines.
+			Labels:      copyWith(machineSet.Spec.Template.ObjectMeta.Labels, rolloutpolicy.TemplateHashLabel, templateHash(&machineSet.Spec.Template)),
 			Annotations: machineSet.Spec.Template.ObjectMeta.Annotations,
 		},
 		Spec: machineSet.Spec.Template.Spec,
@@ -388,53 +485,6 @@ func (r *ReconcileMachineSet) adoptOrphan(machineSet *machinev1.MachineSet, mach
 	return r.Client.Update(context.Background(), machine)
 }
 
-func (r *ReconcileMachineSet) waitForMachineCreation(machineList []*machinev1.Machine) error {
-	for _, machine := range machineList {
-		pollErr := util.PollImmediate(stateConfirmationInterval, stateConfirmationTimeout, func() (bool, error) {
-			key := client.ObjectKey{Namespace: machine.Namespace, Name: machine.Name}
-
-			if err := r.Client.Get(context.Background(), key, &machinev1.Machine{}); err != nil {
-				if apierrors.IsNotFound(err) {
-					return false, nil
-				}
-				klog.Error(err)
-				return false, err
-			}
-
-			return true, nil
-		})
-
-		if pollErr != nil {
-			klog.Error(pollErr)
-			return fmt.Errorf("failed waiting for machine object to be created: %w", pollErr)
-		}
-	}
-
-	return nil
-}
-
-func (r *ReconcileMachineSet) waitForMachineDeletion(machineList []*machinev1.Machine) error {
-	for _, machine := range machineList {
-		pollErr := util.PollImmediate(stateConfirmationInterval, stateConfirmationTimeout, func() (bool, error) {
-			m := &machinev1.Machine{}
-			key := client.ObjectKey{Namespace: machine.Namespace, Name: machine.Name}
-
-			err := r.Client.Get(context.Background(), key, m)
-			if apierrors.IsNotFound(err) || !m.DeletionTimestamp.IsZero() {
-				return true, nil
-			}
-
-			return false, err
-		})
-
-		if pollErr != nil {
-			klog.Error(pollErr)
-			return fmt.Errorf("failed waiting for machine object to be deleted: %w", pollErr)
-		}
-	}
-	return nil
-}
-
 func validateMachineset(m *machinev1.MachineSet) field.ErrorList {
 	errors := field.ErrorList{}
 
@@ -31,6 +31,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
 )
 
 var _ reconcile.Reconciler = &ReconcileMachineSet{}
@@ -257,6 +259,48 @@ func TestAdoptOrphan(t *testing.T) {
 	}
 }
 
+func TestReconcilePausedMachineSet(t *testing.T) {
+	g := NewWithT(t)
+
+	replicas := int32(2)
+	ms := &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "paused",
+			Namespace:   "default",
+			Annotations: map[string]string{annotations.PausedAnnotation: ""},
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas: &replicas,
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Template: machinev1.MachineTemplateSpec{
+				ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
+			},
+		},
+	}
+	orphan := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphan",
+			Namespace: "default",
+			Labels:    map[string]string{"foo": "bar"},
+		},
+	}
+
+	g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+	r := &ReconcileMachineSet{
+		Client:   fake.NewFakeClientWithScheme(scheme.Scheme, ms, orphan),
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(32),
+	}
+
+	_, err := r.reconcile(ctx, ms)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	machines := &machinev1.MachineList{}
+	g.Expect(r.Client.List(ctx, machines, client.InNamespace("default"))).To(Succeed())
+	g.Expect(machines.Items).To(HaveLen(1), "a paused machineset should not create machines")
+	g.Expect(metav1.GetControllerOf(&machines.Items[0])).To(BeNil(), "a paused machineset should not adopt machines")
+}
+
 var _ = Describe("MachineSet Reconcile", func() {
 	var r *ReconcileMachineSet
 	var result reconcile.Result
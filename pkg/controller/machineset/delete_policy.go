@@ -17,12 +17,17 @@ limitations under the License.
 package machineset
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type deletePriority float64
@@ -45,6 +50,13 @@ const (
 	mustNotDelete deletePriority = 0.0
 
 	secondsPerTenDays float64 = 864000
+
+	// zoneLabel is set on Machines by the machine controller, to the availability zone of their instance.
+	zoneLabel = "machine.openshift.io/zone"
+
+	// externalRemediationAnnotation is set on Machines by the MachineHealthCheck controller,
+	// when it requests the external remediation of an unhealthy Machine.
+	externalRemediationAnnotation = "host.metal3.io/external-remediation"
 )
 
 type deletePriorityFunc func(machine *machinev1.Machine) deletePriority
@@ -142,3 +154,176 @@ func getDeletePriorityFunc(ms *machinev1.MachineSet) (deletePriorityFunc, error)
 		return nil, fmt.Errorf("Unsupported delete policy %s. Must be one of 'Random', 'Newest', or 'Oldest'", msdp)
 	}
 }
+
+// isMustDeleteMachine returns true if the machine is deleted first whatever the delete policy:
+// it is being deleted, it has been annotated for deletion, or it has failed.
+func isMustDeleteMachine(machine *machinev1.Machine) bool {
+	if machine.DeletionTimestamp != nil && !machine.DeletionTimestamp.IsZero() {
+		return true
+	}
+	if machine.ObjectMeta.Annotations != nil && (machine.ObjectMeta.Annotations[DeleteNodeAnnotation] != "" || machine.ObjectMeta.Annotations[oldDeleteNodeAnnotation] != "") {
+		return true
+	}
+	return machine.Status.ErrorReason != nil || machine.Status.ErrorMessage != nil
+}
+
+// getMachinesToDelete chooses diff machines to delete out of the filtered machines of the MachineSet, according to
+// its delete policy. The delete policy annotation takes precedence over Spec.DeletePolicy.
+func (r *ReconcileMachineSet) getMachinesToDelete(ctx context.Context, ms *machinev1.MachineSet, filteredMachines []*machinev1.Machine, diff int) ([]*machinev1.Machine, error) {
+	policy, ok := ms.Annotations[machines.DeletePolicyAnnotation]
+	if !ok {
+		deletePriorityFunc, err := getDeletePriorityFunc(ms)
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("Found %s delete policy", ms.Spec.DeletePolicy)
+		return getMachinesToDeletePrioritized(filteredMachines, diff, deletePriorityFunc), nil
+	}
+
+	klog.Infof("Found %s delete policy", policy)
+	if diff <= 0 || diff >= len(filteredMachines) {
+		// There is no choice to make, so there is no need to look up the Nodes of the machines.
+		return getMachinesToDeletePrioritized(filteredMachines, diff, randomDeletePolicy), nil
+	}
+
+	switch machinev1.MachineSetDeletePolicy(policy) {
+	case machines.LeastUtilizedDeletePolicy:
+		deletePriorityFunc, err := r.leastUtilizedDeletePriority(ctx, filteredMachines)
+		if err != nil {
+			return nil, err
+		}
+		return getMachinesToDeletePrioritized(filteredMachines, diff, deletePriorityFunc), nil
+	case machines.UnhealthyFirstDeletePolicy:
+		return getMachinesToDeletePrioritized(filteredMachines, diff, r.unhealthyFirstDeletePriority(filteredMachines)), nil
+	case machines.ZoneBalancedDeletePolicy:
+		return getMachinesToDeleteZoneBalanced(filteredMachines, diff, randomDeletePolicy), nil
+	default:
+		return nil, fmt.Errorf("Unsupported delete policy %s. Must be one of '%s', '%s', or '%s'", policy,
+			machines.LeastUtilizedDeletePolicy, machines.UnhealthyFirstDeletePolicy, machines.ZoneBalancedDeletePolicy)
+	}
+}
+
+// leastUtilizedDeletePriority returns a delete priority func which maps the number of pods running on the Node of each
+// machine onto the 0-40 priority range, fewer pods giving a higher priority. DaemonSet and static pods are not counted,
+// as they run on every Node. Machines without a Node are not running any workloads, and come before all of them.
+func (r *ReconcileMachineSet) leastUtilizedDeletePriority(ctx context.Context, filteredMachines []*machinev1.Machine) (deletePriorityFunc, error) {
+	podCounts := make(map[string]int)
+	for _, machine := range filteredMachines {
+		if machine.Status.NodeRef == nil {
+			continue
+		}
+		nodeName := machine.Status.NodeRef.Name
+		count, err := r.countWorkloadPods(ctx, nodeName)
+		if err != nil {
+			return nil, fmt.Errorf("could not count the pods of node %s: %w", nodeName, err)
+		}
+		podCounts[nodeName] = count
+	}
+
+	return func(machine *machinev1.Machine) deletePriority {
+		if isMustDeleteMachine(machine) {
+			return mustDelete
+		}
+		if machine.Status.NodeRef == nil {
+			return betterDelete
+		}
+		return preferDelete / deletePriority(1+podCounts[machine.Status.NodeRef.Name])
+	}, nil
+}
+
+// countWorkloadPods returns the number of pods running on the Node which are neither DaemonSet nor static pods.
+// Pods are read straight from the API, as the controller does not otherwise need a cache of every pod of the cluster.
+func (r *ReconcileMachineSet) countWorkloadPods(ctx context.Context, nodeName string) (int, error) {
+	pods := &corev1.PodList{}
+	if err := r.apiReader.List(ctx, pods, client.MatchingFields{"spec.nodeName": nodeName}); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName != nodeName || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "DaemonSet" {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// unhealthyFirstDeletePriority returns a delete priority func which prefers the machines whose Node is not Ready, or
+// which a MachineHealthCheck has flagged for external remediation, then the machines without a Node yet.
+func (r *ReconcileMachineSet) unhealthyFirstDeletePriority(filteredMachines []*machinev1.Machine) deletePriorityFunc {
+	// The Nodes are only looked up once, as sorting the machines evaluates their priority many times.
+	unhealthy := make(map[string]bool)
+	for _, machine := range filteredMachines {
+		if _, ok := machine.Annotations[externalRemediationAnnotation]; ok {
+			unhealthy[machine.Name] = true
+			continue
+		}
+		if machine.Status.NodeRef != nil {
+			unhealthy[machine.Name] = !machines.IsMachineHealthy(r.Client, machine)
+		}
+	}
+
+	return func(machine *machinev1.Machine) deletePriority {
+		if isMustDeleteMachine(machine) {
+			return mustDelete
+		}
+		if unhealthy[machine.Name] {
+			return betterDelete
+		}
+		// The machine doesn't have a Node yet, and therefore isn't running any workloads
+		if machine.Status.NodeRef == nil {
+			return preferDelete
+		}
+		return couldDelete
+	}
+}
+
+// getMachinesToDeleteZoneBalanced chooses diff machines to delete so that the remaining machines are spread as evenly
+// as possible across the zones of their zone label. The machines the priority func ranks betterDelete or above are
+// deleted first whatever their zone. Otherwise each machine is taken from the zone with the most machines left,
+// picking the machine of the zone with the highest priority.
+func getMachinesToDeleteZoneBalanced(filteredMachines []*machinev1.Machine, diff int, fun deletePriorityFunc) []*machinev1.Machine {
+	if diff >= len(filteredMachines) {
+		return filteredMachines
+	} else if diff <= 0 {
+		return []*machinev1.Machine{}
+	}
+
+	sortable := sortableMachines{
+		machines: append([]*machinev1.Machine{}, filteredMachines...),
+		priority: fun,
+	}
+	sort.Stable(sortable)
+
+	var toDelete []*machinev1.Machine
+	zones := make(map[string][]*machinev1.Machine)
+	for _, machine := range sortable.machines {
+		if len(toDelete) < diff && fun(machine) >= betterDelete {
+			toDelete = append(toDelete, machine)
+			continue
+		}
+		zone := machine.Labels[zoneLabel]
+		zones[zone] = append(zones[zone], machine)
+	}
+
+	for len(toDelete) < diff {
+		var largest string
+		for zone, zoneMachines := range zones {
+			if len(zoneMachines) > len(zones[largest]) || (len(zoneMachines) == len(zones[largest]) && zone < largest) {
+				largest = zone
+			}
+		}
+		toDelete = append(toDelete, zones[largest][0])
+		zones[largest] = zones[largest][1:]
+	}
+
+	return toDelete
+}
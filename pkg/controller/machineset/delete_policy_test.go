@@ -21,8 +21,13 @@ import (
 	"testing"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestMachineToDelete(t *testing.T) {
@@ -356,3 +361,246 @@ func TestMachineOldestDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestMachineZoneBalancedDelete(t *testing.T) {
+	zoneMachine := func(name, zone string) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneLabel: zone}},
+			Status:     machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+	}
+	a1, a2, a3, a4 := zoneMachine("a1", "a"), zoneMachine("a2", "a"), zoneMachine("a3", "a"), zoneMachine("a4", "a")
+	b1, b2, b3 := zoneMachine("b1", "b"), zoneMachine("b2", "b"), zoneMachine("b3", "b")
+	c1 := zoneMachine("c1", "c")
+	deleteMeB := zoneMachine("delete-me-b", "b")
+	deleteMeB.Annotations = map[string]string{DeleteNodeAnnotation: "yes"}
+	notYetRunningA := zoneMachine("not-yet-running-a", "a")
+	notYetRunningA.Status.NodeRef = nil
+	noZone := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "no-zone"}, Status: machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{}}}
+
+	tests := []struct {
+		desc     string
+		machines []*machinev1.Machine
+		diff     int
+		expect   []*machinev1.Machine
+	}{
+		{
+			desc:     "diff=0",
+			diff:     0,
+			machines: []*machinev1.Machine{a1, b1},
+			expect:   []*machinev1.Machine{},
+		},
+		{
+			desc:     "diff>len(machines)",
+			diff:     3,
+			machines: []*machinev1.Machine{a1, b1},
+			expect:   []*machinev1.Machine{a1, b1},
+		},
+		{
+			desc:     "deletes from the largest zone",
+			diff:     1,
+			machines: []*machinev1.Machine{b1, a1, a2},
+			expect:   []*machinev1.Machine{a1},
+		},
+		{
+			desc:     "rebalances the zones as it deletes",
+			diff:     3,
+			machines: []*machinev1.Machine{a1, a2, a3, a4, b1, b2, b3},
+			expect:   []*machinev1.Machine{a1, a2, b1},
+		},
+		{
+			desc:     "annotated machines come first whatever their zone",
+			diff:     2,
+			machines: []*machinev1.Machine{a1, a2, a3, deleteMeB, c1},
+			expect:   []*machinev1.Machine{deleteMeB, a1},
+		},
+		{
+			desc:     "machines without a Node come first within their zone",
+			diff:     1,
+			machines: []*machinev1.Machine{a1, a2, notYetRunningA, b1},
+			expect:   []*machinev1.Machine{notYetRunningA},
+		},
+		{
+			desc:     "machines without a zone are balanced as a zone of their own",
+			diff:     2,
+			machines: []*machinev1.Machine{noZone, a1, a2, b1},
+			expect:   []*machinev1.Machine{a1, noZone},
+		},
+	}
+
+	for _, test := range tests {
+		result := getMachinesToDeleteZoneBalanced(test.machines, test.diff, randomDeletePolicy)
+		if !reflect.DeepEqual(result, test.expect) {
+			t.Errorf("[case %s] expected %v, got %v", test.desc, machineNames(test.expect), machineNames(result))
+		}
+	}
+}
+
+func TestMachineLeastUtilizedDelete(t *testing.T) {
+	nodeMachine := func(name string) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+	}
+	busy, quiet, idle := nodeMachine("busy"), nodeMachine("quiet"), nodeMachine("idle")
+	notYetRunning := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "not-yet-running"}}
+	deleteMe := nodeMachine("delete-me")
+	deleteMe.Annotations = map[string]string{DeleteNodeAnnotation: "yes"}
+
+	var pods []client.Object
+	newPod := func(name, node string, mutate func(*corev1.Pod)) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if mutate != nil {
+			mutate(pod)
+		}
+		pods = append(pods, pod)
+	}
+	newPod("busy-1", "busy", nil)
+	newPod("busy-2", "busy", nil)
+	newPod("quiet-1", "quiet", nil)
+	newPod("delete-me-1", "delete-me", nil)
+	newPod("delete-me-2", "delete-me", nil)
+	// Neither DaemonSet, static nor terminated pods count towards the utilization of a Node.
+	newPod("idle-daemonset", "idle", func(p *corev1.Pod) {
+		p.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", Controller: pointer.Bool(true)}}
+	})
+	newPod("idle-static", "idle", func(p *corev1.Pod) {
+		p.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	})
+	newPod("idle-completed", "idle", func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded })
+	newPod("idle-failed", "idle", func(p *corev1.Pod) { p.Status.Phase = corev1.PodFailed })
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pods...).Build()
+	r := &ReconcileMachineSet{Client: fakeClient, apiReader: fakeClient}
+	ms := newScalingMachineSet(1, map[string]string{machines.DeletePolicyAnnotation: string(machines.LeastUtilizedDeletePolicy)})
+
+	tests := []struct {
+		desc     string
+		machines []*machinev1.Machine
+		diff     int
+		expect   []*machinev1.Machine
+	}{
+		{
+			desc:     "deletes the machines running the fewest pods",
+			diff:     2,
+			machines: []*machinev1.Machine{busy, quiet, idle},
+			expect:   []*machinev1.Machine{idle, quiet},
+		},
+		{
+			desc:     "machines without a Node come first",
+			diff:     2,
+			machines: []*machinev1.Machine{busy, idle, notYetRunning},
+			expect:   []*machinev1.Machine{notYetRunning, idle},
+		},
+		{
+			desc:     "annotated machines come first",
+			diff:     1,
+			machines: []*machinev1.Machine{busy, idle, deleteMe},
+			expect:   []*machinev1.Machine{deleteMe},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := r.getMachinesToDelete(ctx, ms, test.machines, test.diff)
+		if err != nil {
+			t.Fatalf("[case %s] unexpected error: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(result, test.expect) {
+			t.Errorf("[case %s] expected %v, got %v", test.desc, machineNames(test.expect), machineNames(result))
+		}
+	}
+}
+
+func TestMachineUnhealthyFirstDelete(t *testing.T) {
+	nodeMachine := func(name string, ready corev1.ConditionStatus) (*machinev1.Machine, *corev1.Node) {
+		machine := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+		return machine, node
+	}
+	healthy, healthyNode := nodeMachine("healthy", corev1.ConditionTrue)
+	notReady, notReadyNode := nodeMachine("not-ready", corev1.ConditionFalse)
+	remediated, remediatedNode := nodeMachine("remediated", corev1.ConditionTrue)
+	remediated.Annotations = map[string]string{externalRemediationAnnotation: ""}
+	nodeGone := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-gone"},
+		Status:     machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node-gone"}},
+	}
+	notYetRunning := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "not-yet-running"}}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(healthyNode, notReadyNode, remediatedNode).Build()
+	r := &ReconcileMachineSet{Client: fakeClient, apiReader: fakeClient}
+	ms := newScalingMachineSet(1, map[string]string{machines.DeletePolicyAnnotation: string(machines.UnhealthyFirstDeletePolicy)})
+
+	tests := []struct {
+		desc     string
+		machines []*machinev1.Machine
+		diff     int
+		expect   []*machinev1.Machine
+	}{
+		{
+			desc:     "deletes the machines whose Node is not Ready",
+			diff:     1,
+			machines: []*machinev1.Machine{healthy, notReady},
+			expect:   []*machinev1.Machine{notReady},
+		},
+		{
+			desc:     "deletes the machines flagged for external remediation",
+			diff:     1,
+			machines: []*machinev1.Machine{healthy, remediated},
+			expect:   []*machinev1.Machine{remediated},
+		},
+		{
+			desc:     "deletes the machines whose Node is gone",
+			diff:     1,
+			machines: []*machinev1.Machine{healthy, nodeGone},
+			expect:   []*machinev1.Machine{nodeGone},
+		},
+		{
+			desc:     "unhealthy machines come before machines without a Node",
+			diff:     2,
+			machines: []*machinev1.Machine{healthy, notYetRunning, notReady},
+			expect:   []*machinev1.Machine{notReady, notYetRunning},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := r.getMachinesToDelete(ctx, ms, test.machines, test.diff)
+		if err != nil {
+			t.Fatalf("[case %s] unexpected error: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(result, test.expect) {
+			t.Errorf("[case %s] expected %v, got %v", test.desc, machineNames(test.expect), machineNames(result))
+		}
+	}
+}
+
+func TestGetMachinesToDeleteUnsupportedPolicy(t *testing.T) {
+	r := &ReconcileMachineSet{}
+	ms := newScalingMachineSet(1, map[string]string{machines.DeletePolicyAnnotation: "Cheapest"})
+	running := &machinev1.Machine{Status: machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{}}}
+
+	if _, err := r.getMachinesToDelete(ctx, ms, []*machinev1.Machine{running, running}, 1); err == nil {
+		t.Errorf("expected an error for an unsupported delete policy")
+	}
+}
+
+func machineNames(machineList []*machinev1.Machine) []string {
+	names := []string{}
+	for _, machine := range machineList {
+		names = append(names, machine.Name)
+	}
+	return names
+}
@@ -0,0 +1,207 @@
+package machineset
+
+import (
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// expectationsTimeout is the amount of time after which the creations and deletions a MachineSet expects are given up on,
+// so that a missed event does not stop the MachineSet from syncing its machines forever.
+var expectationsTimeout = 5 * time.Minute
+
+// machineSetExpectations tracks the machines each MachineSet has created and deleted, until the creations and
+// deletions are observed through the events of the machine informer. A MachineSet only syncs its machines once
+// its expectations are satisfied, so that it does not act on a cache which does not reflect its own changes yet.
+//
+// A nil machineSetExpectations expects nothing, which suits clients which read their own writes.
+type machineSetExpectations struct {
+	lock  sync.Mutex
+	items map[types.NamespacedName]*expectation
+
+	// nowFunc returns the current time, it is replaced in tests.
+	nowFunc func() time.Time
+}
+
+// expectation holds the creations and deletions a MachineSet is waiting to observe.
+type expectation struct {
+	// adds is the number of machines created but not observed yet.
+	adds int
+
+	// deletes are the UIDs of the machines deleted but not observed yet.
+	deletes sets.String
+
+	// timestamp is when the first of the expected creations and deletions was made.
+	timestamp time.Time
+}
+
+// newMachineSetExpectations returns expectations which expect nothing.
+func newMachineSetExpectations() *machineSetExpectations {
+	return &machineSetExpectations{
+		items:   make(map[types.NamespacedName]*expectation),
+		nowFunc: time.Now,
+	}
+}
+
+// Satisfied returns whether the MachineSet has observed all of the creations and deletions it expects,
+// or has given up on them after the expectations timeout.
+func (e *machineSetExpectations) Satisfied(key types.NamespacedName) bool {
+	if e == nil {
+		return true
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	exp, ok := e.items[key]
+	if !ok {
+		return true
+	}
+	if exp.adds <= 0 && exp.deletes.Len() == 0 {
+		delete(e.items, key)
+		return true
+	}
+	if e.nowFunc().Sub(exp.timestamp) > expectationsTimeout {
+		klog.Warningf("%v: giving up on observing %d machine creations and %d machine deletions", key, exp.adds, exp.deletes.Len())
+		delete(e.items, key)
+		return true
+	}
+	klog.V(4).Infof("%v: waiting to observe %d machine creations and %d machine deletions", key, exp.adds, exp.deletes.Len())
+	return false
+}
+
+// ExpectCreations records that the MachineSet is about to create the given number of machines.
+func (e *machineSetExpectations) ExpectCreations(key types.NamespacedName, adds int) {
+	if e == nil || adds <= 0 {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.get(key).adds += adds
+}
+
+// CreationObserved records that a machine created by the MachineSet has been observed,
+// or that the creation of a machine failed.
+func (e *machineSetExpectations) CreationObserved(key types.NamespacedName) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if exp, ok := e.items[key]; ok && exp.adds > 0 {
+		exp.adds--
+	}
+}
+
+// ExpectDeletions records that the MachineSet is about to delete the given machines.
+func (e *machineSetExpectations) ExpectDeletions(key types.NamespacedName, machines []*machinev1.Machine) {
+	if e == nil || len(machines) == 0 {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	exp := e.get(key)
+	for _, machine := range machines {
+		exp.deletes.Insert(string(machine.UID))
+	}
+}
+
+// DeletionObserved records that the deletion of a machine of the MachineSet has been observed,
+// or that the deletion of the machine failed. A deletion is only ever observed once.
+func (e *machineSetExpectations) DeletionObserved(key types.NamespacedName, uid types.UID) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if exp, ok := e.items[key]; ok {
+		exp.deletes.Delete(string(uid))
+	}
+}
+
+// Delete forgets the expectations of a MachineSet which no longer exists.
+func (e *machineSetExpectations) Delete(key types.NamespacedName) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	delete(e.items, key)
+}
+
+// get returns the expectation of the MachineSet, creating it if needed. The lock must be held.
+func (e *machineSetExpectations) get(key types.NamespacedName) *expectation {
+	exp, ok := e.items[key]
+	if !ok {
+		exp = &expectation{deletes: sets.NewString(), timestamp: e.nowFunc()}
+		e.items[key] = exp
+	}
+	return exp
+}
+
+// machineEventHandler records the creations and deletions of machines against the expectations of the MachineSets
+// which control them, before enqueueing these MachineSets. The expectations are always updated before the
+// MachineSet is reconciled, so the reconcile sees the machine it is waiting for.
+func machineEventHandler(expectations *machineSetExpectations) handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			if key, ok := machineSetKeyForMachine(e.Object); ok {
+				expectations.CreationObserved(key)
+				q.Add(reconcile.Request{NamespacedName: key})
+			}
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			oldKey, oldOK := machineSetKeyForMachine(e.ObjectOld)
+			key, ok := machineSetKeyForMachine(e.ObjectNew)
+			if ok && e.ObjectNew.GetDeletionTimestamp() != nil {
+				// A machine with a finalizer is only marked for deletion at first.
+				expectations.DeletionObserved(key, e.ObjectNew.GetUID())
+			}
+			if oldOK && oldKey != key {
+				q.Add(reconcile.Request{NamespacedName: oldKey})
+			}
+			if ok {
+				q.Add(reconcile.Request{NamespacedName: key})
+			}
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			if key, ok := machineSetKeyForMachine(e.Object); ok {
+				expectations.DeletionObserved(key, e.Object.GetUID())
+				q.Add(reconcile.Request{NamespacedName: key})
+			}
+		},
+		GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+			if key, ok := machineSetKeyForMachine(e.Object); ok {
+				q.Add(reconcile.Request{NamespacedName: key})
+			}
+		},
+	}
+}
+
+// machineSetKeyForMachine returns the key of the MachineSet which controls the machine, if any.
+func machineSetKeyForMachine(o client.Object) (types.NamespacedName, bool) {
+	ref := metav1.GetControllerOf(o)
+	if ref == nil || ref.Kind != controllerKind.Kind {
+		return types.NamespacedName{}, false
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != controllerKind.Group {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: o.GetNamespace(), Name: ref.Name}, true
+}
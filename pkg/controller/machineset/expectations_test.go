@@ -0,0 +1,140 @@
+package machineset
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMachineSetExpectations(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	e := newMachineSetExpectations()
+	e.nowFunc = func() time.Time { return now }
+	key := types.NamespacedName{Namespace: "default", Name: "ms"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+
+	g.Expect(e.Satisfied(key)).To(BeTrue(), "a MachineSet without expectations should be satisfied")
+
+	e.ExpectCreations(key, 2)
+	e.ExpectDeletions(key, []*machinev1.Machine{{ObjectMeta: metav1.ObjectMeta{UID: "a"}}})
+	g.Expect(e.Satisfied(key)).To(BeFalse())
+	g.Expect(e.Satisfied(other)).To(BeTrue(), "the expectations of other MachineSets should not be affected")
+
+	e.CreationObserved(key)
+	e.CreationObserved(key)
+	g.Expect(e.Satisfied(key)).To(BeFalse(), "the deletion should still be expected")
+
+	e.DeletionObserved(key, "b")
+	g.Expect(e.Satisfied(key)).To(BeFalse(), "the deletion of another machine should be ignored")
+	e.DeletionObserved(key, "a")
+	e.DeletionObserved(key, "a")
+	g.Expect(e.Satisfied(key)).To(BeTrue())
+
+	e.CreationObserved(key)
+	e.ExpectCreations(key, 1)
+	g.Expect(e.Satisfied(key)).To(BeFalse(), "creations observed before they are expected should not count")
+
+	now = now.Add(expectationsTimeout + time.Second)
+	g.Expect(e.Satisfied(key)).To(BeTrue(), "the expectations should be given up on after the timeout")
+
+	e.ExpectCreations(key, 1)
+	e.Delete(key)
+	g.Expect(e.Satisfied(key)).To(BeTrue(), "the expectations of a deleted MachineSet should be forgotten")
+
+	var nilExpectations *machineSetExpectations
+	nilExpectations.ExpectCreations(key, 1)
+	g.Expect(nilExpectations.Satisfied(key)).To(BeTrue())
+}
+
+func TestMachineEventHandler(t *testing.T) {
+	g := NewWithT(t)
+
+	ms := &machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: "ms", Namespace: "default", UID: "ms-uid"}}
+	key := types.NamespacedName{Namespace: "default", Name: "ms"}
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "machine",
+			Namespace:       "default",
+			UID:             "machine-uid",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+		},
+	}
+	orphan := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default"}}
+
+	e := newMachineSetExpectations()
+	h := machineEventHandler(e)
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	e.ExpectCreations(key, 1)
+	h.Create(event.CreateEvent{Object: orphan}, q)
+	g.Expect(q.Len()).To(BeZero(), "machines without a MachineSet should be ignored")
+	h.Create(event.CreateEvent{Object: machine}, q)
+	g.Expect(e.Satisfied(key)).To(BeTrue())
+	g.Expect(q.Len()).To(Equal(1))
+	item, _ := q.Get()
+	g.Expect(item).To(Equal(reconcile.Request{NamespacedName: key}))
+	q.Done(item)
+
+	e.ExpectDeletions(key, []*machinev1.Machine{machine})
+	h.Update(event.UpdateEvent{ObjectOld: machine, ObjectNew: machine}, q)
+	g.Expect(e.Satisfied(key)).To(BeFalse(), "the update of a machine which is not deleting should not be a deletion")
+
+	deleting := machine.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	h.Update(event.UpdateEvent{ObjectOld: machine, ObjectNew: deleting}, q)
+	g.Expect(e.Satisfied(key)).To(BeTrue())
+
+	e.ExpectDeletions(key, []*machinev1.Machine{machine})
+	h.Delete(event.DeleteEvent{Object: machine}, q)
+	g.Expect(e.Satisfied(key)).To(BeTrue())
+}
+
+func TestReconcileWaitsForExpectations(t *testing.T) {
+	g := NewWithT(t)
+
+	ms := newScalingMachineSet(2, nil)
+	key := types.NamespacedName{Namespace: ms.Namespace, Name: ms.Name}
+	g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+	r := &ReconcileMachineSet{
+		Client:       fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ms).Build(),
+		scheme:       scheme.Scheme,
+		recorder:     record.NewFakeRecorder(32),
+		expectations: newMachineSetExpectations(),
+	}
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	machineList := &machinev1.MachineList{}
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	g.Expect(machineList.Items).To(HaveLen(2))
+	g.Expect(r.expectations.Satisfied(key)).To(BeFalse())
+
+	// A cache which does not reflect the creations yet lists fewer machines, which should not be created again.
+	g.Expect(r.Client.Delete(ctx, &machineList.Items[0])).To(Succeed())
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	g.Expect(machineList.Items).To(HaveLen(1))
+
+	// Once the creations are observed, the missing machine is created.
+	r.expectations.CreationObserved(key)
+	r.expectations.CreationObserved(key)
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	g.Expect(machineList.Items).To(HaveLen(2))
+}
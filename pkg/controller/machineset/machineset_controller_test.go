@@ -43,7 +43,7 @@ var _ = Describe("MachineSet Reconciler", func() {
 		By("Setting up a new reconciler")
 		reconciler := newReconciler(mgr)
 
-		err = add(mgr, reconciler, reconciler.MachineToMachineSets)
+		err = add(mgr, reconciler, reconciler.MachineToMachineSets, machineEventHandler(reconciler.expectations))
 		Expect(err).NotTo(HaveOccurred())
 
 		var mgrCtx context.Context
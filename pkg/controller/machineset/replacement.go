@@ -0,0 +1,284 @@
+package machineset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
+)
+
+// replacementNodeReadyInterval is the amount of time between checks for the Node of a replacement Machine to be Ready.
+// Nodes becoming Ready do not trigger a reconcile of the MachineSet.
+var replacementNodeReadyInterval = 30 * time.Second
+
+// replacementTimeout is the amount of time after its creation within which the Node of a replacement Machine
+// must be Ready, otherwise the replacement is failed.
+var replacementTimeout = 30 * time.Minute
+
+// reconcileReplacements replaces the machines of the MachineSet which requested it with the replace annotation.
+// A replacement machine is created first and the replaced machine is only deleted once the Node of its replacement
+// is Ready, so that the MachineSet does not lose capacity. When the MachineSet already has enough machines without
+// the replaced ones, for example because it is being scaled down, the replaced machines are deleted straight away.
+//
+// When the replacement Machine fails, or its Node is not Ready within the replacement timeout, the replacement is
+// deleted and the replaced machine is kept, with the reason of the failure recorded in the replacement failed annotation.
+//
+// It returns the machines to count towards the replicas of the MachineSet, which exclude the machines being replaced
+// and include their replacements, and whether it is waiting for the Node of a replacement to be Ready.
+func (r *ReconcileMachineSet) reconcileReplacements(ctx context.Context, ms *machinev1.MachineSet, filteredMachines []*machinev1.Machine) ([]*machinev1.Machine, bool, error) {
+	var replaced, counted []*machinev1.Machine
+	replacements := make(map[string]*machinev1.Machine)
+	for _, machine := range filteredMachines {
+		if machines.IsReplaceRequested(machine) && !machines.IsReplacementFailed(machine) {
+			replaced = append(replaced, machine)
+			continue
+		}
+		counted = append(counted, machine)
+		if err := r.setReplacedBy(ctx, machine, ""); err != nil {
+			return nil, false, err
+		}
+		if !machines.IsReplaceRequested(machine) {
+			// The failure of a replacement is forgotten along with the request.
+			if err := r.setReplacementFailed(ctx, machine, ""); err != nil {
+				return nil, false, err
+			}
+		}
+		if name, ok := machine.Annotations[machines.ReplacementForAnnotation]; ok {
+			replacements[name] = machine
+		}
+	}
+
+	var replicas int
+	if ms.Spec.Replicas != nil {
+		replicas = int(*ms.Spec.Replicas)
+	}
+
+	waiting := false
+	for _, machine := range replaced {
+		replacement, ok := replacements[machine.Name]
+		if !ok {
+			if len(counted) >= replicas {
+				klog.Infof("%v: deleting machine %q without a replacement: the machineset already has %d machines", ms.Name, machine.Name, len(counted))
+				if err := r.deleteReplacedMachine(ctx, ms, machine, ""); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+
+			var err error
+			replacement, err = r.createReplacementMachine(ctx, ms, machine)
+			if err != nil {
+				return nil, false, err
+			}
+			counted = append(counted, replacement)
+		}
+
+		if err := r.setReplacedBy(ctx, machine, replacement.Name); err != nil {
+			return nil, false, err
+		}
+
+		if len(counted) <= replicas {
+			node, err := r.getMachineNode(replacement)
+			if err != nil || !IsNodeReady(node) {
+				if failure := replacementFailure(replacement); failure != "" {
+					if err := r.failReplacement(ctx, ms, machine, replacement, failure); err != nil {
+						return nil, false, err
+					}
+					counted = append(withoutMachine(counted, replacement.Name), machine)
+					continue
+				}
+				klog.V(3).Infof("%v: waiting for the node of machine %q to be ready before deleting machine %q", ms.Name, replacement.Name, machine.Name)
+				waiting = true
+				continue
+			}
+		}
+
+		if err := r.deleteReplacedMachine(ctx, ms, machine, replacement.Name); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Replacements no longer paired with a machine requesting a replacement, because it is gone or the request
+	// was withdrawn, become regular machines of the MachineSet.
+	for name, replacement := range replacements {
+		if !r.replacementPairEnded(ctx, ms, name) {
+			continue
+		}
+		klog.Infof("%v: replacement of machine %q by machine %q has ended", ms.Name, name, replacement.Name)
+		patchBase := client.MergeFrom(replacement.DeepCopy())
+		delete(replacement.Annotations, machines.ReplacementForAnnotation)
+		if err := r.Client.Patch(ctx, replacement, patchBase); err != nil {
+			return nil, false, fmt.Errorf("failed to remove the %s annotation from machine %q: %w", machines.ReplacementForAnnotation, replacement.Name, err)
+		}
+	}
+
+	return counted, waiting, nil
+}
+
+// createReplacementMachine creates the machine which replaces the given machine.
+func (r *ReconcileMachineSet) createReplacementMachine(ctx context.Context, ms *machinev1.MachineSet, machine *machinev1.Machine) (*machinev1.Machine, error) {
+	replacement := r.createMachine(ms)
+	// The annotations of the template are shared with the MachineSet, so they are copied before being modified.
+	annotations := make(map[string]string, len(replacement.Annotations)+1)
+	for k, v := range replacement.Annotations {
+		annotations[k] = v
+	}
+	annotations[machines.ReplacementForAnnotation] = machine.Name
+	replacement.Annotations = annotations
+	tracing.Inject(ctx, replacement)
+
+	key := client.ObjectKeyFromObject(ms)
+	r.expectations.ExpectCreations(key, 1)
+	if err := r.Client.Create(ctx, replacement); err != nil {
+		r.expectations.CreationObserved(key)
+		return nil, fmt.Errorf("failed to create a replacement for machine %q: %w", machine.Name, err)
+	}
+
+	klog.Infof("%v: created machine %q to replace machine %q", ms.Name, replacement.Name, machine.Name)
+	r.recorder.Eventf(ms, corev1.EventTypeNormal, "ReplacementCreated", "Created machine %q to replace machine %q", replacement.Name, machine.Name)
+	return replacement, nil
+}
+
+// setReplacedBy records the name of its replacement on a machine being replaced.
+// An empty name removes the record, once the replacement of the machine is no longer requested.
+func (r *ReconcileMachineSet) setReplacedBy(ctx context.Context, machine *machinev1.Machine, replacementName string) error {
+	if machine.Annotations[machines.ReplacedByAnnotation] == replacementName {
+		return nil
+	}
+	patchBase := client.MergeFrom(machine.DeepCopy())
+	if replacementName == "" {
+		delete(machine.Annotations, machines.ReplacedByAnnotation)
+	} else {
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[machines.ReplacedByAnnotation] = replacementName
+	}
+	if err := r.Client.Patch(ctx, machine, patchBase); err != nil {
+		return fmt.Errorf("failed to set the %s annotation on machine %q: %w", machines.ReplacedByAnnotation, machine.Name, err)
+	}
+	return nil
+}
+
+// replacementFailure returns why the replacement machine failed, or an empty string while it may still succeed.
+func replacementFailure(replacement *machinev1.Machine) string {
+	if replacement.Status.Phase != nil && *replacement.Status.Phase == "Failed" {
+		if replacement.Status.ErrorMessage != nil {
+			return fmt.Sprintf("machine %q failed: %s", replacement.Name, *replacement.Status.ErrorMessage)
+		}
+		return fmt.Sprintf("machine %q failed", replacement.Name)
+	}
+	if !replacement.CreationTimestamp.IsZero() && time.Since(replacement.CreationTimestamp.Time) > replacementTimeout {
+		return fmt.Sprintf("the node of machine %q was not ready within %v", replacement.Name, replacementTimeout)
+	}
+	return ""
+}
+
+// failReplacement gives up on the replacement of a machine: the failure is recorded on the machine, which is kept,
+// and its replacement is deleted.
+func (r *ReconcileMachineSet) failReplacement(ctx context.Context, ms *machinev1.MachineSet, machine, replacement *machinev1.Machine, failure string) error {
+	klog.Warningf("%v: replacement of machine %q failed: %s", ms.Name, machine.Name, failure)
+	r.recorder.Eventf(ms, corev1.EventTypeWarning, "ReplacementFailed", "Replacement of machine %q failed: %s", machine.Name, failure)
+
+	if err := r.setReplacementFailed(ctx, machine, failure); err != nil {
+		return err
+	}
+	if err := r.setReplacedBy(ctx, machine, ""); err != nil {
+		return err
+	}
+	if _, err := r.deleteMachines(ctx, ms, []*machinev1.Machine{replacement}); err != nil {
+		return fmt.Errorf("failed to delete failed replacement machine %q: %w", replacement.Name, err)
+	}
+	return nil
+}
+
+// setReplacementFailed records why the replacement of a machine failed.
+// An empty failure removes the record, once the replacement of the machine is no longer requested.
+func (r *ReconcileMachineSet) setReplacementFailed(ctx context.Context, machine *machinev1.Machine, failure string) error {
+	if current, ok := machine.Annotations[machines.ReplacementFailedAnnotation]; (!ok && failure == "") || (ok && current == failure && failure != "") {
+		return nil
+	}
+	patchBase := client.MergeFrom(machine.DeepCopy())
+	if failure == "" {
+		delete(machine.Annotations, machines.ReplacementFailedAnnotation)
+	} else {
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[machines.ReplacementFailedAnnotation] = failure
+	}
+	if err := r.Client.Patch(ctx, machine, patchBase); err != nil {
+		return fmt.Errorf("failed to set the %s annotation on machine %q: %w", machines.ReplacementFailedAnnotation, machine.Name, err)
+	}
+	return nil
+}
+
+// withoutMachine returns the machines other than the named one.
+func withoutMachine(filteredMachines []*machinev1.Machine, name string) []*machinev1.Machine {
+	var result []*machinev1.Machine
+	for _, machine := range filteredMachines {
+		if machine.Name != name {
+			result = append(result, machine)
+		}
+	}
+	return result
+}
+
+// calculateReplacementStatus reports the replacements of the machines of the MachineSet which requested one.
+// It returns nil when no machine requested a replacement.
+func calculateReplacementStatus(filteredMachines []*machinev1.Machine) *machines.ReplacementStatus {
+	var replacements []machines.Replacement
+	for _, machine := range filteredMachines {
+		if !machines.IsReplaceRequested(machine) {
+			continue
+		}
+		replacements = append(replacements, machines.Replacement{
+			Machine:     machine.Name,
+			Replacement: machine.Annotations[machines.ReplacedByAnnotation],
+			Failure:     machine.Annotations[machines.ReplacementFailedAnnotation],
+		})
+	}
+	if len(replacements) == 0 {
+		return nil
+	}
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].Machine < replacements[j].Machine })
+	return &machines.ReplacementStatus{Replacements: replacements}
+}
+
+// deleteReplacedMachine deletes a machine which has been replaced. The machine is drained like any deleted machine.
+func (r *ReconcileMachineSet) deleteReplacedMachine(ctx context.Context, ms *machinev1.MachineSet, machine *machinev1.Machine, replacementName string) error {
+	key := client.ObjectKeyFromObject(ms)
+	r.expectations.ExpectDeletions(key, []*machinev1.Machine{machine})
+	if err := r.Client.Delete(ctx, machine); err != nil {
+		r.expectations.DeletionObserved(key, machine.UID)
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete replaced machine %q: %w", machine.Name, err)
+		}
+	}
+	if replacementName == "" {
+		r.recorder.Eventf(ms, corev1.EventTypeNormal, "ReplacedMachineDeleted", "Deleted machine %q without a replacement", machine.Name)
+		return nil
+	}
+	klog.Infof("%v: deleting machine %q replaced by machine %q", ms.Name, machine.Name, replacementName)
+	r.recorder.Eventf(ms, corev1.EventTypeNormal, "ReplacedMachineDeleted", "Deleted machine %q replaced by machine %q", machine.Name, replacementName)
+	return nil
+}
+
+// replacementPairEnded returns true if the named machine no longer exists or no longer requests a replacement.
+// A replaced machine which is being deleted still exists, so the pair is reported until the machine is gone.
+func (r *ReconcileMachineSet) replacementPairEnded(ctx context.Context, ms *machinev1.MachineSet, name string) bool {
+	machine := &machinev1.Machine{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: ms.Namespace, Name: name}, machine); err != nil {
+		return apierrors.IsNotFound(err)
+	}
+	return machine.DeletionTimestamp.IsZero() && !machines.IsReplaceRequested(machine)
+}
@@ -0,0 +1,297 @@
+package machineset
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+)
+
+func TestReconcileReplacements(t *testing.T) {
+	replicas := int32(2)
+	ms := &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ms",
+			Namespace: "default",
+			UID:       "ms-uid",
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas: &replicas,
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Template: machinev1.MachineTemplateSpec{
+				ObjectMeta: machinev1.ObjectMeta{
+					Labels:      map[string]string{"foo": "bar"},
+					Annotations: map[string]string{"template": "annotation"},
+				},
+			},
+		},
+	}
+	machine := func(name string, annotations map[string]string, nodeName string) *machinev1.Machine {
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"foo": "bar"},
+				Annotations:     annotations,
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+			},
+		}
+		if nodeName != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		}
+		return m
+	}
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+
+	failed := func(m *machinev1.Machine) *machinev1.Machine {
+		phase := "Failed"
+		message := "instance creation failed"
+		m.Status.Phase = &phase
+		m.Status.ErrorMessage = &message
+		return m
+	}
+	createdAgo := func(m *machinev1.Machine, age time.Duration) *machinev1.Machine {
+		m.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		return m
+	}
+
+	testCases := []struct {
+		name                   string
+		machines               []*machinev1.Machine
+		nodes                  []client.Object
+		expectedCounted        []string
+		expectedWaiting        bool
+		expectedReplacementFor string
+		expectedReplacedBy     map[string]string
+		expectedDeleted        []string
+		expectedPairEnded      bool
+		expectedFailure        map[string]string
+		expectedFailedEvents   []string
+	}{
+		{
+			name: "with no replacement requested",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", nil, ""),
+			},
+			expectedCounted: []string{"a", "b"},
+		},
+		{
+			name: "with a replacement requested",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: ""}, ""),
+			},
+			expectedCounted:        []string{"a", ""},
+			expectedWaiting:        true,
+			expectedReplacementFor: "b",
+		},
+		{
+			name: "with a replacement whose node is not ready",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacedByAnnotation: "c"}, ""),
+				machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, "node-c"),
+			},
+			nodes:              []client.Object{node("node-c", corev1.ConditionFalse)},
+			expectedCounted:    []string{"a", "c"},
+			expectedWaiting:    true,
+			expectedReplacedBy: map[string]string{"b": "c"},
+		},
+		{
+			name: "with a replacement whose node is ready",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: ""}, ""),
+				machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, "node-c"),
+			},
+			nodes:           []client.Object{node("node-c", corev1.ConditionTrue)},
+			expectedCounted: []string{"a", "c"},
+			expectedDeleted: []string{"b"},
+		},
+		{
+			name: "with a failed replacement",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacedByAnnotation: "c"}, ""),
+				failed(machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, "")),
+			},
+			expectedCounted:      []string{"a", "b"},
+			expectedReplacedBy:   map[string]string{"b": ""},
+			expectedDeleted:      []string{"c"},
+			expectedFailure:      map[string]string{"b": `machine "c" failed: instance creation failed`},
+			expectedFailedEvents: []string{`Warning ReplacementFailed Replacement of machine "b" failed: machine "c" failed: instance creation failed`},
+		},
+		{
+			name: "with a replacement whose node is not ready within the replacement timeout",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacedByAnnotation: "c"}, ""),
+				createdAgo(machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, "node-c"), time.Hour),
+			},
+			nodes:                []client.Object{node("node-c", corev1.ConditionFalse)},
+			expectedCounted:      []string{"a", "b"},
+			expectedReplacedBy:   map[string]string{"b": ""},
+			expectedDeleted:      []string{"c"},
+			expectedFailure:      map[string]string{"b": `the node of machine "c" was not ready within 30m0s`},
+			expectedFailedEvents: []string{`Warning ReplacementFailed Replacement of machine "b" failed: the node of machine "c" was not ready within 30m0s`},
+		},
+		{
+			name: "with a replacement whose node is not ready before the replacement timeout",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacedByAnnotation: "c"}, ""),
+				createdAgo(machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, "node-c"), time.Minute),
+			},
+			nodes:              []client.Object{node("node-c", corev1.ConditionFalse)},
+			expectedCounted:    []string{"a", "c"},
+			expectedWaiting:    true,
+			expectedReplacedBy: map[string]string{"b": "c"},
+		},
+		{
+			name: "with a replacement which failed before",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacementFailedAnnotation: "failure"}, ""),
+			},
+			expectedCounted: []string{"a", "b"},
+			expectedFailure: map[string]string{"b": "failure"},
+		},
+		{
+			name: "with a replacement request withdrawn after the replacement failed",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", map[string]string{machines.ReplacementFailedAnnotation: "failure"}, ""),
+			},
+			expectedCounted: []string{"a", "b"},
+			expectedFailure: map[string]string{"b": ""},
+		},
+		{
+			name: "with a replacement requested while the machineset has enough machines",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("b", nil, ""),
+				machine("c", map[string]string{machines.ReplaceAnnotation: ""}, ""),
+			},
+			expectedCounted: []string{"a", "b"},
+			expectedDeleted: []string{"c"},
+		},
+		{
+			name: "with a replacement whose replaced machine is gone",
+			machines: []*machinev1.Machine{
+				machine("a", nil, ""),
+				machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, ""),
+			},
+			expectedCounted:   []string{"a", "c"},
+			expectedPairEnded: true,
+		},
+		{
+			name: "with a replacement request withdrawn",
+			machines: []*machinev1.Machine{
+				machine("b", map[string]string{machines.ReplacedByAnnotation: "c"}, ""),
+				machine("c", map[string]string{machines.ReplacementForAnnotation: "b"}, ""),
+			},
+			expectedCounted:    []string{"b", "c"},
+			expectedReplacedBy: map[string]string{"b": ""},
+			expectedPairEnded:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+			objects := append([]client.Object{ms.DeepCopy()}, tc.nodes...)
+			for _, m := range tc.machines {
+				objects = append(objects, m)
+			}
+			recorder := record.NewFakeRecorder(32)
+			r := &ReconcileMachineSet{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+				scheme:   scheme.Scheme,
+				recorder: recorder,
+			}
+
+			counted, waiting, err := r.reconcileReplacements(ctx, ms, tc.machines)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(waiting).To(Equal(tc.expectedWaiting))
+
+			var countedNames []string
+			for _, m := range counted {
+				if m.Annotations[machines.ReplacementForAnnotation] == tc.expectedReplacementFor && tc.expectedReplacementFor != "" {
+					// Replacements created during the reconcile have a generated name.
+					countedNames = append(countedNames, "")
+					continue
+				}
+				countedNames = append(countedNames, m.Name)
+			}
+			g.Expect(countedNames).To(Equal(tc.expectedCounted))
+
+			list := &machinev1.MachineList{}
+			g.Expect(r.Client.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+			existing := map[string]machinev1.Machine{}
+			for _, m := range list.Items {
+				existing[m.Name] = m
+			}
+
+			for _, name := range tc.expectedDeleted {
+				g.Expect(existing).ToNot(HaveKey(name))
+			}
+
+			if tc.expectedReplacementFor != "" {
+				replacement := counted[len(counted)-1]
+				created, ok := existing[replacement.Name]
+				g.Expect(ok).To(BeTrue(), "the replacement machine should have been created")
+				g.Expect(created.Annotations).To(HaveKeyWithValue(machines.ReplacementForAnnotation, tc.expectedReplacementFor))
+				g.Expect(created.Annotations).To(HaveKeyWithValue("template", "annotation"))
+				g.Expect(existing[tc.expectedReplacementFor].Annotations).To(HaveKeyWithValue(machines.ReplacedByAnnotation, replacement.Name))
+				g.Expect(ms.Spec.Template.Annotations).ToNot(HaveKey(machines.ReplacementForAnnotation), "the template should not be modified")
+			}
+
+			for name, replacedBy := range tc.expectedReplacedBy {
+				if replacedBy == "" {
+					g.Expect(existing[name].Annotations).ToNot(HaveKey(machines.ReplacedByAnnotation))
+				} else {
+					g.Expect(existing[name].Annotations).To(HaveKeyWithValue(machines.ReplacedByAnnotation, replacedBy))
+				}
+			}
+			if tc.expectedPairEnded {
+				g.Expect(existing["c"].Annotations).ToNot(HaveKey(machines.ReplacementForAnnotation), "the pair should have ended")
+			}
+			for name, failure := range tc.expectedFailure {
+				if failure == "" {
+					g.Expect(existing[name].Annotations).ToNot(HaveKey(machines.ReplacementFailedAnnotation))
+				} else {
+					g.Expect(existing[name].Annotations).To(HaveKeyWithValue(machines.ReplacementFailedAnnotation, failure))
+				}
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				if strings.Contains(event, "ReplacementFailed") {
+					events = append(events, event)
+				}
+			}
+			g.Expect(events).To(Equal(tc.expectedFailedEvents))
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package machineset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
+)
+
+// revision is a revision of the template of a rolling update MachineSet, and the replicas created from it.
+type revision struct {
+	// machineSet is the MachineSet of the revision. It is nil for the Machines owned by the rolling update
+	// MachineSet itself, which were created before it was switched to rolling updates.
+	machineSet *machinev1.MachineSet
+
+	// machines are the Machines owned by the rolling update MachineSet itself, when machineSet is nil.
+	machines []*machinev1.Machine
+
+	replicas  int
+	available int
+}
+
+// reconcileRollout reconciles a MachineSet with the rolling update strategy. Instead of creating Machines, the MachineSet
+// owns a MachineSet per revision of its template. The replicas are shifted from the MachineSets of the previous revisions
+// to the MachineSet of the current revision, within the max surge and max unavailable of the rollout policy, and based on
+// the available replicas reported in the status of these MachineSets.
+// The Machines owned by the MachineSet itself, which were created before it was switched to rolling updates,
+// are scaled down as if they were the oldest revision.
+func (r *ReconcileMachineSet) reconcileRollout(ctx context.Context, ms *machinev1.MachineSet, ownMachines []*machinev1.Machine, paused bool) (reconcile.Result, error) {
+	policy, errs := rolloutpolicy.Parse(ms.Annotations, field.NewPath("metadata", "annotations"))
+	if len(errs) > 0 {
+		return reconcile.Result{}, fmt.Errorf("invalid rollout policy: %v", errs.ToAggregate())
+	}
+
+	revisionMachineSets, err := r.getRevisionMachineSets(ctx, ms)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var ownStatus machinev1.MachineSetStatus
+	if len(ownMachines) > 0 {
+		ownStatus = r.calculateStatus(ms, ownMachines)
+	}
+	own := &revision{machines: ownMachines, replicas: len(ownMachines), available: int(ownStatus.AvailableReplicas)}
+
+	var syncErr error
+	if paused {
+		klog.V(3).Infof("%v: rollout is paused by the %s annotation", ms.Name, annotations.PausedAnnotation)
+	} else if !r.expectations.Satisfied(client.ObjectKeyFromObject(ms)) {
+		// The machines owned by the MachineSet itself are only scaled down once the cache reflects their previous deletions.
+		klog.V(4).Infof("%v: waiting for the cache to reflect the machines deleted", ms.Name)
+	} else if _, ok := ms.Annotations[rolloutpolicy.RollbackToRevisionAnnotation]; ok {
+		// The rollback updates the template, the rollout proceeds on the next reconcile.
+		syncErr = r.rollback(ctx, ms, revisionMachineSets)
+	} else {
+		syncErr = r.syncRollout(ctx, ms, policy, own, revisionMachineSets)
+		if syncErr == nil {
+			syncErr = r.cleanupRevisionHistory(ctx, ms, policy, revisionMachineSets)
+		}
+	}
+
+	// The template status compares the Machines of all of the revisions with the template of the rolling update MachineSet.
+	// It is patched first, as patching the MachineSet resets its status to the one on the server.
+	revisionMachines, err := r.getRevisionMachines(ctx, ms, revisionMachineSets)
+	if err == nil {
+		err = patchStatusAnnotation(ctx, r.Client, ms, machines.TemplateStatusAnnotation, calculateTemplateStatus(ms, append(revisionMachines, ownMachines...)))
+	}
+	if err != nil {
+		if syncErr != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to sync rollout: %v. failed to update machine set template status: %w", syncErr, err)
+		}
+		return reconcile.Result{}, fmt.Errorf("failed to update machine set template status: %w", err)
+	}
+
+	// The status of the rolling update MachineSet adds up the replicas of all of its revisions.
+	newStatus := ms.Status
+	newStatus.Replicas = int32(len(ownMachines))
+	newStatus.FullyLabeledReplicas = ownStatus.FullyLabeledReplicas
+	newStatus.ReadyReplicas = ownStatus.ReadyReplicas
+	newStatus.AvailableReplicas = ownStatus.AvailableReplicas
+	for _, revisionMS := range revisionMachineSets {
+		newStatus.Replicas += revisionMS.Status.Replicas
+		newStatus.FullyLabeledReplicas += revisionMS.Status.FullyLabeledReplicas
+		newStatus.ReadyReplicas += revisionMS.Status.ReadyReplicas
+		newStatus.AvailableReplicas += revisionMS.Status.AvailableReplicas
+	}
+
+	if _, err := updateMachineSetStatus(r.Client, ms, newStatus); err != nil {
+		if syncErr != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to sync rollout: %v. failed to update machine set status: %w", syncErr, err)
+		}
+		return reconcile.Result{}, fmt.Errorf("failed to update machine set status: %w", err)
+	}
+	if syncErr != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to sync rollout: %w", syncErr)
+	}
+
+	// The rollout is driven by the updates of the status of the MachineSets of the revisions.
+	return reconcile.Result{}, nil
+}
+
+// syncRollout creates the MachineSet of the current revision if needed, and shifts the replicas to it.
+func (r *ReconcileMachineSet) syncRollout(ctx context.Context, ms *machinev1.MachineSet, policy *rolloutpolicy.Policy, own *revision, revisionMachineSets []*machinev1.MachineSet) error {
+	if ms.Spec.Replicas == nil {
+		return fmt.Errorf("the Replicas field in Spec for machineset %v is nil, this should not be allowed", ms.Name)
+	}
+	replicas := int(*ms.Spec.Replicas)
+
+	newMS, err := r.getOrCreateNewRevision(ctx, ms, revisionMachineSets)
+	if err != nil {
+		return err
+	}
+
+	// The oldest revisions are scaled down first.
+	oldRevisions := []*revision{own}
+	for _, revisionMS := range revisionMachineSets {
+		if revisionMS.Name != newMS.Name {
+			oldRevisions = append(oldRevisions, newRevision(revisionMS))
+		}
+	}
+	oldReplicas := 0
+	for _, old := range oldRevisions {
+		oldReplicas += old.replicas
+	}
+	current := newRevision(newMS)
+
+	maxSurge, maxUnavailable := policy.Resolve(replicas)
+
+	// Scale up the current revision, without exceeding the max surge.
+	target := current.replicas
+	if current.replicas > replicas {
+		target = replicas
+	} else if current.replicas < replicas {
+		target = replicas + maxSurge - oldReplicas
+		if target > replicas {
+			target = replicas
+		}
+		if target < current.replicas {
+			target = current.replicas
+		}
+	}
+	if target != current.replicas {
+		if err := r.scaleRevision(ctx, ms, current, target); err != nil {
+			return err
+		}
+	}
+
+	minAvailable := replicas - maxUnavailable
+	currentUnavailable := current.replicas - current.available
+	scaleDowns := make([]int, len(oldRevisions))
+
+	// The replicas of the old revisions which are not available are scaled down first, as doing so does not reduce
+	// the availability of the MachineSet, but without exceeding its max unavailable.
+	maxCleanup := oldReplicas + current.replicas - minAvailable - currentUnavailable
+	for i, old := range oldRevisions {
+		if maxCleanup <= 0 {
+			break
+		}
+		scaleDowns[i] = min(maxCleanup, old.replicas-old.available)
+		maxCleanup -= scaleDowns[i]
+	}
+
+	// Then the available replicas of the old revisions, as long as enough replicas remain available.
+	maxScaleDown := current.available - minAvailable
+	for _, old := range oldRevisions {
+		maxScaleDown += old.available
+	}
+	for i, old := range oldRevisions {
+		if maxScaleDown <= 0 {
+			break
+		}
+		scaleDown := min(maxScaleDown, old.replicas-scaleDowns[i])
+		scaleDowns[i] += scaleDown
+		maxScaleDown -= scaleDown
+	}
+
+	for i, old := range oldRevisions {
+		if scaleDowns[i] > 0 {
+			if err := r.scaleRevision(ctx, ms, old, old.replicas-scaleDowns[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newRevision returns the revision of the given MachineSet. Only the replicas which are both wanted and available
+// count as available, so that replicas being scaled down are not counted while the status of the MachineSet catches up.
+func newRevision(ms *machinev1.MachineSet) *revision {
+	rev := &revision{machineSet: ms}
+	if ms.Spec.Replicas != nil {
+		rev.replicas = int(*ms.Spec.Replicas)
+	}
+	rev.available = int(ms.Status.AvailableReplicas)
+	if rev.available > rev.replicas {
+		rev.available = rev.replicas
+	}
+	return rev
+}
+
+// scaleRevision scales the replicas of a revision. The Machines owned by the rolling update MachineSet itself
+// are deleted according to its delete policy.
+func (r *ReconcileMachineSet) scaleRevision(ctx context.Context, ms *machinev1.MachineSet, rev *revision, replicas int) error {
+	if rev.machineSet == nil {
+		klog.Infof("%v: scaling down the machines created before the rolling update from %d to %d", ms.Name, rev.replicas, replicas)
+		scaled := ms.DeepCopy()
+		scaled.Spec.Replicas = pointer.Int32(int32(replicas))
+		if _, err := r.syncReplicas(ctx, scaled, rev.machines); err != nil {
+			return err
+		}
+	} else {
+		klog.Infof("%v: scaling machineset %q of revision %s from %d to %d", ms.Name, rev.machineSet.Name,
+			rev.machineSet.Annotations[rolloutpolicy.RevisionAnnotation], rev.replicas, replicas)
+		patchBase := client.MergeFrom(rev.machineSet.DeepCopy())
+		rev.machineSet.Spec.Replicas = pointer.Int32(int32(replicas))
+		if err := r.Client.Patch(ctx, rev.machineSet, patchBase); err != nil {
+			return fmt.Errorf("failed to scale machineset %q to %d replicas: %w", rev.machineSet.Name, replicas, err)
+		}
+		r.recorder.Eventf(ms, corev1.EventTypeNormal, "ScalingMachineSet", "Scaled machineset %q from %d to %d replicas", rev.machineSet.Name, rev.replicas, replicas)
+	}
+
+	rev.replicas = replicas
+	if rev.available > replicas {
+		rev.available = replicas
+	}
+	return nil
+}
+
+// getRevisionMachineSets returns the MachineSets owned by the rolling update MachineSet, from the oldest revision to the newest.
+func (r *ReconcileMachineSet) getRevisionMachineSets(ctx context.Context, ms *machinev1.MachineSet) ([]*machinev1.MachineSet, error) {
+	allMachineSets := &machinev1.MachineSetList{}
+	if err := r.Client.List(ctx, allMachineSets, client.InNamespace(ms.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machinesets: %w", err)
+	}
+
+	var revisionMachineSets []*machinev1.MachineSet
+	for i := range allMachineSets.Items {
+		revisionMS := &allMachineSets.Items[i]
+		if metav1.IsControlledBy(revisionMS, ms) && revisionMS.DeletionTimestamp.IsZero() {
+			revisionMachineSets = append(revisionMachineSets, revisionMS)
+		}
+	}
+	sort.SliceStable(revisionMachineSets, func(i, j int) bool {
+		return revisionOf(revisionMachineSets[i]) < revisionOf(revisionMachineSets[j])
+	})
+	return revisionMachineSets, nil
+}
+
+// getRevisionMachines returns the Machines of the MachineSets of the revisions which are not being deleted.
+func (r *ReconcileMachineSet) getRevisionMachines(ctx context.Context, ms *machinev1.MachineSet, revisionMachineSets []*machinev1.MachineSet) ([]*machinev1.Machine, error) {
+	allMachines := &machinev1.MachineList{}
+	if err := r.Client.List(ctx, allMachines, client.InNamespace(ms.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	var revisionMachines []*machinev1.Machine
+	for i := range allMachines.Items {
+		machine := &allMachines.Items[i]
+		if !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+		for _, revisionMS := range revisionMachineSets {
+			if metav1.IsControlledBy(machine, revisionMS) {
+				revisionMachines = append(revisionMachines, machine)
+				break
+			}
+		}
+	}
+	return revisionMachines, nil
+}
+
+// getOrCreateNewRevision returns the MachineSet of the current template of the rolling update MachineSet,
+// creating it when the template has not been rolled out before. A MachineSet of a previous revision whose
+// template is rolled out again, for example by a rollback, becomes the newest revision.
+func (r *ReconcileMachineSet) getOrCreateNewRevision(ctx context.Context, ms *machinev1.MachineSet, revisionMachineSets []*machinev1.MachineSet) (*machinev1.MachineSet, error) {
+	hash := templateHash(&ms.Spec.Template)
+
+	var maxRevision int64
+	var newMS *machinev1.MachineSet
+	for _, revisionMS := range revisionMachineSets {
+		if rev := revisionOf(revisionMS); rev > maxRevision {
+			maxRevision = rev
+		}
+		if revisionMS.Labels[rolloutpolicy.TemplateHashLabel] == hash {
+			newMS = revisionMS
+		}
+	}
+
+	switch {
+	case newMS == nil:
+		newMS = newRevisionMachineSet(ms, hash, maxRevision+1)
+		if err := r.Client.Create(ctx, newMS); err != nil {
+			return nil, fmt.Errorf("failed to create machineset for revision %d: %w", maxRevision+1, err)
+		}
+		klog.Infof("%v: created machineset %q for revision %d", ms.Name, newMS.Name, maxRevision+1)
+		r.recorder.Eventf(ms, corev1.EventTypeNormal, "RevisionCreated", "Created machineset %q for revision %d", newMS.Name, maxRevision+1)
+	case revisionOf(newMS) < maxRevision:
+		patchBase := client.MergeFrom(newMS.DeepCopy())
+		newMS.Annotations = copyWith(newMS.Annotations, rolloutpolicy.RevisionAnnotation, strconv.FormatInt(maxRevision+1, 10))
+		if err := r.Client.Patch(ctx, newMS, patchBase); err != nil {
+			return nil, fmt.Errorf("failed to set the revision of machineset %q: %w", newMS.Name, err)
+		}
+		klog.Infof("%v: rolling out machineset %q again as revision %d", ms.Name, newMS.Name, maxRevision+1)
+	}
+
+	if current := newMS.Annotations[rolloutpolicy.RevisionAnnotation]; ms.Annotations[rolloutpolicy.RevisionAnnotation] != current {
+		patchBase := client.MergeFrom(ms.DeepCopy())
+		ms.Annotations = copyWith(ms.Annotations, rolloutpolicy.RevisionAnnotation, current)
+		if err := r.Client.Patch(ctx, ms, patchBase); err != nil {
+			return nil, fmt.Errorf("failed to set the revision of machineset %q: %w", ms.Name, err)
+		}
+	}
+
+	return newMS, nil
+}
+
+// newRevisionMachineSet builds the MachineSet of a revision of the template of the rolling update MachineSet.
+// The hash of the template is added to its selector, so that it only selects the Machines of its own revision.
+func newRevisionMachineSet(ms *machinev1.MachineSet, hash string, rev int64) *machinev1.MachineSet {
+	template := ms.Spec.Template.DeepCopy()
+	template.Labels = copyWith(template.Labels, rolloutpolicy.TemplateHashLabel, hash)
+
+	selector := ms.Spec.Selector.DeepCopy()
+	selector.MatchLabels = copyWith(selector.MatchLabels, rolloutpolicy.TemplateHashLabel, hash)
+
+	annotations := map[string]string{rolloutpolicy.RevisionAnnotation: strconv.FormatInt(rev, 10)}
+	// The MachineSets of the revisions create and delete their Machines within the scaling policy of the rolling update MachineSet,
+	// and according to its delete policy.
+	for _, annotation := range []string{
+		scalingpolicy.CreateBatchSizeAnnotation,
+		scalingpolicy.CreateMaxInFlightAnnotation,
+		scalingpolicy.DeleteBatchSizeAnnotation,
+		scalingpolicy.DeleteMaxInFlightAnnotation,
+		machines.DeletePolicyAnnotation,
+	} {
+		if value, ok := ms.Annotations[annotation]; ok {
+			annotations[annotation] = value
+		}
+	}
+
+	return &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%s", ms.Name, hash),
+			Namespace:       ms.Namespace,
+			Labels:          copyWith(ms.Labels, rolloutpolicy.TemplateHashLabel, hash),
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas:        pointer.Int32(0),
+			MinReadySeconds: ms.Spec.MinReadySeconds,
+			DeletePolicy:    ms.Spec.DeletePolicy,
+			Selector:        *selector,
+			Template:        *template,
+		},
+	}
+}
+
+// rollback sets the template of the rolling update MachineSet back to the template of the revision requested
+// by the rollback annotation, and removes the annotation.
+func (r *ReconcileMachineSet) rollback(ctx context.Context, ms *machinev1.MachineSet, revisionMachineSets []*machinev1.MachineSet) error {
+	value := ms.Annotations[rolloutpolicy.RollbackToRevisionAnnotation]
+	// The annotation has been validated along with the rollout policy.
+	toRevision, _ := rolloutpolicy.ParseRevision(value)
+
+	currentHash := templateHash(&ms.Spec.Template)
+	var target *machinev1.MachineSet
+	for _, revisionMS := range revisionMachineSets {
+		if toRevision == 0 && revisionMS.Labels[rolloutpolicy.TemplateHashLabel] != currentHash {
+			// The MachineSets are sorted by revision, the last one which does not match the template is the previous revision.
+			target = revisionMS
+		}
+		if toRevision != 0 && revisionOf(revisionMS) == toRevision {
+			target = revisionMS
+		}
+	}
+
+	patchBase := client.MergeFrom(ms.DeepCopy())
+	ms.Annotations = copyWith(ms.Annotations, rolloutpolicy.RollbackToRevisionAnnotation, "")
+	delete(ms.Annotations, rolloutpolicy.RollbackToRevisionAnnotation)
+	if target == nil {
+		klog.Warningf("%v: not rolling back: revision %q was not found", ms.Name, value)
+		r.recorder.Eventf(ms, corev1.EventTypeWarning, "RollbackRevisionNotFound", "Unable to roll back to revision %q: revision not found", value)
+	} else {
+		template := target.Spec.Template.DeepCopy()
+		delete(template.Labels, rolloutpolicy.TemplateHashLabel)
+		ms.Spec.Template = *template
+		klog.Infof("%v: rolling back to revision %s", ms.Name, target.Annotations[rolloutpolicy.RevisionAnnotation])
+		r.recorder.Eventf(ms, corev1.EventTypeNormal, "RolledBack", "Rolled back to the template of revision %s", target.Annotations[rolloutpolicy.RevisionAnnotation])
+	}
+
+	if err := r.Client.Patch(ctx, ms, patchBase); err != nil {
+		return fmt.Errorf("failed to roll back machineset %q: %w", ms.Name, err)
+	}
+	return nil
+}
+
+// cleanupRevisionHistory deletes the oldest MachineSets of previous revisions which have been scaled down,
+// beyond the revision history limit.
+func (r *ReconcileMachineSet) cleanupRevisionHistory(ctx context.Context, ms *machinev1.MachineSet, policy *rolloutpolicy.Policy, revisionMachineSets []*machinev1.MachineSet) error {
+	currentHash := templateHash(&ms.Spec.Template)
+
+	var scaledDown []*machinev1.MachineSet
+	for _, revisionMS := range revisionMachineSets {
+		if revisionMS.Labels[rolloutpolicy.TemplateHashLabel] == currentHash {
+			continue
+		}
+		if pointer.Int32Deref(revisionMS.Spec.Replicas, 0) == 0 && revisionMS.Status.Replicas == 0 {
+			scaledDown = append(scaledDown, revisionMS)
+		}
+	}
+
+	for i := 0; i < len(scaledDown)-policy.RevisionHistoryLimit; i++ {
+		klog.Infof("%v: deleting machineset %q of revision %s beyond the revision history limit", ms.Name, scaledDown[i].Name,
+			scaledDown[i].Annotations[rolloutpolicy.RevisionAnnotation])
+		if err := r.Client.Delete(ctx, scaledDown[i]); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete machineset %q: %w", scaledDown[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// templateHash returns a hash of the template of a MachineSet, suitable for names and label values.
+// The template hash label is ignored, so that the templates of the MachineSets of the revisions hash like the template
+// they were created from.
+func templateHash(template *machinev1.MachineTemplateSpec) string {
+	t := template.DeepCopy()
+	delete(t.Labels, rolloutpolicy.TemplateHashLabel)
+
+	// A MachineTemplateSpec can always be marshalled.
+	data, _ := json.Marshal(t)
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// revisionOf returns the revision of a MachineSet owned by a rolling update MachineSet.
+func revisionOf(ms *machinev1.MachineSet) int64 {
+	rev, err := rolloutpolicy.ParseRevision(ms.Annotations[rolloutpolicy.RevisionAnnotation])
+	if err != nil {
+		return 0
+	}
+	return rev
+}
+
+// copyWith returns a copy of the map with the key set to the value.
+// The labels and annotations of a MachineSet may be shared, for example with its template, so they are copied
+// before being modified.
+func copyWith(m map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,299 @@
+package machineset
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+)
+
+func TestReconcileRollout(t *testing.T) {
+	template := func(image string) machinev1.MachineTemplateSpec {
+		return machinev1.MachineTemplateSpec{
+			ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
+			Spec: machinev1.MachineSpec{
+				ProviderSpec: machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(`{"image":"` + image + `"}`)}},
+			},
+		}
+	}
+	hash := func(image string) string {
+		t := template(image)
+		return templateHash(&t)
+	}
+
+	rollingUpdate := func(replicas int32, image string, extraAnnotations map[string]string) *machinev1.MachineSet {
+		ms := &machinev1.MachineSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "workers",
+				Namespace:   "default",
+				UID:         "workers-uid",
+				Annotations: map[string]string{rolloutpolicy.StrategyAnnotation: "RollingUpdate"},
+			},
+			Spec: machinev1.MachineSetSpec{
+				Replicas: pointer.Int32(replicas),
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+				Template: template(image),
+			},
+		}
+		for k, v := range extraAnnotations {
+			ms.Annotations[k] = v
+		}
+		return ms
+	}
+
+	revisionOfImage := func(owner *machinev1.MachineSet, image string, rev int64, replicas, available int32) *machinev1.MachineSet {
+		ms := owner.DeepCopy()
+		ms.Spec.Template = template(image)
+		revisionMS := newRevisionMachineSet(ms, hash(image), rev)
+		revisionMS.Spec.Replicas = pointer.Int32(replicas)
+		revisionMS.Status.Replicas = replicas
+		revisionMS.Status.ReadyReplicas = available
+		revisionMS.Status.AvailableReplicas = available
+		return revisionMS
+	}
+
+	ownMachine := func(owner *machinev1.MachineSet, name string) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"foo": "bar"},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, controllerKind)},
+			},
+			Status: machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+	}
+	readyNode := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name string
+		ms   *machinev1.MachineSet
+		// objects builds the other objects of the test from the rolling update MachineSet.
+		objects func(ms *machinev1.MachineSet) []client.Object
+		// expectedReplicas are the replicas of the MachineSets of the revisions, by image.
+		expectedReplicas map[string]int32
+		// expectedRevisions are the revisions of the MachineSets of the revisions, by image.
+		expectedRevisions    map[string]string
+		expectedRevision     string
+		expectedOwnMachines  int
+		expectedImage        string
+		expectedEvent        string
+		expectedAvailability int32
+	}{
+		{
+			name:              "creates the first revision",
+			ms:                rollingUpdate(3, "b", nil),
+			expectedReplicas:  map[string]int32{"b": 3},
+			expectedRevisions: map[string]string{"b": "1"},
+			expectedRevision:  "1",
+			expectedImage:     "b",
+			expectedEvent:     "RevisionCreated",
+		},
+		{
+			name: "starts to roll out a new template within the max surge",
+			ms:   rollingUpdate(3, "b", nil),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"a": 3, "b": 1},
+			expectedRevisions:    map[string]string{"a": "1", "b": "2"},
+			expectedRevision:     "2",
+			expectedImage:        "b",
+			expectedAvailability: 3,
+		},
+		{
+			name: "scales down the previous revision once replicas of the new revision are available",
+			ms:   rollingUpdate(3, "b", nil),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 3, 3), revisionOfImage(ms, "b", 2, 1, 1)}
+			},
+			expectedReplicas:     map[string]int32{"a": 2, "b": 1},
+			expectedRevision:     "2",
+			expectedImage:        "b",
+			expectedEvent:        "ScalingMachineSet",
+			expectedAvailability: 4,
+		},
+		{
+			name: "scales down the replicas of the previous revision which are not available first",
+			ms: rollingUpdate(3, "b", map[string]string{
+				rolloutpolicy.MaxSurgeAnnotation:       "0",
+				rolloutpolicy.MaxUnavailableAnnotation: "1",
+			}),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 3, 1), revisionOfImage(ms, "b", 2, 0, 0)}
+			},
+			expectedReplicas:     map[string]int32{"a": 2, "b": 0},
+			expectedRevision:     "2",
+			expectedImage:        "b",
+			expectedAvailability: 1,
+		},
+		{
+			name: "completes the rollout",
+			ms:   rollingUpdate(3, "b", nil),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 1, 1), revisionOfImage(ms, "b", 2, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"a": 0, "b": 3},
+			expectedRevision:     "2",
+			expectedImage:        "b",
+			expectedAvailability: 4,
+		},
+		{
+			name: "scales down the machines created before the rolling update",
+			ms:   rollingUpdate(2, "b", nil),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{
+					revisionOfImage(ms, "b", 1, 2, 2),
+					ownMachine(ms, "own-1"), readyNode("own-1"),
+					ownMachine(ms, "own-2"), readyNode("own-2"),
+				}
+			},
+			expectedReplicas:     map[string]int32{"b": 2},
+			expectedRevision:     "1",
+			expectedImage:        "b",
+			expectedOwnMachines:  0,
+			expectedAvailability: 4,
+		},
+		{
+			name: "does not roll out a paused machineset",
+			ms:   rollingUpdate(3, "b", map[string]string{annotations.PausedAnnotation: ""}),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"a": 3},
+			expectedImage:        "b",
+			expectedAvailability: 3,
+		},
+		{
+			name: "rolls back to the previous revision",
+			ms:   rollingUpdate(3, "b", map[string]string{rolloutpolicy.RollbackToRevisionAnnotation: "0"}),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 0, 0), revisionOfImage(ms, "b", 2, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"a": 0, "b": 3},
+			expectedImage:        "a",
+			expectedEvent:        "RolledBack",
+			expectedAvailability: 3,
+		},
+		{
+			name: "does not roll back to a revision which does not exist",
+			ms:   rollingUpdate(3, "b", map[string]string{rolloutpolicy.RollbackToRevisionAnnotation: "5"}),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "b", 1, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"b": 3},
+			expectedImage:        "b",
+			expectedEvent:        "RollbackRevisionNotFound",
+			expectedAvailability: 3,
+		},
+		{
+			name: "rolls out the template of a previous revision as a new revision",
+			ms:   rollingUpdate(3, "a", nil),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{revisionOfImage(ms, "a", 1, 0, 0), revisionOfImage(ms, "b", 2, 3, 3)}
+			},
+			expectedReplicas:     map[string]int32{"a": 1, "b": 3},
+			expectedRevisions:    map[string]string{"a": "3", "b": "2"},
+			expectedRevision:     "3",
+			expectedImage:        "a",
+			expectedAvailability: 3,
+		},
+		{
+			name: "deletes the scaled down revisions beyond the revision history limit",
+			ms:   rollingUpdate(1, "d", map[string]string{rolloutpolicy.RevisionHistoryLimitAnnotation: "1"}),
+			objects: func(ms *machinev1.MachineSet) []client.Object {
+				return []client.Object{
+					revisionOfImage(ms, "a", 1, 0, 0),
+					revisionOfImage(ms, "b", 2, 0, 0),
+					revisionOfImage(ms, "c", 3, 0, 0),
+					revisionOfImage(ms, "d", 4, 1, 1),
+				}
+			},
+			expectedReplicas:     map[string]int32{"c": 0, "d": 1},
+			expectedRevision:     "4",
+			expectedImage:        "d",
+			expectedAvailability: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+			objects := []client.Object{tc.ms}
+			if tc.objects != nil {
+				objects = append(objects, tc.objects(tc.ms)...)
+			}
+			recorder := record.NewFakeRecorder(32)
+			r := &ReconcileMachineSet{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+				scheme:   scheme.Scheme,
+				recorder: recorder,
+			}
+
+			key := types.NamespacedName{Namespace: tc.ms.Namespace, Name: tc.ms.Name}
+			_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			updated := &machinev1.MachineSet{}
+			g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+			g.Expect(updated.Spec.Template).To(Equal(template(tc.expectedImage)))
+			g.Expect(updated.Annotations).ToNot(HaveKey(rolloutpolicy.RollbackToRevisionAnnotation))
+			if tc.expectedRevision != "" {
+				g.Expect(updated.Annotations).To(HaveKeyWithValue(rolloutpolicy.RevisionAnnotation, tc.expectedRevision))
+			}
+			g.Expect(updated.Status.AvailableReplicas).To(Equal(tc.expectedAvailability))
+
+			machineSets := &machinev1.MachineSetList{}
+			g.Expect(r.Client.List(ctx, machineSets, client.InNamespace("default"))).To(Succeed())
+			replicas := map[string]int32{}
+			for _, revisionMS := range machineSets.Items {
+				if revisionMS.Name == tc.ms.Name {
+					continue
+				}
+				for image := range map[string]bool{"a": true, "b": true, "c": true, "d": true} {
+					if revisionMS.Labels[rolloutpolicy.TemplateHashLabel] != hash(image) {
+						continue
+					}
+					replicas[image] = pointer.Int32Deref(revisionMS.Spec.Replicas, 0)
+					g.Expect(revisionMS.Name).To(Equal("workers-" + hash(image)))
+					g.Expect(revisionMS.Spec.Selector.MatchLabels).To(HaveKeyWithValue(rolloutpolicy.TemplateHashLabel, hash(image)))
+					g.Expect(metav1.IsControlledBy(&revisionMS, tc.ms)).To(BeTrue())
+					if expected, ok := tc.expectedRevisions[image]; ok {
+						g.Expect(revisionMS.Annotations).To(HaveKeyWithValue(rolloutpolicy.RevisionAnnotation, expected))
+					}
+				}
+			}
+			g.Expect(replicas).To(Equal(tc.expectedReplicas))
+
+			machines := &machinev1.MachineList{}
+			g.Expect(r.Client.List(ctx, machines, client.InNamespace("default"))).To(Succeed())
+			g.Expect(machines.Items).To(HaveLen(tc.expectedOwnMachines), "the rolling update machineset should not create machines")
+
+			if tc.expectedEvent != "" {
+				g.Expect(recorder.Events).To(Receive(ContainSubstring(tc.expectedEvent)))
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package machineset
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scalingProgressInterval is the amount of time after which a MachineSet whose scaling was limited by its scaling
+// policy is reconciled again, in case no event about its Machines triggers a reconcile in the meantime.
+var scalingProgressInterval = 30 * time.Second
+
+// maxConcurrentDeleteCalls caps the number of Machines deleted concurrently by a single reconcile,
+// whatever the delete batch size of the MachineSet.
+const maxConcurrentDeleteCalls = 10
+
+// countProvisioningMachines returns the number of machines which have not got a Node yet, and have not Failed.
+func countProvisioningMachines(machines []*machinev1.Machine) int {
+	count := 0
+	for _, machine := range machines {
+		if machine.Status.NodeRef == nil && (machine.Status.Phase == nil || *machine.Status.Phase != "Failed") {
+			count++
+		}
+	}
+	return count
+}
+
+// getDeletingMachines returns the machines of the MachineSet which are being deleted.
+func (r *ReconcileMachineSet) getDeletingMachines(ctx context.Context, ms *machinev1.MachineSet) ([]*machinev1.Machine, error) {
+	allMachines := &machinev1.MachineList{}
+	if err := r.Client.List(ctx, allMachines, client.InNamespace(ms.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var deleting []*machinev1.Machine
+	for i := range allMachines.Items {
+		machine := &allMachines.Items[i]
+		if !machine.DeletionTimestamp.IsZero() && metav1.IsControlledBy(machine, ms) {
+			deleting = append(deleting, machine)
+		}
+	}
+	return deleting, nil
+}
+
+// deleteMachines deletes the machines of the MachineSet concurrently, with at most maxConcurrentDeleteCalls calls in flight.
+// It returns the number of machines deleted and the first error hit. Machines which are already gone count as deleted.
+func (r *ReconcileMachineSet) deleteMachines(ctx context.Context, ms *machinev1.MachineSet, machines []*machinev1.Machine) (int, error) {
+	// The deletions are expected before the machines are deleted, as the cache may observe them straight away.
+	key := client.ObjectKeyFromObject(ms)
+	r.expectations.ExpectDeletions(key, machines)
+
+	errCh := make(chan error, len(machines))
+	sem := make(chan struct{}, maxConcurrentDeleteCalls)
+	var wg sync.WaitGroup
+	wg.Add(len(machines))
+	for _, machine := range machines {
+		go func(targetMachine *machinev1.Machine) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := r.Client.Delete(ctx, targetMachine); err != nil {
+				// The deletion will never be observed, or already has been.
+				r.expectations.DeletionObserved(key, targetMachine.UID)
+				if apierrors.IsNotFound(err) {
+					return
+				}
+				klog.Errorf("Unable to delete Machine %s: %v", targetMachine.Name, err)
+				errCh <- err
+			}
+		}(machine)
+	}
+	wg.Wait()
+	close(errCh)
+
+	deleted := len(machines) - len(errCh)
+	// All errors have been reported before and they're likely to be the same, so we'll only return the first one we hit.
+	return deleted, <-errCh
+}
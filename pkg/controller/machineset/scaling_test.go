@@ -0,0 +1,210 @@
+package machineset
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
+)
+
+func newScalingMachineSet(replicas int32, annotations map[string]string) *machinev1.MachineSet {
+	return &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ms",
+			Namespace:   "default",
+			UID:         "ms-uid",
+			Annotations: annotations,
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas: pointer.Int32(replicas),
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Template: machinev1.MachineTemplateSpec{
+				ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
+			},
+		},
+	}
+}
+
+func newScalingMachine(ms *machinev1.MachineSet, name string, hasNode, deleting bool) *machinev1.Machine {
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Labels:          map[string]string{"foo": "bar"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+		},
+	}
+	if hasNode {
+		m.Status.NodeRef = &corev1.ObjectReference{Name: name}
+	}
+	if deleting {
+		m.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		m.Finalizers = []string{machinev1.MachineFinalizer}
+	}
+	return m
+}
+
+func TestSyncReplicasScalingPolicy(t *testing.T) {
+	testCases := []struct {
+		name             string
+		replicas         int32
+		annotations      map[string]string
+		machines         func(ms *machinev1.MachineSet) []*machinev1.Machine
+		expectedMachines int
+		expectedProgress scalingpolicy.ScalingProgress
+	}{
+		{
+			name:             "without a scaling policy",
+			replicas:         3,
+			expectedMachines: 3,
+			expectedProgress: scalingpolicy.ScalingProgress{Creating: 3},
+		},
+		{
+			name:             "with a create batch size",
+			replicas:         5,
+			annotations:      map[string]string{scalingpolicy.CreateBatchSizeAnnotation: "2"},
+			expectedMachines: 2,
+			expectedProgress: scalingpolicy.ScalingProgress{Creating: 2, PendingCreates: 3},
+		},
+		{
+			name:        "with a create max in flight",
+			replicas:    5,
+			annotations: map[string]string{scalingpolicy.CreateMaxInFlightAnnotation: "3"},
+			machines: func(ms *machinev1.MachineSet) []*machinev1.Machine {
+				return []*machinev1.Machine{
+					newScalingMachine(ms, "provisioning-1", false, false),
+					newScalingMachine(ms, "provisioning-2", false, false),
+					newScalingMachine(ms, "running", true, false),
+				}
+			},
+			expectedMachines: 4,
+			expectedProgress: scalingpolicy.ScalingProgress{Creating: 3, PendingCreates: 1},
+		},
+		{
+			name:        "with a delete batch size",
+			replicas:    0,
+			annotations: map[string]string{scalingpolicy.DeleteBatchSizeAnnotation: "1"},
+			machines: func(ms *machinev1.MachineSet) []*machinev1.Machine {
+				return []*machinev1.Machine{
+					newScalingMachine(ms, "a", true, false),
+					newScalingMachine(ms, "b", true, false),
+					newScalingMachine(ms, "c", true, false),
+				}
+			},
+			expectedMachines: 2,
+			expectedProgress: scalingpolicy.ScalingProgress{Deleting: 1, PendingDeletes: 2},
+		},
+		{
+			name:        "with a delete max in flight",
+			replicas:    0,
+			annotations: map[string]string{scalingpolicy.DeleteMaxInFlightAnnotation: "2"},
+			machines: func(ms *machinev1.MachineSet) []*machinev1.Machine {
+				return []*machinev1.Machine{
+					newScalingMachine(ms, "a", true, false),
+					newScalingMachine(ms, "b", true, false),
+					newScalingMachine(ms, "c", true, false),
+					newScalingMachine(ms, "deleting", true, true),
+				}
+			},
+			// The machine which is already deleting is kept by its finalizer.
+			expectedMachines: 3,
+			expectedProgress: scalingpolicy.ScalingProgress{Deleting: 2, PendingDeletes: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ms := newScalingMachineSet(tc.replicas, tc.annotations)
+			objects := []client.Object{ms}
+			var machines []*machinev1.Machine
+			if tc.machines != nil {
+				for _, m := range tc.machines(ms) {
+					objects = append(objects, m)
+					if m.DeletionTimestamp == nil {
+						machines = append(machines, m)
+					}
+				}
+			}
+
+			g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+			r := &ReconcileMachineSet{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+				scheme:   scheme.Scheme,
+				recorder: record.NewFakeRecorder(32),
+			}
+
+			progress, err := r.syncReplicas(ctx, ms, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(progress).To(Equal(tc.expectedProgress))
+
+			machineList := &machinev1.MachineList{}
+			g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+			g.Expect(machineList.Items).To(HaveLen(tc.expectedMachines))
+		})
+	}
+}
+
+func TestReconcileRecordsScalingProgress(t *testing.T) {
+	g := NewWithT(t)
+
+	ms := newScalingMachineSet(3, map[string]string{scalingpolicy.CreateBatchSizeAnnotation: "2"})
+	g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+	r := &ReconcileMachineSet{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ms).Build(),
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(32),
+	}
+
+	key := types.NamespacedName{Namespace: ms.Namespace, Name: ms.Name}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(scalingProgressInterval), "the creation of the pending machines should be retried")
+
+	updated := &machinev1.MachineSet{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	progress, ok := scalingpolicy.GetScalingProgress(updated)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(progress).To(Equal(&scalingpolicy.ScalingProgress{Creating: 2, PendingCreates: 1}))
+
+	// Once every machine has a Node, the MachineSet has reached its replicas and the progress is removed.
+	machineList := &machinev1.MachineList{}
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		m.Status.NodeRef = &corev1.ObjectReference{Name: m.Name}
+		g.Expect(r.Client.Status().Update(ctx, m)).To(Succeed())
+	}
+	result, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(BeZero())
+
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	progress, _ = scalingpolicy.GetScalingProgress(updated)
+	g.Expect(progress).To(Equal(&scalingpolicy.ScalingProgress{Creating: 1}))
+
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		m.Status.NodeRef = &corev1.ObjectReference{Name: m.Name}
+		g.Expect(r.Client.Status().Update(ctx, m)).To(Succeed())
+	}
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Annotations).ToNot(HaveKey(scalingpolicy.ScalingProgressAnnotation))
+}
@@ -18,8 +18,10 @@ package machineset
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -27,6 +29,9 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
 )
 
 const (
@@ -69,6 +74,60 @@ func (c *ReconcileMachineSet) calculateStatus(ms *machinev1.MachineSet, filtered
 	return newStatus
 }
 
+// calculateTemplateStatus compares the template hash label of the machines with the hash of the template of the MachineSet.
+// The machines without the label are not reported as outdated, as they may well match the template.
+func calculateTemplateStatus(ms *machinev1.MachineSet, filteredMachines []*machinev1.Machine) machines.TemplateStatus {
+	hash := templateHash(&ms.Spec.Template)
+
+	status := machines.TemplateStatus{}
+	for _, machine := range filteredMachines {
+		machineHash, ok := machine.Labels[rolloutpolicy.TemplateHashLabel]
+		if !ok {
+			status.UnknownReplicas++
+			continue
+		}
+		if machineHash == hash {
+			status.UpdatedReplicas++
+			continue
+		}
+		status.OutdatedReplicas++
+		status.OutdatedMachines = append(status.OutdatedMachines, machine.Name)
+	}
+	sort.Strings(status.OutdatedMachines)
+
+	return status
+}
+
+// patchStatusAnnotation records a status of the MachineSet, which has no field in the MachineSet status, as JSON in the
+// given annotation. The annotation is removed when the status is nil, and left alone when it is already up to date.
+func patchStatusAnnotation(ctx context.Context, c client.Client, ms *machinev1.MachineSet, annotation string, status interface{}) error {
+	current, ok := ms.Annotations[annotation]
+
+	patchBase := client.MergeFrom(ms.DeepCopy())
+	if status == nil {
+		if !ok {
+			return nil
+		}
+		annotations := make(map[string]string, len(ms.Annotations))
+		for k, v := range ms.Annotations {
+			if k != annotation {
+				annotations[k] = v
+			}
+		}
+		ms.Annotations = annotations
+	} else {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", annotation, err)
+		}
+		if ok && current == string(data) {
+			return nil
+		}
+		ms.Annotations = copyWith(ms.Annotations, annotation, string(data))
+	}
+	return c.Patch(ctx, ms, patchBase)
+}
+
 // updateMachineSetStatus attempts to update the Status.Replicas of the given MachineSet, with a single GET/PUT retry.
 func updateMachineSetStatus(c client.Client, ms *machinev1.MachineSet, newStatus machinev1.MachineSetStatus) (*machinev1.MachineSet, error) {
 	// This is the steady state. It happens when the MachineSet doesn't have any expectations, since
@@ -0,0 +1,165 @@
+package machineset
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+)
+
+func TestReconcileReportsTemplateStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	ms := &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ms",
+			Namespace: "default",
+			UID:       "ms-uid",
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas: pointer.Int32(5),
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Template: machinev1.MachineTemplateSpec{
+				ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
+			},
+		},
+	}
+	hash := templateHash(&ms.Spec.Template)
+	machine := func(name, hash string) *machinev1.Machine {
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"foo": "bar"},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+			},
+		}
+		if hash != "" {
+			m.Labels[rolloutpolicy.TemplateHashLabel] = hash
+		}
+		return m
+	}
+
+	g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+	r := &ReconcileMachineSet{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			ms,
+			machine("updated", hash),
+			machine("outdated-b", "previous"),
+			machine("outdated-a", "older"),
+			machine("unknown", ""),
+		).Build(),
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(32),
+	}
+
+	key := types.NamespacedName{Namespace: ms.Namespace, Name: ms.Name}
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	machineList := &machinev1.MachineList{}
+	g.Expect(r.Client.List(ctx, machineList, client.InNamespace("default"))).To(Succeed())
+	g.Expect(machineList.Items).To(HaveLen(5))
+	for _, m := range machineList.Items {
+		if m.Name != "updated" && m.Name != "outdated-a" && m.Name != "outdated-b" && m.Name != "unknown" {
+			g.Expect(m.Labels).To(HaveKeyWithValue(rolloutpolicy.TemplateHashLabel, hash), "the created machine should be stamped with the template hash")
+		}
+	}
+
+	updated := &machinev1.MachineSet{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Spec.Template.Labels).ToNot(HaveKey(rolloutpolicy.TemplateHashLabel), "the template should not be modified")
+	status, ok := machines.GetTemplateStatus(updated)
+	g.Expect(ok).To(BeTrue())
+	// The machine created by this reconcile is only counted once it is seen by the next reconcile.
+	g.Expect(status).To(Equal(&machines.TemplateStatus{
+		UpdatedReplicas:  1,
+		OutdatedReplicas: 2,
+		OutdatedMachines: []string{"outdated-a", "outdated-b"},
+		UnknownReplicas:  1,
+	}), "the machine without a template hash should not be reported as outdated")
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	status, _ = machines.GetTemplateStatus(updated)
+	g.Expect(status.UpdatedReplicas).To(BeEquivalentTo(2))
+	g.Expect(updated.Status.Replicas).To(BeEquivalentTo(5))
+}
+
+func TestReconcileReportsReplacementStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	ms := &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ms",
+			Namespace: "default",
+			UID:       "ms-uid",
+		},
+		Spec: machinev1.MachineSetSpec{
+			Replicas: pointer.Int32(2),
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Template: machinev1.MachineTemplateSpec{
+				ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
+			},
+		},
+	}
+	machine := func(name string, annotations map[string]string) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"foo": "bar"},
+				Annotations:     annotations,
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ms, controllerKind)},
+			},
+		}
+	}
+
+	g.Expect(machinev1.AddToScheme(scheme.Scheme)).To(Succeed())
+	r := &ReconcileMachineSet{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			ms,
+			machine("a", nil),
+			machine("b", map[string]string{machines.ReplaceAnnotation: "", machines.ReplacementFailedAnnotation: "failure"}),
+		).Build(),
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(32),
+	}
+
+	key := types.NamespacedName{Namespace: ms.Namespace, Name: ms.Name}
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	updated := &machinev1.MachineSet{}
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	status, ok := machines.GetReplacementStatus(updated)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(status).To(Equal(&machines.ReplacementStatus{
+		Replacements: []machines.Replacement{{Machine: "b", Failure: "failure"}},
+	}))
+
+	// Withdrawing the request removes the replacement from the status.
+	b := &machinev1.Machine{}
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "b"}, b)).To(Succeed())
+	delete(b.Annotations, machines.ReplaceAnnotation)
+	g.Expect(r.Client.Update(ctx, b)).To(Succeed())
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Client.Get(ctx, key, updated)).To(Succeed())
+	g.Expect(updated.Annotations).ToNot(HaveKey(machines.ReplacementStatusAnnotation))
+	g.Expect(r.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "b"}, b)).To(Succeed())
+	g.Expect(b.Annotations).ToNot(HaveKey(machines.ReplacementFailedAnnotation))
+}
@@ -0,0 +1,358 @@
+// Package simulated implements an Actuator which simulates instances in memory, for local development and scale
+// testing without a cloud. Instances take some time to provision, are given a provider ID and addresses, and are
+// backed by Node objects which the nodelink controller links to their Machine and machine health checks can watch.
+package simulated
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+const (
+	// FailCreateAnnotation makes the creation of the instance of a Machine fail with an invalid configuration error,
+	// which moves the Machine to the Failed phase. The value is used as the error message.
+	FailCreateAnnotation = "simulated.machine.openshift.io/fail-create"
+
+	// NodeNotReadyAnnotation makes the Node of a Machine report that it is not ready, for example to trigger
+	// the remediation of the Machine by a machine health check.
+	NodeNotReadyAnnotation = "simulated.machine.openshift.io/node-not-ready"
+
+	// TerminateAnnotation terminates the instance of a Machine, as if it had been deleted outside of the Machine API.
+	TerminateAnnotation = "simulated.machine.openshift.io/terminate"
+
+	providerIDPrefix = "simulated://"
+
+	instanceStateProvisioning = "provisioning"
+	instanceStateRunning      = "running"
+	instanceStateTerminating  = "terminating"
+
+	createEventAction = "Create"
+	updateEventAction = "Update"
+	deleteEventAction = "Delete"
+)
+
+var _ machinecontroller.InstanceLister = &Actuator{}
+
+// firstAddress is the first address given to simulated instances.
+var firstAddress = net.IPv4(10, 0, 0, 1).To4()
+
+// instance is a simulated instance.
+type instance struct {
+	providerID string
+	address    string
+	// readyAt is the time at which the instance is provisioned and its Node registered.
+	readyAt time.Time
+	// goneAt is the time at which a terminating instance is gone. It is zero until the instance is deleted.
+	goneAt time.Time
+}
+
+// Actuator simulates the instances of Machines in memory. The instances are lost when the Actuator is restarted,
+// and their Machines then fail as their instances are missing.
+type Actuator struct {
+	client              runtimeclient.Client
+	eventRecorder       record.EventRecorder
+	provisioningLatency time.Duration
+	deletionLatency     time.Duration
+	createFailureRate   float64
+
+	// now returns the current time, it is replaced in tests.
+	now func() time.Time
+
+	lock      sync.Mutex
+	rand      *rand.Rand
+	instances map[string]*instance
+	addresses uint32
+}
+
+// ActuatorParams holds parameter information for Actuator.
+type ActuatorParams struct {
+	Client        runtimeclient.Client
+	EventRecorder record.EventRecorder
+
+	// ProvisioningLatency is the time it takes for an instance to be provisioned and for its Node to register.
+	ProvisioningLatency time.Duration
+
+	// DeletionLatency is the time it takes for an instance to be gone once it has been deleted.
+	DeletionLatency time.Duration
+
+	// CreateFailureRate is the probability, between 0 and 1, that the creation of an instance fails with
+	// a transient error, which is retried by the machine controller.
+	CreateFailureRate float64
+}
+
+// NewActuator returns an actuator.
+func NewActuator(params ActuatorParams) *Actuator {
+	return &Actuator{
+		client:              params.Client,
+		eventRecorder:       params.EventRecorder,
+		provisioningLatency: params.ProvisioningLatency,
+		deletionLatency:     params.DeletionLatency,
+		createFailureRate:   params.CreateFailureRate,
+		now:                 time.Now,
+		rand:                rand.New(rand.NewSource(time.Now().UnixNano())),
+		instances:           map[string]*instance{},
+	}
+}
+
+// Create creates the simulated instance of a machine, which is given a provider ID and an address straight away.
+func (a *Actuator) Create(ctx context.Context, machine *machinev1.Machine) error {
+	klog.Infof("%s: actuator creating machine", machine.GetName())
+
+	if message, ok := machine.Annotations[FailCreateAnnotation]; ok {
+		err := machinecontroller.InvalidMachineConfiguration("simulated failure: %s", message)
+		a.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "Failed"+createEventAction, "%v", err)
+		return err
+	}
+
+	a.lock.Lock()
+	inst, ok := a.instances[instanceKey(machine)]
+	if !ok {
+		if a.rand.Float64() < a.createFailureRate {
+			a.lock.Unlock()
+			err := machinecontroller.CreateMachine("simulated transient failure creating the instance")
+			a.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "Failed"+createEventAction, "%v", err)
+			return err
+		}
+
+		inst = &instance{
+			providerID: providerIDPrefix + instanceKey(machine),
+			address:    a.nextAddress(),
+			readyAt:    a.now().Add(a.provisioningLatency),
+		}
+		a.instances[instanceKey(machine)] = inst
+	}
+	instance := *inst
+	a.lock.Unlock()
+
+	if err := a.patchMachine(ctx, machine, &instance, instanceStateProvisioning); err != nil {
+		return err
+	}
+	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, createEventAction, "Created Machine %v", machine.GetName())
+	return nil
+}
+
+// Exists checks if the simulated instance of a machine exists. Terminating instances exist until the deletion
+// latency has passed, and instances of machines with the terminate annotation are terminated straight away.
+func (a *Actuator) Exists(ctx context.Context, machine *machinev1.Machine) (bool, error) {
+	klog.Infof("%s: actuator checking if machine exists", machine.GetName())
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key := instanceKey(machine)
+	inst, ok := a.instances[key]
+	if !ok {
+		return false, nil
+	}
+
+	if _, terminate := machine.Annotations[TerminateAnnotation]; terminate && inst.goneAt.IsZero() {
+		klog.Infof("%s: terminating instance %q as requested by the %s annotation", machine.GetName(), inst.providerID, TerminateAnnotation)
+		delete(a.instances, key)
+		return false, nil
+	}
+
+	if !inst.goneAt.IsZero() && !a.now().Before(inst.goneAt) {
+		delete(a.instances, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Update updates the machine with the state of its simulated instance. Once the instance is provisioned,
+// the Node of the machine is registered, and its readiness is kept in line with the node not ready annotation.
+func (a *Actuator) Update(ctx context.Context, machine *machinev1.Machine) error {
+	klog.Infof("%s: actuator updating machine", machine.GetName())
+
+	a.lock.Lock()
+	inst, ok := a.instances[instanceKey(machine)]
+	if !ok {
+		a.lock.Unlock()
+		return machinecontroller.UpdateMachine("simulated instance of machine %q not found", machine.GetName())
+	}
+	instance := *inst
+	a.lock.Unlock()
+
+	if remaining := instance.readyAt.Sub(a.now()); remaining > 0 {
+		if err := a.patchMachine(ctx, machine, &instance, instanceStateProvisioning); err != nil {
+			return err
+		}
+		klog.V(3).Infof("%s: instance %q is provisioning, requeuing in %v", machine.GetName(), instance.providerID, remaining)
+		return &machinecontroller.RequeueAfterError{RequeueAfter: remaining}
+	}
+
+	if err := a.ensureNode(ctx, machine, &instance); err != nil {
+		err = fmt.Errorf("%s: failed to register node: %w", machine.GetName(), err)
+		a.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "Failed"+updateEventAction, "%v", err)
+		return err
+	}
+	if err := a.patchMachine(ctx, machine, &instance, instanceStateRunning); err != nil {
+		return err
+	}
+	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, updateEventAction, "Updated Machine %v", machine.GetName())
+	return nil
+}
+
+// Delete terminates the simulated instance of a machine, which is gone once the deletion latency has passed.
+// The Node of the machine is deleted by the machine controller.
+func (a *Actuator) Delete(ctx context.Context, machine *machinev1.Machine) error {
+	klog.Infof("%s: actuator deleting machine", machine.GetName())
+
+	a.lock.Lock()
+	inst, ok := a.instances[instanceKey(machine)]
+	if !ok {
+		a.lock.Unlock()
+		return nil
+	}
+	if inst.goneAt.IsZero() {
+		inst.goneAt = a.now().Add(a.deletionLatency)
+	}
+	instance := *inst
+	a.lock.Unlock()
+
+	if err := a.patchMachine(ctx, machine, &instance, instanceStateTerminating); err != nil {
+		return err
+	}
+	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, deleteEventAction, "Deleted machine %v", machine.GetName())
+	return nil
+}
+
+// ListInstances returns the provider IDs of the simulated instances which are not gone.
+func (a *Actuator) ListInstances(ctx context.Context) (sets.String, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	instances := sets.NewString()
+	now := a.now()
+	for _, inst := range a.instances {
+		if inst.goneAt.IsZero() || now.Before(inst.goneAt) {
+			instances.Insert(inst.providerID)
+		}
+	}
+	return instances, nil
+}
+
+// InstanceID returns the provider ID of the machine. Machines with the terminate annotation have no ID, so that
+// Exists is called and terminates their instance.
+func (a *Actuator) InstanceID(_ context.Context, machine *machinev1.Machine) string {
+	if _, terminate := machine.Annotations[TerminateAnnotation]; terminate {
+		return ""
+	}
+	return pointer.StringDeref(machine.Spec.ProviderID, "")
+}
+
+// patchMachine sets the provider ID, the addresses and the instance state of the machine.
+func (a *Actuator) patchMachine(ctx context.Context, machine *machinev1.Machine, instance *instance, state string) error {
+	patchBase := runtimeclient.MergeFrom(machine.DeepCopy())
+
+	machine.Spec.ProviderID = pointer.String(instance.providerID)
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[machinecontroller.MachineInstanceStateAnnotationName] = state
+	statusCopy := *machine.Status.DeepCopy()
+	statusCopy.Addresses = nodeAddresses(machine, instance)
+
+	if err := a.client.Patch(ctx, machine, patchBase); err != nil {
+		klog.Errorf("Failed to patch machine %q: %v", machine.GetName(), err)
+		return err
+	}
+
+	machine.Status = statusCopy
+	if err := a.client.Status().Patch(ctx, machine, patchBase); err != nil {
+		klog.Errorf("Failed to patch machine status %q: %v", machine.GetName(), err)
+		return err
+	}
+	return nil
+}
+
+// ensureNode registers the Node of a machine, as a kubelet would, and sets its readiness.
+func (a *Actuator) ensureNode(ctx context.Context, machine *machinev1.Machine, instance *instance) error {
+	node := &corev1.Node{}
+	if err := a.client.Get(ctx, runtimeclient.ObjectKey{Name: machine.Name}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		node = &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   machine.Name,
+				Labels: map[string]string{corev1.LabelHostname: machine.Name},
+			},
+			Spec: corev1.NodeSpec{
+				ProviderID: instance.providerID,
+			},
+		}
+		if err := a.client.Create(ctx, node); err != nil {
+			return err
+		}
+		klog.Infof("%s: registered node %q", machine.GetName(), node.Name)
+	}
+
+	ready := corev1.NodeCondition{
+		Type:    corev1.NodeReady,
+		Status:  corev1.ConditionTrue,
+		Reason:  "KubeletReady",
+		Message: "simulated kubelet is posting ready status",
+	}
+	if _, notReady := machine.Annotations[NodeNotReadyAnnotation]; notReady {
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = "KubeletNotReady"
+		ready.Message = fmt.Sprintf("simulated kubelet is not ready, as requested by the %s annotation", NodeNotReadyAnnotation)
+	}
+
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status == ready.Status {
+			return nil
+		}
+	}
+
+	now := metav1.NewTime(a.now())
+	ready.LastHeartbeatTime = now
+	ready.LastTransitionTime = now
+	node.Status.Conditions = []corev1.NodeCondition{ready}
+	node.Status.Addresses = nodeAddresses(machine, instance)
+	node.Status.Capacity = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("16Gi"),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+	node.Status.Allocatable = node.Status.Capacity
+	return a.client.Status().Update(ctx, node)
+}
+
+// nextAddress returns the address of a new instance. It must be called with the lock held.
+func (a *Actuator) nextAddress() string {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(firstAddress)+a.addresses)
+	a.addresses++
+	return ip.String()
+}
+
+func nodeAddresses(machine *machinev1.Machine, instance *instance) []corev1.NodeAddress {
+	return []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: instance.address},
+		{Type: corev1.NodeInternalDNS, Address: machine.Name},
+		{Type: corev1.NodeHostName, Address: machine.Name},
+	}
+}
+
+func instanceKey(machine *machinev1.Machine) string {
+	return machine.Namespace + "/" + machine.Name
+}
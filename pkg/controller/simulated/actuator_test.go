@@ -0,0 +1,173 @@
+package simulated
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+func newTestActuator(t *testing.T, params ActuatorParams, objects ...runtimeclient.Object) (*Actuator, *time.Time) {
+	if err := machinev1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	params.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+	params.EventRecorder = record.NewFakeRecorder(32)
+
+	a := NewActuator(params)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+	return a, &now
+}
+
+func newMachine(name string, annotations map[string]string) *machinev1.Machine {
+	return &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+	}
+}
+
+func getNode(g *WithT, a *Actuator, name string) *corev1.Node {
+	node := &corev1.Node{}
+	g.Expect(a.client.Get(context.Background(), runtimeclient.ObjectKey{Name: name}, node)).To(Succeed())
+	return node
+}
+
+func TestLifecycle(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	m := newMachine("machine", nil)
+	a, now := newTestActuator(t, ActuatorParams{ProvisioningLatency: time.Minute, DeletionLatency: 30 * time.Second}, m)
+
+	exists, err := a.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+
+	g.Expect(a.Create(ctx, m)).To(Succeed())
+	g.Expect(m.Spec.ProviderID).To(Equal(pointer.String("simulated://default/machine")))
+	g.Expect(m.Status.Addresses).To(ContainElement(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}))
+	g.Expect(m.Annotations).To(HaveKeyWithValue(machinecontroller.MachineInstanceStateAnnotationName, instanceStateProvisioning))
+
+	exists, err = a.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	// The node registers once the instance is provisioned.
+	*now = now.Add(20 * time.Second)
+	err = a.Update(ctx, m)
+	var requeueAfterError *machinecontroller.RequeueAfterError
+	g.Expect(errors.As(err, &requeueAfterError)).To(BeTrue())
+	g.Expect(requeueAfterError.RequeueAfter).To(Equal(40 * time.Second))
+	g.Expect(a.client.Get(ctx, runtimeclient.ObjectKey{Name: "machine"}, &corev1.Node{})).ToNot(Succeed())
+
+	*now = now.Add(40 * time.Second)
+	g.Expect(a.Update(ctx, m)).To(Succeed())
+	g.Expect(m.Annotations).To(HaveKeyWithValue(machinecontroller.MachineInstanceStateAnnotationName, instanceStateRunning))
+	node := getNode(g, a, "machine")
+	g.Expect(node.Spec.ProviderID).To(Equal("simulated://default/machine"), "the node should be linked to the machine by its provider ID")
+	g.Expect(node.Status.Addresses).To(Equal(m.Status.Addresses))
+	g.Expect(node.Status.Conditions).To(ConsistOf(HaveField("Status", corev1.ConditionTrue)))
+
+	// The node turns not ready on request.
+	m.Annotations[NodeNotReadyAnnotation] = ""
+	g.Expect(a.Update(ctx, m)).To(Succeed())
+	node = getNode(g, a, "machine")
+	g.Expect(node.Status.Conditions).To(ConsistOf(HaveField("Status", corev1.ConditionFalse)))
+
+	instances, err := a.ListInstances(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(instances.List()).To(ConsistOf(a.InstanceID(ctx, m)))
+
+	// The instance is gone once the deletion latency has passed.
+	g.Expect(a.Delete(ctx, m)).To(Succeed())
+	g.Expect(m.Annotations).To(HaveKeyWithValue(machinecontroller.MachineInstanceStateAnnotationName, instanceStateTerminating))
+	exists, err = a.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	*now = now.Add(30 * time.Second)
+	instances, err = a.ListInstances(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(instances.List()).To(BeEmpty())
+	exists, err = a.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+}
+
+func TestCreateFailures(t *testing.T) {
+	testCases := []struct {
+		name           string
+		params         ActuatorParams
+		annotations    map[string]string
+		expectedReason machinev1.MachineStatusError
+	}{
+		{
+			name:           "with the fail create annotation",
+			annotations:    map[string]string{FailCreateAnnotation: "no capacity"},
+			expectedReason: machinev1.InvalidConfigurationMachineError,
+		},
+		{
+			name:           "with transient failures",
+			params:         ActuatorParams{CreateFailureRate: 1},
+			expectedReason: machinev1.CreateMachineError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			m := newMachine("machine", tc.annotations)
+			a, _ := newTestActuator(t, tc.params, m)
+
+			err := a.Create(ctx, m)
+			var machineError *machinecontroller.MachineError
+			g.Expect(errors.As(err, &machineError)).To(BeTrue())
+			g.Expect(machineError.Reason).To(Equal(tc.expectedReason))
+
+			exists, err := a.Exists(ctx, m)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(exists).To(BeFalse(), "no instance should have been created")
+		})
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	m := newMachine("machine", nil)
+	other := newMachine("other", nil)
+	a, _ := newTestActuator(t, ActuatorParams{}, m, other)
+
+	g.Expect(a.Create(ctx, m)).To(Succeed())
+	g.Expect(a.Create(ctx, other)).To(Succeed())
+	g.Expect(other.Status.Addresses).To(ContainElement(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}))
+
+	m.Annotations[TerminateAnnotation] = ""
+	g.Expect(a.InstanceID(ctx, m)).To(BeEmpty(), "the instance should be looked up individually to be terminated")
+	exists, err := a.Exists(ctx, m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse(), "the instance should have been terminated")
+
+	exists, err = a.Exists(ctx, other)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue(), "other instances should not be terminated")
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,6 +32,8 @@ import (
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/tracing"
 )
 
 const (
@@ -43,6 +46,13 @@ const (
 	minimumHWVersion      = 15
 )
 
+// Attributes set on the spans of the checks of vSphere tasks.
+const (
+	taskRefKey         = attribute.Key("vsphere.task.ref")
+	taskDescriptionKey = attribute.Key("vsphere.task.description")
+	taskStateKey       = attribute.Key("vsphere.task.state")
+)
+
 // These are the guestinfo variables used by Ignition.
 // https://access.redhat.com/documentation/en-us/openshift_container_platform/4.1/html/installing/installing-on-vsphere
 const (
@@ -104,7 +114,7 @@ func (r *Reconciler) create() error {
 		return setProviderStatus(task, conditionSuccess(), r.machineScope, nil)
 	}
 
-	moTask, err := r.session.GetTask(r.Context, r.providerStatus.TaskRef)
+	moTask, err := r.getTask(r.providerStatus.TaskRef)
 	if err != nil {
 		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
 			Name:      r.machine.Name,
@@ -173,7 +183,7 @@ func (r *Reconciler) update() error {
 	}
 
 	if r.providerStatus.TaskRef != "" {
-		moTask, err := r.session.GetTask(r.Context, r.providerStatus.TaskRef)
+		moTask, err := r.getTask(r.providerStatus.TaskRef)
 		if err != nil {
 			if !isRetrieveMONotFound(r.providerStatus.TaskRef, err) {
 				metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
@@ -256,6 +266,7 @@ func (r *Reconciler) exists() (bool, error) {
 	// Check if machine was powered on after clone.
 	// If it is powered off and in "Provisioning" phase, treat machine as non-existed yet and requeue for proceed
 	// with creation procedure.
+	// An adopted VM was never cloned by the machine, so it exists whatever its power state.
 	powerState := types.VirtualMachinePowerState(pointer.StringDeref(r.machineScope.providerStatus.InstanceState, ""))
 	if powerState == "" {
 		vm := &virtualMachine{
@@ -266,7 +277,8 @@ func (r *Reconciler) exists() (bool, error) {
 		powerState, err = vm.getPowerState()
 	}
 
-	if pointer.StringDeref(r.machine.Status.Phase, "") == machinePhaseProvisioning && powerState == types.VirtualMachinePowerStatePoweredOff {
+	if pointer.StringDeref(r.machine.Status.Phase, "") == machinePhaseProvisioning && powerState == types.VirtualMachinePowerStatePoweredOff &&
+		!machines.IsAdoptingInstance(r.machine) {
 		klog.Infof("%v: already exists, but was not powered on after clone, requeue ", r.machine.GetName())
 		return false, nil
 	}
@@ -279,7 +291,7 @@ func (r *Reconciler) delete() error {
 	if r.providerStatus.TaskRef != "" {
 		// TODO: We need to use a separate status field for the create and the
 		// delete taskref.
-		moTask, err := r.session.GetTask(r.Context, r.providerStatus.TaskRef)
+		moTask, err := r.getTask(r.providerStatus.TaskRef)
 		if err != nil {
 			if !isRetrieveMONotFound(r.providerStatus.TaskRef, err) {
 				return err
@@ -337,15 +349,19 @@ func (r *Reconciler) delete() error {
 			if err := vm.detachPVDisks(); err != nil {
 				return fmt.Errorf("%v: Failed to detach virtual disks related to pvs: %w", r.machine.GetName(), err)
 			}
-		}
-
-		// After node draining, make sure volumes are detached before deleting the Node.
-		attached, err := r.nodeHasVolumesAttached(r.Context, r.machine.Status.NodeRef.Name, r.machine.Name)
-		if err != nil {
-			return fmt.Errorf("failed to determine if node %v has attached volumes: %w", r.machine.Status.NodeRef.Name, err)
-		}
-		if attached {
-			return fmt.Errorf("node %v has attached volumes, requeuing", r.machine.Status.NodeRef.Name)
+		} else {
+			// The machine controller waits for the volumes to detach, but the wait may have been skipped or timed out.
+			// Destroying the vm would then delete the VMDKs of the volumes still attached to it.
+			attached, err := r.nodeHasVolumesAttached(r.Context, r.machine.Status.NodeRef.Name)
+			if err != nil {
+				return fmt.Errorf("failed to determine if node %v has attached volumes: %w", r.machine.Status.NodeRef.Name, err)
+			}
+			if attached {
+				klog.Infof("%v: node still has volumes attached. Detaching disks before vm destroy.", r.machine.GetName())
+				if err := vm.detachPVDisks(); err != nil {
+					return fmt.Errorf("%v: Failed to detach virtual disks related to pvs: %w", r.machine.GetName(), err)
+				}
+			}
 		}
 	}
 
@@ -382,16 +398,12 @@ func (r *Reconciler) delete() error {
 	return fmt.Errorf("destroying vm in progress, requeuing")
 }
 
-// nodeHasVolumesAttached returns true if node status still have volumes attached
-// pod deletion and volume detach happen asynchronously, so pod could be deleted before volume detached from the node
-// this could cause issue for some storage provisioner, for example, vsphere-volume this is problematic
-// because if the node is deleted before detach success, then the underline VMDK will be deleted together with the Machine
-// so after node draining we need to check if all volumes are detached before deleting the node.
-func (r *Reconciler) nodeHasVolumesAttached(ctx context.Context, nodeName string, machineName string) (bool, error) {
+// nodeHasVolumesAttached returns true if node status still have volumes attached.
+func (r *Reconciler) nodeHasVolumesAttached(ctx context.Context, nodeName string) (bool, error) {
 	node := &corev1.Node{}
 	if err := r.apiReader.Get(ctx, apimachinerytypes.NamespacedName{Name: nodeName}, node); err != nil {
 		if apierrors.IsNotFound(err) {
-			klog.Errorf("Could not find node from noderef, it may have already been deleted: %w", err)
+			klog.Errorf("Could not find node from noderef, it may have already been deleted: %v", err)
 			return false, nil
 		}
 		return true, err
@@ -483,6 +495,18 @@ func convertUUIDToProviderID(UUID string) (string, error) {
 	return providerIDPrefix + parsedUUID.String(), nil
 }
 
+// convertProviderIDToUUID extracts the UUID from a provider ID.
+func convertProviderIDToUUID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, providerIDPrefix) {
+		return "", fmt.Errorf("provider ID must start with %q", providerIDPrefix)
+	}
+	parsedUUID, err := uuid.Parse(strings.TrimPrefix(providerID, providerIDPrefix))
+	if err != nil {
+		return "", err
+	}
+	return parsedUUID.String(), nil
+}
+
 func (r *Reconciler) reconcileNetwork(vm *virtualMachine) error {
 	currentNetworkStatusList, err := vm.getNetworkStatusList(r.session.Client.Client)
 	if err != nil {
@@ -553,6 +577,10 @@ func validateMachine(machine machinev1.Machine) error {
 }
 
 func findVM(s *machineScope) (types.ManagedObjectReference, error) {
+	if machines.IsAdoptingInstance(s.machine) {
+		return findAdoptedVM(s)
+	}
+
 	uuid := string(s.machine.UID)
 
 	vm, err := s.GetSession().FindVM(s.Context, uuid, s.machine.Name)
@@ -570,6 +598,27 @@ func findVM(s *machineScope) (types.ManagedObjectReference, error) {
 	return vm.Reference(), nil
 }
 
+// findAdoptedVM finds the VM adopted by a Machine by the BIOS UUID in its provider ID.
+// The VM was not cloned for the Machine, so neither its instance UUID nor its name match the Machine.
+func findAdoptedVM(s *machineScope) (types.ManagedObjectReference, error) {
+	providerID := pointer.StringDeref(s.machine.Spec.ProviderID, "")
+	uuid, err := convertProviderIDToUUID(providerID)
+	if err != nil {
+		return types.ManagedObjectReference{}, machinecontroller.InvalidMachineConfiguration("%v: invalid provider ID %q to adopt: %v", s.machine.GetName(), providerID, err)
+	}
+
+	ref, err := s.GetSession().FindRefByBIOSUUID(s.Context, uuid)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	if ref == nil {
+		return types.ManagedObjectReference{}, errNotFound{uuid: uuid}
+	}
+
+	return ref.Reference(), nil
+}
+
 // errNotFound is returned by the findVM function when a VM is not found.
 type errNotFound struct {
 	instanceUUID bool
@@ -926,6 +975,28 @@ func newVMFlagInfo() *types.VirtualMachineFlagInfo {
 	}
 }
 
+// getTask fetches the vSphere task of the machine.
+// Tasks are not waited on in place: their state is checked on every reconcile until they have finished,
+// and a span is recorded with the state of the task for each check.
+func (r *Reconciler) getTask(taskRef string) (*mo.Task, error) {
+	attrs := append(tracing.MachineAttributes(r.machine), taskRefKey.String(taskRef))
+	ctx, span := tracing.Start(r.Context, "vsphere.WaitForTask", r.machine, attrs...)
+	defer span.End()
+
+	moTask, err := r.session.GetTask(ctx, taskRef)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if moTask != nil {
+		span.SetAttributes(
+			taskDescriptionKey.String(moTask.Info.DescriptionId),
+			taskStateKey.String(string(moTask.Info.State)),
+		)
+	}
+	return moTask, nil
+}
+
 func taskIsFinished(task *mo.Task) (bool, error) {
 	if task == nil {
 		return true, nil
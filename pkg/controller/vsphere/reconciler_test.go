@@ -41,6 +41,7 @@ import (
 
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
 
 	_ "github.com/vmware/govmomi/vapi/simulator"
 )
@@ -1448,6 +1449,43 @@ func TestConvertUUIDToProviderID(t *testing.T) {
 	}
 }
 
+func TestConvertProviderIDToUUID(t *testing.T) {
+	validUUID := "f7c371d6-2003-5a48-9859-3bc9a8b08908"
+	testCases := []struct {
+		testCase   string
+		providerID string
+		expected   string
+	}{
+		{
+			testCase:   "valid",
+			providerID: providerIDPrefix + validUUID,
+			expected:   validUUID,
+		},
+		{
+			testCase:   "without the prefix",
+			providerID: validUUID,
+			expected:   "",
+		},
+		{
+			testCase:   "invalid",
+			providerID: providerIDPrefix + "f7c371d6",
+			expected:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			got, err := convertProviderIDToUUID(tc.providerID)
+			if got != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+			if tc.expected == "" && err == nil {
+				t.Errorf("expected error, got %v", err)
+			}
+		})
+	}
+}
+
 func TestDelete(t *testing.T) {
 	withMoreVms := func(vmsCount int) simulatorModelOption {
 		return func(m *simulator.Model) {
@@ -1576,6 +1614,26 @@ func TestDelete(t *testing.T) {
 				})
 			},
 		},
+		{
+			testCase: "all good, volumes still attached",
+			machine: func(t *testing.T) *machinev1.Machine {
+				return getMachineWithStatus(t, machinev1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{
+						Name: nodeName,
+					},
+				})
+			},
+			node: func(t *testing.T) *corev1.Node {
+				node := getNodeWithConditions([]corev1.NodeCondition{
+					{
+						Type:   corev1.NodeReady,
+						Status: corev1.ConditionTrue,
+					},
+				})
+				node.Status.VolumesAttached = []corev1.AttachedVolume{{Name: "kubernetes.io/vsphere-volume/[datastore] kubevols/volume.vmdk"}}
+				return node
+			},
+		},
 		{
 			testCase: "all good, no node linked",
 			machine: func(t *testing.T) *machinev1.Machine {
@@ -2085,6 +2143,7 @@ func TestExists(t *testing.T) {
 		instanceState string
 		exists        bool
 		vmExists      bool
+		adoptVM       string
 	}{
 		{
 			name:          "VM doesn't exist",
@@ -2114,6 +2173,25 @@ func TestExists(t *testing.T) {
 			exists:        true,
 			vmExists:      true,
 		},
+		{
+			name:          "adopted VM exists",
+			instanceState: string(types.VirtualMachinePowerStatePoweredOn),
+			adoptVM:       providerIDPrefix + vm.Config.Uuid,
+			exists:        true,
+		},
+		{
+			name:          "adopted VM exists, but powered off while provisioning",
+			machinePhase:  "Provisioning",
+			instanceState: string(types.VirtualMachinePowerStatePoweredOff),
+			adoptVM:       providerIDPrefix + vm.Config.Uuid,
+			exists:        true,
+		},
+		{
+			name:          "adopted VM doesn't exist",
+			instanceState: string(types.VirtualMachinePowerStatePoweredOn),
+			adoptVM:       providerIDPrefix + "5a4d7b5e-61b1-4d76-9b0d-c41c2a2f0e9a",
+			exists:        false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -2149,6 +2227,11 @@ func TestExists(t *testing.T) {
 				reconciler.machine.UID = apimachinerytypes.UID(instanceUUID)
 			}
 
+			if tc.adoptVM != "" {
+				reconciler.machine.Annotations = map[string]string{machines.AdoptInstanceAnnotation: ""}
+				reconciler.machine.Spec.ProviderID = &tc.adoptVM
+			}
+
 			exists, err := reconciler.exists()
 			if err != nil {
 				t.Fatalf("reconciler was not expected to return error: %v", err)
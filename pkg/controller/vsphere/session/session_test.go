@@ -140,6 +140,44 @@ func TestFindRefByInstanceUUID(t *testing.T) {
 	}
 }
 
+func TestFindRefByBIOSUUID(t *testing.T) {
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	simulatorVM := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	biosUUID := "422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"
+	simulatorVM.Config.Uuid = biosUUID
+
+	testCases := []struct {
+		testCase string
+		ID       string
+		found    bool
+	}{
+		{
+			testCase: "found",
+			ID:       biosUUID,
+			found:    true,
+		},
+		{
+			testCase: "not found",
+			ID:       "notFound",
+			found:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			ref, err := session.FindRefByBIOSUUID(context.TODO(), tc.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (ref != nil) != tc.found {
+				t.Errorf("Expected found: %v, got: %v", tc.found, ref)
+			}
+		})
+	}
+}
+
 func TestFindVM(t *testing.T) {
 	model, session, server := initSimulator(t)
 	defer model.Remove()
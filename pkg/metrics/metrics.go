@@ -1,10 +1,18 @@
 package metrics
 
 import (
+	"time"
+
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	machineinformers "github.com/openshift/client-go/machine/informers/externalversions/machine/v1beta1"
 	machinelisters "github.com/openshift/client-go/machine/listers/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
 	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -35,6 +43,30 @@ var (
 	// MachineSetStatusReplicasDesc is the information of the Machineset's status for replicas.
 	MachineSetStatusReplicasDesc = prometheus.NewDesc("mapi_machine_set_status_replicas", "Information of the mapi managed Machineset's status for replicas", []string{"name", "namespace"}, nil)
 
+	// MachineSetStatusUpdatedReplicasDesc is the number of Machines of the Machineset created from its current template.
+	MachineSetStatusUpdatedReplicasDesc = prometheus.NewDesc("mapi_machine_set_status_replicas_updated", "Number of Machines of the mapi managed Machineset created from its current template", []string{"name", "namespace"}, nil)
+
+	// MachineSetStatusOutdatedReplicasDesc is the number of Machines of the Machineset created from a previous template.
+	MachineSetStatusOutdatedReplicasDesc = prometheus.NewDesc("mapi_machine_set_status_replicas_outdated", "Number of Machines of the mapi managed Machineset created from a previous template", []string{"name", "namespace"}, nil)
+
+	// MachineSetStatusUnknownReplicasDesc is the number of Machines of the Machineset whose template is unknown.
+	MachineSetStatusUnknownReplicasDesc = prometheus.NewDesc("mapi_machine_set_status_replicas_unknown_template", "Number of Machines of the mapi managed Machineset without a template hash, whose template is unknown", []string{"name", "namespace"}, nil)
+
+	// MachineOutdatedDesc reports the Machines created from a previous template of their Machineset.
+	MachineOutdatedDesc = prometheus.NewDesc("mapi_machine_outdated", "Set to 1 while a mapi managed Machine was created from a previous template of its Machineset", []string{"name", "namespace", "machineset"}, nil)
+
+	// MachineSetScalingMachinesDesc reports the Machines of the Machineset which are in flight, or pending because of its scaling policy.
+	MachineSetScalingMachinesDesc = prometheus.NewDesc("mapi_machine_set_scaling_machines", "Number of Machines of the mapi managed Machineset which are creating or deleting, or pending because of its scaling policy", []string{"name", "namespace", "state"}, nil)
+
+	// MachineLifecycleHookHeldDesc is the time the lifecycle hooks of the deleted Machines have been holding their deletion.
+	MachineLifecycleHookHeldDesc = prometheus.NewDesc("mapi_machine_lifecycle_hook_held_seconds", "Number of seconds a lifecycle hook has been holding the deletion of a mapi managed Machine", []string{"name", "namespace", "stage", "hook", "owner"}, nil)
+
+	// MachinePausedDesc reports the Machines whose reconciliation is paused.
+	MachinePausedDesc = prometheus.NewDesc("mapi_machine_paused", "Set to 1 while the reconciliation of a mapi managed Machine is paused", []string{"name", "namespace"}, nil)
+
+	// MachineSetPausedDesc reports the MachineSets whose replica reconciliation is paused.
+	MachineSetPausedDesc = prometheus.NewDesc("mapi_machine_set_paused", "Set to 1 while the replica reconciliation of a mapi managed Machineset is paused", []string{"name", "namespace"}, nil)
+
 	// MachineCollectorUp is a Prometheus metric, which reports reflects successful collection and reporting of all the metrics
 	MachineCollectorUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "mapi_mao_collector_up",
@@ -61,6 +93,13 @@ var (
 			Help: "Number of times provider instance delete has failed.",
 		}, []string{"name", "namespace", "reason"},
 	)
+
+	lifecycleHookTimeoutCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_machine_lifecycle_hook_timeouts_total",
+			Help: "Number of lifecycle hooks which held the deletion of a Machine for longer than their timeout.",
+		}, []string{"stage", "policy"},
+	)
 )
 
 // Metrics for use in the Machine controller
@@ -73,15 +112,97 @@ var (
 			Buckets: []float64{5, 10, 20, 30, 60, 90, 120, 180, 240, 300, 360, 480, 600},
 		}, []string{"phase"},
 	)
+
+	// MachineDrainDurationSeconds is the time the drains of the Nodes of deleted Machines took,
+	// by whether the drain succeeded or was abandoned after exceeding its timeout.
+	MachineDrainDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_machine_drain_duration_seconds",
+			Help:    "Number of seconds between the start and the end of the drain of the Node of a deleted Machine.",
+			Buckets: []float64{5, 10, 30, 60, 120, 300, 600, 900, 1800, 3600, 7200},
+		}, []string{"result"},
+	)
+
+	// MachineInstanceDeleteDurationSeconds is the time the actuator took to delete the instances of deleted Machines.
+	MachineInstanceDeleteDurationSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "mapi_machine_instance_delete_duration_seconds",
+			Help:    "Number of seconds between the first request to the actuator to delete the instance of a Machine and the instance no longer existing.",
+			Buckets: []float64{5, 10, 20, 30, 60, 90, 120, 180, 240, 300, 600, 900},
+		},
+	)
+
+	// MachineNodeDeleteDurationSeconds is the time the machine controller took to delete the Nodes of deleted Machines.
+	MachineNodeDeleteDurationSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "mapi_machine_node_delete_duration_seconds",
+			Help:    "Number of seconds taken to delete the Node of a deleted Machine once its instance no longer existed.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+	)
+
+	// ActuatorOperationsThrottledTotal counts the actuator operations which were not started because of the actuator limits.
+	ActuatorOperationsThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_actuator_operations_throttled_total",
+			Help: "Number of actuator operations which were not started, and requeued, because of the actuator limits of the machine controller.",
+		}, []string{"operation", "reason"},
+	)
+
+	// ActuatorOperationsInFlight is the number of actuator operations in progress.
+	ActuatorOperationsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_actuator_operations_in_flight",
+			Help: "Number of actuator operations in progress.",
+		}, []string{"operation"},
+	)
+
+	// InstanceSnapshotLookupsTotal counts the lookups of instances in the snapshot shared by all Machines,
+	// by whether the instance was found in the snapshot or had to be looked up individually.
+	InstanceSnapshotLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_instance_snapshot_lookups_total",
+			Help: "Number of instance existence checks served from the instance snapshot (hit), or looked up individually because the instance was not in the snapshot (miss) or the snapshot could not be listed (fallback).",
+		}, []string{"result"},
+	)
+
+	// InstanceSnapshotAgeSeconds is the age of the instance snapshot when it was last used.
+	InstanceSnapshotAgeSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mapi_instance_snapshot_age_seconds",
+			Help: "Number of seconds since the instance snapshot was listed, when it was last used.",
+		},
+	)
+
+	// InstanceSnapshotListFailuresTotal counts the failures to list the instances of the snapshot.
+	InstanceSnapshotListFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mapi_instance_snapshot_list_failures_total",
+			Help: "Number of times the instances of the snapshot could not be listed.",
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(MachineCollectorUp)
 	metrics.Registry.MustRegister(MachinePhaseTransitionSeconds)
+	metrics.Registry.MustRegister(
+		MachineDrainDurationSeconds,
+		MachineInstanceDeleteDurationSeconds,
+		MachineNodeDeleteDurationSeconds,
+	)
+	metrics.Registry.MustRegister(
+		InstanceSnapshotLookupsTotal,
+		InstanceSnapshotAgeSeconds,
+		InstanceSnapshotListFailuresTotal,
+		ActuatorOperationsThrottledTotal,
+		ActuatorOperationsInFlight,
+	)
 	metrics.Registry.MustRegister(
 		failedInstanceCreateCount,
 		failedInstanceUpdateCount,
 		failedInstanceDeleteCount,
+		lifecycleHookTimeoutCount,
 	)
 }
 
@@ -128,6 +249,7 @@ func (mc MachineCollector) collectMachineMetrics(ch chan<- prometheus.Metric) {
 	}
 	MachineCollectorUp.With(prometheus.Labels{"kind": "mapi_machine_items"}).Set(float64(1))
 
+	now := time.Now()
 	for _, machine := range machineList {
 		nodeName := ""
 		if machine.Status.NodeRef != nil {
@@ -149,12 +271,51 @@ func (mc MachineCollector) collectMachineMetrics(ch chan<- prometheus.Metric) {
 				phase,
 			)
 		}
+
+		collectLifecycleHookMetrics(ch, machine, now)
+
+		if machineIsPaused(machine) {
+			ch <- prometheus.MustNewConstMetric(MachinePausedDesc, prometheus.GaugeValue, 1, machine.Name, machine.Namespace)
+		}
 	}
 
 	ch <- prometheus.MustNewConstMetric(MachineCountDesc, prometheus.GaugeValue, float64(len(machineList)))
 	klog.V(4).Infof("collectmachineMetrics exit")
 }
 
+// collectLifecycleHookMetrics reports how long each lifecycle hook has been holding the deletion of the Machine.
+func collectLifecycleHookMetrics(ch chan<- prometheus.Metric, machine *machinev1.Machine, now time.Time) {
+	for _, stage := range []lifecyclehooks.Stage{lifecyclehooks.PreDrain, lifecyclehooks.PreTerminate} {
+		heldSince, held := lifecyclehooks.HeldSince(machine, stage)
+		if !held {
+			continue
+		}
+
+		for _, hook := range lifecyclehooks.Hooks(machine, stage) {
+			ch <- prometheus.MustNewConstMetric(
+				MachineLifecycleHookHeldDesc,
+				prometheus.GaugeValue,
+				now.Sub(heldSince).Seconds(),
+				machine.Name,
+				machine.Namespace,
+				string(stage),
+				hook.Name,
+				hook.Owner,
+			)
+		}
+	}
+}
+
+// machineIsPaused checks whether the reconciliation of the Machine is paused,
+// either by its own annotation or by the MachineSet which owns it.
+func machineIsPaused(machine *machinev1.Machine) bool {
+	if annotations.IsPaused(machine) {
+		return true
+	}
+	paused := conditions.Get(machine, conditions.MachinePaused)
+	return paused != nil && paused.Status == corev1.ConditionTrue
+}
+
 func stringPointerDeref(stringPointer *string) string {
 	if stringPointer != nil {
 		return *stringPointer
@@ -198,6 +359,45 @@ func (mc MachineCollector) collectMachineSetMetrics(ch chan<- prometheus.Metric)
 			float64(machineSet.Status.Replicas),
 			machineSet.Name, machineSet.Namespace,
 		)
+		if annotations.IsPaused(machineSet) {
+			ch <- prometheus.MustNewConstMetric(MachineSetPausedDesc, prometheus.GaugeValue, 1, machineSet.Name, machineSet.Namespace)
+		}
+		collectTemplateStatusMetrics(ch, machineSet)
+		collectScalingProgressMetrics(ch, machineSet)
+	}
+}
+
+// collectScalingProgressMetrics reports the progress of the MachineSet towards its replicas.
+// Nothing is reported while the MachineSet has no Machines in flight and none pending.
+func collectScalingProgressMetrics(ch chan<- prometheus.Metric, machineSet *machinev1.MachineSet) {
+	progress, ok := scalingpolicy.GetScalingProgress(machineSet)
+	if !ok {
+		return
+	}
+
+	for state, value := range map[string]int32{
+		"creating":       progress.Creating,
+		"deleting":       progress.Deleting,
+		"pending_create": progress.PendingCreates,
+		"pending_delete": progress.PendingDeletes,
+	} {
+		ch <- prometheus.MustNewConstMetric(MachineSetScalingMachinesDesc, prometheus.GaugeValue, float64(value), machineSet.Name, machineSet.Namespace, state)
+	}
+}
+
+// collectTemplateStatusMetrics reports the Machines of the MachineSet which were created from a previous template.
+// Nothing is reported until the MachineSet controller has recorded the template status of the MachineSet.
+func collectTemplateStatusMetrics(ch chan<- prometheus.Metric, machineSet *machinev1.MachineSet) {
+	status, ok := machines.GetTemplateStatus(machineSet)
+	if !ok {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(MachineSetStatusUpdatedReplicasDesc, prometheus.GaugeValue, float64(status.UpdatedReplicas), machineSet.Name, machineSet.Namespace)
+	ch <- prometheus.MustNewConstMetric(MachineSetStatusOutdatedReplicasDesc, prometheus.GaugeValue, float64(status.OutdatedReplicas), machineSet.Name, machineSet.Namespace)
+	ch <- prometheus.MustNewConstMetric(MachineSetStatusUnknownReplicasDesc, prometheus.GaugeValue, float64(status.UnknownReplicas), machineSet.Name, machineSet.Namespace)
+	for _, name := range status.OutdatedMachines {
+		ch <- prometheus.MustNewConstMetric(MachineOutdatedDesc, prometheus.GaugeValue, 1, name, machineSet.Namespace, machineSet.Name)
 	}
 }
 
@@ -232,3 +432,11 @@ func RegisterFailedInstanceDelete(labels *MachineLabels) {
 		"reason":    labels.Reason,
 	}).Inc()
 }
+
+// RegisterLifecycleHookTimeout records that a lifecycle hook held the deletion of a Machine for longer than its timeout.
+func RegisterLifecycleHookTimeout(stage lifecyclehooks.Stage, policy lifecyclehooks.TimeoutPolicy) {
+	lifecycleHookTimeoutCount.With(prometheus.Labels{
+		"stage":  string(stage),
+		"policy": string(policy),
+	}).Inc()
+}
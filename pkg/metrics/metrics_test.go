@@ -1,6 +1,16 @@
 package metrics
 
-import "testing"
+import (
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
+)
 
 func TestStringPointerDeref(t *testing.T) {
 	value := "test"
@@ -23,3 +33,92 @@ func TestStringPointerDeref(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectTemplateStatusMetrics(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    map[string]float64
+	}{
+		{
+			name:     "without a template status",
+			expected: map[string]float64{},
+		},
+		{
+			name: "with outdated machines",
+			annotations: map[string]string{
+				machines.TemplateStatusAnnotation: `{"updatedReplicas":1,"outdatedReplicas":2,"outdatedMachines":["a","b"],"unknownReplicas":3}`,
+			},
+			expected: map[string]float64{
+				MachineSetStatusUpdatedReplicasDesc.String():  1,
+				MachineSetStatusOutdatedReplicasDesc.String(): 2,
+				MachineSetStatusUnknownReplicasDesc.String():  3,
+				MachineOutdatedDesc.String():                  2,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			machineSet := &machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: "ms", Namespace: "default", Annotations: tc.annotations}}
+
+			ch := make(chan prometheus.Metric, 10)
+			collectTemplateStatusMetrics(ch, machineSet)
+			close(ch)
+
+			// The values of the machine metrics are added up, which counts the outdated machines.
+			got := map[string]float64{}
+			for metric := range ch {
+				m := &dto.Metric{}
+				if err := metric.Write(m); err != nil {
+					t.Fatalf("Failed to write metric: %v", err)
+				}
+				got[metric.Desc().String()] += m.GetGauge().GetValue()
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("Got: %v, expected: %v", got, tc.expected)
+			}
+			for desc, value := range tc.expected {
+				if got[desc] != value {
+					t.Errorf("Got: %v for %s, expected: %v", got[desc], desc, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectScalingProgressMetrics(t *testing.T) {
+	machineSet := &machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "ms",
+		Namespace: "default",
+		Annotations: map[string]string{
+			scalingpolicy.ScalingProgressAnnotation: `{"creating":2,"deleting":0,"pendingCreates":3,"pendingDeletes":0}`,
+		},
+	}}
+
+	ch := make(chan prometheus.Metric, 10)
+	collectScalingProgressMetrics(ch, machineSet)
+	close(ch)
+
+	got := map[string]float64{}
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			t.Fatalf("Failed to write metric: %v", err)
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "state" {
+				got[label.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{"creating": 2, "deleting": 0, "pending_create": 3, "pending_delete": 0}
+	if len(got) != len(expected) {
+		t.Fatalf("Got: %v, expected: %v", got, expected)
+	}
+	for state, value := range expected {
+		if got[state] != value {
+			t.Errorf("Got: %v for %s, expected: %v", got[state], state, value)
+		}
+	}
+}
@@ -6,8 +6,8 @@ import (
 )
 
 const (
-	// PausedAnnotation is an annotation that can be applied to MachineHealthCheck objects to prevent the MHC controller
-	// from processing it.
+	// PausedAnnotation is an annotation that can be applied to MachineHealthCheck, Machine and MachineSet objects
+	// to prevent their controllers from processing them. The Machines owned by a paused MachineSet are paused too.
 	// TODO: move this annotation to the openshift/api package
 	PausedAnnotation = "cluster.x-k8s.io/paused"
 )
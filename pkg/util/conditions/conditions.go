@@ -1,10 +1,15 @@
 package conditions
 
 import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// MachinePaused is set to true on the Machine while its reconciliation is paused,
+// either by the paused annotation on the Machine or on the MachineSet which owns it.
+const MachinePaused machinev1.ConditionType = "Paused"
+
 // GetNodeCondition returns node condition by type
 func GetNodeCondition(node *corev1.Node, conditionType corev1.NodeConditionType) *corev1.NodeCondition {
 	for _, cond := range node.Status.Conditions {
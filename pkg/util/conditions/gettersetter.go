@@ -84,6 +84,23 @@ func Set(to interface{}, condition *machinev1.Condition) {
 	obj.SetConditions(conditions)
 }
 
+// Delete deletes the condition with the given type.
+func Delete(to interface{}, t machinev1.ConditionType) {
+	if to == nil {
+		return
+	}
+
+	obj := getWrapperObject(to)
+	conditions := obj.GetConditions()
+	newConditions := make(machinev1.Conditions, 0, len(conditions))
+	for _, condition := range conditions {
+		if condition.Type != t {
+			newConditions = append(newConditions, condition)
+		}
+	}
+	obj.SetConditions(newConditions)
+}
+
 // TrueCondition returns a condition with Status=True and the given type.
 func TrueCondition(t machinev1.ConditionType) *machinev1.Condition {
 	return &machinev1.Condition{
@@ -178,6 +178,19 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &machinev1.Machine{}
+	Delete(machine, "conditionBaz")
+	g.Expect(machine.Status.Conditions).To(BeEmpty())
+
+	machine.Status.Conditions = conditionList(TrueCondition("conditionBar"), TrueCondition("conditionBaz"))
+	Delete(machine, "conditionBaz")
+	g.Expect(Get(machine, "conditionBaz")).To(BeNil())
+	g.Expect(Get(machine, "conditionBar")).To(haveSameStateOf(TrueCondition("conditionBar")))
+}
+
 func TestSetLastTransitionTime(t *testing.T) {
 	x := metav1.Date(2012, time.January, 1, 12, 15, 30, 5e8, time.UTC)
 
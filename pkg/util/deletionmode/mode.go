@@ -0,0 +1,57 @@
+// Package deletionmode implements parsing and validation of the annotation
+// used to choose what happens to the instance and Node of a Machine when the Machine is deleted.
+package deletionmode
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DeletionModeAnnotation sets what happens to the instance and Node of a Machine when the Machine is deleted.
+// It must be set before the Machine is deleted, and can not be changed once the deletion has started.
+const DeletionModeAnnotation = "machine.openshift.io/deletion-mode"
+
+// Mode is what happens to the instance and Node of a Machine when the Machine is deleted.
+type Mode string
+
+const (
+	// Delete drains the Node, then deletes the instance and the Node along with the Machine.
+	// This is the default.
+	Delete Mode = "Delete"
+
+	// Orphan deletes the Machine only. The Node is not drained, and the instance and the Node are left running,
+	// for example so that they can be adopted by another cluster or management plane.
+	Orphan Mode = "Orphan"
+)
+
+// Parse returns the deletion Mode set by the given annotations.
+func Parse(annotations map[string]string, fldPath *field.Path) (Mode, field.ErrorList) {
+	value, ok := annotations[DeletionModeAnnotation]
+	if !ok {
+		return Delete, nil
+	}
+
+	switch mode := Mode(value); mode {
+	case Delete, Orphan:
+		return mode, nil
+	default:
+		return Delete, field.ErrorList{field.NotSupported(fldPath.Key(DeletionModeAnnotation), value, []string{string(Delete), string(Orphan)})}
+	}
+}
+
+// IsOrphan checks whether the given annotations set the Orphan deletion mode.
+// Invalid values are treated as the default, so that instances are never orphaned by mistake.
+func IsOrphan(annotations map[string]string) bool {
+	mode, errs := Parse(annotations, field.NewPath("metadata", "annotations"))
+	return len(errs) == 0 && mode == Orphan
+}
+
+// ValidateUpdate checks that the deletion mode is not changed once the deletion of the Machine has started,
+// as the instance may already be partially torn down.
+func ValidateUpdate(annotations, oldAnnotations map[string]string, deleting bool, fldPath *field.Path) field.ErrorList {
+	if !deleting || annotations[DeletionModeAnnotation] == oldAnnotations[DeletionModeAnnotation] {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(fldPath.Key(DeletionModeAnnotation), fmt.Sprintf("can not be changed once the machine is being deleted, it was %q", oldAnnotations[DeletionModeAnnotation]))}
+}
@@ -0,0 +1,64 @@
+package deletionmode
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedMode  Mode
+		expectedError string
+	}{
+		{
+			name:         "with no annotation",
+			expectedMode: Delete,
+		},
+		{
+			name:         "with the delete mode",
+			annotations:  map[string]string{DeletionModeAnnotation: "Delete"},
+			expectedMode: Delete,
+		},
+		{
+			name:         "with the orphan mode",
+			annotations:  map[string]string{DeletionModeAnnotation: "Orphan"},
+			expectedMode: Orphan,
+		},
+		{
+			name:          "with an unknown mode",
+			annotations:   map[string]string{DeletionModeAnnotation: "orphan"},
+			expectedMode:  Delete,
+			expectedError: "metadata.annotations[machine.openshift.io/deletion-mode]: Unsupported value: \"orphan\": supported values: \"Delete\", \"Orphan\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mode, errs := Parse(tc.annotations, field.NewPath("metadata", "annotations"))
+			g.Expect(mode).To(Equal(tc.expectedMode))
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(errs.ToAggregate()).To(MatchError(tc.expectedError))
+			}
+			g.Expect(IsOrphan(tc.annotations)).To(Equal(tc.expectedMode == Orphan && tc.expectedError == ""))
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	g := NewWithT(t)
+	fldPath := field.NewPath("metadata", "annotations")
+	orphan := map[string]string{DeletionModeAnnotation: "Orphan"}
+
+	g.Expect(ValidateUpdate(orphan, nil, false, fldPath)).To(BeEmpty())
+	g.Expect(ValidateUpdate(orphan, orphan, true, fldPath)).To(BeEmpty())
+	g.Expect(ValidateUpdate(orphan, nil, true, fldPath).ToAggregate()).To(MatchError("metadata.annotations[machine.openshift.io/deletion-mode]: Forbidden: can not be changed once the machine is being deleted, it was \"\""))
+	g.Expect(ValidateUpdate(nil, orphan, true, fldPath)).To(HaveLen(1))
+}
@@ -0,0 +1,225 @@
+// Package drainpolicy implements parsing and validation of the annotations
+// used to configure how the Node of a Machine is drained.
+//
+// The annotations may be set on a Machine directly, or on the template of a MachineSet,
+// in which case they are inherited by the Machines it creates.
+package drainpolicy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// DrainTimeoutAnnotation sets the maximum amount of time the drain controller will spend
+	// draining the Node of a Machine. Once the timeout has passed, the drain is abandoned and
+	// the deletion of the Machine proceeds. The value must be a positive duration, eg "30m".
+	DrainTimeoutAnnotation = "machine.openshift.io/drain-timeout"
+
+	// DrainForceAnnotation controls whether pods that are not managed by a controller
+	// are deleted during the drain. When "false", the drain fails while such pods are present.
+	DrainForceAnnotation = "machine.openshift.io/drain-force"
+
+	// DrainDeleteEmptyDirDataAnnotation controls whether pods using emptyDir volumes are
+	// evicted during the drain. When "false", the drain fails while such pods are present.
+	DrainDeleteEmptyDirDataAnnotation = "machine.openshift.io/drain-delete-emptydir-data"
+
+	// DrainGracePeriodSecondsAnnotation overrides the termination grace period of the evicted pods.
+	// A value of -1 means the grace period set on each pod is used.
+	DrainGracePeriodSecondsAnnotation = "machine.openshift.io/drain-grace-period-seconds"
+
+	// DrainEvictionTimeoutAnnotation sets how long a single drain attempt waits for the pods to be
+	// evicted before the drain is retried. The value must be a positive duration, eg "1m".
+	DrainEvictionTimeoutAnnotation = "machine.openshift.io/drain-eviction-timeout"
+
+	// DrainSkipPodSelectorAnnotation is a label selector, eg "app=database", for the pods that
+	// should be left on the Node during the drain.
+	DrainSkipPodSelectorAnnotation = "machine.openshift.io/drain-skip-pod-selector"
+
+	// VolumeDetachTimeoutAnnotation sets the maximum amount of time the machine controller will wait, once
+	// the Node has been drained, for the volumes to be detached from the Node before the instance is deleted.
+	// Once the timeout has passed, the deletion of the Machine proceeds. The value must be a positive duration, eg "10m".
+	VolumeDetachTimeoutAnnotation = "machine.openshift.io/volume-detach-timeout"
+
+	// DrainBudgetAnnotation limits how many Machines may drain their Nodes at the same time, eg "2".
+	// By default the budget covers the Machines owned by the same MachineSet as the Machine.
+	DrainBudgetAnnotation = "machine.openshift.io/drain-budget"
+
+	// DrainBudgetSelectorAnnotation is a label selector, eg "machine.openshift.io/pool=storage", for the Machines
+	// covered by the drain budget, instead of those owned by the same MachineSet. It requires DrainBudgetAnnotation to be set.
+	DrainBudgetSelectorAnnotation = "machine.openshift.io/drain-budget-selector"
+
+	// DrainTimeoutExceededReason is the reason set on the Drained condition of a Machine when the drain
+	// was abandoned because it did not complete within the drain timeout.
+	DrainTimeoutExceededReason = "DrainTimeoutExceeded"
+
+	// DefaultGracePeriodSeconds is the grace period used when none is set, it defers to the pods' own grace period.
+	DefaultGracePeriodSeconds = -1
+
+	// DefaultEvictionTimeout is the eviction timeout used when none is set.
+	// If a pod is not evicted within this time, the eviction is retried the next time the
+	// machine gets reconciled again (to allow other machines to be reconciled).
+	DefaultEvictionTimeout = 20 * time.Second
+)
+
+// Policy describes how the Node of a Machine should be drained.
+type Policy struct {
+	// Timeout is the maximum amount of time to spend draining the Node.
+	// A zero Timeout means the drain is retried until it succeeds.
+	Timeout time.Duration
+
+	// Force allows pods that are not managed by a controller to be deleted.
+	Force bool
+
+	// DeleteEmptyDirData allows pods using emptyDir volumes to be evicted.
+	DeleteEmptyDirData bool
+
+	// GracePeriodSeconds is the termination grace period given to the evicted pods.
+	GracePeriodSeconds int
+
+	// EvictionTimeout is how long a single drain attempt waits for the pods to be evicted.
+	EvictionTimeout time.Duration
+
+	// SkipPodSelector selects the pods that should not be evicted. It is nil when no pods are skipped.
+	SkipPodSelector labels.Selector
+
+	// VolumeDetachTimeout is the maximum amount of time to wait for the volumes to be detached from the Node.
+	// A zero VolumeDetachTimeout means the deletion waits until the volumes are detached.
+	VolumeDetachTimeout time.Duration
+
+	// MaxConcurrentDrains is the maximum number of Machines covered by the drain budget that may drain at the same time.
+	// A zero MaxConcurrentDrains means there is no drain budget.
+	MaxConcurrentDrains int
+
+	// DrainBudgetSelector selects the Machines covered by the drain budget.
+	// It is nil when the drain budget covers the Machines owned by the same MachineSet.
+	DrainBudgetSelector labels.Selector
+}
+
+// DefaultPolicy returns the drain Policy used when no annotations are set.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Force:              true,
+		DeleteEmptyDirData: true,
+		GracePeriodSeconds: DefaultGracePeriodSeconds,
+		EvictionTimeout:    DefaultEvictionTimeout,
+	}
+}
+
+// Parse builds the drain Policy described by the given annotations.
+func Parse(annotations map[string]string, fldPath *field.Path) (*Policy, field.ErrorList) {
+	var errs field.ErrorList
+	policy := DefaultPolicy()
+
+	if value, ok := annotations[DrainTimeoutAnnotation]; ok {
+		timeout, err := parsePositiveDuration(value, fldPath.Key(DrainTimeoutAnnotation))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		policy.Timeout = timeout
+	}
+
+	if value, ok := annotations[DrainForceAnnotation]; ok {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(DrainForceAnnotation), value, "must be either \"true\" or \"false\""))
+		} else {
+			policy.Force = force
+		}
+	}
+
+	if value, ok := annotations[DrainDeleteEmptyDirDataAnnotation]; ok {
+		deleteEmptyDirData, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(DrainDeleteEmptyDirDataAnnotation), value, "must be either \"true\" or \"false\""))
+		} else {
+			policy.DeleteEmptyDirData = deleteEmptyDirData
+		}
+	}
+
+	if value, ok := annotations[DrainGracePeriodSecondsAnnotation]; ok {
+		gracePeriodSeconds, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainGracePeriodSecondsAnnotation), value, "must be an integer"))
+		case gracePeriodSeconds < -1:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainGracePeriodSecondsAnnotation), value, "must be greater than or equal to -1"))
+		default:
+			policy.GracePeriodSeconds = gracePeriodSeconds
+		}
+	}
+
+	if value, ok := annotations[DrainEvictionTimeoutAnnotation]; ok {
+		evictionTimeout, err := parsePositiveDuration(value, fldPath.Key(DrainEvictionTimeoutAnnotation))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			policy.EvictionTimeout = evictionTimeout
+		}
+	}
+
+	if value, ok := annotations[DrainSkipPodSelectorAnnotation]; ok {
+		selector, err := labels.Parse(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainSkipPodSelectorAnnotation), value, fmt.Sprintf("must be a valid label selector: %v", err)))
+		case selector.Empty():
+			errs = append(errs, field.Invalid(fldPath.Key(DrainSkipPodSelectorAnnotation), value, "must not be empty, as it would skip every pod"))
+		default:
+			policy.SkipPodSelector = selector
+		}
+	}
+
+	if value, ok := annotations[VolumeDetachTimeoutAnnotation]; ok {
+		volumeDetachTimeout, err := parsePositiveDuration(value, fldPath.Key(VolumeDetachTimeoutAnnotation))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		policy.VolumeDetachTimeout = volumeDetachTimeout
+	}
+
+	if value, ok := annotations[DrainBudgetAnnotation]; ok {
+		maxConcurrentDrains, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainBudgetAnnotation), value, "must be an integer"))
+		case maxConcurrentDrains < 1:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainBudgetAnnotation), value, "must be greater than zero"))
+		default:
+			policy.MaxConcurrentDrains = maxConcurrentDrains
+		}
+	}
+
+	if value, ok := annotations[DrainBudgetSelectorAnnotation]; ok {
+		selector, err := labels.Parse(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(DrainBudgetSelectorAnnotation), value, fmt.Sprintf("must be a valid label selector: %v", err)))
+		case selector.Empty():
+			errs = append(errs, field.Invalid(fldPath.Key(DrainBudgetSelectorAnnotation), value, "must not be empty"))
+		default:
+			policy.DrainBudgetSelector = selector
+		}
+
+		if _, ok := annotations[DrainBudgetAnnotation]; !ok {
+			errs = append(errs, field.Required(fldPath.Key(DrainBudgetAnnotation), fmt.Sprintf("must be set when %s is set", DrainBudgetSelectorAnnotation)))
+		}
+	}
+
+	return policy, errs
+}
+
+func parsePositiveDuration(value string, fldPath *field.Path) (time.Duration, *field.Error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, field.Invalid(fldPath, value, fmt.Sprintf("must be a valid duration, eg \"30m\": %v", err))
+	}
+	if duration <= 0 {
+		return 0, field.Invalid(fldPath, value, "must be greater than zero")
+	}
+	return duration, nil
+}
@@ -0,0 +1,124 @@
+package drainpolicy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedPolicy func() *Policy
+		expectedErrors []string
+	}{
+		{
+			name:           "with no annotations",
+			expectedPolicy: DefaultPolicy,
+		},
+		{
+			name: "with every annotation set",
+			annotations: map[string]string{
+				DrainTimeoutAnnotation:            "1h",
+				DrainForceAnnotation:              "false",
+				DrainDeleteEmptyDirDataAnnotation: "false",
+				DrainGracePeriodSecondsAnnotation: "120",
+				DrainEvictionTimeoutAnnotation:    "1m",
+				VolumeDetachTimeoutAnnotation:     "10m",
+				DrainBudgetAnnotation:             "2",
+			},
+			expectedPolicy: func() *Policy {
+				return &Policy{
+					Timeout:             time.Hour,
+					Force:               false,
+					DeleteEmptyDirData:  false,
+					GracePeriodSeconds:  120,
+					EvictionTimeout:     time.Minute,
+					VolumeDetachTimeout: 10 * time.Minute,
+					MaxConcurrentDrains: 2,
+				}
+			},
+		},
+		{
+			name: "with invalid annotations",
+			annotations: map[string]string{
+				DrainTimeoutAnnotation:            "0s",
+				DrainForceAnnotation:              "sometimes",
+				DrainDeleteEmptyDirDataAnnotation: "maybe",
+				DrainGracePeriodSecondsAnnotation: "-2",
+				DrainEvictionTimeoutAnnotation:    "soon",
+				DrainSkipPodSelectorAnnotation:    "app in (",
+				VolumeDetachTimeoutAnnotation:     "-1m",
+				DrainBudgetAnnotation:             "0",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/drain-timeout]: Invalid value: \"0s\": must be greater than zero",
+				"metadata.annotations[machine.openshift.io/drain-force]: Invalid value: \"sometimes\": must be either \"true\" or \"false\"",
+				"metadata.annotations[machine.openshift.io/drain-delete-emptydir-data]: Invalid value: \"maybe\": must be either \"true\" or \"false\"",
+				"metadata.annotations[machine.openshift.io/drain-grace-period-seconds]: Invalid value: \"-2\": must be greater than or equal to -1",
+				"metadata.annotations[machine.openshift.io/drain-eviction-timeout]: Invalid value: \"soon\": must be a valid duration, eg \"30m\": time: invalid duration \"soon\"",
+				"metadata.annotations[machine.openshift.io/volume-detach-timeout]: Invalid value: \"-1m\": must be greater than zero",
+				"metadata.annotations[machine.openshift.io/drain-budget]: Invalid value: \"0\": must be greater than zero",
+			},
+		},
+		{
+			name: "with an empty skip pod selector",
+			annotations: map[string]string{
+				DrainSkipPodSelectorAnnotation: "",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/drain-skip-pod-selector]: Invalid value: \"\": must not be empty, as it would skip every pod",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			policy, errs := Parse(tc.annotations, field.NewPath("metadata", "annotations"))
+			if len(tc.expectedErrors) > 0 {
+				var errStrings []string
+				for _, err := range errs {
+					errStrings = append(errStrings, err.Error())
+				}
+				for _, expected := range tc.expectedErrors {
+					g.Expect(errStrings).To(ContainElement(expected))
+				}
+				return
+			}
+
+			g.Expect(errs).To(BeEmpty())
+			g.Expect(policy).To(Equal(tc.expectedPolicy()))
+		})
+	}
+
+	t.Run("with a drain budget selector but no drain budget", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, errs := Parse(map[string]string{DrainBudgetSelectorAnnotation: "pool=storage"}, field.NewPath("metadata", "annotations"))
+		g.Expect(errs.ToAggregate()).To(MatchError("metadata.annotations[machine.openshift.io/drain-budget]: Required value: must be set when machine.openshift.io/drain-budget-selector is set"))
+	})
+
+	t.Run("with a drain budget selector", func(t *testing.T) {
+		g := NewWithT(t)
+
+		policy, errs := Parse(map[string]string{DrainBudgetAnnotation: "2", DrainBudgetSelectorAnnotation: "pool=storage"}, field.NewPath("metadata", "annotations"))
+		g.Expect(errs).To(BeEmpty())
+		g.Expect(policy.MaxConcurrentDrains).To(Equal(2))
+		g.Expect(policy.DrainBudgetSelector).ToNot(BeNil())
+		g.Expect(policy.DrainBudgetSelector.String()).To(Equal("pool=storage"))
+	})
+
+	t.Run("with a skip pod selector", func(t *testing.T) {
+		g := NewWithT(t)
+
+		policy, errs := Parse(map[string]string{DrainSkipPodSelectorAnnotation: "app=database"}, field.NewPath("metadata", "annotations"))
+		g.Expect(errs).To(BeEmpty())
+		g.Expect(policy.SkipPodSelector).ToNot(BeNil())
+		g.Expect(policy.SkipPodSelector.String()).To(Equal("app=database"))
+	})
+}
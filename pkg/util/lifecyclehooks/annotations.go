@@ -0,0 +1,71 @@
+package lifecyclehooks
+
+import (
+	"sort"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// PreCreateHookAnnotationPrefix is the prefix of the annotations which hold the creation of the instance of a Machine.
+	// Each hook is an annotation "pre-create.hook.machine.openshift.io/<hook name>" whose value is the owner of the hook,
+	// eg "pre-create.hook.machine.openshift.io/ipam-reservation: ipam-controller".
+	// The instance is not created until all of the hooks have been removed by their owners.
+	PreCreateHookAnnotationPrefix = "pre-create.hook.machine.openshift.io"
+
+	// PostProvisionHookAnnotationPrefix is the prefix of the annotations which keep a provisioned Machine out of the Running phase,
+	// in the same format as the pre-create hooks.
+	// The Machine does not become Running until all of the hooks have been removed by their owners.
+	PostProvisionHookAnnotationPrefix = "post-provision.hook.machine.openshift.io"
+)
+
+const (
+	// PreCreate hooks hold the creation of the instance of a Machine.
+	PreCreate Stage = "pre-create"
+
+	// PostProvision hooks hold a provisioned Machine before it becomes Running.
+	PostProvision Stage = "post-provision"
+)
+
+// GetAnnotationHooks returns the lifecycle hooks set through the annotations with the given prefix, sorted by name.
+func GetAnnotationHooks(annotations map[string]string, prefix string) []machinev1.LifecycleHook {
+	hooks := []machinev1.LifecycleHook{}
+	for key, owner := range annotations {
+		if name, ok := hookName(key, prefix); ok {
+			hooks = append(hooks, machinev1.LifecycleHook{Name: name, Owner: owner})
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Name < hooks[j].Name
+	})
+	return hooks
+}
+
+// ValidateAnnotationHooks checks that every pre-create and post-provision hook set in the annotations names its owner.
+func ValidateAnnotationHooks(annotations map[string]string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for key, owner := range annotations {
+		for _, prefix := range []string{PreCreateHookAnnotationPrefix, PostProvisionHookAnnotationPrefix} {
+			if _, ok := hookName(key, prefix); ok && strings.TrimSpace(owner) == "" {
+				errs = append(errs, field.Required(fldPath.Key(key), "must be set to the owner of the lifecycle hook"))
+			}
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+	return errs
+}
+
+func hookName(key, prefix string) (string, bool) {
+	name := strings.TrimPrefix(key, prefix+"/")
+	if name == key || name == "" {
+		return "", false
+	}
+	return name, true
+}
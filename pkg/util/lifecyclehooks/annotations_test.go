@@ -0,0 +1,45 @@
+package lifecyclehooks
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestGetAnnotationHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	annotations := map[string]string{
+		PreCreateHookAnnotationPrefix + "/license-checkout": "license-controller",
+		PreCreateHookAnnotationPrefix + "/ipam-reservation": "ipam-controller",
+		PostProvisionHookAnnotationPrefix + "/hardening":    "hardening-controller",
+		PreCreateHookAnnotationPrefix:                       "not-a-hook",
+		PreCreateHookAnnotationPrefix + "/":                 "not-a-hook",
+		"machine.openshift.io/drain-timeout":                "10m",
+	}
+
+	g.Expect(GetAnnotationHooks(annotations, PreCreateHookAnnotationPrefix)).To(Equal([]machinev1.LifecycleHook{
+		{Name: "ipam-reservation", Owner: "ipam-controller"},
+		{Name: "license-checkout", Owner: "license-controller"},
+	}))
+	g.Expect(GetAnnotationHooks(annotations, PostProvisionHookAnnotationPrefix)).To(Equal([]machinev1.LifecycleHook{
+		{Name: "hardening", Owner: "hardening-controller"},
+	}))
+	g.Expect(GetAnnotationHooks(nil, PostProvisionHookAnnotationPrefix)).To(BeEmpty())
+}
+
+func TestValidateAnnotationHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	errs := ValidateAnnotationHooks(map[string]string{
+		PreCreateHookAnnotationPrefix + "/ipam-reservation": "ipam-controller",
+		PreCreateHookAnnotationPrefix + "/license-checkout": "",
+		PostProvisionHookAnnotationPrefix + "/hardening":    " ",
+	}, field.NewPath("metadata", "annotations"))
+
+	g.Expect(errs.ToAggregate()).To(MatchError("[" +
+		"metadata.annotations[post-provision.hook.machine.openshift.io/hardening]: Required value: must be set to the owner of the lifecycle hook, " +
+		"metadata.annotations[pre-create.hook.machine.openshift.io/license-checkout]: Required value: must be set to the owner of the lifecycle hook]"))
+}
@@ -0,0 +1,179 @@
+package lifecyclehooks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+const (
+	// PreDrainHookTimeoutsAnnotation sets how long each pre-drain hook may hold the deletion of a Machine,
+	// as a comma separated list of hook names and durations, eg "MigrateData=30m,example.com/Backup=1h".
+	PreDrainHookTimeoutsAnnotation = "machine.openshift.io/pre-drain-hook-timeouts"
+
+	// PreTerminateHookTimeoutsAnnotation sets how long each pre-terminate hook may hold the deletion of a Machine,
+	// in the same format as PreDrainHookTimeoutsAnnotation.
+	PreTerminateHookTimeoutsAnnotation = "machine.openshift.io/pre-terminate-hook-timeouts"
+
+	// HookTimeoutPolicyAnnotation sets what happens to a lifecycle hook once its timeout has expired,
+	// either "Remove" (the default) or "Fail".
+	HookTimeoutPolicyAnnotation = "machine.openshift.io/lifecycle-hook-timeout-policy"
+)
+
+// Stage is the stage of the lifecycle of a Machine that a lifecycle hook holds.
+type Stage string
+
+const (
+	// PreDrain hooks hold the deletion before the Node is drained.
+	PreDrain Stage = "pre-drain"
+
+	// PreTerminate hooks hold the deletion before the instance is terminated.
+	PreTerminate Stage = "pre-terminate"
+)
+
+// TimeoutPolicy is what happens to a lifecycle hook once its timeout has expired.
+type TimeoutPolicy string
+
+const (
+	// TimeoutPolicyRemove removes the expired hook, so that the deletion of the Machine proceeds.
+	TimeoutPolicyRemove TimeoutPolicy = "Remove"
+
+	// TimeoutPolicyFail leaves the expired hook in place and reports it as failed.
+	// The deletion of the Machine stays held until the hook is removed.
+	TimeoutPolicyFail TimeoutPolicy = "Fail"
+)
+
+// Timeouts holds the lifecycle hook timeouts configured on a Machine.
+type Timeouts struct {
+	// PreDrain maps the names of the pre-drain hooks to their timeouts.
+	PreDrain map[string]time.Duration
+
+	// PreTerminate maps the names of the pre-terminate hooks to their timeouts.
+	PreTerminate map[string]time.Duration
+
+	// Policy is what happens to a hook once its timeout has expired.
+	Policy TimeoutPolicy
+}
+
+// For returns the timeouts of the hooks of the given stage.
+func (t *Timeouts) For(stage Stage) map[string]time.Duration {
+	if stage == PreDrain {
+		return t.PreDrain
+	}
+	return t.PreTerminate
+}
+
+// ParseTimeouts builds the lifecycle hook Timeouts described by the given annotations.
+// Timeouts may be set for hooks which are not present, they are ignored.
+func ParseTimeouts(annotations map[string]string, fldPath *field.Path) (*Timeouts, field.ErrorList) {
+	var errs field.ErrorList
+	timeouts := &Timeouts{
+		PreDrain:     map[string]time.Duration{},
+		PreTerminate: map[string]time.Duration{},
+		Policy:       TimeoutPolicyRemove,
+	}
+
+	if value, ok := annotations[PreDrainHookTimeoutsAnnotation]; ok {
+		preDrain, parseErrs := parseHookTimeouts(value, fldPath.Key(PreDrainHookTimeoutsAnnotation))
+		errs = append(errs, parseErrs...)
+		timeouts.PreDrain = preDrain
+	}
+
+	if value, ok := annotations[PreTerminateHookTimeoutsAnnotation]; ok {
+		preTerminate, parseErrs := parseHookTimeouts(value, fldPath.Key(PreTerminateHookTimeoutsAnnotation))
+		errs = append(errs, parseErrs...)
+		timeouts.PreTerminate = preTerminate
+	}
+
+	if value, ok := annotations[HookTimeoutPolicyAnnotation]; ok {
+		switch policy := TimeoutPolicy(value); policy {
+		case TimeoutPolicyRemove, TimeoutPolicyFail:
+			timeouts.Policy = policy
+		default:
+			errs = append(errs, field.NotSupported(fldPath.Key(HookTimeoutPolicyAnnotation), value, []string{string(TimeoutPolicyRemove), string(TimeoutPolicyFail)}))
+		}
+	}
+
+	return timeouts, errs
+}
+
+func parseHookTimeouts(value string, fldPath *field.Path) (map[string]time.Duration, field.ErrorList) {
+	var errs field.ErrorList
+	timeouts := map[string]time.Duration{}
+
+	for _, entry := range strings.Split(value, ",") {
+		name, durationValue, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || name == "" {
+			errs = append(errs, field.Invalid(fldPath, value, fmt.Sprintf("%q must be in the form <hook name>=<duration>, eg \"MigrateData=30m\"", entry)))
+			continue
+		}
+
+		if _, exists := timeouts[name]; exists {
+			errs = append(errs, field.Invalid(fldPath, value, fmt.Sprintf("timeout for hook %q must only be set once", name)))
+			continue
+		}
+
+		timeout, err := time.ParseDuration(durationValue)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath, value, fmt.Sprintf("timeout for hook %q must be a valid duration, eg \"30m\": %v", name, err)))
+		case timeout <= 0:
+			errs = append(errs, field.Invalid(fldPath, value, fmt.Sprintf("timeout for hook %q must be greater than zero", name)))
+		default:
+			timeouts[name] = timeout
+		}
+	}
+
+	return timeouts, errs
+}
+
+// HeldSince returns the time since when the lifecycle hooks of the given stage have been holding the deletion of the Machine.
+// Pre-drain hooks hold the Machine from the moment it is deleted, pre-terminate hooks from the moment the drain finished.
+// It returns false when the hooks of the stage are not holding the Machine.
+func HeldSince(m *machinev1.Machine, stage Stage) (time.Time, bool) {
+	if m.DeletionTimestamp.IsZero() {
+		return time.Time{}, false
+	}
+
+	switch stage {
+	case PreDrain:
+		if len(m.Spec.LifecycleHooks.PreDrain) == 0 {
+			return time.Time{}, false
+		}
+		return m.DeletionTimestamp.Time, true
+	case PreTerminate:
+		if len(m.Spec.LifecycleHooks.PreTerminate) == 0 {
+			return time.Time{}, false
+		}
+		drained := conditions.Get(m, machinev1.MachineDrained)
+		if drained == nil || drained.LastTransitionTime.IsZero() {
+			return time.Time{}, false
+		}
+		if drained.Status != corev1.ConditionTrue && drained.Reason != drainpolicy.DrainTimeoutExceededReason {
+			return time.Time{}, false
+		}
+		return drained.LastTransitionTime.Time, true
+	}
+
+	return time.Time{}, false
+}
+
+// Hooks returns the lifecycle hooks of the Machine for the given stage.
+func Hooks(m *machinev1.Machine, stage Stage) []machinev1.LifecycleHook {
+	switch stage {
+	case PreCreate:
+		return GetAnnotationHooks(m.GetAnnotations(), PreCreateHookAnnotationPrefix)
+	case PostProvision:
+		return GetAnnotationHooks(m.GetAnnotations(), PostProvisionHookAnnotationPrefix)
+	case PreDrain:
+		return m.Spec.LifecycleHooks.PreDrain
+	}
+	return m.Spec.LifecycleHooks.PreTerminate
+}
@@ -0,0 +1,188 @@
+package lifecyclehooks
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	testCases := []struct {
+		name             string
+		annotations      map[string]string
+		expectedTimeouts *Timeouts
+		expectedErrors   []string
+	}{
+		{
+			name: "with no annotations",
+			expectedTimeouts: &Timeouts{
+				PreDrain:     map[string]time.Duration{},
+				PreTerminate: map[string]time.Duration{},
+				Policy:       TimeoutPolicyRemove,
+			},
+		},
+		{
+			name: "with every annotation set",
+			annotations: map[string]string{
+				PreDrainHookTimeoutsAnnotation:     "MigrateData=30m, example.com/Backup=1h",
+				PreTerminateHookTimeoutsAnnotation: "Detach=5m",
+				HookTimeoutPolicyAnnotation:        "Fail",
+			},
+			expectedTimeouts: &Timeouts{
+				PreDrain: map[string]time.Duration{
+					"MigrateData":        30 * time.Minute,
+					"example.com/Backup": time.Hour,
+				},
+				PreTerminate: map[string]time.Duration{
+					"Detach": 5 * time.Minute,
+				},
+				Policy: TimeoutPolicyFail,
+			},
+		},
+		{
+			name: "with invalid annotations",
+			annotations: map[string]string{
+				PreDrainHookTimeoutsAnnotation:     "MigrateData,=5m,Backup=soon,Backup=1h",
+				PreTerminateHookTimeoutsAnnotation: "Detach=0s,Detach=5m",
+				HookTimeoutPolicyAnnotation:        "Ignore",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/pre-drain-hook-timeouts]: Invalid value: \"MigrateData,=5m,Backup=soon,Backup=1h\": \"MigrateData\" must be in the form <hook name>=<duration>, eg \"MigrateData=30m\"",
+				"metadata.annotations[machine.openshift.io/pre-drain-hook-timeouts]: Invalid value: \"MigrateData,=5m,Backup=soon,Backup=1h\": \"=5m\" must be in the form <hook name>=<duration>, eg \"MigrateData=30m\"",
+				"metadata.annotations[machine.openshift.io/pre-drain-hook-timeouts]: Invalid value: \"MigrateData,=5m,Backup=soon,Backup=1h\": timeout for hook \"Backup\" must be a valid duration, eg \"30m\": time: invalid duration \"soon\"",
+				"metadata.annotations[machine.openshift.io/pre-terminate-hook-timeouts]: Invalid value: \"Detach=0s,Detach=5m\": timeout for hook \"Detach\" must be greater than zero",
+				"metadata.annotations[machine.openshift.io/lifecycle-hook-timeout-policy]: Unsupported value: \"Ignore\": supported values: \"Remove\", \"Fail\"",
+			},
+		},
+		{
+			name: "with a hook timeout set twice",
+			annotations: map[string]string{
+				PreTerminateHookTimeoutsAnnotation: "Detach=5m,Detach=10m",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/pre-terminate-hook-timeouts]: Invalid value: \"Detach=5m,Detach=10m\": timeout for hook \"Detach\" must only be set once",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			timeouts, errs := ParseTimeouts(tc.annotations, field.NewPath("metadata", "annotations"))
+			if len(tc.expectedErrors) > 0 {
+				var errStrings []string
+				for _, err := range errs {
+					errStrings = append(errStrings, err.Error())
+				}
+				for _, expected := range tc.expectedErrors {
+					g.Expect(errStrings).To(ContainElement(expected))
+				}
+				return
+			}
+
+			g.Expect(errs).To(BeEmpty())
+			g.Expect(timeouts).To(Equal(tc.expectedTimeouts))
+		})
+	}
+}
+
+func TestHeldSince(t *testing.T) {
+	deletionTime := metav1.NewTime(time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC))
+	drainTime := metav1.NewTime(deletionTime.Add(10 * time.Minute))
+
+	hook := machinev1.LifecycleHook{Name: "Hook", Owner: "owner"}
+	drained := func(status corev1.ConditionStatus, reason string) machinev1.Condition {
+		return machinev1.Condition{
+			Type:               machinev1.MachineDrained,
+			Status:             status,
+			Reason:             reason,
+			LastTransitionTime: drainTime,
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		deleted       bool
+		hooks         machinev1.LifecycleHooks
+		conditions    machinev1.Conditions
+		stage         Stage
+		expectedHeld  bool
+		expectedSince time.Time
+	}{
+		{
+			name:  "with a pre-drain hook on a machine which is not deleted",
+			hooks: machinev1.LifecycleHooks{PreDrain: []machinev1.LifecycleHook{hook}},
+			stage: PreDrain,
+		},
+		{
+			name:    "with no pre-drain hooks",
+			deleted: true,
+			stage:   PreDrain,
+		},
+		{
+			name:          "with a pre-drain hook",
+			deleted:       true,
+			hooks:         machinev1.LifecycleHooks{PreDrain: []machinev1.LifecycleHook{hook}},
+			stage:         PreDrain,
+			expectedHeld:  true,
+			expectedSince: deletionTime.Time,
+		},
+		{
+			name:    "with a pre-terminate hook before the drain finished",
+			deleted: true,
+			hooks:   machinev1.LifecycleHooks{PreTerminate: []machinev1.LifecycleHook{hook}},
+			stage:   PreTerminate,
+		},
+		{
+			name:       "with a pre-terminate hook while the drain is failing",
+			deleted:    true,
+			hooks:      machinev1.LifecycleHooks{PreTerminate: []machinev1.LifecycleHook{hook}},
+			conditions: machinev1.Conditions{drained(corev1.ConditionFalse, "DrainError")},
+			stage:      PreTerminate,
+		},
+		{
+			name:          "with a pre-terminate hook once the drain finished",
+			deleted:       true,
+			hooks:         machinev1.LifecycleHooks{PreTerminate: []machinev1.LifecycleHook{hook}},
+			conditions:    machinev1.Conditions{drained(corev1.ConditionTrue, "")},
+			stage:         PreTerminate,
+			expectedHeld:  true,
+			expectedSince: drainTime.Time,
+		},
+		{
+			name:          "with a pre-terminate hook once the drain timed out",
+			deleted:       true,
+			hooks:         machinev1.LifecycleHooks{PreTerminate: []machinev1.LifecycleHook{hook}},
+			conditions:    machinev1.Conditions{drained(corev1.ConditionFalse, drainpolicy.DrainTimeoutExceededReason)},
+			stage:         PreTerminate,
+			expectedHeld:  true,
+			expectedSince: drainTime.Time,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := &machinev1.Machine{
+				Spec:   machinev1.MachineSpec{LifecycleHooks: tc.hooks},
+				Status: machinev1.MachineStatus{Conditions: tc.conditions},
+			}
+			if tc.deleted {
+				m.DeletionTimestamp = &deletionTime
+			}
+
+			since, held := HeldSince(m, tc.stage)
+			g.Expect(held).To(Equal(tc.expectedHeld))
+			g.Expect(since).To(Equal(tc.expectedSince))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package machines
+
+import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+)
+
+// AdoptInstanceAnnotation marks a Machine created to bring an existing instance under the management of the Machine API.
+// The instance is identified by the provider ID set in the spec of the Machine, and is never created by the machine controller.
+// The annotation can only be set when the Machine is created.
+const AdoptInstanceAnnotation = "machine.openshift.io/adopt-instance"
+
+// IsAdoptingInstance returns true if the Machine was created to adopt an existing instance.
+func IsAdoptingInstance(machine *machinev1.Machine) bool {
+	_, ok := machine.GetAnnotations()[AdoptInstanceAnnotation]
+	return ok
+}
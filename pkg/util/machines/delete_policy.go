@@ -0,0 +1,45 @@
+package machines
+
+import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DeletePolicyAnnotation selects the delete policy of a MachineSet among the policies which need more than the Machines
+// themselves to choose which Machines to delete, eg "ZoneBalanced". It takes precedence over spec.deletePolicy.
+const DeletePolicyAnnotation = "machine.openshift.io/delete-policy"
+
+const (
+	// LeastUtilizedDeletePolicy prefers deleting the Machines whose Nodes run the fewest pods,
+	// not counting DaemonSet and static pods.
+	LeastUtilizedDeletePolicy machinev1.MachineSetDeletePolicy = "LeastUtilized"
+
+	// UnhealthyFirstDeletePolicy prefers deleting the Machines whose Node is not Ready,
+	// or which a MachineHealthCheck has flagged for external remediation.
+	UnhealthyFirstDeletePolicy machinev1.MachineSetDeletePolicy = "UnhealthyFirst"
+
+	// ZoneBalancedDeletePolicy deletes Machines from the zones with the most Machines first,
+	// so that the remaining Machines stay evenly spread across zones.
+	ZoneBalancedDeletePolicy machinev1.MachineSetDeletePolicy = "ZoneBalanced"
+)
+
+// annotationDeletePolicies are the delete policies which may be set through the DeletePolicyAnnotation.
+var annotationDeletePolicies = []string{
+	string(LeastUtilizedDeletePolicy),
+	string(UnhealthyFirstDeletePolicy),
+	string(ZoneBalancedDeletePolicy),
+}
+
+// ValidateDeletePolicyAnnotation validates the delete policy set through the DeletePolicyAnnotation, if any.
+func ValidateDeletePolicyAnnotation(annotations map[string]string, fldPath *field.Path) field.ErrorList {
+	value, ok := annotations[DeletePolicyAnnotation]
+	if !ok {
+		return nil
+	}
+	for _, policy := range annotationDeletePolicies {
+		if value == policy {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath.Key(DeletePolicyAnnotation), value, annotationDeletePolicies)}
+}
@@ -0,0 +1,17 @@
+package machines
+
+import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+)
+
+// MaintenanceAnnotation requests that the Node of a Machine is taken out of service, for example for hardware
+// or hypervisor work, without deleting the Machine. The value may describe the reason for the maintenance.
+// While the annotation is set, the Node is cordoned and drained, and the Machine is not remediated.
+// The Node is uncordoned once the annotation is removed.
+const MaintenanceAnnotation = "machine.openshift.io/maintenance"
+
+// IsInMaintenance returns true if maintenance has been requested for the Machine.
+func IsInMaintenance(machine *machinev1.Machine) bool {
+	_, ok := machine.GetAnnotations()[MaintenanceAnnotation]
+	return ok
+}
@@ -0,0 +1,74 @@
+package machines
+
+import (
+	"encoding/json"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+)
+
+const (
+	// ReplaceAnnotation requests the surge replacement of a Machine owned by a MachineSet. The value may describe the
+	// reason for the replacement. The MachineSet first creates a replacement Machine and only deletes the annotated
+	// Machine once the Node of its replacement is Ready.
+	ReplaceAnnotation = "machine.openshift.io/replace"
+
+	// ReplacedByAnnotation is set by the MachineSet controller on a Machine being replaced, to the name of its replacement.
+	ReplacedByAnnotation = "machine.openshift.io/replaced-by"
+
+	// ReplacementForAnnotation is set by the MachineSet controller on a replacement Machine, to the name of the Machine
+	// it replaces. It is removed once the replaced Machine is gone.
+	ReplacementForAnnotation = "machine.openshift.io/replacement-for"
+
+	// ReplacementFailedAnnotation is set by the MachineSet controller on a Machine whose replacement failed, to the
+	// reason of the failure. The failed replacement is deleted and the Machine is kept. No other replacement is created
+	// until the annotation is removed, which retries the replacement.
+	ReplacementFailedAnnotation = "machine.openshift.io/replacement-failed"
+
+	// ReplacementStatusAnnotation holds the ReplacementStatus of a MachineSet, serialised as JSON.
+	// It is maintained by the MachineSet controller and removed once no Machine of the MachineSet requests a replacement.
+	ReplacementStatusAnnotation = "machine.openshift.io/replacement-status"
+)
+
+// ReplacementStatus reports the replacements of the Machines of a MachineSet.
+type ReplacementStatus struct {
+	// Replacements lists the Machines which requested a replacement, sorted by name.
+	Replacements []Replacement `json:"replacements"`
+}
+
+// Replacement reports the replacement of a Machine.
+type Replacement struct {
+	// Machine is the name of the Machine being replaced.
+	Machine string `json:"machine"`
+
+	// Replacement is the name of the Machine replacing it, empty until the replacement is created.
+	Replacement string `json:"replacement,omitempty"`
+
+	// Failure is the reason why the replacement failed, empty unless it did.
+	Failure string `json:"failure,omitempty"`
+}
+
+// IsReplaceRequested returns true if the replacement of the Machine has been requested.
+func IsReplaceRequested(machine *machinev1.Machine) bool {
+	_, ok := machine.GetAnnotations()[ReplaceAnnotation]
+	return ok
+}
+
+// IsReplacementFailed returns true if the replacement of the Machine failed and has not been retried yet.
+func IsReplacementFailed(machine *machinev1.Machine) bool {
+	_, ok := machine.GetAnnotations()[ReplacementFailedAnnotation]
+	return ok
+}
+
+// GetReplacementStatus returns the ReplacementStatus recorded on the MachineSet, if any.
+func GetReplacementStatus(ms *machinev1.MachineSet) (*ReplacementStatus, bool) {
+	value, ok := ms.GetAnnotations()[ReplacementStatusAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	status := &ReplacementStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, false
+	}
+	return status, true
+}
@@ -0,0 +1,42 @@
+package machines
+
+import (
+	"encoding/json"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+)
+
+// TemplateStatusAnnotation holds the TemplateStatus of a MachineSet, serialised as JSON.
+// It is maintained by the MachineSet controller and should not be set by users.
+const TemplateStatusAnnotation = "machine.openshift.io/template-status"
+
+// TemplateStatus reports how many of the Machines of a MachineSet were created from its current template.
+// A Machine is compared to the template through the template hash label set on it when it is created,
+// so Machines created before this label was introduced, or adopted by the MachineSet, are reported as unknown.
+type TemplateStatus struct {
+	// UpdatedReplicas is the number of Machines created from the current template of the MachineSet.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+
+	// OutdatedReplicas is the number of Machines created from a previous template of the MachineSet.
+	OutdatedReplicas int32 `json:"outdatedReplicas"`
+
+	// OutdatedMachines lists the names of the outdated Machines, sorted.
+	OutdatedMachines []string `json:"outdatedMachines,omitempty"`
+
+	// UnknownReplicas is the number of Machines without a template hash label, whose template is unknown.
+	UnknownReplicas int32 `json:"unknownReplicas,omitempty"`
+}
+
+// GetTemplateStatus returns the TemplateStatus recorded on the MachineSet, if any.
+func GetTemplateStatus(ms *machinev1.MachineSet) (*TemplateStatus, bool) {
+	value, ok := ms.GetAnnotations()[TemplateStatusAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	status := &TemplateStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, false
+	}
+	return status, true
+}
@@ -49,7 +49,3 @@ func Retry(fn wait.ConditionFunc, initialBackoffSec int) error {
 func Poll(interval, timeout time.Duration, condition wait.ConditionFunc) error {
 	return wait.Poll(interval, timeout, condition)
 }
-
-func PollImmediate(interval, timeout time.Duration, condition wait.ConditionFunc) error {
-	return wait.PollImmediate(interval, timeout, condition)
-}
@@ -0,0 +1,110 @@
+// Package retrypolicy implements parsing and validation of the annotations
+// used to configure how a Machine in the Failed phase is retried.
+//
+// The annotations may be set on a Machine directly, or on the template of a MachineSet,
+// in which case they are inherited by the Machines it creates.
+package retrypolicy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// FailedRetryLimitAnnotation opts a Machine in to being retried once it has reached the Failed phase.
+	// The value is the maximum number of times the Machine is retried, eg "3".
+	FailedRetryLimitAnnotation = "machine.openshift.io/failed-retry-limit"
+
+	// FailedRetryBackoffAnnotation sets how long the machine controller waits before the first retry of a Failed Machine.
+	// The wait doubles with every attempt, up to MaxBackoff. The value must be a positive duration, eg "5m".
+	FailedRetryBackoffAnnotation = "machine.openshift.io/failed-retry-backoff"
+
+	// FailedRetryAttemptsAnnotation records how many times the machine controller has retried the Machine.
+	// It is maintained by the machine controller and should not be set by users.
+	FailedRetryAttemptsAnnotation = "machine.openshift.io/failed-retry-attempts"
+
+	// DefaultBackoff is the wait before the first retry when none is set.
+	DefaultBackoff = time.Minute
+
+	// MaxBackoff caps the wait between two retries.
+	MaxBackoff = time.Hour
+)
+
+// Policy describes how a Machine in the Failed phase is retried.
+type Policy struct {
+	// Limit is the maximum number of times the Machine is retried.
+	// A zero Limit means the Machine is never retried.
+	Limit int
+
+	// Backoff is the wait before the first retry.
+	Backoff time.Duration
+}
+
+// DefaultPolicy returns the retry Policy used when no annotations are set.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Backoff: DefaultBackoff,
+	}
+}
+
+// Parse builds the retry Policy described by the given annotations.
+func Parse(annotations map[string]string, fldPath *field.Path) (*Policy, field.ErrorList) {
+	var errs field.ErrorList
+	policy := DefaultPolicy()
+
+	if value, ok := annotations[FailedRetryLimitAnnotation]; ok {
+		limit, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(FailedRetryLimitAnnotation), value, "must be an integer"))
+		case limit < 1:
+			errs = append(errs, field.Invalid(fldPath.Key(FailedRetryLimitAnnotation), value, "must be greater than zero"))
+		default:
+			policy.Limit = limit
+		}
+	}
+
+	if value, ok := annotations[FailedRetryBackoffAnnotation]; ok {
+		backoff, err := time.ParseDuration(value)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Key(FailedRetryBackoffAnnotation), value, fmt.Sprintf("must be a valid duration, eg \"5m\": %v", err)))
+		case backoff <= 0:
+			errs = append(errs, field.Invalid(fldPath.Key(FailedRetryBackoffAnnotation), value, "must be greater than zero"))
+		default:
+			policy.Backoff = backoff
+		}
+	}
+
+	if value, ok := annotations[FailedRetryAttemptsAnnotation]; ok {
+		if attempts, err := strconv.Atoi(value); err != nil || attempts < 0 {
+			errs = append(errs, field.Invalid(fldPath.Key(FailedRetryAttemptsAnnotation), value, "must be an integer greater than or equal to zero"))
+		}
+	}
+
+	return policy, errs
+}
+
+// BackoffFor returns how long to wait before the given attempt, counting from zero.
+func (p *Policy) BackoffFor(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 0; i < attempt && backoff < MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxBackoff {
+		return MaxBackoff
+	}
+	return backoff
+}
+
+// Attempts returns how many times the Machine with the given annotations has been retried.
+func Attempts(annotations map[string]string) int {
+	attempts, err := strconv.Atoi(annotations[FailedRetryAttemptsAnnotation])
+	if err != nil || attempts < 0 {
+		return 0
+	}
+	return attempts
+}
@@ -0,0 +1,99 @@
+package retrypolicy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedPolicy func() *Policy
+		expectedErrors []string
+	}{
+		{
+			name:           "with no annotations",
+			expectedPolicy: DefaultPolicy,
+		},
+		{
+			name: "with every annotation set",
+			annotations: map[string]string{
+				FailedRetryLimitAnnotation:    "3",
+				FailedRetryBackoffAnnotation:  "5m",
+				FailedRetryAttemptsAnnotation: "1",
+			},
+			expectedPolicy: func() *Policy {
+				return &Policy{
+					Limit:   3,
+					Backoff: 5 * time.Minute,
+				}
+			},
+		},
+		{
+			name: "with invalid annotations",
+			annotations: map[string]string{
+				FailedRetryLimitAnnotation:    "0",
+				FailedRetryBackoffAnnotation:  "later",
+				FailedRetryAttemptsAnnotation: "-1",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/failed-retry-limit]: Invalid value: \"0\": must be greater than zero",
+				"metadata.annotations[machine.openshift.io/failed-retry-backoff]: Invalid value: \"later\": must be a valid duration, eg \"5m\": time: invalid duration \"later\"",
+				"metadata.annotations[machine.openshift.io/failed-retry-attempts]: Invalid value: \"-1\": must be an integer greater than or equal to zero",
+			},
+		},
+		{
+			name: "with a retry limit which is not a number",
+			annotations: map[string]string{
+				FailedRetryLimitAnnotation: "many",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/failed-retry-limit]: Invalid value: \"many\": must be an integer",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			policy, errs := Parse(tc.annotations, field.NewPath("metadata", "annotations"))
+			if len(tc.expectedErrors) > 0 {
+				var errStrings []string
+				for _, err := range errs {
+					errStrings = append(errStrings, err.Error())
+				}
+				for _, expected := range tc.expectedErrors {
+					g.Expect(errStrings).To(ContainElement(expected))
+				}
+				return
+			}
+
+			g.Expect(errs).To(BeEmpty())
+			g.Expect(policy).To(Equal(tc.expectedPolicy()))
+		})
+	}
+}
+
+func TestBackoffFor(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := &Policy{Limit: 10, Backoff: 10 * time.Minute}
+	g.Expect(policy.BackoffFor(0)).To(Equal(10 * time.Minute))
+	g.Expect(policy.BackoffFor(1)).To(Equal(20 * time.Minute))
+	g.Expect(policy.BackoffFor(2)).To(Equal(40 * time.Minute))
+	g.Expect(policy.BackoffFor(3)).To(Equal(MaxBackoff))
+	g.Expect(policy.BackoffFor(100)).To(Equal(MaxBackoff))
+}
+
+func TestAttempts(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(Attempts(nil)).To(Equal(0))
+	g.Expect(Attempts(map[string]string{FailedRetryAttemptsAnnotation: "2"})).To(Equal(2))
+	g.Expect(Attempts(map[string]string{FailedRetryAttemptsAnnotation: "invalid"})).To(Equal(0))
+}
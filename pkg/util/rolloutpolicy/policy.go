@@ -0,0 +1,167 @@
+// Package rolloutpolicy implements parsing and validation of the annotations
+// used to roll out the template of a MachineSet as a rolling update.
+//
+// A MachineSet with the rolling update strategy does not create Machines itself.
+// Instead, it owns one MachineSet per revision of its template, and shifts its replicas
+// from the MachineSets of the previous revisions to the MachineSet of the current one.
+package rolloutpolicy
+
+import (
+	"fmt"
+	"strconv"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// StrategyAnnotation opts a MachineSet in to rolling out its template across MachineSets.
+	// The only supported value is "RollingUpdate".
+	StrategyAnnotation = "machine.openshift.io/rollout-strategy"
+
+	// MaxSurgeAnnotation sets how many Machines may be created above the replicas of the MachineSet during a rollout.
+	// The value is a number, eg "2", or a percentage of the replicas, eg "25%", rounded up.
+	MaxSurgeAnnotation = "machine.openshift.io/rollout-max-surge"
+
+	// MaxUnavailableAnnotation sets how many of the replicas of the MachineSet may be unavailable during a rollout.
+	// The value is a number, eg "1", or a percentage of the replicas, eg "25%", rounded down.
+	MaxUnavailableAnnotation = "machine.openshift.io/rollout-max-unavailable"
+
+	// RevisionHistoryLimitAnnotation sets how many MachineSets of previous revisions are kept, scaled down,
+	// so that the rollout can be rolled back to them.
+	RevisionHistoryLimitAnnotation = "machine.openshift.io/revision-history-limit"
+
+	// RollbackToRevisionAnnotation requests that the template of the MachineSet is rolled back to the template
+	// of the given revision, eg "3". "0" rolls back to the previous revision.
+	// It is removed by the MachineSet controller once the template has been rolled back.
+	RollbackToRevisionAnnotation = "machine.openshift.io/rollback-to-revision"
+
+	// RevisionAnnotation holds the revision of the template of the MachineSets owned by a rolling update MachineSet,
+	// and the current revision on the rolling update MachineSet itself.
+	// It is maintained by the MachineSet controller and should not be set by users.
+	RevisionAnnotation = "machine.openshift.io/revision"
+
+	// TemplateHashLabel is set on the MachineSets owned by a rolling update MachineSet, and on every Machine created
+	// by a MachineSet, to the hash of the template they were created from. It keeps the selectors of the MachineSets
+	// of the revisions apart, and tells the Machines created from a previous template apart.
+	TemplateHashLabel = "machine.openshift.io/template-hash"
+
+	// DefaultRevisionHistoryLimit is the number of MachineSets of previous revisions kept when no limit is set.
+	DefaultRevisionHistoryLimit = 10
+)
+
+// Policy describes how the template of a MachineSet is rolled out.
+type Policy struct {
+	// MaxSurge is the number, or percentage, of Machines which may be created above the replicas of the MachineSet.
+	MaxSurge intstr.IntOrString
+
+	// MaxUnavailable is the number, or percentage, of the replicas of the MachineSet which may be unavailable.
+	MaxUnavailable intstr.IntOrString
+
+	// RevisionHistoryLimit is the number of MachineSets of previous revisions which are kept.
+	RevisionHistoryLimit int
+}
+
+// DefaultPolicy returns the rollout Policy used when no annotations are set.
+// By default, a single Machine is created above the replicas at a time, and no capacity is lost.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxSurge:             intstr.FromInt(1),
+		MaxUnavailable:       intstr.FromInt(0),
+		RevisionHistoryLimit: DefaultRevisionHistoryLimit,
+	}
+}
+
+// IsRollingUpdate returns whether the given annotations opt a MachineSet in to rolling updates.
+func IsRollingUpdate(annotations map[string]string) bool {
+	return annotations[StrategyAnnotation] == string(machinev1.RollingUpdateMachineDeploymentStrategyType)
+}
+
+// Parse builds the rollout Policy described by the given annotations.
+func Parse(annotations map[string]string, fldPath *field.Path) (*Policy, field.ErrorList) {
+	var errs field.ErrorList
+	policy := DefaultPolicy()
+
+	if value, ok := annotations[StrategyAnnotation]; ok && !IsRollingUpdate(annotations) {
+		errs = append(errs, field.NotSupported(fldPath.Key(StrategyAnnotation), value, []string{string(machinev1.RollingUpdateMachineDeploymentStrategyType)}))
+	}
+
+	if value, ok := annotations[MaxSurgeAnnotation]; ok {
+		maxSurge, err := parseIntOrPercent(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(MaxSurgeAnnotation), value, err.Error()))
+		} else {
+			policy.MaxSurge = maxSurge
+		}
+	}
+
+	if value, ok := annotations[MaxUnavailableAnnotation]; ok {
+		maxUnavailable, err := parseIntOrPercent(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(MaxUnavailableAnnotation), value, err.Error()))
+		} else {
+			policy.MaxUnavailable = maxUnavailable
+		}
+	}
+
+	if isZero(policy.MaxSurge) && isZero(policy.MaxUnavailable) {
+		errs = append(errs, field.Invalid(fldPath.Key(MaxUnavailableAnnotation), policy.MaxUnavailable.String(), "may not be zero when the max surge is zero"))
+	}
+
+	if value, ok := annotations[RevisionHistoryLimitAnnotation]; ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			errs = append(errs, field.Invalid(fldPath.Key(RevisionHistoryLimitAnnotation), value, "must be an integer greater than or equal to zero"))
+		} else {
+			policy.RevisionHistoryLimit = limit
+		}
+	}
+
+	if value, ok := annotations[RollbackToRevisionAnnotation]; ok {
+		if _, err := ParseRevision(value); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(RollbackToRevisionAnnotation), value, err.Error()))
+		}
+	}
+
+	return policy, errs
+}
+
+// Resolve returns the number of Machines which may be created above the given replicas,
+// and the number of replicas which may be unavailable.
+func (p *Policy) Resolve(replicas int) (maxSurge, maxUnavailable int) {
+	// The values have been validated by Parse.
+	maxSurge, _ = intstr.GetScaledValueFromIntOrPercent(&p.MaxSurge, replicas, true)
+	maxUnavailable, _ = intstr.GetScaledValueFromIntOrPercent(&p.MaxUnavailable, replicas, false)
+
+	// A percentage may round both values down to zero, which would not let the rollout progress.
+	if maxSurge == 0 && maxUnavailable == 0 {
+		maxUnavailable = 1
+	}
+	return maxSurge, maxUnavailable
+}
+
+// ParseRevision parses a revision, as set in the revision and rollback annotations.
+func ParseRevision(value string) (int64, error) {
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("must be an integer greater than or equal to zero")
+	}
+	return revision, nil
+}
+
+// parseIntOrPercent parses a number, eg "2", or a percentage, eg "25%".
+func parseIntOrPercent(value string) (intstr.IntOrString, error) {
+	parsed := intstr.Parse(value)
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&parsed, 100, true)
+	if err != nil || scaled < 0 || (parsed.Type == intstr.String && scaled > 100) {
+		return intstr.IntOrString{}, fmt.Errorf("must be an integer or a percentage, eg \"25%%\", greater than or equal to zero")
+	}
+	return parsed, nil
+}
+
+// isZero returns whether the number or percentage is zero.
+func isZero(value intstr.IntOrString) bool {
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&value, 100, true)
+	return err == nil && scaled == 0
+}
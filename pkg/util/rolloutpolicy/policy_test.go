@@ -0,0 +1,128 @@
+package rolloutpolicy
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedPolicy func() *Policy
+		expectedErrors []string
+	}{
+		{
+			name:           "with no annotations",
+			expectedPolicy: DefaultPolicy,
+		},
+		{
+			name: "with every annotation set",
+			annotations: map[string]string{
+				StrategyAnnotation:             "RollingUpdate",
+				MaxSurgeAnnotation:             "25%",
+				MaxUnavailableAnnotation:       "2",
+				RevisionHistoryLimitAnnotation: "3",
+				RollbackToRevisionAnnotation:   "0",
+			},
+			expectedPolicy: func() *Policy {
+				return &Policy{
+					MaxSurge:             intstr.FromString("25%"),
+					MaxUnavailable:       intstr.FromInt(2),
+					RevisionHistoryLimit: 3,
+				}
+			},
+		},
+		{
+			name: "with invalid annotations",
+			annotations: map[string]string{
+				StrategyAnnotation:             "Recreate",
+				MaxSurgeAnnotation:             "lots",
+				MaxUnavailableAnnotation:       "150%",
+				RevisionHistoryLimitAnnotation: "-1",
+				RollbackToRevisionAnnotation:   "previous",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/rollout-strategy]: Unsupported value: \"Recreate\": supported values: \"RollingUpdate\"",
+				"metadata.annotations[machine.openshift.io/rollout-max-surge]: Invalid value: \"lots\": must be an integer or a percentage, eg \"25%\", greater than or equal to zero",
+				"metadata.annotations[machine.openshift.io/rollout-max-unavailable]: Invalid value: \"150%\": must be an integer or a percentage, eg \"25%\", greater than or equal to zero",
+				"metadata.annotations[machine.openshift.io/revision-history-limit]: Invalid value: \"-1\": must be an integer greater than or equal to zero",
+				"metadata.annotations[machine.openshift.io/rollback-to-revision]: Invalid value: \"previous\": must be an integer greater than or equal to zero",
+			},
+		},
+		{
+			name: "with a zero max surge and max unavailable",
+			annotations: map[string]string{
+				MaxSurgeAnnotation:       "0%",
+				MaxUnavailableAnnotation: "0",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/rollout-max-unavailable]: Invalid value: \"0\": may not be zero when the max surge is zero",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			policy, errs := Parse(tc.annotations, field.NewPath("metadata", "annotations"))
+			if len(tc.expectedErrors) > 0 {
+				var errStrings []string
+				for _, err := range errs {
+					errStrings = append(errStrings, err.Error())
+				}
+				for _, expected := range tc.expectedErrors {
+					g.Expect(errStrings).To(ContainElement(expected))
+				}
+				return
+			}
+
+			g.Expect(errs).To(BeEmpty())
+			g.Expect(policy).To(Equal(tc.expectedPolicy()))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		policy                 *Policy
+		replicas               int
+		expectedMaxSurge       int
+		expectedMaxUnavailable int
+	}{
+		{
+			name:             "with the default policy",
+			policy:           DefaultPolicy(),
+			replicas:         10,
+			expectedMaxSurge: 1,
+		},
+		{
+			name:                   "with percentages",
+			policy:                 &Policy{MaxSurge: intstr.FromString("25%"), MaxUnavailable: intstr.FromString("25%")},
+			replicas:               10,
+			expectedMaxSurge:       3,
+			expectedMaxUnavailable: 2,
+		},
+		{
+			name:                   "when the percentages round down to zero",
+			policy:                 &Policy{MaxSurge: intstr.FromInt(0), MaxUnavailable: intstr.FromString("10%")},
+			replicas:               5,
+			expectedMaxUnavailable: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			maxSurge, maxUnavailable := tc.policy.Resolve(tc.replicas)
+			g.Expect(maxSurge).To(Equal(tc.expectedMaxSurge))
+			g.Expect(maxUnavailable).To(Equal(tc.expectedMaxUnavailable))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package scalingpolicy implements parsing and validation of the annotations
+// used to limit how fast a MachineSet creates and deletes its Machines.
+//
+// The annotations are set on the MachineSet itself. Without them, a MachineSet creates
+// and deletes all of the Machines it needs to reach its replicas at once.
+package scalingpolicy
+
+import (
+	"encoding/json"
+	"strconv"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// CreateBatchSizeAnnotation limits how many Machines a MachineSet creates each time it is reconciled, eg "10".
+	CreateBatchSizeAnnotation = "machine.openshift.io/create-batch-size"
+
+	// CreateMaxInFlightAnnotation limits how many Machines of a MachineSet may be provisioning at the same time, eg "20".
+	// A Machine is provisioning from its creation until it has a Node, unless it has Failed.
+	CreateMaxInFlightAnnotation = "machine.openshift.io/create-max-in-flight"
+
+	// DeleteBatchSizeAnnotation limits how many Machines a MachineSet deletes each time it is reconciled, eg "10".
+	DeleteBatchSizeAnnotation = "machine.openshift.io/delete-batch-size"
+
+	// DeleteMaxInFlightAnnotation limits how many Machines of a MachineSet may be deleting at the same time, eg "5".
+	// A Machine is deleting from its deletion until its finalizer is removed, which includes the drain of its Node.
+	DeleteMaxInFlightAnnotation = "machine.openshift.io/delete-max-in-flight"
+
+	// ScalingProgressAnnotation holds the ScalingProgress of a MachineSet, serialised as JSON.
+	// It is maintained by the MachineSet controller and removed once the MachineSet has reached its replicas.
+	ScalingProgressAnnotation = "machine.openshift.io/scaling-progress"
+)
+
+// Limits bounds how many Machines are created, or deleted, at once. Zero means no limit.
+type Limits struct {
+	// BatchSize is the number of Machines created, or deleted, each time the MachineSet is reconciled.
+	BatchSize int
+
+	// MaxInFlight is the number of Machines which may be provisioning, or deleting, at the same time.
+	MaxInFlight int
+}
+
+// Policy describes how fast a MachineSet creates and deletes its Machines.
+type Policy struct {
+	// Create limits the creation of Machines when the MachineSet is scaled up.
+	Create Limits
+
+	// Delete limits the deletion of Machines when the MachineSet is scaled down.
+	Delete Limits
+}
+
+// DefaultPolicy returns the scaling Policy used when no annotations are set, which does not limit anything.
+func DefaultPolicy() *Policy {
+	return &Policy{}
+}
+
+// Parse builds the scaling Policy described by the given annotations.
+func Parse(annotations map[string]string, fldPath *field.Path) (*Policy, field.ErrorList) {
+	var errs field.ErrorList
+	policy := DefaultPolicy()
+
+	for _, l := range []struct {
+		annotation string
+		limit      *int
+	}{
+		{annotation: CreateBatchSizeAnnotation, limit: &policy.Create.BatchSize},
+		{annotation: CreateMaxInFlightAnnotation, limit: &policy.Create.MaxInFlight},
+		{annotation: DeleteBatchSizeAnnotation, limit: &policy.Delete.BatchSize},
+		{annotation: DeleteMaxInFlightAnnotation, limit: &policy.Delete.MaxInFlight},
+	} {
+		value, ok := annotations[l.annotation]
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, field.Invalid(fldPath.Key(l.annotation), value, "must be a positive integer"))
+			continue
+		}
+		*l.limit = parsed
+	}
+
+	return policy, errs
+}
+
+// Allowed returns how many of the pending Machines may be created, or deleted, now,
+// given the number of Machines already in flight.
+func (l Limits) Allowed(pending, inFlight int) int {
+	allowed := pending
+	if l.BatchSize > 0 && allowed > l.BatchSize {
+		allowed = l.BatchSize
+	}
+	if l.MaxInFlight > 0 && allowed > l.MaxInFlight-inFlight {
+		allowed = l.MaxInFlight - inFlight
+	}
+	if allowed < 0 {
+		return 0
+	}
+	return allowed
+}
+
+// ScalingProgress reports how far a MachineSet has got in reaching its replicas.
+type ScalingProgress struct {
+	// Creating is the number of Machines of the MachineSet which are provisioning.
+	Creating int32 `json:"creating"`
+
+	// Deleting is the number of Machines of the MachineSet which are deleting.
+	Deleting int32 `json:"deleting"`
+
+	// PendingCreates is the number of Machines which are still to be created, because of the scaling policy.
+	PendingCreates int32 `json:"pendingCreates"`
+
+	// PendingDeletes is the number of Machines which are still to be deleted, because of the scaling policy.
+	PendingDeletes int32 `json:"pendingDeletes"`
+}
+
+// IsZero returns whether the MachineSet has no Machines in flight and none pending.
+func (p ScalingProgress) IsZero() bool {
+	return p == ScalingProgress{}
+}
+
+// GetScalingProgress returns the ScalingProgress recorded on the MachineSet, if any.
+func GetScalingProgress(ms *machinev1.MachineSet) (*ScalingProgress, bool) {
+	value, ok := ms.GetAnnotations()[ScalingProgressAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	progress := &ScalingProgress{}
+	if err := json.Unmarshal([]byte(value), progress); err != nil {
+		return nil, false
+	}
+	return progress, true
+}
@@ -0,0 +1,115 @@
+package scalingpolicy
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedPolicy *Policy
+		expectedErrors []string
+	}{
+		{
+			name:           "with no annotations",
+			expectedPolicy: DefaultPolicy(),
+		},
+		{
+			name: "with every annotation set",
+			annotations: map[string]string{
+				CreateBatchSizeAnnotation:   "10",
+				CreateMaxInFlightAnnotation: "20",
+				DeleteBatchSizeAnnotation:   "5",
+				DeleteMaxInFlightAnnotation: "2",
+			},
+			expectedPolicy: &Policy{
+				Create: Limits{BatchSize: 10, MaxInFlight: 20},
+				Delete: Limits{BatchSize: 5, MaxInFlight: 2},
+			},
+		},
+		{
+			name: "with invalid annotations",
+			annotations: map[string]string{
+				CreateBatchSizeAnnotation:   "0",
+				DeleteMaxInFlightAnnotation: "many",
+			},
+			expectedErrors: []string{
+				"metadata.annotations[machine.openshift.io/create-batch-size]: Invalid value: \"0\": must be a positive integer",
+				"metadata.annotations[machine.openshift.io/delete-max-in-flight]: Invalid value: \"many\": must be a positive integer",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			policy, errs := Parse(tc.annotations, field.NewPath("metadata", "annotations"))
+			if len(tc.expectedErrors) > 0 {
+				var errStrings []string
+				for _, err := range errs {
+					errStrings = append(errStrings, err.Error())
+				}
+				g.Expect(errStrings).To(Equal(tc.expectedErrors))
+				return
+			}
+
+			g.Expect(errs).To(BeEmpty())
+			g.Expect(policy).To(Equal(tc.expectedPolicy))
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		limits   Limits
+		pending  int
+		inFlight int
+		expected int
+	}{
+		{
+			name:     "without limits",
+			pending:  200,
+			inFlight: 50,
+			expected: 200,
+		},
+		{
+			name:     "with a batch size",
+			limits:   Limits{BatchSize: 10},
+			pending:  200,
+			expected: 10,
+		},
+		{
+			name:     "with room for fewer machines in flight than the batch size",
+			limits:   Limits{BatchSize: 10, MaxInFlight: 20},
+			pending:  200,
+			inFlight: 15,
+			expected: 5,
+		},
+		{
+			name:     "with more machines in flight than the limit",
+			limits:   Limits{MaxInFlight: 20},
+			pending:  200,
+			inFlight: 25,
+			expected: 0,
+		},
+		{
+			name:     "with fewer pending machines than the limits",
+			limits:   Limits{BatchSize: 10, MaxInFlight: 20},
+			pending:  3,
+			expected: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tc.limits.Allowed(tc.pending, tc.inFlight)).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package tracing sets up the optional OpenTelemetry tracing of the machine-api controllers,
+// and stores the trace context of the Machines so that all their reconciles can be correlated.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/openshift/machine-api-operator/pkg/version"
+)
+
+// TraceContextAnnotation holds the W3C trace context of the first traced reconcile of an object.
+// Each later reconcile of the object is recorded in a trace of its own, linked to this context,
+// so that the reconciles can be correlated without growing a single trace for the lifetime of the object.
+const TraceContextAnnotation = "machine.openshift.io/trace-context"
+
+const (
+	instrumentationName = "github.com/openshift/machine-api-operator"
+
+	// traceParentKey is the key of the W3C trace context in a propagation carrier.
+	traceParentKey = "traceparent"
+)
+
+// Attributes set on the spans of the machine-api controllers.
+const (
+	MachineNameKey      = attribute.Key("machine.name")
+	MachineNamespaceKey = attribute.Key("machine.namespace")
+	MachinePhaseKey     = attribute.Key("machine.phase")
+)
+
+// Options configures the export of the traces.
+type Options struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector the traces are exported to.
+	// Tracing is disabled when it is empty.
+	Endpoint string
+
+	// Insecure disables TLS when exporting the traces.
+	Insecure bool
+
+	// SamplingRatio is the ratio of the traces which are recorded, between 0 and 1.
+	// The traces linked to a stored trace context follow the sampling decision of that context.
+	SamplingRatio float64
+}
+
+// Setup configures the global tracer provider of the process to export its traces to the collector set in the options.
+// The returned function flushes the pending spans and must be called before the process exits.
+// When no endpoint is set, tracing is left disabled and the spans of the controllers are not recorded.
+func Setup(ctx context.Context, serviceName string, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.SamplingRatio < 0 || opts.SamplingRatio > 1 {
+		return nil, fmt.Errorf("sampling ratio must be between 0 and 1, got %v", opts.SamplingRatio)
+	}
+
+	clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptrace.New(ctx, otlptracehttp.NewClient(clientOpts...))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(version.Raw),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(linkBasedSampler{root: sdktrace.TraceIDRatioBased(opts.SamplingRatio)})),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the machine-api controllers.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span for an operation on the object. When the context carries a span already, the span is its child.
+// Otherwise the span is the root of a new trace, linked to the trace context stored on the object, if any.
+// The object is nil for operations which are not about a single object.
+func Start(ctx context.Context, name string, obj metav1.Object, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{trace.WithAttributes(attrs...)}
+	if !trace.SpanContextFromContext(ctx).IsValid() && obj != nil {
+		if stored := storedSpanContext(ctx, obj); stored.IsValid() {
+			opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: stored}))
+		}
+	}
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// storedSpanContext returns the trace context stored on the object, which is invalid when it has none.
+func storedSpanContext(ctx context.Context, obj metav1.Object) trace.SpanContext {
+	traceParent, ok := obj.GetAnnotations()[TraceContextAnnotation]
+	if !ok {
+		return trace.SpanContext{}
+	}
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// linkBasedSampler samples the root spans linked to a sampled trace context, so that all the reconciles of an object
+// are recorded once its first reconcile was, and leaves the decision for the other root spans to the root sampler.
+type linkBasedSampler struct {
+	root sdktrace.Sampler
+}
+
+func (s linkBasedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, link := range p.Links {
+		if link.SpanContext.IsSampled() {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.RecordAndSample,
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return s.root.ShouldSample(p)
+}
+
+func (s linkBasedSampler) Description() string {
+	return fmt.Sprintf("LinkBased{%s}", s.root.Description())
+}
+
+// Inject stores the trace context of the current span on the object, unless the object has one already.
+// Only the trace contexts of sampled spans are stored, so that objects whose spans are not recorded
+// get a chance to be sampled on their next reconcile.
+// The annotations are copied before being modified, as they may be shared, for example with the template of a MachineSet.
+// It returns whether the annotations of the object were changed.
+func Inject(ctx context.Context, obj metav1.Object) bool {
+	if _, ok := obj.GetAnnotations()[TraceContextAnnotation]; ok {
+		return false
+	}
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return false
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	traceParent := carrier.Get(traceParentKey)
+	if traceParent == "" {
+		return false
+	}
+
+	annotations := make(map[string]string, len(obj.GetAnnotations())+1)
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[TraceContextAnnotation] = traceParent
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// MachineAttributes returns the attributes identifying the Machine and its phase.
+func MachineAttributes(m *machinev1.Machine) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MachineNameKey.String(m.GetName()),
+		MachineNamespaceKey.String(m.GetNamespace()),
+		MachinePhaseKey.String(pointer.StringDeref(m.Status.Phase, "")),
+	}
+}
+
+// RecordError records the error on the span and marks the span as failed. It is a no-op when err is nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// setTracerProvider records the spans of the test with the given sampler.
+func setTracerProvider(t *testing.T, sampler sdktrace.Sampler) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler), sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+	return recorder
+}
+
+func newMachine() *machinev1.Machine {
+	return &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "machine",
+			Namespace:   "default",
+			Annotations: map[string]string{"foo": "bar"},
+		},
+		Status: machinev1.MachineStatus{Phase: pointer.String("Running")},
+	}
+}
+
+func TestReconcilesLinkStoredTraceContext(t *testing.T) {
+	g := NewWithT(t)
+	recorder := setTracerProvider(t, sdktrace.AlwaysSample())
+
+	m := newMachine()
+	ctx, first := Start(context.Background(), "first", m, MachineAttributes(m)...)
+	g.Expect(Inject(ctx, m)).To(BeTrue())
+	g.Expect(m.Annotations).To(HaveKey(TraceContextAnnotation))
+	first.End()
+
+	g.Expect(Inject(ctx, m)).To(BeFalse(), "the stored trace context should not be replaced")
+
+	_, second := Start(context.Background(), "second", m)
+	second.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(2))
+	g.Expect(spans[1].Parent().IsValid()).To(BeFalse(), "each reconcile should start a new trace")
+	g.Expect(spans[1].SpanContext().TraceID()).ToNot(Equal(spans[0].SpanContext().TraceID()))
+	g.Expect(spans[1].Links()).To(HaveLen(1))
+	g.Expect(spans[1].Links()[0].SpanContext.SpanID()).To(Equal(spans[0].SpanContext().SpanID()))
+	g.Expect(spans[0].Attributes()).To(ContainElements(
+		MachineNameKey.String("machine"),
+		MachineNamespaceKey.String("default"),
+		MachinePhaseKey.String("Running"),
+	))
+}
+
+func TestLinkedReconcilesFollowStoredSamplingDecision(t *testing.T) {
+	g := NewWithT(t)
+	// The root sampler samples no new trace, only the reconciles linked to a sampled trace context are recorded.
+	recorder := setTracerProvider(t, sdktrace.ParentBased(linkBasedSampler{root: sdktrace.NeverSample()}))
+
+	sampled := newMachine()
+	sampled.Annotations[TraceContextAnnotation] = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	_, span := Start(context.Background(), "sampled", sampled)
+	span.End()
+
+	unsampled := newMachine()
+	unsampled.Annotations[TraceContextAnnotation] = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"
+	_, span = Start(context.Background(), "unsampled", unsampled)
+	span.End()
+
+	_, span = Start(context.Background(), "untraced", newMachine())
+	span.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(1))
+	g.Expect(spans[0].Name()).To(Equal("sampled"))
+}
+
+func TestStartKeepsCurrentSpan(t *testing.T) {
+	g := NewWithT(t)
+	recorder := setTracerProvider(t, sdktrace.AlwaysSample())
+
+	stored := newMachine()
+	storedCtx, storedSpan := Start(context.Background(), "stored", stored)
+	Inject(storedCtx, stored)
+	storedSpan.End()
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", stored)
+	child.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(3))
+	g.Expect(spans[1].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()),
+		"the span of the context should be preferred to the trace context stored on the object")
+}
+
+func TestInjectUnsampled(t *testing.T) {
+	g := NewWithT(t)
+	setTracerProvider(t, sdktrace.NeverSample())
+
+	m := newMachine()
+	ctx, span := Start(context.Background(), "unsampled", m)
+	defer span.End()
+	g.Expect(Inject(ctx, m)).To(BeFalse())
+	g.Expect(m.Annotations).ToNot(HaveKey(TraceContextAnnotation))
+
+	g.Expect(Inject(context.Background(), m)).To(BeFalse(), "nothing should be stored without a span")
+}
+
+func TestInjectCopiesAnnotations(t *testing.T) {
+	g := NewWithT(t)
+	setTracerProvider(t, sdktrace.AlwaysSample())
+
+	shared := map[string]string{"foo": "bar"}
+	m := newMachine()
+	m.Annotations = shared
+
+	ctx, span := Tracer().Start(context.Background(), "span")
+	defer span.End()
+	g.Expect(Inject(ctx, m)).To(BeTrue())
+	g.Expect(m.Annotations).To(HaveKeyWithValue("foo", "bar"))
+	g.Expect(shared).ToNot(HaveKey(TraceContextAnnotation))
+}
+
+func TestRecordError(t *testing.T) {
+	g := NewWithT(t)
+	recorder := setTracerProvider(t, sdktrace.AlwaysSample())
+
+	_, succeeded := Tracer().Start(context.Background(), "succeeded")
+	RecordError(succeeded, nil)
+	succeeded.End()
+
+	_, failed := Tracer().Start(context.Background(), "failed")
+	RecordError(failed, errors.New("boom"))
+	failed.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+	g.Expect(spans[1].Status().Code).To(Equal(codes.Error))
+	g.Expect(spans[1].Status().Description).To(Equal("boom"))
+	g.Expect(spans[1].Events()).To(HaveLen(1))
+}
+
+func TestSetup(t *testing.T) {
+	g := NewWithT(t)
+
+	previous := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), "test", Options{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(shutdown(context.Background())).To(Succeed())
+	g.Expect(otel.GetTracerProvider()).To(BeIdenticalTo(previous), "tracing should stay disabled without an endpoint")
+
+	_, err = Setup(context.Background(), "test", Options{Endpoint: "localhost:4318", SamplingRatio: 2})
+	g.Expect(err).To(MatchError("sampling ratio must be between 0 and 1, got 2"))
+}
@@ -14,7 +14,11 @@ import (
 	machinev1 "github.com/openshift/api/machine/v1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
 	osclientset "github.com/openshift/client-go/config/clientset/versioned"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+	"github.com/openshift/machine-api-operator/pkg/util/drainpolicy"
 	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -572,6 +576,11 @@ func (h *machineValidatorHandler) validateMachine(m, oldM *machinev1beta1.Machin
 	}
 
 	errs := validateMachineLifecycleHooks(m, oldM)
+	errs = append(errs, validateMachineDrainPolicy(m.GetAnnotations(), field.NewPath("metadata", "annotations"))...)
+	errs = append(errs, validateMachineRetryPolicy(m.GetAnnotations(), field.NewPath("metadata", "annotations"))...)
+	errs = append(errs, validateMachineDeletionMode(m, oldM)...)
+	errs = append(errs, validateMachineAdoption(m, oldM)...)
+	errs = append(errs, validateMachineReplacement(m)...)
 
 	ok, warnings, err := h.webhookOperations(m, h.admissionConfig)
 	if !ok {
@@ -1596,6 +1605,135 @@ func validateMachineLifecycleHooks(m, oldM *machinev1beta1.Machine) []error {
 		}
 	}
 
+	if oldM != nil {
+		annotationsPath := field.NewPath("metadata", "annotations")
+		phase := pointer.StringDeref(oldM.Status.Phase, "")
+
+		// Pre-create hooks can only hold the instance creation if they are set before the instance is created.
+		if phase != "" && phase != "Provisioning" {
+			oldPreCreate := lifecyclehooks.GetAnnotationHooks(oldM.GetAnnotations(), lifecyclehooks.PreCreateHookAnnotationPrefix)
+			preCreate := lifecyclehooks.GetAnnotationHooks(m.GetAnnotations(), lifecyclehooks.PreCreateHookAnnotationPrefix)
+			if changedPreCreate := lifecyclehooks.GetChangedLifecycleHooks(oldPreCreate, preCreate); len(changedPreCreate) > 0 {
+				errs = append(errs, field.Forbidden(annotationsPath, fmt.Sprintf("pre-create hooks are immutable once the instance has been created: the following hooks are new or changed: %+v", changedPreCreate)))
+			}
+		}
+
+		// Post-provision hooks can only hold the machine out of the Running phase if they are set before it is running.
+		if phase == "Running" {
+			oldPostProvision := lifecyclehooks.GetAnnotationHooks(oldM.GetAnnotations(), lifecyclehooks.PostProvisionHookAnnotationPrefix)
+			postProvision := lifecyclehooks.GetAnnotationHooks(m.GetAnnotations(), lifecyclehooks.PostProvisionHookAnnotationPrefix)
+			if changedPostProvision := lifecyclehooks.GetChangedLifecycleHooks(oldPostProvision, postProvision); len(changedPostProvision) > 0 {
+				errs = append(errs, field.Forbidden(annotationsPath, fmt.Sprintf("post-provision hooks are immutable once the machine is running: the following hooks are new or changed: %+v", changedPostProvision)))
+			}
+		}
+	}
+
+	errs = append(errs, validateAnnotationLifecycleHooks(m.GetAnnotations(), field.NewPath("metadata", "annotations"))...)
+	errs = append(errs, validateLifecycleHookTimeouts(m.GetAnnotations(), field.NewPath("metadata", "annotations"))...)
+
+	return errs
+}
+
+// validateAnnotationLifecycleHooks validates the pre-create and post-provision lifecycle hooks set through annotations.
+func validateAnnotationLifecycleHooks(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	for _, err := range lifecyclehooks.ValidateAnnotationHooks(annotations, fldPath) {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateLifecycleHookTimeouts validates the annotations used to configure how long lifecycle hooks may hold the deletion of a Machine.
+func validateLifecycleHookTimeouts(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	_, fieldErrs := lifecyclehooks.ParseTimeouts(annotations, fldPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateMachineDrainPolicy validates the annotations used to configure how the Node of a Machine is drained.
+func validateMachineDrainPolicy(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	_, fieldErrs := drainpolicy.Parse(annotations, fldPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateMachineRetryPolicy validates the annotations used to configure how a Failed Machine is retried.
+func validateMachineRetryPolicy(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	_, fieldErrs := retrypolicy.Parse(annotations, fldPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateMachineDeletionMode validates the annotation used to choose whether the instance of a Machine is deleted along with it.
+// The deletion mode can not be changed once the Machine is being deleted.
+func validateMachineDeletionMode(m, oldM *machinev1beta1.Machine) []error {
+	var errs []error
+	annotationsPath := field.NewPath("metadata", "annotations")
+
+	_, fieldErrs := deletionmode.Parse(m.GetAnnotations(), annotationsPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	if oldM != nil {
+		for _, err := range deletionmode.ValidateUpdate(m.GetAnnotations(), oldM.GetAnnotations(), !oldM.DeletionTimestamp.IsZero(), annotationsPath) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validateMachineAdoption validates Machines created to adopt an existing instance.
+// The instance is identified by the provider ID, and a Machine can only adopt an instance when it is created.
+func validateMachineAdoption(m, oldM *machinev1beta1.Machine) []error {
+	var errs []error
+
+	if !machines.IsAdoptingInstance(m) {
+		return errs
+	}
+
+	if oldM == nil && pointer.StringDeref(m.Spec.ProviderID, "") == "" {
+		errs = append(errs, field.Required(field.NewPath("spec", "providerID"), fmt.Sprintf("must be set to the provider ID of the instance to adopt when %s is set", machines.AdoptInstanceAnnotation)))
+	}
+
+	if oldM != nil && !machines.IsAdoptingInstance(oldM) {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(machines.AdoptInstanceAnnotation), "can only be set when the machine is created"))
+	}
+
+	return errs
+}
+
+// validateMachineReplacement validates the annotation used to request the replacement of a Machine.
+// Replacements are created by the MachineSet owning the Machine, so the annotation has no effect on other Machines.
+func validateMachineReplacement(m *machinev1beta1.Machine) []error {
+	var errs []error
+
+	if !machines.IsReplaceRequested(m) {
+		return errs
+	}
+
+	if owner := metav1.GetControllerOf(m); owner == nil || owner.Kind != "MachineSet" {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(machines.ReplaceAnnotation), "can only be set on machines owned by a machineset"))
+	}
+
 	return errs
 }
 
@@ -12,12 +12,15 @@ import (
 	osconfigv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kruntime "k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -1699,6 +1702,113 @@ func TestMachineUpdate(t *testing.T) {
 				m.Spec.LifecycleHooks = machinev1beta1.LifecycleHooks{}
 			},
 		},
+		{
+			name:         "when adding a drain timeout",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/drain-timeout": "30m"}
+			},
+		},
+		{
+			name:         "when adding an invalid drain timeout",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/drain-timeout": "forever"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/drain-timeout]: Invalid value: \"forever\": must be a valid duration, eg \"30m\": time: invalid duration \"forever\"",
+		},
+		{
+			name:         "when adding an invalid drain grace period",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/drain-grace-period-seconds": "-5"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/drain-grace-period-seconds]: Invalid value: \"-5\": must be greater than or equal to -1",
+		},
+		{
+			name:         "when adding a drain budget selector without a drain budget",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/drain-budget-selector": "pool=storage"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/drain-budget]: Required value: must be set when machine.openshift.io/drain-budget-selector is set",
+		},
+		{
+			name:         "when adding a lifecycle hook timeout without a duration",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/pre-drain-hook-timeouts": "MigrateData"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/pre-drain-hook-timeouts]: Invalid value: \"MigrateData\": \"MigrateData\" must be in the form <hook name>=<duration>, eg \"MigrateData=30m\"",
+		},
+		{
+			name:         "when adding an unknown lifecycle hook timeout policy",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/lifecycle-hook-timeout-policy": "Ignore"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/lifecycle-hook-timeout-policy]: Unsupported value: \"Ignore\": supported values: \"Remove\", \"Fail\"",
+		},
+		{
+			name:         "when adding an invalid failed retry limit",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/failed-retry-limit": "0"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/failed-retry-limit]: Invalid value: \"0\": must be greater than zero",
+		},
+		{
+			name:         "when adding an unknown deletion mode",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"machine.openshift.io/deletion-mode": "Keep"}
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/deletion-mode]: Unsupported value: \"Keep\": supported values: \"Delete\", \"Orphan\"",
+		},
+		{
+			name:         "when adding a pre-create hook without an owner",
+			platformType: osconfigv1.AWSPlatformType,
+			clusterID:    awsClusterID,
+			baseProviderSpecValue: &kruntime.RawExtension{
+				Object: defaultAWSProviderSpec.DeepCopy(),
+			},
+			updateMachine: func(m *machinev1beta1.Machine) {
+				m.Annotations = map[string]string{"pre-create.hook.machine.openshift.io/ipam-reservation": ""}
+			},
+			expectedError: "metadata.annotations[pre-create.hook.machine.openshift.io/ipam-reservation]: Required value: must be set to the owner of the lifecycle hook",
+		},
 		{
 			name:         "when duplicating a lifecycle hook",
 			platformType: osconfigv1.AWSPlatformType,
@@ -4555,3 +4665,174 @@ func TestValidateNutanixProviderSpec(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateMachineDeletionMode(t *testing.T) {
+	now := metav1.Now()
+	machine := func(mode string, deleting bool) *machinev1beta1.Machine {
+		m := &machinev1beta1.Machine{}
+		if mode != "" {
+			m.Annotations = map[string]string{deletionmode.DeletionModeAnnotation: mode}
+		}
+		if deleting {
+			m.DeletionTimestamp = &now
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name          string
+		machine       *machinev1beta1.Machine
+		oldMachine    *machinev1beta1.Machine
+		expectedError string
+	}{
+		{
+			name:    "when creating a machine with the orphan mode",
+			machine: machine("Orphan", false),
+		},
+		{
+			name:       "when setting the orphan mode before deleting the machine",
+			machine:    machine("Orphan", false),
+			oldMachine: machine("", false),
+		},
+		{
+			name:          "when setting the orphan mode once the machine is being deleted",
+			machine:       machine("Orphan", true),
+			oldMachine:    machine("", true),
+			expectedError: "metadata.annotations[machine.openshift.io/deletion-mode]: Forbidden: can not be changed once the machine is being deleted, it was \"\"",
+		},
+		{
+			name:          "when removing the orphan mode once the machine is being deleted",
+			machine:       machine("", true),
+			oldMachine:    machine("Orphan", true),
+			expectedError: "metadata.annotations[machine.openshift.io/deletion-mode]: Forbidden: can not be changed once the machine is being deleted, it was \"Orphan\"",
+		},
+		{
+			name:          "when setting an unknown mode",
+			machine:       machine("Keep", false),
+			expectedError: "metadata.annotations[machine.openshift.io/deletion-mode]: Unsupported value: \"Keep\": supported values: \"Delete\", \"Orphan\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineDeletionMode(tc.machine, tc.oldMachine)
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestValidateMachineAdoption(t *testing.T) {
+	machine := func(adopting bool, providerID string) *machinev1beta1.Machine {
+		m := &machinev1beta1.Machine{}
+		if adopting {
+			m.Annotations = map[string]string{machines.AdoptInstanceAnnotation: ""}
+		}
+		if providerID != "" {
+			m.Spec.ProviderID = pointer.String(providerID)
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name          string
+		machine       *machinev1beta1.Machine
+		oldMachine    *machinev1beta1.Machine
+		expectedError string
+	}{
+		{
+			name:    "when creating a machine to adopt an instance",
+			machine: machine(true, "vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"),
+		},
+		{
+			name:          "when creating a machine to adopt an instance without a provider ID",
+			machine:       machine(true, ""),
+			expectedError: "spec.providerID: Required value: must be set to the provider ID of the instance to adopt when machine.openshift.io/adopt-instance is set",
+		},
+		{
+			name:       "when updating a machine which adopted an instance",
+			machine:    machine(true, "vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"),
+			oldMachine: machine(true, "vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"),
+		},
+		{
+			name:          "when adopting an instance with an existing machine",
+			machine:       machine(true, "vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"),
+			oldMachine:    machine(false, "vsphere://422e4c5b-3b3e-4d4b-9d0b-0b4c1b0b2c3d"),
+			expectedError: "metadata.annotations[machine.openshift.io/adopt-instance]: Forbidden: can only be set when the machine is created",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineAdoption(tc.machine, tc.oldMachine)
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestValidateMachineReplacement(t *testing.T) {
+	machine := func(replace bool, ownerKind string) *machinev1beta1.Machine {
+		m := &machinev1beta1.Machine{}
+		if replace {
+			m.Annotations = map[string]string{machines.ReplaceAnnotation: "faulty disk"}
+		}
+		if ownerKind != "" {
+			m.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: machinev1beta1.SchemeGroupVersion.String(),
+				Kind:       ownerKind,
+				Name:       "owner",
+				Controller: pointer.Bool(true),
+			}}
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name          string
+		machine       *machinev1beta1.Machine
+		expectedError string
+	}{
+		{
+			name:    "when not requesting a replacement",
+			machine: machine(false, ""),
+		},
+		{
+			name:    "when requesting the replacement of a machine owned by a machineset",
+			machine: machine(true, "MachineSet"),
+		},
+		{
+			name:          "when requesting the replacement of a machine without owner",
+			machine:       machine(true, ""),
+			expectedError: "metadata.annotations[machine.openshift.io/replace]: Forbidden: can only be set on machines owned by a machineset",
+		},
+		{
+			name:          "when requesting the replacement of a machine owned by a control plane machine set",
+			machine:       machine(true, "ControlPlaneMachineSet"),
+			expectedError: "metadata.annotations[machine.openshift.io/replace]: Forbidden: can only be set on machines owned by a machineset",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineReplacement(tc.machine)
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
@@ -9,6 +9,11 @@ import (
 
 	osconfigv1 "github.com/openshift/api/config/v1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/deletionmode"
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -182,5 +187,68 @@ func validateMachineSetSpec(ms, oldMS *machinev1beta1.MachineSet) []error {
 		errs = append(errs, field.Invalid(field.NewPath("spec", "template", "metadata", "labels"), ms.Spec.Template.Labels, "`selector` does not match template `labels`"))
 	}
 
+	errs = append(errs, validateMachineDrainPolicy(ms.Spec.Template.Annotations, field.NewPath("spec", "template", "metadata", "annotations"))...)
+	errs = append(errs, validateMachineRetryPolicy(ms.Spec.Template.Annotations, field.NewPath("spec", "template", "metadata", "annotations"))...)
+	if _, ok := ms.Spec.Template.Annotations[retrypolicy.FailedRetryAttemptsAnnotation]; ok {
+		// The attempts are counted by the machine controller for each Machine, new Machines start with none.
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "template", "metadata", "annotations").Key(retrypolicy.FailedRetryAttemptsAnnotation), "the retry attempts are recorded by the machine controller"))
+	}
+	if _, ok := ms.Spec.Template.Annotations[deletionmode.DeletionModeAnnotation]; ok {
+		// Orphaning every Machine removed by a scale down would leak instances, so the deletion mode is only set on individual Machines.
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "template", "metadata", "annotations").Key(deletionmode.DeletionModeAnnotation), "the deletion mode can only be set on individual machines"))
+	}
+	if _, ok := ms.Spec.Template.Annotations[machines.AdoptInstanceAnnotation]; ok {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "template", "metadata", "annotations").Key(machines.AdoptInstanceAnnotation), "instances can only be adopted by individual machines"))
+	}
+	if _, ok := ms.Spec.Template.Annotations[machines.MaintenanceAnnotation]; ok {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "template", "metadata", "annotations").Key(machines.MaintenanceAnnotation), "maintenance can only be requested for individual machines"))
+	}
+	for _, annotation := range []string{machines.ReplaceAnnotation, machines.ReplacedByAnnotation, machines.ReplacementForAnnotation, machines.ReplacementFailedAnnotation} {
+		if _, ok := ms.Spec.Template.Annotations[annotation]; ok {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "template", "metadata", "annotations").Key(annotation), "replacements can only be requested for individual machines"))
+		}
+	}
+	errs = append(errs, validateAnnotationLifecycleHooks(ms.Spec.Template.Annotations, field.NewPath("spec", "template", "metadata", "annotations"))...)
+	errs = append(errs, validateLifecycleHookTimeouts(ms.Spec.Template.Annotations, field.NewPath("spec", "template", "metadata", "annotations"))...)
+	errs = append(errs, validateMachineSetRolloutPolicy(ms.Annotations, field.NewPath("metadata", "annotations"))...)
+	errs = append(errs, validateMachineSetScalingPolicy(ms.Annotations, field.NewPath("metadata", "annotations"))...)
+	errs = append(errs, validateMachineSetDeletePolicy(ms.Annotations, field.NewPath("metadata", "annotations"))...)
+
+	return errs
+}
+
+// validateMachineSetRolloutPolicy validates the annotations used to configure how the template of a MachineSet is rolled out.
+func validateMachineSetRolloutPolicy(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	_, fieldErrs := rolloutpolicy.Parse(annotations, fldPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateMachineSetScalingPolicy validates the annotations used to limit how fast a MachineSet creates and deletes its Machines.
+func validateMachineSetScalingPolicy(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	_, fieldErrs := scalingpolicy.Parse(annotations, fldPath)
+	for _, err := range fieldErrs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateMachineSetDeletePolicy validates the annotation used to select the delete policy of a MachineSet
+// among the policies which cannot be set in its spec.
+func validateMachineSetDeletePolicy(annotations map[string]string, fldPath *field.Path) []error {
+	var errs []error
+
+	for _, err := range machines.ValidateDeletePolicyAnnotation(annotations, fldPath) {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
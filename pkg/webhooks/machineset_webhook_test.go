@@ -15,12 +15,19 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/rest"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/openshift/machine-api-operator/pkg/util/machines"
+	"github.com/openshift/machine-api-operator/pkg/util/retrypolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/rolloutpolicy"
+	"github.com/openshift/machine-api-operator/pkg/util/scalingpolicy"
 )
 
 func TestMachineSetCreation(t *testing.T) {
@@ -1251,3 +1258,198 @@ func TestMachineSetUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateMachineSetRolloutPolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedError string
+	}{
+		{
+			name: "without a rollout policy",
+		},
+		{
+			name: "with a valid rollout policy",
+			annotations: map[string]string{
+				rolloutpolicy.StrategyAnnotation:       "RollingUpdate",
+				rolloutpolicy.MaxSurgeAnnotation:       "25%",
+				rolloutpolicy.MaxUnavailableAnnotation: "1",
+			},
+		},
+		{
+			name: "with an invalid max surge",
+			annotations: map[string]string{
+				rolloutpolicy.StrategyAnnotation: "RollingUpdate",
+				rolloutpolicy.MaxSurgeAnnotation: "-1",
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/rollout-max-surge]: Invalid value: \"-1\": must be an integer or a percentage, eg \"25%\", greater than or equal to zero",
+		},
+		{
+			name: "with an invalid revision to roll back to",
+			annotations: map[string]string{
+				rolloutpolicy.StrategyAnnotation:           "RollingUpdate",
+				rolloutpolicy.RollbackToRevisionAnnotation: "previous",
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/rollback-to-revision]: Invalid value: \"previous\": must be an integer greater than or equal to zero",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineSetRolloutPolicy(tc.annotations, field.NewPath("metadata", "annotations"))
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestValidateMachineSetScalingPolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedError string
+	}{
+		{
+			name: "without a scaling policy",
+		},
+		{
+			name: "with a valid scaling policy",
+			annotations: map[string]string{
+				scalingpolicy.CreateBatchSizeAnnotation:   "10",
+				scalingpolicy.DeleteMaxInFlightAnnotation: "2",
+			},
+		},
+		{
+			name: "with an invalid batch size",
+			annotations: map[string]string{
+				scalingpolicy.DeleteBatchSizeAnnotation: "0",
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/delete-batch-size]: Invalid value: \"0\": must be a positive integer",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineSetScalingPolicy(tc.annotations, field.NewPath("metadata", "annotations"))
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestValidateMachineSetDeletePolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedError string
+	}{
+		{
+			name: "without a delete policy",
+		},
+		{
+			name: "with the least utilized delete policy",
+			annotations: map[string]string{
+				machines.DeletePolicyAnnotation: "LeastUtilized",
+			},
+		},
+		{
+			name: "with the unhealthy first delete policy",
+			annotations: map[string]string{
+				machines.DeletePolicyAnnotation: "UnhealthyFirst",
+			},
+		},
+		{
+			name: "with the zone balanced delete policy",
+			annotations: map[string]string{
+				machines.DeletePolicyAnnotation: "ZoneBalanced",
+			},
+		},
+		{
+			name: "with an unsupported delete policy",
+			annotations: map[string]string{
+				machines.DeletePolicyAnnotation: "Oldest",
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/delete-policy]: Unsupported value: \"Oldest\": supported values: \"LeastUtilized\", \"UnhealthyFirst\", \"ZoneBalanced\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateMachineSetDeletePolicy(tc.annotations, field.NewPath("metadata", "annotations"))
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestValidateMachineSetTemplateAnnotations(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedError string
+	}{
+		{
+			name: "with a retry policy",
+			annotations: map[string]string{
+				retrypolicy.FailedRetryLimitAnnotation:   "3",
+				retrypolicy.FailedRetryBackoffAnnotation: "5m",
+			},
+		},
+		{
+			name: "with retry attempts",
+			annotations: map[string]string{
+				retrypolicy.FailedRetryLimitAnnotation:    "3",
+				retrypolicy.FailedRetryAttemptsAnnotation: "3",
+			},
+			expectedError: "spec.template.metadata.annotations[machine.openshift.io/failed-retry-attempts]: Forbidden: the retry attempts are recorded by the machine controller",
+		},
+		{
+			name: "with a replacement",
+			annotations: map[string]string{
+				machines.ReplacedByAnnotation: "replacement",
+			},
+			expectedError: "spec.template.metadata.annotations[machine.openshift.io/replaced-by]: Forbidden: replacements can only be requested for individual machines",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			labels := map[string]string{"machineset-name": "machineset"}
+			ms := &machinev1beta1.MachineSet{
+				Spec: machinev1beta1.MachineSetSpec{
+					Selector: metav1.LabelSelector{MatchLabels: labels},
+					Template: machinev1beta1.MachineTemplateSpec{
+						ObjectMeta: machinev1beta1.ObjectMeta{
+							Labels:      labels,
+							Annotations: tc.annotations,
+						},
+					},
+				},
+			}
+
+			errs := validateMachineSetSpec(ms, nil)
+			if tc.expectedError == "" {
+				g.Expect(errs).To(BeEmpty())
+			} else {
+				g.Expect(utilerrors.NewAggregate(errs)).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}